@@ -0,0 +1,115 @@
+// clamd-stub answers the parts of the ClamAV daemon protocol the API uses,
+// for development without a real scanner. It reports the EICAR test file as
+// infected and everything else as clean.
+//
+//	go run ./cmd/clamd-stub -addr localhost:3310
+//	SCANNER=clamd CLAMD_ADDRESS=localhost:3310 go run ./cmd/server
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"io"
+	"log"
+	"net"
+	"strings"
+)
+
+const eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// Like clamd's StreamMaxLength
+const maxStreamBytes = 25 << 20
+
+func main() {
+	addr := flag.String("addr", "localhost:3310", "address to listen on")
+	flag.Parse()
+
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("clamd stub listening on %s", *addr)
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			log.Fatal(err)
+		}
+		go serve(conn)
+	}
+}
+
+func serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	// Commands are prefixed with z (NUL-terminated) or n (newline-terminated)
+	prefix, err := r.ReadByte()
+	if err != nil {
+		return
+	}
+	delim := byte('\n')
+	switch prefix {
+	case 'z':
+		delim = 0
+	case 'n':
+	default:
+		r.UnreadByte()
+	}
+	command, err := r.ReadString(delim)
+	if err != nil {
+		return
+	}
+	reply := func(s string) { conn.Write(append([]byte(s), delim)) }
+
+	switch strings.TrimRight(command, "\x00\n") {
+	case "PING":
+		reply("PONG")
+	case "VERSION":
+		reply("ClamAV stub")
+	case "INSTREAM":
+		data, err := readStream(r)
+		if err == errTooLarge {
+			reply("INSTREAM size limit exceeded. ERROR")
+			return
+		}
+		if err != nil {
+			log.Printf("reading stream: %v", err)
+			return
+		}
+		if bytes.Contains(data, []byte(eicar)) {
+			reply("stream: Eicar-Test-Signature FOUND")
+			return
+		}
+		reply("stream: OK")
+	default:
+		reply("UNKNOWN COMMAND")
+	}
+}
+
+var errTooLarge = errors.New("stream too large")
+
+// readStream reads length-prefixed chunks until a zero length
+func readStream(r io.Reader) ([]byte, error) {
+	var data []byte
+	for {
+		var size uint32
+		if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+			return nil, err
+		}
+		if size == 0 {
+			return data, nil
+		}
+		if len(data)+int(size) > maxStreamBytes {
+			return nil, errTooLarge
+		}
+		chunk := make([]byte, size)
+		if _, err := io.ReadFull(r, chunk); err != nil {
+			return nil, err
+		}
+		data = append(data, chunk...)
+	}
+}
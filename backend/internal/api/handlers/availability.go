@@ -0,0 +1,483 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/gin-gonic/gin"
+	"github.com/ireuven89/routewise/internal/models"
+	"github.com/ireuven89/routewise/internal/repository"
+	"github.com/ireuven89/routewise/internal/scheduling"
+)
+
+const (
+	defaultAvailabilitySpan = 7 * 24 * time.Hour
+	maxAvailabilitySpan     = 31 * 24 * time.Hour
+	// Free slots shorter than this are not worth offering
+	minFreeSlot = 30 * time.Minute
+)
+
+type AvailabilityHandler struct {
+	availabilityRepo *repository.AvailabilityRepository
+	workerRepo       *repository.WorkerRepository
+	checker          *scheduling.Checker
+}
+
+func NewAvailabilityHandler(db *sql.DB, checker *scheduling.Checker) *AvailabilityHandler {
+	return &AvailabilityHandler{
+		availabilityRepo: repository.NewAvailabilityRepository(db),
+		workerRepo:       repository.NewWorkerRepository(db),
+		checker:          checker,
+	}
+}
+
+type UpdateSchedulingSettingsRequest struct {
+	TravelBufferMinutes *int    `json:"travel_buffer_minutes" binding:"omitempty,min=0,max=240"`
+	ConflictMode        *string `json:"conflict_mode" binding:"omitempty,oneof=warn reject"`
+	Timezone            *string `json:"timezone"`
+}
+
+type WorkingHoursRequest struct {
+	Hours []models.WorkingHours `json:"hours" binding:"required,dive"`
+}
+
+type TimeOffRequest struct {
+	StartsAt time.Time `json:"starts_at" binding:"required"`
+	EndsAt   time.Time `json:"ends_at" binding:"required"`
+	Reason   string    `json:"reason"`
+}
+
+type HolidayRequest struct {
+	Date string `json:"date" binding:"required"`
+	Name string `json:"name" binding:"required"`
+}
+
+// GetAvailability returns a worker's free slots between ?from and ?to, which
+// take a date (YYYY-MM-DD, in the organization's timezone) or RFC 3339
+func (h *AvailabilityHandler) GetAvailability(c *gin.Context) {
+	organizationID := c.GetUint("organization_id")
+
+	workerID, ok := h.findWorker(c)
+	if !ok {
+		return
+	}
+
+	settings, err := h.availabilityRepo.GetSettings(organizationID)
+	if err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch availability"})
+		return
+	}
+	loc, err := time.LoadLocation(settings.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+
+	now := time.Now().In(loc)
+	from := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	if v := c.Query("from"); v != "" {
+		if from, err = parseCalendarTime(v, loc, false); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from, expected YYYY-MM-DD or RFC 3339"})
+			return
+		}
+	}
+	to := from.Add(defaultAvailabilitySpan)
+	if v := c.Query("to"); v != "" {
+		if to, err = parseCalendarTime(v, loc, true); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to, expected YYYY-MM-DD or RFC 3339"})
+			return
+		}
+	}
+	if !from.Before(to) || to.Sub(from) > maxAvailabilitySpan {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid time range"})
+		return
+	}
+
+	cal, _, err := h.checker.Calendar(organizationID, workerID, from, to, 0)
+	if err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch availability"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"worker_id":             workerID,
+		"from":                  from,
+		"to":                    to,
+		"timezone":              loc.String(),
+		"travel_buffer_minutes": settings.TravelBufferMinutes,
+		"working":               nonNilIntervals(cal.Working(from, to)),
+		"busy":                  cal.Busy,
+		"time_off":              cal.TimeOff,
+		"holidays":              cal.Holidays,
+		"free":                  cal.Free(from, to, minFreeSlot),
+	})
+}
+
+func (h *AvailabilityHandler) GetWorkingHours(c *gin.Context) {
+	workerID, ok := h.findWorker(c)
+	if !ok {
+		return
+	}
+
+	hours, err := h.availabilityRepo.GetWorkingHours(workerID)
+	if err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch working hours"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"hours":      hours,
+		"is_default": len(hours) == 0,
+		"default":    scheduling.DefaultWorkingHours(),
+	})
+}
+
+// ReplaceWorkingHours sets the worker's whole week. An empty list falls back
+// to the default hours.
+func (h *AvailabilityHandler) ReplaceWorkingHours(c *gin.Context) {
+	workerID, ok := h.findWorker(c)
+	if !ok {
+		return
+	}
+
+	var req WorkingHoursRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	for _, block := range req.Hours {
+		if err := validateWorkingHours(block); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if err := h.availabilityRepo.ReplaceWorkingHours(workerID, req.Hours); err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save working hours"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"hours": req.Hours})
+}
+
+func (h *AvailabilityHandler) ListTimeOff(c *gin.Context) {
+	workerID, ok := h.findWorker(c)
+	if !ok {
+		return
+	}
+
+	// Upcoming and current entries unless a range is given
+	from := time.Now()
+	to := from.AddDate(1, 0, 0)
+	var err error
+	if v := c.Query("from"); v != "" {
+		if from, err = time.Parse(time.RFC3339, v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from, expected RFC 3339"})
+			return
+		}
+	}
+	if v := c.Query("to"); v != "" {
+		if to, err = time.Parse(time.RFC3339, v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to, expected RFC 3339"})
+			return
+		}
+	}
+
+	entries, err := h.availabilityRepo.FindTimeOff(workerID, from, to)
+	if err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch time off"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"time_off": entries})
+}
+
+func (h *AvailabilityHandler) CreateTimeOff(c *gin.Context) {
+	organizationUserID := c.GetUint("organization_user_id")
+
+	workerID, ok := h.findWorker(c)
+	if !ok {
+		return
+	}
+
+	var req TimeOffRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !req.StartsAt.Before(req.EndsAt) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ends_at must be after starts_at"})
+		return
+	}
+
+	entry := &models.TimeOff{
+		WorkerID: workerID,
+		StartsAt: req.StartsAt,
+		EndsAt:   req.EndsAt,
+		Reason:   req.Reason,
+	}
+	if c.GetString("user_type") != "worker" {
+		entry.CreatedBy = &organizationUserID
+	}
+
+	if err := h.availabilityRepo.CreateTimeOff(entry); err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save time off"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, entry)
+}
+
+func (h *AvailabilityHandler) DeleteTimeOff(c *gin.Context) {
+	workerID, ok := h.findWorker(c)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("timeOffId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid time off ID"})
+		return
+	}
+
+	if err := h.availabilityRepo.DeleteTimeOff(uint(id), workerID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Time off not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Time off deleted successfully"})
+}
+
+// ListHolidays returns the organization's holidays in ?year (default: this year)
+func (h *AvailabilityHandler) ListHolidays(c *gin.Context) {
+	organizationID := c.GetUint("organization_id")
+
+	year := time.Now().Year()
+	if v := c.Query("year"); v != "" {
+		y, err := strconv.Atoi(v)
+		if err != nil || y < 1970 || y > 9999 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid year"})
+			return
+		}
+		year = y
+	}
+
+	holidays, err := h.availabilityRepo.FindHolidays(organizationID, fmt.Sprintf("%d-01-01", year), fmt.Sprintf("%d-12-31", year))
+	if err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch holidays"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"holidays": holidays})
+}
+
+func (h *AvailabilityHandler) CreateHoliday(c *gin.Context) {
+	organizationID := c.GetUint("organization_id")
+
+	var req HolidayRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if _, err := time.Parse(routeDateLayout, req.Date); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date, expected YYYY-MM-DD"})
+		return
+	}
+
+	holiday := &models.Holiday{
+		OrganizationID: organizationID,
+		Date:           req.Date,
+		Name:           req.Name,
+	}
+	if err := h.availabilityRepo.CreateHoliday(holiday); err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save holiday"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, holiday)
+}
+
+func (h *AvailabilityHandler) DeleteHoliday(c *gin.Context) {
+	organizationID := c.GetUint("organization_id")
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid holiday ID"})
+		return
+	}
+
+	if err := h.availabilityRepo.DeleteHoliday(uint(id), organizationID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Holiday not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Holiday deleted successfully"})
+}
+
+func (h *AvailabilityHandler) GetSettings(c *gin.Context) {
+	organizationID := c.GetUint("organization_id")
+
+	settings, err := h.availabilityRepo.GetSettings(organizationID)
+	if err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch scheduling settings"})
+		return
+	}
+
+	c.JSON(http.StatusOK, settings)
+}
+
+func (h *AvailabilityHandler) UpdateSettings(c *gin.Context) {
+	organizationID := c.GetUint("organization_id")
+
+	var req UpdateSchedulingSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	settings, err := h.availabilityRepo.GetSettings(organizationID)
+	if err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch scheduling settings"})
+		return
+	}
+
+	if req.TravelBufferMinutes != nil {
+		settings.TravelBufferMinutes = *req.TravelBufferMinutes
+	}
+	if req.ConflictMode != nil {
+		settings.ConflictMode = *req.ConflictMode
+	}
+	if req.Timezone != nil {
+		if _, err := time.LoadLocation(*req.Timezone); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown timezone"})
+			return
+		}
+		settings.Timezone = *req.Timezone
+	}
+
+	if err := h.availabilityRepo.SaveSettings(settings); err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save scheduling settings"})
+		return
+	}
+
+	c.JSON(http.StatusOK, settings)
+}
+
+func (h *AvailabilityHandler) findWorker(c *gin.Context) (uint, bool) {
+	organizationID := c.GetUint("organization_id")
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid worker ID"})
+		return 0, false
+	}
+
+	if _, err := h.workerRepo.FindByID(uint(id), organizationID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Worker not found"})
+		return 0, false
+	}
+
+	return uint(id), true
+}
+
+func validateWorkingHours(block models.WorkingHours) error {
+	if block.Weekday < 0 || block.Weekday > 6 {
+		return fmt.Errorf("weekday must be 0 (Sunday) to 6")
+	}
+	start, err := time.Parse("15:04", block.StartTime)
+	if err != nil {
+		return fmt.Errorf("invalid start_time %q, expected HH:MM", block.StartTime)
+	}
+	end, err := time.Parse("15:04", block.EndTime)
+	if err != nil {
+		return fmt.Errorf("invalid end_time %q, expected HH:MM", block.EndTime)
+	}
+	if !start.Before(end) {
+		return fmt.Errorf("end_time must be after start_time")
+	}
+	return nil
+}
+
+// parseCalendarTime accepts RFC 3339 or a plain date in loc. A date used as
+// the end of a range covers the whole day.
+func parseCalendarTime(v string, loc *time.Location, endOfRange bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation(routeDateLayout, v, loc)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if endOfRange {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+func nonNilIntervals(in []scheduling.Interval) []scheduling.Interval {
+	if in == nil {
+		return []scheduling.Interval{}
+	}
+	return in
+}
+
+// scheduleBlockedError stops a write when the conflict check rejects it
+type scheduleBlockedError struct {
+	conflicts []models.ScheduleConflict
+}
+
+func (e *scheduleBlockedError) Error() string {
+	return "worker is not available at that time"
+}
+
+// scheduleCheck returns the conflict check the repositories run when they
+// give a worker a job slot. It reads through the write's transaction after
+// the worker is locked, so two writes cannot both take the same free slot.
+// Conflicts that block the change fail the write with a scheduleBlockedError;
+// the rest come back as warnings.
+func scheduleCheck(checker *scheduling.Checker, organizationID uint, excludeJobID uint) repository.ScheduleCheck {
+	return func(tx *sql.Tx, workerID uint, start time.Time, durationMinutes int) ([]models.ScheduleConflict, error) {
+		result, err := checker.WithTx(tx).Check(organizationID, workerID, start, durationMinutes, excludeJobID)
+		if err != nil {
+			return nil, err
+		}
+		if result.Blocking {
+			return nil, &scheduleBlockedError{conflicts: result.Conflicts}
+		}
+		return result.Conflicts, nil
+	}
+}
+
+// respondScheduleError answers the errors a schedule check can fail a write
+// with and reports whether err was one of them
+func respondScheduleError(c *gin.Context, err error) bool {
+	var blocked *scheduleBlockedError
+	switch {
+	case errors.As(err, &blocked):
+		c.JSON(http.StatusConflict, gin.H{
+			"error":     "Worker is not available at that time",
+			"conflicts": blocked.conflicts,
+		})
+	case err.Error() == "worker not found":
+		c.JSON(http.StatusNotFound, gin.H{"error": "Worker not found"})
+	default:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/gin-gonic/gin"
+	"github.com/ireuven89/routewise/internal/events"
+	"github.com/ireuven89/routewise/internal/models"
+	"github.com/ireuven89/routewise/internal/repository"
+	"github.com/ireuven89/routewise/internal/scheduling"
+)
+
+type CrewHandler struct {
+	crewRepo *repository.CrewRepository
+	checker  *scheduling.Checker
+	events   events.Publisher
+}
+
+func NewCrewHandler(db *sql.DB, checker *scheduling.Checker, publisher events.Publisher) *CrewHandler {
+	return &CrewHandler{
+		crewRepo: repository.NewCrewRepository(db),
+		checker:  checker,
+		events:   publisher,
+	}
+}
+
+type AddCrewMemberRequest struct {
+	WorkerID uint   `json:"worker_id" binding:"required"`
+	Role     string `json:"role" binding:"required,max=50"`
+}
+
+type UpdateCrewRoleRequest struct {
+	Role string `json:"role" binding:"required,max=50"`
+}
+
+// GetCrew lists a job's crew. ?include_removed=true also returns past members.
+func (h *CrewHandler) GetCrew(c *gin.Context) {
+	organizationID := c.GetUint("organization_id")
+
+	jobID, ok := parseJobID(c)
+	if !ok {
+		return
+	}
+
+	crew, err := h.crewRepo.FindByJob(jobID, organizationID, c.Query("include_removed") == "true")
+	if err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch crew"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"crew": crew})
+}
+
+func (h *CrewHandler) AddMember(c *gin.Context) {
+	organizationID := c.GetUint("organization_id")
+	userID := c.GetUint("organization_user_id")
+
+	jobID, ok := parseJobID(c)
+	if !ok {
+		return
+	}
+
+	var req AddCrewMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	assignment := &models.CrewAssignment{
+		JobID:    jobID,
+		WorkerID: req.WorkerID,
+		Role:     normalizeRole(req.Role),
+	}
+	if c.GetString("user_type") != "worker" {
+		assignment.AssignedBy = &userID
+	}
+
+	// Crew members are as busy as the lead, so they are checked the same way
+	warnings, err := h.crewRepo.AddMember(assignment, organizationID, scheduleCheck(h.checker, organizationID, jobID))
+	if err != nil {
+		if !respondScheduleError(c, err) {
+			respondCrewError(c, err, "Failed to add crew member")
+		}
+		return
+	}
+
+	h.events.Publish(organizationID, events.JobCrewAdded, assignment)
+
+	c.JSON(http.StatusCreated, gin.H{"assignment": assignment, "warnings": warnings})
+}
+
+func (h *CrewHandler) UpdateRole(c *gin.Context) {
+	organizationID := c.GetUint("organization_id")
+
+	jobID, workerID, ok := parseJobItemIDs(c, "workerId")
+	if !ok {
+		return
+	}
+
+	var req UpdateCrewRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.crewRepo.UpdateRole(jobID, workerID, normalizeRole(req.Role), organizationID); err != nil {
+		respondCrewError(c, err, "Failed to update crew role")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Crew role updated successfully"})
+}
+
+func (h *CrewHandler) RemoveMember(c *gin.Context) {
+	organizationID := c.GetUint("organization_id")
+
+	jobID, workerID, ok := parseJobItemIDs(c, "workerId")
+	if !ok {
+		return
+	}
+
+	assignment, err := h.crewRepo.RemoveMember(jobID, workerID, organizationID)
+	if err != nil {
+		respondCrewError(c, err, "Failed to remove crew member")
+		return
+	}
+
+	h.events.Publish(organizationID, events.JobCrewRemoved, assignment)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Crew member removed successfully"})
+}
+
+// GetWorkerAssignments lists the jobs a worker is currently on a crew for
+func (h *CrewHandler) GetWorkerAssignments(c *gin.Context) {
+	organizationID := c.GetUint("organization_id")
+
+	workerID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid worker ID"})
+		return
+	}
+
+	assignments, err := h.crewRepo.FindActiveByWorker(uint(workerID), organizationID)
+	if err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch assignments"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"assignments": assignments})
+}
+
+func normalizeRole(role string) string {
+	return strings.ToLower(strings.TrimSpace(role))
+}
+
+func respondCrewError(c *gin.Context, err error, message string) {
+	switch err.Error() {
+	case "job not found":
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+	case "worker not found":
+		c.JSON(http.StatusNotFound, gin.H{"error": "Worker not found"})
+	case "crew member not found":
+		c.JSON(http.StatusNotFound, gin.H{"error": "Crew member not found"})
+	case "worker already on crew":
+		c.JSON(http.StatusConflict, gin.H{"error": "Worker is already on this crew"})
+	default:
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
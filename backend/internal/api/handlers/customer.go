@@ -1,23 +1,41 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"github.com/getsentry/sentry-go"
 	"github.com/gin-gonic/gin"
+	"github.com/ireuven89/routewise/internal/events"
 	"github.com/ireuven89/routewise/internal/models"
 	"github.com/ireuven89/routewise/internal/repository"
+	"github.com/ireuven89/routewise/services"
 	"net/http"
 	"strconv"
+	"time"
+)
+
+const (
+	geocodeTimeout       = 10 * time.Second
+	defaultBackfillLimit = 100
+	maxBackfillLimit     = 1000
+	// Backfills skip customers whose geocoding failed more recently than this
+	geocodeRetryAfter = 24 * time.Hour
 )
 
 type CustomerHandler struct {
 	customerRepo *repository.CustomerRepository
+	geocoder     services.Geocoder
+	events       events.Publisher
 }
 
-func NewCustomerHandler(db *sql.DB) *CustomerHandler {
+// NewCustomerHandler creates the handler; geocoder may be nil to disable geocoding
+func NewCustomerHandler(db *sql.DB, geocoder services.Geocoder, publisher events.Publisher) *CustomerHandler {
 	return &CustomerHandler{
 		customerRepo: repository.NewCustomerRepository(db),
+		geocoder:     geocoder,
+		events:       publisher,
 	}
 }
 
@@ -65,6 +83,8 @@ func (h *CustomerHandler) Create(c *gin.Context) {
 		Notes:          req.Notes,
 	}
 
+	h.fillCoordinates(c.Request.Context(), customer)
+
 	if err := h.customerRepo.Create(customer); err != nil {
 		sentry.CaptureException(err)
 		fmt.Println("failed creating customer", err)
@@ -72,6 +92,8 @@ func (h *CustomerHandler) Create(c *gin.Context) {
 		return
 	}
 
+	h.events.Publish(organizationID, events.CustomerCreated, customer)
+
 	c.JSON(http.StatusCreated, customer)
 }
 
@@ -155,6 +177,8 @@ func (h *CustomerHandler) Update(c *gin.Context) {
 	customer.Longitude = req.Longitude
 	customer.Notes = req.Notes
 
+	h.fillCoordinates(c.Request.Context(), customer)
+
 	if err := h.customerRepo.Update(customer); err != nil {
 		sentry.CaptureException(err)
 		fmt.Println("failed updating customer", err)
@@ -162,6 +186,8 @@ func (h *CustomerHandler) Update(c *gin.Context) {
 		return
 	}
 
+	h.events.Publish(organizationID, events.CustomerUpdated, customer)
+
 	c.JSON(http.StatusOK, customer)
 }
 
@@ -183,5 +209,109 @@ func (h *CustomerHandler) Delete(c *gin.Context) {
 		return
 	}
 
+	h.events.Publish(organizationID, events.CustomerDeleted, gin.H{"customer_id": uint(id)})
+
 	c.JSON(http.StatusOK, gin.H{"message": "Customer deleted successfully"})
 }
+
+// BackfillCoordinates geocodes existing customers that have no coordinates.
+// It processes up to ?limit customers per call and reports what is left.
+// Customers that fail are skipped by later calls for geocodeRetryAfter, or
+// until their address changes, so repeated calls work through the rest.
+func (h *CustomerHandler) BackfillCoordinates(c *gin.Context) {
+	organizationID := c.GetUint("organization_id")
+
+	if h.geocoder == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Geocoding is not configured"})
+		return
+	}
+
+	limit := defaultBackfillLimit
+	if v := c.Query("limit"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed <= 0 || parsed > maxBackfillLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+			return
+		}
+		limit = parsed
+	}
+
+	failedBefore := time.Now().Add(-geocodeRetryAfter)
+	customers, err := h.customerRepo.FindMissingCoordinates(organizationID, failedBefore, limit)
+	if err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch customers"})
+		return
+	}
+
+	geocoded := 0
+	notFound := []uint{}
+	failed := []uint{}
+
+	for _, customer := range customers {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), geocodeTimeout)
+		result, err := h.geocoder.Geocode(ctx, customer.Address)
+		cancel()
+
+		if err != nil {
+			if errors.Is(err, services.ErrAddressNotFound) {
+				notFound = append(notFound, customer.ID)
+			} else {
+				fmt.Println("failed geocoding customer", customer.ID, err)
+				failed = append(failed, customer.ID)
+			}
+			if err := h.customerRepo.MarkGeocodeFailed(customer.ID, organizationID); err != nil {
+				sentry.CaptureException(err)
+			}
+			continue
+		}
+
+		if err := h.customerRepo.UpdateCoordinates(customer.ID, organizationID, result.Latitude, result.Longitude); err != nil {
+			sentry.CaptureException(err)
+			failed = append(failed, customer.ID)
+			continue
+		}
+		geocoded++
+	}
+
+	remaining, err := h.customerRepo.CountMissingCoordinates(organizationID, failedBefore)
+	if err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count customers"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"processed": len(customers),
+		"geocoded":  geocoded,
+		"not_found": notFound,
+		"failed":    failed,
+		"remaining": remaining,
+	})
+}
+
+// fillCoordinates geocodes the customer's address when coordinates are missing.
+// Failures are logged and never block saving the customer.
+func (h *CustomerHandler) fillCoordinates(ctx context.Context, customer *models.Customer) {
+	if h.geocoder == nil || customer.Address == "" {
+		return
+	}
+	if customer.Latitude != nil && customer.Longitude != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, geocodeTimeout)
+	defer cancel()
+
+	result, err := h.geocoder.Geocode(ctx, customer.Address)
+	if err != nil {
+		if !errors.Is(err, services.ErrAddressNotFound) {
+			sentry.CaptureException(err)
+		}
+		fmt.Println("failed geocoding customer address", err)
+		return
+	}
+
+	customer.Latitude = &result.Latitude
+	customer.Longitude = &result.Longitude
+}
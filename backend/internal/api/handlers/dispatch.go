@@ -0,0 +1,234 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/gin-gonic/gin"
+	"github.com/ireuven89/routewise/internal/events"
+	"github.com/ireuven89/routewise/internal/models"
+	"github.com/ireuven89/routewise/internal/repository"
+	"github.com/ireuven89/routewise/internal/scheduling"
+)
+
+const maxDispatchBoardDays = 14
+
+type DispatchHandler struct {
+	jobRepo          *repository.JobRepository
+	workerRepo       *repository.WorkerRepository
+	availabilityRepo *repository.AvailabilityRepository
+	checker          *scheduling.Checker
+	events           events.Publisher
+}
+
+func NewDispatchHandler(db *sql.DB, checker *scheduling.Checker, publisher events.Publisher) *DispatchHandler {
+	return &DispatchHandler{
+		jobRepo:          repository.NewJobRepository(db),
+		workerRepo:       repository.NewWorkerRepository(db),
+		availabilityRepo: repository.NewAvailabilityRepository(db),
+		checker:          checker,
+		events:           publisher,
+	}
+}
+
+// MoveJobRequest carries the job's full new placement. Version is the job
+// version the client last saw; the move is rejected if it has changed since.
+type MoveJobRequest struct {
+	WorkerID        *uint     `json:"worker_id"` // null moves the job to the unassigned bucket
+	ScheduledAt     time.Time `json:"scheduled_at" binding:"required"`
+	DurationMinutes int       `json:"duration_minutes" binding:"omitempty,min=1,max=10080"`
+	Version         int       `json:"version" binding:"required"`
+}
+
+type DispatchLane struct {
+	Worker        *models.Worker `json:"worker"`
+	Jobs          []*models.Job  `json:"jobs"`
+	BookedMinutes int            `json:"booked_minutes"`
+}
+
+// GetBoard returns the jobs between ?from and ?to (YYYY-MM-DD in the
+// organization's timezone, inclusive) grouped by worker, with unassigned jobs in their own bucket. Every active
+// worker gets a lane, even an empty one.
+func (h *DispatchHandler) GetBoard(c *gin.Context) {
+	organizationID := c.GetUint("organization_id")
+
+	// Days are the organization's days, not UTC ones
+	settings, err := h.availabilityRepo.GetSettings(organizationID)
+	if err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch jobs"})
+		return
+	}
+	loc, err := time.LoadLocation(settings.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+
+	now := time.Now().In(loc)
+	from := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	if v := c.Query("from"); v != "" {
+		if from, err = parseCalendarTime(v, loc, false); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from, expected YYYY-MM-DD"})
+			return
+		}
+	}
+	end := from.AddDate(0, 0, 1)
+	if v := c.Query("to"); v != "" {
+		if end, err = parseCalendarTime(v, loc, true); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to, expected YYYY-MM-DD"})
+			return
+		}
+	}
+	if !from.Before(end) || end.After(from.AddDate(0, 0, maxDispatchBoardDays)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date range"})
+		return
+	}
+
+	filters := map[string]interface{}{
+		"scheduled_from": from,
+		"scheduled_to":   end,
+	}
+	if c.Query("include_cancelled") != "true" {
+		filters["exclude_status"] = models.StatusCancelled
+	}
+
+	jobs, err := h.jobRepo.FindAll(organizationID, filters, "scheduled_at")
+	if err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch jobs"})
+		return
+	}
+
+	workers, err := h.workerRepo.FindAll(organizationID, false)
+	if err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch workers"})
+		return
+	}
+
+	lanes := make(map[uint]*DispatchLane)
+	for _, w := range workers {
+		if w.IsActive {
+			lanes[w.ID] = &DispatchLane{Worker: w, Jobs: []*models.Job{}}
+		}
+	}
+
+	unassigned := []*models.Job{}
+	for _, job := range jobs {
+		if job.TechnicianID == nil {
+			unassigned = append(unassigned, job)
+			continue
+		}
+
+		lane, ok := lanes[*job.TechnicianID]
+		if !ok {
+			// Inactive workers only get a lane when they still have jobs
+			for _, w := range workers {
+				if w.ID == *job.TechnicianID {
+					lane = &DispatchLane{Worker: w, Jobs: []*models.Job{}}
+					lanes[w.ID] = lane
+				}
+			}
+			if lane == nil {
+				unassigned = append(unassigned, job)
+				continue
+			}
+		}
+		lane.Jobs = append(lane.Jobs, job)
+		lane.BookedMinutes += job.DurationMinutes
+	}
+
+	board := make([]*DispatchLane, 0, len(lanes))
+	for _, lane := range lanes {
+		board = append(board, lane)
+	}
+	sort.Slice(board, func(i, j int) bool { return board[i].Worker.Name < board[j].Worker.Name })
+
+	c.JSON(http.StatusOK, gin.H{
+		"from":       from.In(loc).Format(routeDateLayout),
+		"to":         end.AddDate(0, 0, -1).In(loc).Format(routeDateLayout),
+		"timezone":   loc.String(),
+		"workers":    board,
+		"unassigned": unassigned,
+	})
+}
+
+// MoveJob changes a job's worker, time and duration in one transaction after
+// checking the target worker's schedule. A stale version gets 409.
+func (h *DispatchHandler) MoveJob(c *gin.Context) {
+	organizationID := c.GetUint("organization_id")
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid job ID"})
+		return
+	}
+
+	var req MoveJobRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	job, err := h.jobRepo.FindByID(uint(id), organizationID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	}
+
+	move := &models.JobMove{
+		JobID:           job.ID,
+		OrganizationID:  organizationID,
+		WorkerID:        req.WorkerID,
+		ScheduledAt:     req.ScheduledAt,
+		DurationMinutes: req.DurationMinutes,
+		ExpectedVersion: req.Version,
+	}
+	if move.DurationMinutes == 0 {
+		move.DurationMinutes = job.DurationMinutes
+	}
+
+	warnings, err := h.jobRepo.Move(move, scheduleCheck(h.checker, organizationID, job.ID))
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrStaleJob):
+			respondStaleJob(c, h.jobRepo, job.ID)
+		case errors.Is(err, models.ErrJobNotMovable):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case respondScheduleError(c, err):
+		case err.Error() == "job not found":
+			c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		default:
+			sentry.CaptureException(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to move job"})
+		}
+		return
+	}
+
+	moved, err := h.jobRepo.FindByID(job.ID, organizationID)
+	if err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch job"})
+		return
+	}
+	moved.ScheduleWarnings = warnings
+
+	h.events.Publish(organizationID, events.JobUpdated, moved)
+	if !sameWorker(job.TechnicianID, moved.TechnicianID) {
+		h.events.Publish(organizationID, events.JobAssigned, gin.H{"job_id": moved.ID, "technician_id": moved.TechnicianID})
+	}
+
+	c.JSON(http.StatusOK, moved)
+}
+
+func sameWorker(a, b *uint) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
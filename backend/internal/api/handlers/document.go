@@ -0,0 +1,486 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/gin-gonic/gin"
+	"github.com/ireuven89/routewise/internal/documents"
+	"github.com/ireuven89/routewise/internal/models"
+	"github.com/ireuven89/routewise/internal/repository"
+	"github.com/ireuven89/routewise/pkg/utils"
+	"github.com/ireuven89/routewise/services"
+)
+
+const (
+	maxLogoBytes     = 2 << 20
+	maxPhotoBytes    = 15 << 20
+	maxReportPhotos  = 24
+	maxFooterTextLen = 300
+)
+
+// DocumentHandler renders PDFs and manages the branding they use
+type DocumentHandler struct {
+	invoiceRepo      *repository.InvoiceRepository
+	quoteRepo        *repository.QuoteRepository
+	jobRepo          *repository.JobRepository
+	customerRepo     *repository.CustomerRepository
+	workerRepo       *repository.WorkerRepository
+	fileRepo         *repository.FileRepository
+	brandingRepo     *repository.BrandingRepository
+	userRepo         *repository.OrganizationUserRepository
+	availabilityRepo *repository.AvailabilityRepository
+	storage          services.Storage
+}
+
+func NewDocumentHandler(db *sql.DB, storage services.Storage) *DocumentHandler {
+	return &DocumentHandler{
+		invoiceRepo:      repository.NewInvoiceRepository(db),
+		quoteRepo:        repository.NewQuoteRepository(db),
+		jobRepo:          repository.NewJobRepository(db),
+		customerRepo:     repository.NewCustomerRepository(db),
+		workerRepo:       repository.NewWorkerRepository(db),
+		fileRepo:         repository.NewFileRepository(db),
+		brandingRepo:     repository.NewBrandingRepository(db),
+		userRepo:         repository.NewUserRepository(db),
+		availabilityRepo: repository.NewAvailabilityRepository(db),
+		storage:          storage,
+	}
+}
+
+type UpdateBrandingRequest struct {
+	PrimaryColor *string `json:"primary_color"`
+	AccentColor  *string `json:"accent_color"`
+	FooterText   *string `json:"footer_text"`
+}
+
+func (h *DocumentHandler) GetBranding(c *gin.Context) {
+	organizationID := c.GetUint("organization_id")
+
+	branding, err := h.brandingRepo.Get(organizationID)
+	if err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch branding"})
+		return
+	}
+
+	h.withLogoURL(c.Request.Context(), branding)
+	c.JSON(http.StatusOK, branding)
+}
+
+func (h *DocumentHandler) UpdateBranding(c *gin.Context) {
+	if !rejectWorkers(c, "Workers cannot change branding") {
+		return
+	}
+	organizationID := c.GetUint("organization_id")
+
+	var req UpdateBrandingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	branding, err := h.brandingRepo.Get(organizationID)
+	if err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch branding"})
+		return
+	}
+
+	for _, color := range []struct {
+		value  *string
+		target *string
+		name   string
+	}{
+		{req.PrimaryColor, &branding.PrimaryColor, "primary_color"},
+		{req.AccentColor, &branding.AccentColor, "accent_color"},
+	} {
+		if color.value == nil {
+			continue
+		}
+		if _, _, _, err := models.ParseHexColor(*color.value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s: %v", color.name, err)})
+			return
+		}
+		*color.target = *color.value
+	}
+	if req.FooterText != nil {
+		if len(*req.FooterText) > maxFooterTextLen {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("footer_text is limited to %d characters", maxFooterTextLen)})
+			return
+		}
+		branding.FooterText = *req.FooterText
+	}
+
+	if err := h.brandingRepo.Save(branding); err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save branding"})
+		return
+	}
+
+	h.withLogoURL(c.Request.Context(), branding)
+	c.JSON(http.StatusOK, branding)
+}
+
+// UploadLogo replaces the logo printed on documents. PNG and JPEG only.
+func (h *DocumentHandler) UploadLogo(c *gin.Context) {
+	if !rejectWorkers(c, "Workers cannot change branding") {
+		return
+	}
+	organizationID := c.GetUint("organization_id")
+
+	file, header, err := c.Request.FormFile("logo")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No logo provided"})
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxLogoBytes+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read logo"})
+		return
+	}
+	if len(data) > maxLogoBytes {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Logo is limited to 2 MB"})
+		return
+	}
+
+	mimeType := http.DetectContentType(data)
+	if mimeType != "image/png" && mimeType != "image/jpeg" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Logo must be a PNG or JPEG image"})
+		return
+	}
+	if err := documents.CheckImage(documents.Image{Data: data, MimeType: mimeType}); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Logo could not be read: " + err.Error()})
+		return
+	}
+
+	branding, err := h.brandingRepo.Get(organizationID)
+	if err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch branding"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	s3Key := fmt.Sprintf("organizations/%d/branding/%d_%s", organizationID, time.Now().Unix(), filepath.Base(header.Filename))
+	if err := h.storage.UploadFile(ctx, bytes.NewReader(data), s3Key, mimeType); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload logo"})
+		return
+	}
+
+	previous := branding.LogoS3Key
+	branding.LogoS3Key = s3Key
+	if err := h.brandingRepo.Save(branding); err != nil {
+		h.storage.DeleteFile(ctx, s3Key) // Rollback upload
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save branding"})
+		return
+	}
+	if previous != "" {
+		h.storage.DeleteFile(ctx, previous)
+	}
+
+	h.withLogoURL(ctx, branding)
+	c.JSON(http.StatusOK, branding)
+}
+
+func (h *DocumentHandler) DeleteLogo(c *gin.Context) {
+	if !rejectWorkers(c, "Workers cannot change branding") {
+		return
+	}
+	organizationID := c.GetUint("organization_id")
+
+	branding, err := h.brandingRepo.Get(organizationID)
+	if err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch branding"})
+		return
+	}
+	if branding.LogoS3Key == "" {
+		c.JSON(http.StatusOK, branding)
+		return
+	}
+
+	previous := branding.LogoS3Key
+	branding.LogoS3Key = ""
+	if err := h.brandingRepo.Save(branding); err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save branding"})
+		return
+	}
+	h.storage.DeleteFile(c.Request.Context(), previous)
+
+	c.JSON(http.StatusOK, branding)
+}
+
+func (h *DocumentHandler) InvoicePDF(c *gin.Context) {
+	if !rejectWorkers(c, "Workers cannot manage invoices") {
+		return
+	}
+	organizationID := c.GetUint("organization_id")
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invoice ID"})
+		return
+	}
+
+	invoice, err := h.invoiceRepo.FindByID(uint(id), organizationID)
+	if err != nil {
+		if err.Error() == "invoice not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Invoice not found"})
+			return
+		}
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch invoice"})
+		return
+	}
+
+	name := fmt.Sprintf("invoice-draft-%d.pdf", invoice.ID)
+	if invoice.Number != nil {
+		name = fmt.Sprintf("invoice-%d.pdf", *invoice.Number)
+	}
+
+	h.render(c, organizationID, name, func(w io.Writer, brand documents.Brand) error {
+		customer, _ := h.customerRepo.FindByID(invoice.CustomerID, organizationID)
+		return documents.RenderInvoice(w, brand, invoice, customer, time.Now())
+	})
+}
+
+func (h *DocumentHandler) QuotePDF(c *gin.Context) {
+	organizationID := c.GetUint("organization_id")
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid quote ID"})
+		return
+	}
+
+	h.renderQuote(c, organizationID, uint(id))
+}
+
+// PublicQuotePDF lets the customer holding the approval link download the quote
+func (h *DocumentHandler) PublicQuotePDF(c *gin.Context) {
+	claims, err := utils.ValidatePublicToken(c.Param("token"), utils.ScopeQuoteApproval)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired link"})
+		return
+	}
+
+	h.renderQuote(c, claims.OrganizationID, claims.ResourceID)
+}
+
+func (h *DocumentHandler) renderQuote(c *gin.Context, organizationID, id uint) {
+	quote, err := h.quoteRepo.FindByID(id, organizationID)
+	if err != nil {
+		if err.Error() == "quote not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Quote not found"})
+			return
+		}
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch quote"})
+		return
+	}
+
+	h.render(c, organizationID, fmt.Sprintf("quote-%d.pdf", quote.Number), func(w io.Writer, brand documents.Brand) error {
+		customer, _ := h.customerRepo.FindByID(quote.CustomerID, organizationID)
+		return documents.RenderQuote(w, brand, quote, customer)
+	})
+}
+
+// JobReportPDF renders the completion report with notes, parts and photos
+func (h *DocumentHandler) JobReportPDF(c *gin.Context) {
+	organizationID := c.GetUint("organization_id")
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid job ID"})
+		return
+	}
+
+	job, err := h.jobRepo.FindByID(uint(id), organizationID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	}
+
+	report := &documents.JobReport{Job: job}
+	report.Customer, _ = h.customerRepo.FindByID(job.CustomerID, organizationID)
+	if job.TechnicianID != nil {
+		if worker, err := h.workerRepo.FindByID(*job.TechnicianID, organizationID); err == nil {
+			report.WorkerName = worker.Name
+		}
+	}
+	if report.Notes, err = h.jobRepo.GetNotes(job.ID, organizationID); err == nil {
+		report.Parts, err = h.jobRepo.GetParts(job.ID, organizationID)
+	}
+	if err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch job details"})
+		return
+	}
+
+	report.Photos, err = h.jobPhotos(c.Request.Context(), job.ID)
+	if err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch photos"})
+		return
+	}
+
+	report.Signature = h.jobSignature(c.Request.Context(), job.ID)
+
+	h.render(c, organizationID, fmt.Sprintf("job-%d-report.pdf", job.ID), func(w io.Writer, brand documents.Brand) error {
+		return documents.RenderJobReport(w, brand, report)
+	})
+}
+
+// jobPhotos downloads the job's photos in upload order. A photo that cannot
+// be fetched is left out of the report rather than failing it.
+func (h *DocumentHandler) jobPhotos(ctx context.Context, jobID uint) ([]documents.Image, error) {
+	files, err := h.fileRepo.FindByType(jobID, models.FileTypePhoto)
+	if err != nil {
+		return nil, err
+	}
+
+	photos := []documents.Image{}
+	for _, file := range files {
+		if len(photos) == maxReportPhotos {
+			break
+		}
+		// The medium rendition is upright and much smaller than the original
+		key, mimeType := file.S3Key, file.MimeType
+		if file.MediumS3Key != "" {
+			key, mimeType = file.MediumS3Key, "image/jpeg"
+		}
+		if !documents.Supported(mimeType) {
+			continue
+		}
+		data, err := h.download(ctx, key, maxPhotoBytes)
+		if err != nil {
+			log.Printf("job report %d: photo %d: %v", jobID, file.ID, err)
+			continue
+		}
+		photos = append(photos, documents.Image{Data: data, MimeType: mimeType, Caption: file.Description})
+	}
+
+	return photos, nil
+}
+
+// jobSignature returns the most recent signature for the job, or nil so the
+// report prints a blank signature line
+func (h *DocumentHandler) jobSignature(ctx context.Context, jobID uint) *documents.Signature {
+	files, err := h.fileRepo.FindByType(jobID, models.FileTypeSignature)
+	if err != nil || len(files) == 0 {
+		return nil
+	}
+
+	file := files[0]
+	data, err := h.download(ctx, file.S3Key, maxSignatureBytes)
+	if err != nil {
+		log.Printf("job report %d: signature %d: %v", jobID, file.ID, err)
+		return nil
+	}
+
+	signedAt := file.CreatedAt
+	if file.TakenAt != nil {
+		signedAt = *file.TakenAt
+	}
+	return &documents.Signature{
+		Image:      documents.Image{Data: data, MimeType: file.MimeType},
+		SignerName: file.SignerName,
+		SignedAt:   signedAt,
+	}
+}
+
+// render builds the organization's letterhead and sends the PDF inline
+func (h *DocumentHandler) render(c *gin.Context, organizationID uint, filename string, fn func(io.Writer, documents.Brand) error) {
+	brand, err := h.brand(c.Request.Context(), organizationID)
+	if err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load branding"})
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := fn(&buf, brand); err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render PDF"})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("inline; filename=%q", filename))
+	c.Data(http.StatusOK, "application/pdf", buf.Bytes())
+}
+
+func (h *DocumentHandler) brand(ctx context.Context, organizationID uint) (documents.Brand, error) {
+	org, err := h.userRepo.FindOrganizationByID(organizationID)
+	if err != nil {
+		return documents.Brand{}, err
+	}
+	branding, err := h.brandingRepo.Get(organizationID)
+	if err != nil {
+		return documents.Brand{}, err
+	}
+
+	brand := documents.Brand{
+		CompanyName: org.Name,
+		Phone:       org.Phone,
+		Branding:    branding,
+		Location:    time.UTC,
+	}
+
+	if settings, err := h.availabilityRepo.GetSettings(organizationID); err == nil {
+		if loc, err := time.LoadLocation(settings.Timezone); err == nil {
+			brand.Location = loc
+		}
+	}
+
+	// A missing logo should not stop the document
+	if branding.LogoS3Key != "" {
+		data, err := h.download(ctx, branding.LogoS3Key, maxLogoBytes)
+		if err == nil {
+			brand.Logo = &documents.Image{Data: data, MimeType: http.DetectContentType(data)}
+		} else {
+			log.Printf("branding logo for organization %d: %v", organizationID, err)
+		}
+	}
+
+	return brand, nil
+}
+
+func (h *DocumentHandler) download(ctx context.Context, s3Key string, limit int64) ([]byte, error) {
+	body, err := h.storage.DownloadFile(ctx, s3Key)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("file is larger than %d bytes", limit)
+	}
+	return data, nil
+}
+
+func (h *DocumentHandler) withLogoURL(ctx context.Context, branding *models.OrganizationBranding) {
+	if branding.LogoS3Key == "" {
+		return
+	}
+	if url, err := h.storage.GetSignedURL(ctx, branding.LogoS3Key); err == nil {
+		branding.LogoURL = url
+	}
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+	"github.com/ireuven89/routewise/internal/events"
+	"github.com/ireuven89/routewise/pkg/utils"
+)
+
+const (
+	// Proxies tend to close connections that are idle for a minute
+	streamKeepAlive = 25 * time.Second
+
+	// A stream token only has to last until the stream is opened
+	streamTokenTTL = 2 * time.Minute
+)
+
+type EventHandler struct {
+	bus *events.Bus
+}
+
+func NewEventHandler(bus *events.Bus) *EventHandler {
+	return &EventHandler{bus: bus}
+}
+
+// IssueStreamToken returns a token for opening the event stream with
+// ?stream_token=. It expires shortly, so clients ask for a new one each
+// time they connect.
+func (h *EventHandler) IssueStreamToken(c *gin.Context) {
+	token, expiresAt, err := utils.GeneratePublicToken(
+		utils.ScopeEventStream, c.GetUint("organization_id"), c.GetUint("organization_user_id"), streamTokenTTL,
+	)
+	if err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue stream token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"token": token, "expires_at": expiresAt})
+}
+
+// Stream sends the organization's events as server-sent events. A client
+// that reconnects with Last-Event-ID (or ?last_event_id=) first receives
+// what it missed; if that is no longer available it gets a "reset" event
+// and should reload. ?types= takes a comma-separated list of event types.
+func (h *EventHandler) Stream(c *gin.Context) {
+	organizationID := c.GetUint("organization_id")
+
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("last_event_id")
+	}
+
+	var types map[string]bool
+	if v := c.Query("types"); v != "" {
+		types = make(map[string]bool)
+		for _, t := range strings.Split(v, ",") {
+			types[strings.TrimSpace(t)] = true
+		}
+	}
+	send := func(event events.Event) {
+		if types == nil || types[event.Type] {
+			c.Render(-1, sse.Event{Id: event.ID, Event: event.Type, Data: event})
+		}
+	}
+
+	sub, missed, complete := h.bus.Subscribe(organizationID, lastEventID)
+	defer sub.Close()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	if !complete {
+		c.Render(-1, sse.Event{Event: "reset", Data: gin.H{"reason": "missed events are no longer available"}})
+	}
+	for _, event := range missed {
+		send(event)
+	}
+	c.Writer.Flush()
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+
+	// A closed channel means the client fell behind; it resumes on reconnect
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case event, ok := <-sub.C:
+			if !ok {
+				return false
+			}
+			send(event)
+			return true
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+			return true
+		}
+	})
+}
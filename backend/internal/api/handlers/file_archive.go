@@ -0,0 +1,264 @@
+package handlers
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ireuven89/routewise/internal/models"
+)
+
+const archiveManifest = "manifest.csv"
+
+// DownloadArchive streams a ZIP of the project's files, in folders by type
+// and category, with a manifest.csv describing each one. Files can be
+// filtered with ?category= and a ?from=/?to= date range (YYYY-MM-DD in UTC,
+// inclusive), matched against when a photo was taken or, for other files,
+// when it was uploaded.
+//
+// Files are copied from storage one at a time as the ZIP is written, so
+// nothing is held in memory. Once streaming starts errors can no longer
+// change the response; a file that cannot be read is left out and marked
+// missing in the manifest.
+func (h *FileHandler) DownloadArchive(c *gin.Context) {
+	projectID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+		return
+	}
+	orgID := c.GetUint("organization_id")
+
+	if _, err := h.projectRepo.FindByID(uint(projectID), orgID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+		return
+	}
+
+	category := c.Query("category")
+	var from, to time.Time
+	if v := c.Query("from"); v != "" {
+		if from, err = time.Parse("2006-01-02", v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from date, expected YYYY-MM-DD"})
+			return
+		}
+	}
+	if v := c.Query("to"); v != "" {
+		if to, err = time.Parse("2006-01-02", v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to date, expected YYYY-MM-DD"})
+			return
+		}
+		to = to.AddDate(0, 0, 1) // the whole day
+	}
+
+	files, err := h.fileRepo.FindByProjectID(uint(projectID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch files"})
+		return
+	}
+
+	selected := selectArchiveFiles(files, category, from, to)
+
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="project-%d-files.zip"`, projectID))
+	c.Status(http.StatusOK)
+
+	if err := h.writeArchive(c.Request.Context(), c.Writer, selected); err != nil {
+		log.Printf("archive of project %d: %v", projectID, err)
+	}
+}
+
+// selectArchiveFiles keeps the files in category, when set, dated within
+// [from, to); zero times leave that end open
+func selectArchiveFiles(files []*models.ProjectFile, category string, from, to time.Time) []*models.ProjectFile {
+	var selected []*models.ProjectFile
+	for _, file := range files {
+		date := archiveDate(file)
+		if category != "" && file.FileCategory != category {
+			continue
+		}
+		if (!from.IsZero() && date.Before(from)) || (!to.IsZero() && !date.Before(to)) {
+			continue
+		}
+		selected = append(selected, file)
+	}
+	return selected
+}
+
+// writeArchive writes the ZIP of files and its manifest to w. Files that
+// cannot be read are logged and marked missing; an error is returned only
+// when the archive itself is cut short.
+func (h *FileHandler) writeArchive(ctx context.Context, w io.Writer, files []*models.ProjectFile) error {
+	zw := zip.NewWriter(w)
+	manifest := [][]string{{
+		"path", "file_name", "file_type", "category", "mime_type", "size",
+		"uploaded_at", "taken_at", "description", "status",
+	}}
+	names := make(map[string]bool)
+
+	for _, file := range files {
+		if err := ctx.Err(); err != nil {
+			return err // client went away
+		}
+
+		name := uniqueArchiveName(names, archivePath(file))
+		status := "ok"
+		if err := h.addToArchive(ctx, zw, name, file); err != nil {
+			if err == errArchiveBroken {
+				return fmt.Errorf("file %d: %w", file.ID, err)
+			}
+			log.Printf("archive: file %d: %v", file.ID, err)
+			status = "missing"
+		}
+
+		takenAt := ""
+		if file.TakenAt != nil {
+			takenAt = file.TakenAt.UTC().Format(time.RFC3339)
+		}
+		manifest = append(manifest, []string{
+			name, csvText(file.OriginalFileName), file.FileType, csvText(file.FileCategory), file.MimeType,
+			strconv.FormatInt(file.FileSize, 10), file.CreatedAt.UTC().Format(time.RFC3339), takenAt,
+			csvText(file.Description), status,
+		})
+	}
+
+	mw, err := zw.CreateHeader(&zip.FileHeader{Name: archiveManifest, Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return errArchiveBroken
+	}
+	cw := csv.NewWriter(mw)
+	if err := cw.WriteAll(manifest); err != nil {
+		return errArchiveBroken
+	}
+	if err := zw.Close(); err != nil {
+		return errArchiveBroken
+	}
+	return nil
+}
+
+// errArchiveBroken means the ZIP itself could not be written, usually
+// because the client disconnected
+var errArchiveBroken = errors.New("writing archive failed")
+
+// addToArchive copies one file from storage into the ZIP. The storage
+// object is opened before the entry is created so a missing object leaves
+// no empty entry behind.
+func (h *FileHandler) addToArchive(ctx context.Context, zw *zip.Writer, name string, file *models.ProjectFile) error {
+	body, err := h.storage.DownloadFile(ctx, file.S3Key)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	method := zip.Deflate
+	if alreadyCompressed(file.MimeType) {
+		method = zip.Store
+	}
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: method, Modified: archiveDate(file)})
+	if err != nil {
+		return errArchiveBroken
+	}
+
+	// A read error mid-copy leaves a truncated entry the manifest marks
+	// missing; a write error means the archive cannot go on
+	src := &archiveSource{r: body}
+	if _, err := io.Copy(w, src); err != nil {
+		if src.err != nil && ctx.Err() == nil {
+			return src.err
+		}
+		return errArchiveBroken
+	}
+	return nil
+}
+
+// archiveSource remembers read errors, so io.Copy's error can be told
+// apart from a failed write
+type archiveSource struct {
+	r   io.Reader
+	err error
+}
+
+func (s *archiveSource) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	if err != nil && err != io.EOF {
+		s.err = err
+	}
+	return n, err
+}
+
+// archivePath is type/category/name, with the name reduced to a single safe
+// path element
+func archivePath(file *models.ProjectFile) string {
+	category := file.FileCategory
+	if category == "" {
+		category = "uncategorized"
+	}
+	name := file.OriginalFileName
+	if name == "" {
+		name = file.FileName
+	}
+	return path.Join(archiveElement(file.FileType), archiveElement(category), archiveElement(name))
+}
+
+func archiveElement(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r < 0x20 || r == 0x7f {
+			return '_'
+		}
+		return r
+	}, s)
+	s = strings.TrimLeft(strings.TrimSpace(s), ".")
+	if s == "" {
+		return "_"
+	}
+	return s
+}
+
+// uniqueArchiveName numbers repeated names: photo.jpg, photo (2).jpg, ...
+func uniqueArchiveName(used map[string]bool, name string) string {
+	candidate := name
+	ext := path.Ext(name)
+	for n := 2; used[candidate]; n++ {
+		candidate = fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(name, ext), n, ext)
+	}
+	used[candidate] = true
+	return candidate
+}
+
+// csvText keeps spreadsheets from running user text that looks like a
+// formula
+func csvText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// archiveDate is when a photo was taken, or else when the file was uploaded
+func archiveDate(file *models.ProjectFile) time.Time {
+	if file.TakenAt != nil {
+		return *file.TakenAt
+	}
+	return file.CreatedAt
+}
+
+// alreadyCompressed types gain nothing from deflate
+func alreadyCompressed(mimeType string) bool {
+	switch {
+	case strings.HasPrefix(mimeType, "image/") && !strings.HasPrefix(mimeType, "image/bmp") && !strings.HasPrefix(mimeType, "image/tiff"):
+		return true
+	case strings.HasPrefix(mimeType, "video/"), strings.HasPrefix(mimeType, "audio/"):
+		return true
+	case strings.HasPrefix(mimeType, "application/zip"), strings.HasPrefix(mimeType, "application/vnd.openxmlformats-officedocument."):
+		return true
+	}
+	return false
+}
@@ -0,0 +1,331 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/ireuven89/routewise/internal/models"
+	"github.com/ireuven89/routewise/services"
+)
+
+// streamCheckStorage records how much of the archive was already written
+// each time a file is opened
+type streamCheckStorage struct {
+	services.Storage
+	out       *bytes.Buffer
+	writtenAt []int
+}
+
+func (s *streamCheckStorage) DownloadFile(ctx context.Context, key string) (io.ReadCloser, error) {
+	s.writtenAt = append(s.writtenAt, s.out.Len())
+	return s.Storage.DownloadFile(ctx, key)
+}
+
+// failingWriter accepts limit bytes and then fails, like a dropped client
+type failingWriter struct {
+	limit int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if len(p) > w.limit {
+		n := w.limit
+		w.limit = 0
+		return n, errors.New("connection reset")
+	}
+	w.limit -= len(p)
+	return len(p), nil
+}
+
+func archiveTestFiles(t *testing.T, storage services.Storage) []*models.ProjectFile {
+	ctx := context.Background()
+	uploaded := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+	taken := time.Date(2026, 2, 27, 8, 30, 0, 0, time.UTC)
+
+	files := []*models.ProjectFile{
+		{ID: 1, FileType: "photo", FileCategory: "progress", OriginalFileName: "kitchen.jpg", MimeType: "image/jpeg", S3Key: "p/1.jpg", CreatedAt: uploaded, TakenAt: &taken},
+		{ID: 2, FileType: "photo", FileCategory: "progress", OriginalFileName: "kitchen.jpg", MimeType: "image/jpeg", S3Key: "p/2.jpg", CreatedAt: uploaded},
+		{ID: 3, FileType: "document", FileCategory: "", OriginalFileName: "../../etc/passwd", MimeType: "text/plain", S3Key: "p/3.txt", CreatedAt: uploaded, Description: "=HYPERLINK(\"x\")"},
+		{ID: 4, FileType: "document", FileCategory: "contract", OriginalFileName: "contract.pdf", MimeType: "application/pdf", S3Key: "p/gone.pdf", CreatedAt: uploaded},
+	}
+	contents := map[string]string{
+		// Larger than the ZIP writer's buffer, so each file reaches the output
+		"p/1.jpg": strings.Repeat("first photo ", 1000),
+		"p/2.jpg": strings.Repeat("second photo ", 1000),
+		"p/3.txt": strings.Repeat("compressible text ", 100),
+	}
+	for key, content := range contents {
+		if err := storage.UploadFile(ctx, strings.NewReader(content), key, "application/octet-stream"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return files
+}
+
+func TestWriteArchive(t *testing.T) {
+	memory := services.NewMemoryStorage(services.NewURLSigner("http://localhost", []byte("secret")))
+	files := archiveTestFiles(t, memory)
+
+	var out bytes.Buffer
+	storage := &streamCheckStorage{Storage: memory, out: &out}
+	h := &FileHandler{storage: storage}
+	if err := h.writeArchive(context.Background(), &out, files); err != nil {
+		t.Fatalf("writeArchive() error = %v", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(out.Bytes()), int64(out.Len()))
+	if err != nil {
+		t.Fatalf("archive is not a valid ZIP: %v", err)
+	}
+
+	entries := make(map[string]*zip.File)
+	var names []string
+	for _, f := range zr.File {
+		entries[f.Name] = f
+		names = append(names, f.Name)
+	}
+
+	wantNames := []string{
+		"photo/progress/kitchen.jpg",
+		"photo/progress/kitchen (2).jpg",
+		"document/uncategorized/_.._etc_passwd",
+		archiveManifest,
+	}
+	if strings.Join(names, "|") != strings.Join(wantNames, "|") {
+		t.Fatalf("entries = %q, want %q", names, wantNames)
+	}
+
+	tests := []struct {
+		name       string
+		want       string
+		wantMethod uint16
+		wantDate   time.Time
+	}{
+		{"photo/progress/kitchen.jpg", strings.Repeat("first photo ", 1000), zip.Store, *files[0].TakenAt},
+		{"photo/progress/kitchen (2).jpg", strings.Repeat("second photo ", 1000), zip.Store, files[1].CreatedAt},
+		{"document/uncategorized/_.._etc_passwd", strings.Repeat("compressible text ", 100), zip.Deflate, files[2].CreatedAt},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := entries[tt.name]
+			if f.Method != tt.wantMethod {
+				t.Errorf("Method = %d, want %d", f.Method, tt.wantMethod)
+			}
+			if !f.Modified.Equal(tt.wantDate) {
+				t.Errorf("Modified = %v, want %v", f.Modified, tt.wantDate)
+			}
+			rc, err := f.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rc.Close()
+			data, err := io.ReadAll(rc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("content = %q, want %q", data, tt.want)
+			}
+		})
+	}
+
+	rc, err := entries[archiveManifest].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	rows, err := csv.NewReader(rc).ReadAll()
+	if err != nil {
+		t.Fatalf("manifest is not valid CSV: %v", err)
+	}
+	if len(rows) != len(files)+1 {
+		t.Fatalf("manifest has %d rows, want a header and %d files", len(rows), len(files))
+	}
+	if got := rows[1][7]; got != "2026-02-27T08:30:00Z" {
+		t.Errorf("taken_at = %q, want the photo's date", got)
+	}
+	if got := rows[3][8]; got != `'=HYPERLINK("x")` {
+		t.Errorf("description = %q, want the formula escaped", got)
+	}
+	for i, want := range []string{"ok", "ok", "ok", "missing"} {
+		if got := rows[i+1][9]; got != want {
+			t.Errorf("status of row %d = %q, want %q", i+1, got, want)
+		}
+	}
+
+	// Each photo reached the output before the next file was read
+	photos := len(strings.Repeat("first photo ", 1000))
+	if len(storage.writtenAt) != len(files) || storage.writtenAt[1] < photos || storage.writtenAt[2] < 2*photos {
+		t.Errorf("files opened with %v bytes written, want the earlier photos out first", storage.writtenAt)
+	}
+}
+
+// brokenStorage fails partway through reading one key
+type brokenStorage struct {
+	services.Storage
+	broken string
+}
+
+func (s *brokenStorage) DownloadFile(ctx context.Context, key string) (io.ReadCloser, error) {
+	if key == s.broken {
+		return io.NopCloser(io.MultiReader(strings.NewReader("partial"), iotest.ErrReader(errors.New("read timeout")))), nil
+	}
+	return s.Storage.DownloadFile(ctx, key)
+}
+
+func TestWriteArchiveReadError(t *testing.T) {
+	memory := services.NewMemoryStorage(services.NewURLSigner("http://localhost", []byte("secret")))
+	files := archiveTestFiles(t, memory)
+	h := &FileHandler{storage: &brokenStorage{Storage: memory, broken: "p/1.jpg"}}
+
+	var out bytes.Buffer
+	if err := h.writeArchive(context.Background(), &out, files); err != nil {
+		t.Fatalf("writeArchive() error = %v, want the archive finished", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(out.Bytes()), int64(out.Len()))
+	if err != nil {
+		t.Fatalf("archive is not a valid ZIP: %v", err)
+	}
+	manifest, err := zr.Open(archiveManifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer manifest.Close()
+	rows, err := csv.NewReader(manifest).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var statuses []string
+	for _, row := range rows[1:] {
+		statuses = append(statuses, row[9])
+	}
+	if want := []string{"missing", "ok", "ok", "missing"}; strings.Join(statuses, ",") != strings.Join(want, ",") {
+		t.Errorf("statuses = %v, want %v", statuses, want)
+	}
+}
+
+func TestWriteArchiveStops(t *testing.T) {
+	memory := services.NewMemoryStorage(services.NewURLSigner("http://localhost", []byte("secret")))
+	files := archiveTestFiles(t, memory)
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name       string
+		ctx        context.Context
+		w          io.Writer
+		wantOpened int
+	}{
+		{"client disconnects", context.Background(), &failingWriter{limit: 10}, 1},
+		{"request cancelled", cancelled, io.Discard, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := &streamCheckStorage{Storage: memory, out: &bytes.Buffer{}}
+			h := &FileHandler{storage: storage}
+			if err := h.writeArchive(tt.ctx, tt.w, files); err == nil {
+				t.Errorf("writeArchive() error = nil, want the archive cut short")
+			}
+			if len(storage.writtenAt) != tt.wantOpened {
+				t.Errorf("opened %d files, want %d", len(storage.writtenAt), tt.wantOpened)
+			}
+		})
+	}
+}
+
+func TestSelectArchiveFiles(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2026, 3, d, 12, 0, 0, 0, time.UTC) }
+	taken := day(1)
+	files := []*models.ProjectFile{
+		{ID: 1, FileCategory: "progress", CreatedAt: day(5), TakenAt: &taken},
+		{ID: 2, FileCategory: "progress", CreatedAt: day(3)},
+		{ID: 3, FileCategory: "contract", CreatedAt: day(4)},
+	}
+
+	tests := []struct {
+		name     string
+		category string
+		from, to time.Time
+		want     []uint
+	}{
+		{"everything", "", time.Time{}, time.Time{}, []uint{1, 2, 3}},
+		{"category", "progress", time.Time{}, time.Time{}, []uint{1, 2}},
+		{"photos by the day taken", "", day(1).Truncate(24 * time.Hour), day(2).Truncate(24 * time.Hour), []uint{1}},
+		{"to is exclusive", "", time.Time{}, day(3), []uint{1}},
+		{"from is inclusive", "", day(3), time.Time{}, []uint{2, 3}},
+		{"category and dates", "contract", day(2), day(5), []uint{3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []uint
+			for _, file := range selectArchiveFiles(files, tt.category, tt.from, tt.to) {
+				got = append(got, file.ID)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("selectArchiveFiles() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("selectArchiveFiles() = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestArchivePath(t *testing.T) {
+	tests := []struct {
+		name string
+		file models.ProjectFile
+		want string
+	}{
+		{"plain", models.ProjectFile{FileType: "photo", FileCategory: "progress", OriginalFileName: "a.jpg"}, "photo/progress/a.jpg"},
+		{"no category", models.ProjectFile{FileType: "document", OriginalFileName: "a.pdf"}, "document/uncategorized/a.pdf"},
+		{"stored name when the original is unknown", models.ProjectFile{FileType: "photo", FileCategory: "x", FileName: "1_a.jpg"}, "photo/x/1_a.jpg"},
+		{"traversal", models.ProjectFile{FileType: "photo", FileCategory: "../..", OriginalFileName: "../../a.jpg"}, "photo/_../_.._a.jpg"},
+		{"windows separators", models.ProjectFile{FileType: "photo", FileCategory: "x", OriginalFileName: `C:\temp\a.jpg`}, "photo/x/C:_temp_a.jpg"},
+		{"hidden file", models.ProjectFile{FileType: "photo", FileCategory: "x", OriginalFileName: ".htaccess"}, "photo/x/htaccess"},
+		{"control characters", models.ProjectFile{FileType: "photo", FileCategory: "x", OriginalFileName: "a\nb.jpg"}, "photo/x/a_b.jpg"},
+		{"blank", models.ProjectFile{FileType: "photo", FileCategory: " ", OriginalFileName: "..."}, "photo/_/_"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := archivePath(&tt.file); got != tt.want {
+				t.Errorf("archivePath() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUniqueArchiveName(t *testing.T) {
+	used := make(map[string]bool)
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"photo/x/a.jpg", "photo/x/a.jpg"},
+		{"photo/x/a.jpg", "photo/x/a (2).jpg"},
+		{"photo/x/a.jpg", "photo/x/a (3).jpg"},
+		{"photo/x/a (2).jpg", "photo/x/a (2) (2).jpg"},
+		{"photo/x/README", "photo/x/README"},
+		{"photo/x/README", "photo/x/README (2)"},
+	}
+
+	for _, tt := range tests {
+		if got := uniqueArchiveName(used, tt.in); got != tt.want {
+			t.Errorf("uniqueArchiveName(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
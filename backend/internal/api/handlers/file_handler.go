@@ -1,38 +1,63 @@
 package handlers
 
 import (
+	"bytes"
 	"context"
-	"log"
-	"os"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/getsentry/sentry-go"
 	"github.com/gin-gonic/gin"
+	"github.com/ireuven89/routewise/internal/documents"
+	"github.com/ireuven89/routewise/internal/events"
 	"github.com/ireuven89/routewise/internal/models"
 	"github.com/ireuven89/routewise/internal/repository"
 	"github.com/ireuven89/routewise/services"
 )
 
+const (
+	maxSignatureBytes     = 1 << 20
+	maxSignatureClockSkew = 5 * time.Minute
+
+	// Allowance for the boundaries, part headers and form fields sent along
+	// with an uploaded file
+	formOverhead = 1 << 20
+)
+
 type FileHandler struct {
 	fileRepo    *repository.FileRepository
 	projectRepo *repository.JobRepository
-	s3Service   *services.S3Service
+	uploadRepo  *repository.UploadRepository
+	usageRepo   *repository.UsageRepository
+	storage     services.Storage
+	scanner     services.Scanner // nil when uploads are not scanned
+	events      events.Publisher
+	// Deleted files can be restored for this long before they are purged
+	trashRetention time.Duration
 }
 
-func NewFileHandler(fileRepo *repository.FileRepository, projectRepo *repository.JobRepository, s3Service *services.S3Service) *FileHandler {
+func NewFileHandler(fileRepo *repository.FileRepository, projectRepo *repository.JobRepository, uploadRepo *repository.UploadRepository, usageRepo *repository.UsageRepository, storage services.Storage, scanner services.Scanner, publisher events.Publisher, trashRetention time.Duration) *FileHandler {
 	return &FileHandler{
-		fileRepo:    fileRepo,
-		projectRepo: projectRepo,
-		s3Service:   s3Service,
+		fileRepo:       fileRepo,
+		projectRepo:    projectRepo,
+		uploadRepo:     uploadRepo,
+		usageRepo:      usageRepo,
+		storage:        storage,
+		scanner:        scanner,
+		events:         publisher,
+		trashRetention: trashRetention,
 	}
 }
 
 func (h *FileHandler) Upload(c *gin.Context) {
 	projectID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
 	orgID := c.GetUint("organization_id")
-	userID := c.GetUint("organization_user_id")
-	userType := c.GetString("user_type")
 
 	// Verify project belongs to org
 	project, err := h.projectRepo.FindByID(uint(projectID), orgID)
@@ -41,9 +66,24 @@ func (h *FileHandler) Upload(c *gin.Context) {
 		return
 	}
 
+	policy, err := h.uploadRepo.GetPolicy(orgID)
+	if err != nil {
+		sentry.CaptureException(err)
+		c.JSON(500, gin.H{"error": "Failed to fetch upload policy"})
+		return
+	}
+
+	// Refuse oversized bodies while they are read, before anything is spooled
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, policy.MaxFileSize+formOverhead)
+
 	// Get uploaded file
 	file, header, err := c.Request.FormFile("file")
 	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(413, gin.H{"error": fmt.Sprintf("Files are limited to %s", formatBytes(policy.MaxFileSize))})
+			return
+		}
 		c.JSON(400, gin.H{"error": "No file provided"})
 		return
 	}
@@ -53,44 +93,61 @@ func (h *FileHandler) Upload(c *gin.Context) {
 	category := c.PostForm("category")       // Optional: 'progress', 'contract', etc.
 	description := c.PostForm("description") // Optional
 
-	// Detect file type from MIME
-	mimeType := header.Header.Get("Content-Type")
-	fileType := determineFileType(mimeType)
+	// Optional: the file this is a new version of
+	var replaces *uint
+	if v := c.PostForm("replaces_file_id"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "Invalid replaces_file_id"})
+			return
+		}
+		replaces = new(uint)
+		*replaces = uint(id)
+	}
 
-	if fileType == "" {
-		c.JSON(400, gin.H{"error": "Unsupported file type"})
+	// The content decides the type; the client's Content-Type is not trusted
+	mimeType, err := sniffType(file)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Failed to read file"})
+		return
+	}
+	if status, msg := checkUpload(policy, mimeType, category, header.Size); status != 0 {
+		c.JSON(status, gin.H{"error": msg})
+		return
+	}
+	if !h.checkQuota(c, header.Size) {
 		return
 	}
 
-	// Generate S3 key
-	s3Key := services.GenerateS3Key(orgID, uint(projectID), fileType, header.Filename)
-
-	// Upload to S3
-	ctx := context.Background()
-	err = h.s3Service.UploadFile(ctx, file, s3Key, mimeType)
+	ctx := c.Request.Context()
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		c.JSON(500, gin.H{"error": "Failed to read file"})
+		return
+	}
+	scanStatus, scanSignature, err := h.scan(ctx, file)
 	if err != nil {
-		c.JSON(500, gin.H{"error": "Failed to upload file"})
+		sentry.CaptureException(err)
+		c.JSON(503, gin.H{"error": "Virus scanning is unavailable, try again later"})
 		return
 	}
-
-	var uploadedByUser, uploadedByWorker *uint
-
-	if userType == "worker" {
-		uploadedByWorker = &userID
-		log.Printf("  - Setting uploaded_by_worker: %d", userID)
-	} else {
-		uploadedByUser = &userID
-		log.Printf("  - Setting uploaded_by_user: %d", userID)
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		c.JSON(500, gin.H{"error": "Failed to read file"})
+		return
 	}
 
-	log.Printf("  - uploadedByUser: %v", uploadedByUser)
-	log.Printf("  - uploadedByWorker: %v", uploadedByWorker)
+	fileType := determineFileType(mimeType)
+	previous, err := h.previousVersion(uint(projectID), replaces, fileType, header.Filename)
+	if err != nil {
+		if err.Error() == "file not found" {
+			c.JSON(400, gin.H{"error": "File to replace not found"})
+			return
+		}
+		c.JSON(500, gin.H{"error": "Failed to fetch files"})
+		return
+	}
 
-	// Save to database
 	projectFile := &models.ProjectFile{
 		ProjectID:        uint(projectID),
-		UploadedByUser:   uploadedByUser,
-		UploadedByWorker: uploadedByWorker,
 		FileType:         fileType,
 		FileCategory:     category,
 		FileName:         header.Filename,
@@ -98,32 +155,185 @@ func (h *FileHandler) Upload(c *gin.Context) {
 		MimeType:         mimeType,
 		FileSize:         header.Size,
 		FileExtension:    strings.TrimPrefix(filepath.Ext(header.Filename), "."),
-		S3Bucket:         os.Getenv("S3_BUCKET_NAME"),
-		S3Key:            s3Key,
 		Description:      description,
+		ScanStatus:       scanStatus,
+		ScanSignature:    scanSignature,
+	}
+	if previous != nil {
+		projectFile.DocumentID = previous.DocumentID
+	}
+	if !h.store(c, projectFile, file) {
+		return
 	}
 
+	if projectFile.ScanStatus == models.ScanQuarantined {
+		c.JSON(422, gin.H{
+			"error": "File failed the virus scan and was quarantined",
+			"file":  projectFile,
+		})
+		return
+	}
+
+	c.JSON(201, gin.H{
+		"message": "File uploaded successfully",
+		"file":    projectFile,
+	})
+}
+
+// store uploads the content to storage and records it in project_files. The
+// caller fills in the file details; the uploader and storage key are set here.
+func (h *FileHandler) store(c *gin.Context, projectFile *models.ProjectFile, content io.Reader) bool {
+	orgID := c.GetUint("organization_id")
+
+	// Checked again right before writing, as other uploads may have used the
+	// quota meanwhile. Signatures are never turned away.
+	if projectFile.FileType != models.FileTypeSignature && !h.checkQuota(c, projectFile.FileSize) {
+		return false
+	}
+
+	// Generate S3 key
+	s3Key := services.GenerateS3Key(orgID, projectFile.ProjectID, projectFile.FileType, projectFile.FileName)
+
+	// Upload to storage
+	ctx := context.Background()
+	err := h.storage.UploadFile(ctx, content, s3Key, projectFile.MimeType)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to upload file"})
+		return false
+	}
+
+	uploadedByUser, uploadedByWorker := uploader(c)
+
+	// Save to database
+	projectFile.UploadedByUser = uploadedByUser
+	projectFile.UploadedByWorker = uploadedByWorker
+	projectFile.S3Bucket = h.storage.Bucket()
+	projectFile.S3Key = s3Key
+
 	err = h.fileRepo.Create(projectFile)
 	if err != nil {
-		h.s3Service.DeleteFile(ctx, s3Key) // Rollback S3 upload
+		h.storage.DeleteFile(ctx, s3Key) // Rollback upload
+		if errors.Is(err, models.ErrStorageQuotaExceeded) {
+			h.quotaExceeded(c, projectFile.FileSize)
+			return false
+		}
 		c.JSON(500, gin.H{"error": "Failed to save file"})
+		return false
+	}
+
+	if projectFile.ScanStatus == models.ScanQuarantined {
+		h.events.Publish(orgID, events.FileQuarantined, projectFile)
+	} else {
+		h.events.Publish(orgID, events.FileUploaded, projectFile)
+	}
+	return true
+}
+
+// uploader returns the caller as either an organization user or a worker
+func uploader(c *gin.Context) (user *uint, worker *uint) {
+	userID := c.GetUint("organization_user_id")
+	if c.GetString("user_type") == "worker" {
+		return nil, &userID
+	}
+	return &userID, nil
+}
+
+// UploadSignature stores the customer's sign-off for a job. The worker app
+// sends a PNG or SVG image with the signer's name and, optionally, when they
+// signed (RFC 3339, defaults to now).
+func (h *FileHandler) UploadSignature(c *gin.Context) {
+	jobID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid job ID"})
+		return
+	}
+	orgID := c.GetUint("organization_id")
+
+	if _, err := h.projectRepo.FindByID(uint(jobID), orgID); err != nil {
+		c.JSON(404, gin.H{"error": "Job not found"})
+		return
+	}
+
+	signerName := strings.TrimSpace(c.PostForm("signer_name"))
+	if signerName == "" {
+		c.JSON(400, gin.H{"error": "signer_name is required"})
+		return
+	}
+
+	signedAt := time.Now()
+	if v := c.PostForm("signed_at"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "Invalid signed_at, expected RFC 3339"})
+			return
+		}
+		// Allow for a device clock that runs slightly ahead
+		if t.After(signedAt.Add(maxSignatureClockSkew)) {
+			c.JSON(400, gin.H{"error": "signed_at cannot be in the future"})
+			return
+		}
+		signedAt = t
+	}
+
+	file, header, err := c.Request.FormFile("signature")
+	if err != nil {
+		c.JSON(400, gin.H{"error": "No signature provided"})
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxSignatureBytes+1))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Failed to read signature"})
+		return
+	}
+	if len(data) > maxSignatureBytes {
+		c.JSON(400, gin.H{"error": "Signature is limited to 1 MB"})
+		return
+	}
+
+	// The content decides the type; the client's Content-Type is not trusted
+	mimeType, extension := "image/png", "png"
+	if http.DetectContentType(data) != mimeType {
+		mimeType, extension = documents.SVGMimeType, "svg"
+	}
+	if err := documents.CheckImage(documents.Image{Data: data, MimeType: mimeType}); err != nil {
+		c.JSON(400, gin.H{"error": "Signature must be a PNG or a simple SVG image"})
+		return
+	}
+
+	utc := signedAt.UTC()
+	projectFile := &models.ProjectFile{
+		ProjectID:        uint(jobID),
+		FileType:         models.FileTypeSignature,
+		FileName:         "signature." + extension,
+		OriginalFileName: header.Filename,
+		MimeType:         mimeType,
+		FileSize:         int64(len(data)),
+		FileExtension:    extension,
+		TakenAt:          &utc,
+		SignerName:       signerName,
+	}
+	if !h.store(c, projectFile, bytes.NewReader(data)) {
 		return
 	}
 
 	c.JSON(201, gin.H{
-		"message": "File uploaded successfully",
+		"message": "Signature saved successfully",
 		"file":    projectFile,
 	})
 }
 
+// determineFileType files a type the upload policy allowed
 func determineFileType(mimeType string) string {
-	if strings.HasPrefix(mimeType, "image/") {
-		return "photo"
+	switch {
+	case strings.HasPrefix(mimeType, "image/"):
+		return models.FileTypePhoto
+	case strings.HasPrefix(mimeType, "video/"):
+		return models.FileTypeVideo
+	default:
+		return models.FileTypeDocument
 	}
-	if mimeType == "application/pdf" || strings.HasPrefix(mimeType, "application/") {
-		return "document"
-	}
-	return ""
 }
 
 func (h *FileHandler) ListFiles(c *gin.Context) {
@@ -156,10 +366,7 @@ func (h *FileHandler) ListFiles(c *gin.Context) {
 	// Generate presigned URLs
 	ctx := context.Background()
 	for _, file := range files {
-		url, err := h.s3Service.GetSignedURL(ctx, file.S3Key)
-		if err == nil {
-			file.S3URL = url
-		}
+		h.signURLs(ctx, file)
 	}
 
 	c.JSON(200, gin.H{
@@ -172,9 +379,9 @@ func (h *FileHandler) GetFile(c *gin.Context) {
 	fileID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
 	orgID := c.GetUint("organization_id")
 
-	// Get file
+	// Get file; trashed files are only reachable through the trash
 	file, err := h.fileRepo.FindByID(uint(fileID))
-	if err != nil {
+	if err != nil || file.DeletedAt != nil {
 		c.JSON(404, gin.H{"error": "File not found"})
 		return
 	}
@@ -186,16 +393,19 @@ func (h *FileHandler) GetFile(c *gin.Context) {
 		return
 	}
 
-	// Generate presigned URL
+	// Quarantined files are described but never served
+	if file.ScanStatus == models.ScanQuarantined {
+		c.JSON(200, gin.H{"file": file})
+		return
+	}
+
+	// Generate presigned URLs
 	ctx := context.Background()
-	url, err := h.s3Service.GetSignedURL(ctx, file.S3Key)
-	if err != nil {
+	if !h.signURLs(ctx, file) {
 		c.JSON(500, gin.H{"error": "Failed to generate download URL"})
 		return
 	}
 
-	file.S3URL = url
-
 	c.JSON(200, gin.H{"file": file})
 }
 
@@ -217,20 +427,37 @@ func (h *FileHandler) DeleteFile(c *gin.Context) {
 		return
 	}
 
-	// Delete from S3
-	ctx := context.Background()
-	err = h.s3Service.DeleteFile(ctx, file.S3Key)
-	if err != nil {
-		c.JSON(500, gin.H{"error": "Failed to delete from storage"})
+	// Objects stay in storage until the trash is purged
+	if err := h.fileRepo.Trash(file); err != nil {
+		if err.Error() == "file not found" {
+			c.JSON(409, gin.H{"error": "File is already in the trash"})
+			return
+		}
+		c.JSON(500, gin.H{"error": "Failed to delete file"})
 		return
 	}
 
-	// Delete from database
-	err = h.fileRepo.Delete(uint(fileID))
-	if err != nil {
-		c.JSON(500, gin.H{"error": "Failed to delete file record"})
-		return
+	c.JSON(200, gin.H{
+		"message":  "File moved to trash",
+		"file":     file,
+		"purge_at": file.DeletedAt.Add(h.trashRetention),
+	})
+}
+
+// signURLs sets the presigned URLs of the original and its renditions. It
+// reports whether the original could be signed.
+func (h *FileHandler) signURLs(ctx context.Context, file *models.ProjectFile) bool {
+	if file.ThumbnailS3Key != "" {
+		file.ThumbnailURL, _ = h.storage.GetSignedURL(ctx, file.ThumbnailS3Key)
+	}
+	if file.MediumS3Key != "" {
+		file.MediumURL, _ = h.storage.GetSignedURL(ctx, file.MediumS3Key)
 	}
 
-	c.JSON(200, gin.H{"message": "File deleted successfully"})
+	url, err := h.storage.GetSignedURL(ctx, file.S3Key)
+	if err != nil {
+		return false
+	}
+	file.S3URL = url
+	return true
 }
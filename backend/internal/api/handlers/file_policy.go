@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/getsentry/sentry-go"
+	"github.com/gin-gonic/gin"
+	"github.com/ireuven89/routewise/internal/models"
+	"github.com/ireuven89/routewise/services"
+)
+
+// sniffBytes is how much of a file is read to detect its type
+const sniffBytes = 3072
+
+// blockedTypes run code in a browser or on a device. They are refused
+// whatever the organization's policy says.
+var blockedTypes = []string{
+	"application/vnd.microsoft.portable-executable",
+	"application/x-elf",
+	"application/x-mach-binary",
+	"application/x-msi",
+	"application/vnd.android.package-archive",
+	"application/x-ms-shortcut",
+	"application/jar",
+	"application/x-java-applet",
+	"application/wasm",
+	"application/x-shockwave-flash",
+	"text/html",
+	"text/javascript",
+	"image/svg+xml",
+	"text/x-php",
+	"text/x-python",
+	"text/x-perl",
+	"text/x-lua",
+	"text/x-tcl",
+}
+
+type UpdateUploadPolicyRequest struct {
+	AllowedTypes      []string `json:"allowed_types"`
+	AllowedCategories []string `json:"allowed_categories"`
+	MaxFileSize       *int64   `json:"max_file_size"`
+}
+
+func (h *FileHandler) GetUploadPolicy(c *gin.Context) {
+	policy, err := h.uploadRepo.GetPolicy(c.GetUint("organization_id"))
+	if err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch upload policy"})
+		return
+	}
+
+	c.JSON(http.StatusOK, policy)
+}
+
+func (h *FileHandler) UpdateUploadPolicy(c *gin.Context) {
+	if !rejectWorkers(c, "Workers cannot change the upload policy") {
+		return
+	}
+	organizationID := c.GetUint("organization_id")
+
+	var req UpdateUploadPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	policy, err := h.uploadRepo.GetPolicy(organizationID)
+	if err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch upload policy"})
+		return
+	}
+
+	if req.AllowedTypes != nil {
+		types := []string{}
+		for _, t := range req.AllowedTypes {
+			t = strings.ToLower(strings.TrimSpace(t))
+			family, subtype, ok := strings.Cut(t, "/")
+			if !ok || family == "" || family == "*" || subtype == "" || strings.ContainsAny(t, " ;") {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid MIME type %q", t)})
+				return
+			}
+			if subtype != "*" && mimetype.EqualsAny(t, blockedTypes...) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s files cannot be allowed", t)})
+				return
+			}
+			types = append(types, t)
+		}
+		policy.AllowedTypes = types
+	}
+	if req.AllowedCategories != nil {
+		categories := []string{}
+		for _, category := range req.AllowedCategories {
+			if category = strings.TrimSpace(category); category != "" {
+				categories = append(categories, category)
+			}
+		}
+		policy.AllowedCategories = categories
+	}
+	if req.MaxFileSize != nil {
+		if *req.MaxFileSize < 1 || *req.MaxFileSize > maxDirectUploadBytes {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "max_file_size must be between 1 byte and 5 GB"})
+			return
+		}
+		policy.MaxFileSize = *req.MaxFileSize
+	}
+
+	if err := h.uploadRepo.SavePolicy(policy); err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save upload policy"})
+		return
+	}
+
+	c.JSON(http.StatusOK, policy)
+}
+
+// ListQuarantined returns files held back by the virus scan, for review
+func (h *FileHandler) ListQuarantined(c *gin.Context) {
+	if !rejectWorkers(c, "Workers cannot review quarantined files") {
+		return
+	}
+
+	files, err := h.fileRepo.FindQuarantined(c.GetUint("organization_id"))
+	if err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch files"})
+		return
+	}
+	if files == nil {
+		files = []*models.ProjectFile{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"files": files, "count": len(files)})
+}
+
+// sniffType detects the MIME type from the start of the content
+func sniffType(content io.Reader) (string, error) {
+	head, err := io.ReadAll(io.LimitReader(content, sniffBytes))
+	if err != nil {
+		return "", err
+	}
+	return mimetype.Detect(head).String(), nil
+}
+
+// checkUpload applies the policy to a file's type, category and size. It
+// returns the status and message to respond with, or 0 if the file may be
+// stored.
+func checkUpload(policy *models.UploadPolicy, mimeType, category string, size int64) (int, string) {
+	if size > policy.MaxFileSize {
+		return http.StatusRequestEntityTooLarge, fmt.Sprintf("Files are limited to %s", formatBytes(policy.MaxFileSize))
+	}
+	if !policy.AllowsCategory(category) {
+		return http.StatusBadRequest, fmt.Sprintf("Category %q is not allowed", category)
+	}
+	if isBlockedType(mimeType) || !policy.AllowsType(mimeType) {
+		mediaType, _, _ := strings.Cut(mimeType, ";")
+		return http.StatusUnsupportedMediaType, fmt.Sprintf("%s files are not allowed", mediaType)
+	}
+	return 0, ""
+}
+
+// isBlockedType also refuses types derived from a blocked one, such as
+// shared libraries from ELF
+func isBlockedType(mimeType string) bool {
+	mimeType, _, _ = strings.Cut(mimeType, ";")
+	for m := mimetype.Lookup(mimeType); m != nil; m = m.Parent() {
+		if mimetype.EqualsAny(m.String(), blockedTypes...) {
+			return true
+		}
+	}
+	return mimetype.EqualsAny(mimeType, blockedTypes...)
+}
+
+// scan runs the configured scanner, if any, over the content and returns the
+// file's scan status and what was found. Content too large for the scanner
+// is stored unscanned.
+func (h *FileHandler) scan(ctx context.Context, content io.Reader) (status, signature string, err error) {
+	if h.scanner == nil {
+		return "", "", nil
+	}
+
+	result, err := h.scanner.Scan(ctx, content)
+	if errors.Is(err, services.ErrTooLargeToScan) {
+		return models.ScanSkipped, "", nil
+	}
+	if err != nil {
+		return "", "", err
+	}
+	if result.Infected {
+		return models.ScanQuarantined, result.Signature, nil
+	}
+	return models.ScanClean, "", nil
+}
+
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<30 && n%(1<<30) == 0:
+		return fmt.Sprintf("%d GB", n>>30)
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1f GB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%d MB", n>>20)
+	case n >= 1<<10:
+		return fmt.Sprintf("%d KB", n>>10)
+	default:
+		return fmt.Sprintf("%d bytes", n)
+	}
+}
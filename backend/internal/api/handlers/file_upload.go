@@ -0,0 +1,394 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/gin-gonic/gin"
+	"github.com/ireuven89/routewise/internal/events"
+	"github.com/ireuven89/routewise/internal/models"
+	"github.com/ireuven89/routewise/internal/uploads"
+	"github.com/ireuven89/routewise/services"
+)
+
+const (
+	// S3 takes at most 5 GB in a single PUT
+	maxDirectUploadBytes = 5 << 30
+	// Larger files are uploaded in parts where the storage supports it
+	multipartThreshold = 64 << 20
+	uploadPartSize     = 16 << 20
+	// Slots and their upload URLs expire after this; the sweeper removes them
+	uploadSlotTTL = 2 * time.Hour
+)
+
+type RequestUploadRequest struct {
+	FileName    string     `json:"file_name" binding:"required"`
+	MimeType    string     `json:"mime_type" binding:"required"`
+	FileSize    int64      `json:"file_size" binding:"required,min=1"`
+	Category    string     `json:"category"`
+	Description string     `json:"description"`
+	TakenAt     *time.Time `json:"taken_at"`
+	// Optional: the file this is a new version of
+	ReplacesFileID *uint `json:"replaces_file_id"`
+}
+
+// UploadSlotResponse has either one request for the whole file or one per
+// part. For parts the client keeps each response's ETag header and sends
+// them all when completing.
+type UploadSlotResponse struct {
+	Upload  *models.FileUpload         `json:"upload"`
+	Request *services.PresignedRequest `json:"request,omitempty"`
+	Parts   []UploadPartRequest        `json:"parts,omitempty"`
+}
+
+type UploadPartRequest struct {
+	PartNumber int32                      `json:"part_number"`
+	Size       int64                      `json:"size"`
+	Request    *services.PresignedRequest `json:"request"`
+}
+
+type CompleteUploadRequest struct {
+	Parts []services.UploadedPart `json:"parts" binding:"dive"`
+}
+
+// RequestUpload hands out a slot for uploading a file straight to storage.
+// The file is recorded when the client confirms it with CompleteUpload.
+func (h *FileHandler) RequestUpload(c *gin.Context) {
+	projectID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+		return
+	}
+	orgID := c.GetUint("organization_id")
+
+	if _, err := h.projectRepo.FindByID(uint(projectID), orgID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+		return
+	}
+
+	var req RequestUploadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.FileSize > maxDirectUploadBytes {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Files are limited to 5 GB"})
+		return
+	}
+
+	// The declared type is checked now to fail early; the content is sniffed
+	// and checked again on completion
+	policy, err := h.uploadRepo.GetPolicy(orgID)
+	if err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch upload policy"})
+		return
+	}
+	if status, msg := checkUpload(policy, req.MimeType, req.Category, req.FileSize); status != 0 {
+		c.JSON(status, gin.H{"error": msg})
+		return
+	}
+	if !h.checkQuota(c, req.FileSize) {
+		return
+	}
+	fileType := determineFileType(req.MimeType)
+
+	fileName := filepath.Base(req.FileName)
+	if req.ReplacesFileID != nil {
+		if _, err := h.previousVersion(uint(projectID), req.ReplacesFileID, fileType, fileName); err != nil {
+			if err.Error() == "file not found" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "File to replace not found"})
+				return
+			}
+			sentry.CaptureException(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch files"})
+			return
+		}
+	}
+
+	upload := &models.FileUpload{
+		OrganizationID: orgID,
+		ProjectID:      uint(projectID),
+		FileType:       fileType,
+		FileCategory:   req.Category,
+		FileName:       fileName,
+		MimeType:       req.MimeType,
+		FileSize:       req.FileSize,
+		FileExtension:  strings.TrimPrefix(filepath.Ext(fileName), "."),
+		Description:    req.Description,
+		TakenAt:        req.TakenAt,
+		ReplacesFileID: req.ReplacesFileID,
+		S3Key:          services.GenerateS3Key(orgID, uint(projectID), fileType, fileName),
+		ExpiresAt:      time.Now().Add(uploadSlotTTL),
+	}
+	upload.UploadedByUser, upload.UploadedByWorker = uploader(c)
+
+	ctx := c.Request.Context()
+	response := &UploadSlotResponse{Upload: upload}
+
+	multipart, ok := h.storage.(services.MultipartUploader)
+	if ok && req.FileSize > multipartThreshold {
+		upload.MultipartID, err = multipart.CreateMultipartUpload(ctx, upload.S3Key, upload.MimeType)
+		if err == nil {
+			upload.PartSize = uploadPartSize
+			response.Parts, err = presignParts(ctx, multipart, upload)
+		}
+	} else {
+		response.Request, err = h.storage.PresignUpload(ctx, upload.S3Key, upload.MimeType, upload.FileSize, upload.ExpiresAt)
+	}
+
+	if err == nil {
+		err = h.uploadRepo.Create(upload)
+	}
+	if err != nil {
+		if upload.Multipart() {
+			uploads.Discard(ctx, h.storage, upload)
+		}
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to prepare upload"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, response)
+}
+
+// CompleteUpload checks that the object was uploaded with the size the slot
+// was issued for and that its content passes the upload policy and virus
+// scan, and records it as a project file
+func (h *FileHandler) CompleteUpload(c *gin.Context) {
+	upload, ok := h.findUpload(c)
+	if !ok {
+		return
+	}
+	orgID := c.GetUint("organization_id")
+
+	if time.Now().After(upload.ExpiresAt) {
+		c.JSON(http.StatusGone, gin.H{"error": "Upload has expired"})
+		return
+	}
+
+	var req CompleteUploadRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	ctx := c.Request.Context()
+	info, err := h.storage.StatFile(ctx, upload.S3Key)
+
+	// A retried confirmation finds the parts already assembled
+	if upload.Multipart() && errors.Is(err, services.ErrObjectNotFound) {
+		if msg := checkParts(upload, req.Parts); msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+		multipart, ok := h.storage.(services.MultipartUploader)
+		if !ok {
+			c.JSON(http.StatusConflict, gin.H{"error": "Storage no longer accepts this upload"})
+			return
+		}
+		if err := multipart.CompleteMultipartUpload(ctx, upload.S3Key, upload.MultipartID, req.Parts); err != nil {
+			log.Printf("upload %d: %v", upload.ID, err)
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Failed to assemble the uploaded parts"})
+			return
+		}
+		info, err = h.storage.StatFile(ctx, upload.S3Key)
+	}
+
+	if errors.Is(err, services.ErrObjectNotFound) {
+		c.JSON(http.StatusConflict, gin.H{"error": "File has not been uploaded"})
+		return
+	}
+	if err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check upload"})
+		return
+	}
+	if info.Size != upload.FileSize {
+		// The slot stays open so the client can upload again
+		h.storage.DeleteFile(ctx, upload.S3Key)
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error": fmt.Sprintf("Uploaded %d bytes, expected %d", info.Size, upload.FileSize),
+		})
+		return
+	}
+
+	policy, err := h.uploadRepo.GetPolicy(orgID)
+	if err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch upload policy"})
+		return
+	}
+	mimeType, err := h.sniffStored(ctx, upload.S3Key)
+	if err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check upload"})
+		return
+	}
+	if status, msg := checkUpload(policy, mimeType, upload.FileCategory, info.Size); status != 0 {
+		h.storage.DeleteFile(ctx, upload.S3Key)
+		c.JSON(status, gin.H{"error": msg})
+		return
+	}
+
+	projectFile := upload.ProjectFile(h.storage.Bucket())
+	projectFile.MimeType = mimeType
+	projectFile.FileType = determineFileType(mimeType)
+
+	// The replaced file was checked when the slot was issued; if it has been
+	// purged since, the upload becomes a new file
+	previous, err := h.previousVersion(upload.ProjectID, upload.ReplacesFileID, projectFile.FileType, upload.FileName)
+	if err != nil && err.Error() != "file not found" {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch files"})
+		return
+	}
+	if previous != nil {
+		projectFile.DocumentID = previous.DocumentID
+	}
+	projectFile.ScanStatus, projectFile.ScanSignature, err = h.scanStored(ctx, upload.S3Key)
+	if err != nil {
+		// The slot stays open so the client can retry
+		sentry.CaptureException(err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Virus scanning is unavailable, try again later"})
+		return
+	}
+
+	if err := h.uploadRepo.Complete(upload, projectFile); err != nil {
+		if err.Error() == "upload not found" {
+			c.JSON(http.StatusConflict, gin.H{"error": "Upload was already completed"})
+			return
+		}
+		if errors.Is(err, models.ErrStorageQuotaExceeded) {
+			// The slot stays open; cancelling it deletes the object
+			h.quotaExceeded(c, projectFile.FileSize)
+			return
+		}
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file"})
+		return
+	}
+
+	if projectFile.ScanStatus == models.ScanQuarantined {
+		h.events.Publish(orgID, events.FileQuarantined, projectFile)
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error": "File failed the virus scan and was quarantined",
+			"file":  projectFile,
+		})
+		return
+	}
+
+	if url, err := h.storage.GetSignedURL(ctx, projectFile.S3Key); err == nil {
+		projectFile.S3URL = url
+	}
+	h.events.Publish(orgID, events.FileUploaded, projectFile)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "File uploaded successfully",
+		"file":    projectFile,
+	})
+}
+
+// sniffStored detects the type of an uploaded object from its first bytes
+func (h *FileHandler) sniffStored(ctx context.Context, key string) (string, error) {
+	body, err := h.storage.DownloadFile(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+	return sniffType(body)
+}
+
+func (h *FileHandler) scanStored(ctx context.Context, key string) (status, signature string, err error) {
+	if h.scanner == nil {
+		return "", "", nil
+	}
+	body, err := h.storage.DownloadFile(ctx, key)
+	if err != nil {
+		return "", "", err
+	}
+	defer body.Close()
+	return h.scan(ctx, body)
+}
+
+// CancelUpload gives up a slot and deletes anything uploaded for it
+func (h *FileHandler) CancelUpload(c *gin.Context) {
+	upload, ok := h.findUpload(c)
+	if !ok {
+		return
+	}
+
+	if err := uploads.Discard(c.Request.Context(), h.storage, upload); err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete upload"})
+		return
+	}
+	if err := h.uploadRepo.Delete(upload.ID); err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete upload"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Upload cancelled"})
+}
+
+func (h *FileHandler) findUpload(c *gin.Context) (*models.FileUpload, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid upload ID"})
+		return nil, false
+	}
+
+	upload, err := h.uploadRepo.FindByID(uint(id), c.GetUint("organization_id"))
+	if err != nil {
+		if err.Error() == "upload not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Upload not found"})
+			return nil, false
+		}
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch upload"})
+		return nil, false
+	}
+	return upload, true
+}
+
+func presignParts(ctx context.Context, multipart services.MultipartUploader, upload *models.FileUpload) ([]UploadPartRequest, error) {
+	parts := []UploadPartRequest{}
+	for offset, number := int64(0), int32(1); offset < upload.FileSize; offset, number = offset+upload.PartSize, number+1 {
+		size := min(upload.PartSize, upload.FileSize-offset)
+		request, err := multipart.PresignUploadPart(ctx, upload.S3Key, upload.MultipartID, number, size, upload.ExpiresAt)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, UploadPartRequest{PartNumber: number, Size: size, Request: request})
+	}
+	return parts, nil
+}
+
+// checkParts sorts the reported parts and makes sure each one was uploaded
+func checkParts(upload *models.FileUpload, parts []services.UploadedPart) string {
+	expected := (upload.FileSize + upload.PartSize - 1) / upload.PartSize
+	if int64(len(parts)) != expected {
+		return fmt.Sprintf("Expected %d parts", expected)
+	}
+
+	sort.Slice(parts, func(i, j int) bool { return parts[i].PartNumber < parts[j].PartNumber })
+	for i, part := range parts {
+		if part.PartNumber != int32(i+1) {
+			return fmt.Sprintf("Missing part %d", i+1)
+		}
+	}
+	return ""
+}
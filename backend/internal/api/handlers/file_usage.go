@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/gin-gonic/gin"
+)
+
+// GetStorageUsage reports the organization's usage against its quota,
+// broken down by job, file type and upload month
+func (h *FileHandler) GetStorageUsage(c *gin.Context) {
+	if !rejectWorkers(c, "Workers cannot view storage usage") {
+		return
+	}
+	orgID := c.GetUint("organization_id")
+
+	usage, err := h.usageRepo.GetUsage(orgID)
+	if err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch storage usage"})
+		return
+	}
+	breakdown, err := h.usageRepo.GetBreakdown(orgID)
+	if err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch storage usage"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"usage": usage, "breakdown": breakdown})
+}
+
+// checkQuota responds 413 and returns false if size more bytes do not fit in
+// the organization's quota. Uploads are checked again when they are
+// recorded, as others may have used the space meanwhile.
+func (h *FileHandler) checkQuota(c *gin.Context, size int64) bool {
+	usage, err := h.usageRepo.GetUsage(c.GetUint("organization_id"))
+	if err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch storage usage"})
+		return false
+	}
+	if !usage.Allows(size) {
+		respondQuotaExceeded(c, usage.BytesUsed, usage.QuotaBytes, size)
+		return false
+	}
+	return true
+}
+
+// quotaExceeded responds for a file that was turned away when recorded
+func (h *FileHandler) quotaExceeded(c *gin.Context, size int64) {
+	usage, err := h.usageRepo.GetUsage(c.GetUint("organization_id"))
+	if err != nil {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Storage quota exceeded"})
+		return
+	}
+	respondQuotaExceeded(c, usage.BytesUsed, usage.QuotaBytes, size)
+}
+
+func respondQuotaExceeded(c *gin.Context, used, quota, size int64) {
+	c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+		"error": fmt.Sprintf("Storage quota exceeded: %s of %s used, this file needs %s more",
+			formatBytes(used), formatBytes(quota), formatBytes(size)),
+		"bytes_used":  used,
+		"quota_bytes": quota,
+		"file_size":   size,
+	})
+}
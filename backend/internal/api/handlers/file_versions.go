@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/gin-gonic/gin"
+	"github.com/ireuven89/routewise/internal/models"
+)
+
+// ListVersions returns every version of the file's document, newest first
+func (h *FileHandler) ListVersions(c *gin.Context) {
+	file, ok := h.findFile(c)
+	if !ok {
+		return
+	}
+
+	versions, err := h.fileRepo.FindVersions(file.DocumentID)
+	if err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch versions"})
+		return
+	}
+	if versions == nil {
+		versions = []*models.ProjectFile{}
+	}
+
+	ctx := c.Request.Context()
+	for _, version := range versions {
+		h.signURLs(ctx, version)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"versions": versions, "count": len(versions)})
+}
+
+// ListTrash returns the project's deleted files that can still be restored
+func (h *FileHandler) ListTrash(c *gin.Context) {
+	projectID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+		return
+	}
+
+	if _, err := h.projectRepo.FindByID(uint(projectID), c.GetUint("organization_id")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+		return
+	}
+
+	files, err := h.fileRepo.FindTrash(uint(projectID))
+	if err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch files"})
+		return
+	}
+	if files == nil {
+		files = []*models.ProjectFile{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"files":          files,
+		"count":          len(files),
+		"retention_days": int(h.trashRetention.Hours() / 24),
+	})
+}
+
+// RestoreFile takes a file out of the trash, along with the versions of its
+// document that were trashed with it
+func (h *FileHandler) RestoreFile(c *gin.Context) {
+	file, ok := h.findFile(c)
+	if !ok {
+		return
+	}
+
+	if err := h.fileRepo.Restore(file); err != nil {
+		if err.Error() == "file not found" {
+			c.JSON(http.StatusConflict, gin.H{"error": "File is not in the trash"})
+			return
+		}
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore file"})
+		return
+	}
+
+	if file.ScanStatus != models.ScanQuarantined {
+		h.signURLs(c.Request.Context(), file)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "File restored", "file": file})
+}
+
+// findFile loads the file in the id parameter, making sure it belongs to the
+// caller's organization
+func (h *FileHandler) findFile(c *gin.Context) (*models.ProjectFile, bool) {
+	fileID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid file ID"})
+		return nil, false
+	}
+
+	file, err := h.fileRepo.FindByID(uint(fileID))
+	if err != nil {
+		if err.Error() == "file not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+			return nil, false
+		}
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch file"})
+		return nil, false
+	}
+
+	if _, err := h.projectRepo.FindByID(file.ProjectID, c.GetUint("organization_id")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return nil, false
+	}
+	return file, true
+}
+
+// previousVersion finds the file an upload is a new version of: the one
+// named by replaces, which may be in the trash, or else for documents the
+// listed one with the same name. It returns nil for a new file.
+func (h *FileHandler) previousVersion(projectID uint, replaces *uint, fileType, fileName string) (*models.ProjectFile, error) {
+	if replaces != nil {
+		file, err := h.fileRepo.FindByID(*replaces)
+		if err != nil {
+			return nil, err
+		}
+		if file.ProjectID != projectID {
+			return nil, fmt.Errorf("file not found")
+		}
+		return file, nil
+	}
+
+	if fileType != models.FileTypeDocument {
+		return nil, nil
+	}
+	file, err := h.fileRepo.FindCurrentByName(projectID, fileType, fileName)
+	if err != nil && err.Error() == "file not found" {
+		return nil, nil
+	}
+	return file, err
+}
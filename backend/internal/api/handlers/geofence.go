@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/gin-gonic/gin"
+	"github.com/ireuven89/routewise/internal/events"
+	"github.com/ireuven89/routewise/internal/models"
+	"github.com/ireuven89/routewise/internal/repository"
+)
+
+type GeofenceHandler struct {
+	geofenceRepo *repository.GeofenceRepository
+	jobRepo      *repository.JobRepository
+	events       events.Publisher
+}
+
+func NewGeofenceHandler(db *sql.DB, publisher events.Publisher) *GeofenceHandler {
+	return &GeofenceHandler{
+		geofenceRepo: repository.NewGeofenceRepository(db),
+		jobRepo:      repository.NewJobRepository(db),
+		events:       publisher,
+	}
+}
+
+type UpdateGeofenceSettingsRequest struct {
+	Enabled         *bool `json:"enabled"`
+	RadiusMeters    *int  `json:"radius_meters" binding:"omitempty,min=25,max=5000"`
+	MinDwellMinutes *int  `json:"min_dwell_minutes" binding:"omitempty,min=0,max=1440"`
+}
+
+func (h *GeofenceHandler) GetSettings(c *gin.Context) {
+	organizationID := c.GetUint("organization_id")
+
+	settings, err := h.geofenceRepo.GetSettings(organizationID)
+	if err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch geofence settings"})
+		return
+	}
+
+	c.JSON(http.StatusOK, settings)
+}
+
+func (h *GeofenceHandler) UpdateSettings(c *gin.Context) {
+	organizationID := c.GetUint("organization_id")
+
+	var req UpdateGeofenceSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	settings, err := h.geofenceRepo.GetSettings(organizationID)
+	if err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch geofence settings"})
+		return
+	}
+
+	if req.Enabled != nil {
+		settings.Enabled = *req.Enabled
+	}
+	if req.RadiusMeters != nil {
+		settings.RadiusMeters = *req.RadiusMeters
+	}
+	if req.MinDwellMinutes != nil {
+		settings.MinDwellMinutes = *req.MinDwellMinutes
+	}
+
+	if err := h.geofenceRepo.SaveSettings(settings); err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save geofence settings"})
+		return
+	}
+
+	c.JSON(http.StatusOK, settings)
+}
+
+// ListSuggestions returns pending "mark completed" suggestions for dispatchers
+func (h *GeofenceHandler) ListSuggestions(c *gin.Context) {
+	organizationID := c.GetUint("organization_id")
+
+	events, err := h.geofenceRepo.FindPendingSuggestions(organizationID)
+	if err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch suggestions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"suggestions": events,
+		"count":       len(events),
+	})
+}
+
+// AcceptSuggestion applies a suggested transition to the job
+func (h *GeofenceHandler) AcceptSuggestion(c *gin.Context) {
+	organizationID := c.GetUint("organization_id")
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid suggestion ID"})
+		return
+	}
+
+	event, err := h.geofenceRepo.FindEventByID(uint(id), organizationID)
+	if err != nil || event.Outcome != models.GeofenceOutcomeSuggested || event.ToStatus == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Suggestion not found"})
+		return
+	}
+	if event.ResolvedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Suggestion already resolved"})
+		return
+	}
+
+	change := statusChangeFor(c, *event.ToStatus, false, event.Rule)
+	change.Source = models.StatusSourceGeofence
+	update, err := h.geofenceRepo.AcceptSuggestion(event.ID, organizationID, change)
+	if err != nil {
+		if err.Error() == "geofence event not found" {
+			c.JSON(http.StatusConflict, gin.H{"error": "Suggestion already resolved"})
+			return
+		}
+		respondStatusError(c, err)
+		return
+	}
+
+	h.events.Publish(organizationID, events.JobStatusChanged, update)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Status updated successfully"})
+}
+
+func (h *GeofenceHandler) DismissSuggestion(c *gin.Context) {
+	organizationID := c.GetUint("organization_id")
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid suggestion ID"})
+		return
+	}
+
+	if err := h.geofenceRepo.DismissSuggestion(uint(id), organizationID); err != nil {
+		if err.Error() == "geofence event not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Suggestion not found"})
+			return
+		}
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to dismiss suggestion"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Suggestion dismissed"})
+}
+
+// GetJobEvents lists every geofence rule that fired for a job
+func (h *GeofenceHandler) GetJobEvents(c *gin.Context) {
+	organizationID := c.GetUint("organization_id")
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid job ID"})
+		return
+	}
+
+	if _, err := h.jobRepo.FindByID(uint(id), organizationID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	}
+
+	events, err := h.geofenceRepo.FindEventsByJob(uint(id), organizationID)
+	if err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch geofence events"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"events": events})
+}
@@ -0,0 +1,459 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/gin-gonic/gin"
+	"github.com/ireuven89/routewise/internal/billing"
+	"github.com/ireuven89/routewise/internal/events"
+	"github.com/ireuven89/routewise/internal/models"
+	"github.com/ireuven89/routewise/internal/repository"
+	"github.com/shopspring/decimal"
+)
+
+const maxPaymentTermsDays = 365
+
+type InvoiceHandler struct {
+	invoiceRepo *repository.InvoiceRepository
+	events      events.Publisher
+	termsDays   int
+}
+
+func NewInvoiceHandler(db *sql.DB, publisher events.Publisher, termsDays int) *InvoiceHandler {
+	return &InvoiceHandler{
+		invoiceRepo: repository.NewInvoiceRepository(db),
+		events:      publisher,
+		termsDays:   termsDays,
+	}
+}
+
+type CreateInvoiceRequest struct {
+	PaymentTermsDays *int `json:"payment_terms_days"`
+}
+
+// InvoiceRequest edits a draft. DueDate is YYYY-MM-DD; when empty it is set
+// from the payment terms on sending.
+type InvoiceRequest struct {
+	Notes            string             `json:"notes"`
+	PaymentTermsDays int                `json:"payment_terms_days"`
+	DueDate          string             `json:"due_date"`
+	LineItems        []QuoteLineRequest `json:"line_items" binding:"required,min=1,dive"`
+}
+
+type VoidInvoiceRequest struct {
+	Reason string `json:"reason"`
+}
+
+type PaymentRequest struct {
+	Amount    decimal.Decimal `json:"amount"`
+	Method    string          `json:"method" binding:"required"`
+	Reference string          `json:"reference"`
+	PaidAt    *time.Time      `json:"paid_at"` // defaults to now
+	Notes     string          `json:"notes"`
+}
+
+// CreateFromJob drafts an invoice for a completed job. Completed jobs are
+// also drafted automatically; this covers jobs whose invoice was voided.
+func (h *InvoiceHandler) CreateFromJob(c *gin.Context) {
+	if !rejectWorkers(c, "Workers cannot manage invoices") {
+		return
+	}
+	organizationID := c.GetUint("organization_id")
+	organizationUserID := c.GetUint("organization_user_id")
+
+	jobID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid job ID"})
+		return
+	}
+
+	var req CreateInvoiceRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	termsDays := h.termsDays
+	if req.PaymentTermsDays != nil {
+		termsDays = *req.PaymentTermsDays
+		if termsDays < 0 || termsDays > maxPaymentTermsDays {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payment_terms_days"})
+			return
+		}
+	}
+
+	invoice, err := h.invoiceRepo.CreateFromJob(uint(jobID), organizationID, &organizationUserID, termsDays)
+	if err != nil {
+		if err.Error() == "job not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+			return
+		}
+		respondInvoiceError(c, err, "Failed to create invoice")
+		return
+	}
+
+	h.events.Publish(organizationID, events.InvoiceCreated, invoice)
+
+	c.JSON(http.StatusCreated, invoice)
+}
+
+func (h *InvoiceHandler) GetAll(c *gin.Context) {
+	if !rejectWorkers(c, "Workers cannot manage invoices") {
+		return
+	}
+	organizationID := c.GetUint("organization_id")
+
+	filters := make(map[string]interface{})
+	if status := c.Query("status"); status != "" {
+		filters["status"] = status
+	}
+	for _, key := range []string{"customer_id", "job_id"} {
+		if v := c.Query(key); v != "" {
+			id, err := strconv.ParseUint(v, 10, 32)
+			if err == nil {
+				filters[key] = uint(id)
+			}
+		}
+	}
+
+	invoices, err := h.invoiceRepo.FindAll(organizationID, filters)
+	if err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch invoices"})
+		return
+	}
+
+	now := time.Now()
+	for _, invoice := range invoices {
+		showOverdue(invoice, now)
+	}
+
+	c.JSON(http.StatusOK, invoices)
+}
+
+func (h *InvoiceHandler) GetByID(c *gin.Context) {
+	invoice, ok := h.findInvoice(c)
+	if !ok {
+		return
+	}
+
+	showOverdue(invoice, time.Now())
+	c.JSON(http.StatusOK, invoice)
+}
+
+// Update replaces a draft invoice's terms and line items
+func (h *InvoiceHandler) Update(c *gin.Context) {
+	invoice, ok := h.findInvoice(c)
+	if !ok {
+		return
+	}
+	if invoice.Status != models.InvoiceDraft {
+		c.JSON(http.StatusConflict, gin.H{"error": models.ErrInvoiceNotEditable.Error()})
+		return
+	}
+
+	var req InvoiceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.PaymentTermsDays < 0 || req.PaymentTermsDays > maxPaymentTermsDays {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payment_terms_days"})
+		return
+	}
+
+	var dueDate *time.Time
+	if req.DueDate != "" {
+		d, err := time.Parse(routeDateLayout, req.DueDate)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid due_date, expected YYYY-MM-DD"})
+			return
+		}
+		dueDate = &d
+	}
+
+	lines := make([]*models.InvoiceLineItem, len(req.LineItems))
+	for i, lr := range req.LineItems {
+		lines[i] = &models.InvoiceLineItem{
+			Kind:        lr.Kind,
+			Description: strings.TrimSpace(lr.Description),
+			LinePricing: lr.pricing(),
+		}
+		if err := lines[i].Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("line %d: %v", i+1, err)})
+			return
+		}
+	}
+
+	invoice.Notes = req.Notes
+	invoice.PaymentTermsDays = req.PaymentTermsDays
+	invoice.DueDate = dueDate
+	invoice.LineItems = lines
+	invoice.ComputeTotals()
+	if err := invoice.DocumentTotals.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.invoiceRepo.Update(invoice); err != nil {
+		respondInvoiceError(c, err, "Failed to update invoice")
+		return
+	}
+
+	c.JSON(http.StatusOK, invoice)
+}
+
+func (h *InvoiceHandler) Delete(c *gin.Context) {
+	if !rejectWorkers(c, "Workers cannot manage invoices") {
+		return
+	}
+	organizationID := c.GetUint("organization_id")
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invoice ID"})
+		return
+	}
+
+	if err := h.invoiceRepo.Delete(uint(id), organizationID); err != nil {
+		respondInvoiceError(c, err, "Failed to delete invoice")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Invoice deleted successfully"})
+}
+
+// Send issues a draft: it is numbered and its due date is fixed
+func (h *InvoiceHandler) Send(c *gin.Context) {
+	h.transition(c, func(id, organizationID uint) error {
+		return h.invoiceRepo.Send(id, organizationID, time.Now())
+	}, events.InvoiceSent, "Failed to send invoice")
+}
+
+func (h *InvoiceHandler) Void(c *gin.Context) {
+	var req VoidInvoiceRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.transition(c, func(id, organizationID uint) error {
+		return h.invoiceRepo.Void(id, organizationID, strings.TrimSpace(req.Reason), time.Now())
+	}, events.InvoiceVoided, "Failed to void invoice")
+}
+
+// AddPayment records a full or partial payment taken outside the app, such
+// as cash or a check
+func (h *InvoiceHandler) AddPayment(c *gin.Context) {
+	if !rejectWorkers(c, "Workers cannot manage invoices") {
+		return
+	}
+	organizationID := c.GetUint("organization_id")
+	organizationUserID := c.GetUint("organization_user_id")
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invoice ID"})
+		return
+	}
+
+	var req PaymentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !req.Amount.IsPositive() || !models.HasScale(req.Amount, 2) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "amount must be positive with at most 2 decimal places"})
+		return
+	}
+	if !models.IsPaymentMethod(req.Method) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payment method"})
+		return
+	}
+
+	now := time.Now()
+	paidAt := now
+	if req.PaidAt != nil {
+		if req.PaidAt.After(now) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "paid_at cannot be in the future"})
+			return
+		}
+		paidAt = req.PaidAt.UTC()
+	}
+
+	payment := &models.InvoicePayment{
+		InvoiceID:  uint(id),
+		Amount:     req.Amount,
+		Method:     req.Method,
+		Reference:  strings.TrimSpace(req.Reference),
+		PaidAt:     paidAt,
+		Notes:      req.Notes,
+		RecordedBy: &organizationUserID,
+	}
+	if err := h.invoiceRepo.AddPayment(payment, organizationID); err != nil {
+		respondInvoiceError(c, err, "Failed to record payment")
+		return
+	}
+
+	invoice, err := h.invoiceRepo.FindByID(uint(id), organizationID)
+	if err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch invoice"})
+		return
+	}
+
+	h.events.Publish(organizationID, events.PaymentRecorded, payment)
+	if invoice.Status == models.InvoicePaid {
+		h.events.Publish(organizationID, events.InvoicePaid, invoice)
+	}
+
+	showOverdue(invoice, now)
+	c.JSON(http.StatusCreated, gin.H{"payment": payment, "invoice": invoice})
+}
+
+// DeletePayment removes a payment entered by mistake; a paid invoice goes
+// back to awaiting payment
+func (h *InvoiceHandler) DeletePayment(c *gin.Context) {
+	if !rejectWorkers(c, "Workers cannot manage invoices") {
+		return
+	}
+	organizationID := c.GetUint("organization_id")
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invoice ID"})
+		return
+	}
+	paymentID, err := strconv.ParseUint(c.Param("paymentId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payment ID"})
+		return
+	}
+
+	if err := h.invoiceRepo.DeletePayment(uint(paymentID), uint(id), organizationID); err != nil {
+		if err.Error() == "payment not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Payment not found"})
+			return
+		}
+		respondInvoiceError(c, err, "Failed to delete payment")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Payment deleted successfully"})
+}
+
+// GetAgedReceivables buckets open balances by days past due as of a date,
+// defaulting to today. Payments made after that date are not counted.
+func (h *InvoiceHandler) GetAgedReceivables(c *gin.Context) {
+	if !rejectWorkers(c, "Workers cannot view receivables") {
+		return
+	}
+	organizationID := c.GetUint("organization_id")
+
+	date := c.Query("as_of")
+	if date == "" {
+		date = time.Now().Format(routeDateLayout)
+	}
+	asOf, err := time.Parse(routeDateLayout, date)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid as_of, expected YYYY-MM-DD"})
+		return
+	}
+
+	open, err := h.invoiceRepo.FindOpenAsOf(organizationID, asOf)
+	if err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build receivables report"})
+		return
+	}
+
+	c.JSON(http.StatusOK, billing.AgeReceivables(open, asOf))
+}
+
+// transition applies a status change and publishes the updated invoice
+func (h *InvoiceHandler) transition(c *gin.Context, apply func(id, organizationID uint) error, eventType, failure string) {
+	if !rejectWorkers(c, "Workers cannot manage invoices") {
+		return
+	}
+	organizationID := c.GetUint("organization_id")
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invoice ID"})
+		return
+	}
+
+	if err := apply(uint(id), organizationID); err != nil {
+		respondInvoiceError(c, err, failure)
+		return
+	}
+
+	invoice, err := h.invoiceRepo.FindByID(uint(id), organizationID)
+	if err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch invoice"})
+		return
+	}
+
+	h.events.Publish(organizationID, eventType, invoice)
+
+	showOverdue(invoice, time.Now())
+	c.JSON(http.StatusOK, invoice)
+}
+
+func (h *InvoiceHandler) findInvoice(c *gin.Context) (*models.Invoice, bool) {
+	if !rejectWorkers(c, "Workers cannot manage invoices") {
+		return nil, false
+	}
+	organizationID := c.GetUint("organization_id")
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invoice ID"})
+		return nil, false
+	}
+
+	invoice, err := h.invoiceRepo.FindByID(uint(id), organizationID)
+	if err != nil {
+		if err.Error() == "invoice not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Invoice not found"})
+			return nil, false
+		}
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch invoice"})
+		return nil, false
+	}
+
+	return invoice, true
+}
+
+// showOverdue reports a sent invoice past its due date as overdue. The
+// status is derived, so it is only set on responses.
+func showOverdue(invoice *models.Invoice, now time.Time) {
+	if invoice.IsOverdue(now) {
+		invoice.Status = models.InvoiceOverdue
+	}
+}
+
+func respondInvoiceError(c *gin.Context, err error, message string) {
+	switch {
+	case err.Error() == "invoice not found":
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invoice not found"})
+	case errors.Is(err, models.ErrInvoiceExists), errors.Is(err, models.ErrInvoiceNotEditable),
+		errors.Is(err, models.ErrInvoiceNotOpen), errors.Is(err, models.ErrInvoiceHasPayments),
+		errors.Is(err, models.ErrInvoiceVoid), errors.Is(err, models.ErrJobNotBillable):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrOverpayment), errors.Is(err, models.ErrInvoiceEmpty):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	default:
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
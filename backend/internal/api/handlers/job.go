@@ -1,10 +1,8 @@
 package handlers
 
 import (
-	"bytes"
 	"database/sql"
-	"fmt"
-	"io"
+	"errors"
 	"net/http"
 	"strconv"
 	"time"
@@ -12,17 +10,28 @@ import (
 	"github.com/getsentry/sentry-go"
 
 	"github.com/gin-gonic/gin"
+	"github.com/ireuven89/routewise/internal/events"
 	"github.com/ireuven89/routewise/internal/models"
+	"github.com/ireuven89/routewise/internal/recurrence"
 	"github.com/ireuven89/routewise/internal/repository"
+	"github.com/ireuven89/routewise/internal/scheduling"
 )
 
 type JobHandler struct {
-	jobRepo *repository.JobRepository
+	jobRepo      *repository.JobRepository
+	crewRepo     *repository.CrewRepository
+	templateRepo *repository.JobTemplateRepository
+	checker      *scheduling.Checker
+	events       events.Publisher
 }
 
-func NewJobHandler(db *sql.DB) *JobHandler {
+func NewJobHandler(db *sql.DB, checker *scheduling.Checker, publisher events.Publisher) *JobHandler {
 	return &JobHandler{
-		jobRepo: repository.NewJobRepository(db),
+		jobRepo:      repository.NewJobRepository(db),
+		crewRepo:     repository.NewCrewRepository(db),
+		templateRepo: repository.NewJobTemplateRepository(db),
+		checker:      checker,
+		events:       publisher,
 	}
 }
 
@@ -44,15 +53,21 @@ type UpdateJobRequest struct {
 	DurationMinutes int         `json:"duration_minutes"`
 	Price           *float64    `json:"price"`
 	Status          string      `json:"status"`
+	Reopen          bool        `json:"reopen"`
 	Metadata        models.JSON `json:"metadata"`
+	Scope           string      `json:"scope"`                      // recurring jobs only: "this" (default) or "future"
+	Version         int         `json:"version" binding:"required"` // the job.version the edit was made against
 }
 
 type AssignTechnicianRequest struct {
 	TechnicianID *uint `json:"technician_id"`
+	Version      int   `json:"version" binding:"required"`
 }
 
 type UpdateStatusRequest struct {
 	Status string `json:"status" binding:"required"`
+	Reopen bool   `json:"reopen"`
+	Reason string `json:"reason"`
 }
 
 func (h *JobHandler) Create(c *gin.Context) {
@@ -84,12 +99,17 @@ func (h *JobHandler) Create(c *gin.Context) {
 		job.DurationMinutes = 60 // Default 1 hour
 	}
 
-	if err := h.jobRepo.Create(job); err != nil {
+	if err := h.jobRepo.Create(job, scheduleCheck(h.checker, organizationID, 0)); err != nil {
+		if respondScheduleError(c, err) {
+			return
+		}
 		sentry.CaptureException(err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create job"})
 		return
 	}
 
+	h.events.Publish(organizationID, events.JobCreated, job)
+
 	c.JSON(http.StatusCreated, job)
 }
 
@@ -110,10 +130,21 @@ func (h *JobHandler) GetAll(c *gin.Context) {
 		}
 	}
 
+	if crewIDStr := c.Query("crew_member"); crewIDStr != "" {
+		crewID, err := strconv.ParseUint(crewIDStr, 10, 32)
+		if err == nil {
+			filters["crew_worker_id"] = uint(crewID)
+		}
+	}
+
 	if date := c.Query("date"); date != "" {
 		filters["scheduled_date"] = date
 	}
 
+	if c.Query("unassigned") == "true" {
+		filters["unassigned"] = true
+	}
+
 	sortBy := c.Query("sort")
 	if sortBy == "" {
 		sortBy = "created_at" // Default sort
@@ -146,6 +177,14 @@ func (h *JobHandler) GetByID(c *gin.Context) {
 		return
 	}
 
+	crew, err := h.crewRepo.FindByJob(job.ID, organizationID, false)
+	if err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch crew"})
+		return
+	}
+	job.Crew = crew
+
 	c.JSON(http.StatusOK, job)
 }
 
@@ -174,6 +213,9 @@ func (h *JobHandler) Update(c *gin.Context) {
 		return
 	}
 
+	previousStart, previousDuration := job.ScheduledAt, job.DurationMinutes
+	job.Version = req.Version // checked against the stored version when saving
+
 	// Update fields
 	if req.Title != "" {
 		job.Title = req.Title
@@ -186,19 +228,71 @@ func (h *JobHandler) Update(c *gin.Context) {
 		job.DurationMinutes = req.DurationMinutes
 	}
 	job.Price = req.Price
-	if req.Status != "" {
-		job.Status = models.JobStatus(req.Status)
-	}
 	if req.Metadata != nil {
 		job.Metadata = req.Metadata
 	}
 
-	if err := h.jobRepo.Update(job); err != nil {
-		sentry.CaptureException(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update job"})
+	// A status change goes through the state machine; check it before saving anything
+	newStatus := models.JobStatus(req.Status)
+	statusChanged := req.Status != "" && newStatus != job.Status
+	if statusChanged {
+		if err := models.JobStatusFlow.Validate(job.Status, newStatus, req.Reopen); err != nil {
+			respondStatusError(c, err)
+			return
+		}
+	}
+
+	// A new slot is checked against the worker's calendar while the job is saved
+	var check repository.ScheduleCheck
+	if !job.ScheduledAt.Equal(previousStart) || job.DurationMinutes != previousDuration {
+		check = scheduleCheck(h.checker, organizationID, job.ID)
+	}
+
+	// The status change is saved with the edit, so neither happens without the other
+	var change *models.StatusChange
+	if statusChanged {
+		sc := statusChangeFor(c, newStatus, req.Reopen, "")
+		change = &sc
+	}
+
+	var update *models.JobStatusUpdate
+	switch {
+	case req.Scope == scopeFuture:
+		if job.TemplateID == nil || job.OccurrenceAt == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Job is not part of a recurring series"})
+			return
+		}
+		update, err = h.splitSeries(job, change, check)
+		if err != nil {
+			if errors.Is(err, recurrence.ErrInvalidRule) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			h.respondUpdateError(c, err, job.ID, "Failed to update recurring job")
+			return
+		}
+
+	case req.Scope == "" || req.Scope == scopeThis:
+		// Edited on its own, so later series edits leave this occurrence alone
+		if job.TemplateID != nil {
+			job.IsException = true
+		}
+		update, err = h.jobRepo.Update(job, change, check)
+		if err != nil {
+			h.respondUpdateError(c, err, job.ID, "Failed to update job")
+			return
+		}
+
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid scope"})
 		return
 	}
 
+	h.events.Publish(organizationID, events.JobUpdated, job)
+	if update != nil {
+		h.events.Publish(organizationID, events.JobStatusChanged, update)
+	}
+
 	c.JSON(http.StatusOK, job)
 }
 
@@ -217,74 +311,120 @@ func (h *JobHandler) AssignTechnician(c *gin.Context) {
 		return
 	}
 
-	if err := h.jobRepo.AssignTechnician(uint(id), organizationID, req.TechnicianID); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign technician"})
+	warnings, err := h.jobRepo.AssignTechnician(uint(id), organizationID, req.TechnicianID, req.Version, scheduleCheck(h.checker, organizationID, uint(id)))
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrStaleJob):
+			respondStaleJob(c, h.jobRepo, uint(id))
+		case respondScheduleError(c, err):
+		case err.Error() == "job not found":
+			c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		default:
+			sentry.CaptureException(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign technician"})
+		}
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Worker assigned successfully"})
+	h.events.Publish(organizationID, events.JobAssigned, gin.H{"job_id": uint(id), "technician_id": req.TechnicianID})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Worker assigned successfully",
+		"warnings": warnings,
+	})
 }
 
 func (h *JobHandler) UpdateStatus(c *gin.Context) {
-	fmt.Println("🔍 UpdateStatus called") // DEBUG
-
 	organizationID := c.GetUint("organization_id")
-	fmt.Println("🔍 OrganizationID:", organizationID) // DEBUG
 
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
-		fmt.Println("❌ Invalid job ID:", err) // DEBUG
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid job ID"})
 		return
 	}
-	fmt.Println("🔍 Job ID:", id) // DEBUG
-
-	// DEBUG: Check request details
-	fmt.Println("🔍 Content-Type:", c.GetHeader("Content-Type"))
-	fmt.Println("🔍 Content-Length:", c.Request.ContentLength)
-	fmt.Println("🔍 Method:", c.Request.Method)
-
-	// DEBUG: Try to read body manually
-	bodyBytes, _ := io.ReadAll(c.Request.Body)
-	fmt.Println("🔍 Raw body:", string(bodyBytes))
-
-	// IMPORTANT: Reset body so ShouldBindJSON can read it
-	c.Request.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
 
 	var req UpdateStatusRequest
-	fmt.Println("🔍 About to bind JSON...") // DEBUG
-
 	if err := c.ShouldBindJSON(&req); err != nil {
-		fmt.Println("❌ Failed to bind JSON:", err) // DEBUG
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	fmt.Println("🔍 Successfully bound JSON, status:", req.Status) // DEBUG
 
-	status := models.JobStatus(req.Status)
+	change := statusChangeFor(c, models.JobStatus(req.Status), req.Reopen, req.Reason)
+	update, err := h.jobRepo.UpdateStatus(uint(id), organizationID, change)
+	if err != nil {
+		respondStatusError(c, err)
+		return
+	}
+
+	h.events.Publish(organizationID, events.JobStatusChanged, update)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Status updated successfully",
+		"update":  update,
+	})
+}
+
+// GetHistory returns every status change of a job, oldest first
+func (h *JobHandler) GetHistory(c *gin.Context) {
+	organizationID := c.GetUint("organization_id")
 
-	// Validate status
-	validStatuses := map[models.JobStatus]bool{
-		models.StatusScheduled:  true,
-		models.StatusInProgress: true,
-		models.StatusCompleted:  true,
-		models.StatusCancelled:  true,
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid job ID"})
+		return
 	}
 
-	if !validStatuses[status] {
-		fmt.Println("❌ Invalid status:", status) // DEBUG
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status"})
+	if _, err := h.jobRepo.FindByID(uint(id), organizationID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
 		return
 	}
 
-	if err := h.jobRepo.UpdateStatus(uint(id), organizationID, status); err != nil {
-		fmt.Println("❌ Failed to update in DB:", err) // DEBUG
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update status"})
+	history, err := h.jobRepo.FindStatusHistory(uint(id), organizationID)
+	if err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch job history"})
 		return
 	}
 
-	fmt.Println("✅ Status updated successfully") // DEBUG
-	c.JSON(http.StatusOK, gin.H{"message": "Status updated successfully"})
+	c.JSON(http.StatusOK, gin.H{"history": history})
+}
+
+// statusChangeFor builds a manual status change attributed to the caller
+func statusChangeFor(c *gin.Context, to models.JobStatus, reopen bool, reason string) models.StatusChange {
+	actorID := c.GetUint("organization_user_id")
+	change := models.StatusChange{
+		To:     to,
+		Reopen: reopen,
+		Source: models.StatusSourceManual,
+		Reason: reason,
+	}
+	if c.GetString("user_type") == "worker" {
+		change.ChangedByWorker = &actorID
+	} else {
+		change.ChangedByUser = &actorID
+	}
+	return change
+}
+
+func respondStatusError(c *gin.Context, err error) {
+	var transitionErr *models.TransitionError
+	switch {
+	case errors.As(err, &transitionErr):
+		c.JSON(http.StatusConflict, gin.H{
+			"error":        err.Error(),
+			"needs_reopen": transitionErr.NeedsReopen,
+			"allowed":      models.JobStatusFlow.Next(transitionErr.From),
+		})
+	case errors.Is(err, models.ErrInvalidTransition):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status"})
+	case errors.Is(err, models.ErrSignatureRequired):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "signature_required": true})
+	case err.Error() == "job not found":
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+	default:
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update status"})
+	}
 }
 
 func (h *JobHandler) Delete(c *gin.Context) {
@@ -296,10 +436,112 @@ func (h *JobHandler) Delete(c *gin.Context) {
 		return
 	}
 
+	// ?scope=future also ends a recurring series from this occurrence on
+	if c.Query("scope") == scopeFuture {
+		job, err := h.jobRepo.FindByID(uint(id), organizationID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+			return
+		}
+		if job.TemplateID == nil || job.OccurrenceAt == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Job is not part of a recurring series"})
+			return
+		}
+
+		deleted, err := h.endSeriesAt(job)
+		if err != nil {
+			sentry.CaptureException(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete recurring job"})
+			return
+		}
+
+		h.events.Publish(organizationID, events.JobDeleted, gin.H{"job_id": job.ID, "scope": scopeFuture, "jobs_deleted": deleted})
+
+		c.JSON(http.StatusOK, gin.H{"message": "Job deleted successfully", "jobs_deleted": deleted})
+		return
+	}
+
 	if err := h.jobRepo.Delete(uint(id), organizationID); err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
 		return
 	}
 
+	h.events.Publish(organizationID, events.JobDeleted, gin.H{"job_id": uint(id)})
+
 	c.JSON(http.StatusOK, gin.H{"message": "Job deleted successfully"})
 }
+
+type UpdateCompletionSettingsRequest struct {
+	RequireSignature *bool `json:"require_signature"`
+}
+
+func (h *JobHandler) GetCompletionSettings(c *gin.Context) {
+	organizationID := c.GetUint("organization_id")
+
+	settings, err := h.jobRepo.GetCompletionSettings(organizationID)
+	if err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch completion settings"})
+		return
+	}
+
+	c.JSON(http.StatusOK, settings)
+}
+
+func (h *JobHandler) UpdateCompletionSettings(c *gin.Context) {
+	if !rejectWorkers(c, "Workers cannot change completion settings") {
+		return
+	}
+	organizationID := c.GetUint("organization_id")
+
+	var req UpdateCompletionSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	settings, err := h.jobRepo.GetCompletionSettings(organizationID)
+	if err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch completion settings"})
+		return
+	}
+
+	if req.RequireSignature != nil {
+		settings.RequireSignature = *req.RequireSignature
+	}
+
+	if err := h.jobRepo.SaveCompletionSettings(settings); err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save completion settings"})
+		return
+	}
+
+	c.JSON(http.StatusOK, settings)
+}
+
+// respondUpdateError reports a failed edit, which the status change saved
+// with it may have refused
+func (h *JobHandler) respondUpdateError(c *gin.Context, err error, jobID uint, message string) {
+	if errors.Is(err, models.ErrStaleJob) {
+		respondStaleJob(c, h.jobRepo, jobID)
+		return
+	}
+	if respondScheduleError(c, err) {
+		return
+	}
+	if errors.Is(err, models.ErrInvalidTransition) || errors.Is(err, models.ErrSignatureRequired) ||
+		err.Error() == "job not found" {
+		respondStatusError(c, err)
+		return
+	}
+	sentry.CaptureException(err)
+	c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+}
+
+// respondStaleJob answers a write made against an old version of the job
+// with 409 and the job as it is now, so the client can reload it
+func respondStaleJob(c *gin.Context, jobRepo *repository.JobRepository, jobID uint) {
+	current, _ := jobRepo.FindByID(jobID, c.GetUint("organization_id"))
+	c.JSON(http.StatusConflict, gin.H{"error": "Job was changed by someone else, reload and try again", "job": current})
+}
@@ -0,0 +1,296 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/gin-gonic/gin"
+	"github.com/ireuven89/routewise/internal/models"
+)
+
+type JobNoteRequest struct {
+	Note string `json:"note" binding:"required"`
+}
+
+type JobPartRequest struct {
+	PartName    string  `json:"part_name" binding:"required"`
+	Description string  `json:"description"`
+	Quantity    int     `json:"quantity" binding:"required,min=1"`
+	UnitPrice   float64 `json:"unit_price" binding:"min=0"`
+}
+
+func (h *JobHandler) GetNotes(c *gin.Context) {
+	organizationID := c.GetUint("organization_id")
+
+	jobID, ok := parseJobID(c)
+	if !ok {
+		return
+	}
+
+	notes, err := h.jobRepo.GetNotes(jobID, organizationID)
+	if err != nil {
+		respondItemError(c, err, "Failed to fetch notes")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"notes": notes})
+}
+
+func (h *JobHandler) AddNote(c *gin.Context) {
+	organizationID := c.GetUint("organization_id")
+
+	jobID, ok := parseJobID(c)
+	if !ok {
+		return
+	}
+
+	var req JobNoteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	note := &models.JobNote{JobID: jobID, Note: req.Note}
+	note.CreatedByUser, note.CreatedByWorker = actorIDs(c)
+
+	if err := h.jobRepo.AddNote(note, organizationID); err != nil {
+		respondItemError(c, err, "Failed to add note")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"note": note})
+}
+
+func (h *JobHandler) UpdateNote(c *gin.Context) {
+	organizationID := c.GetUint("organization_id")
+
+	jobID, noteID, ok := parseJobItemIDs(c, "noteId")
+	if !ok {
+		return
+	}
+
+	var req JobNoteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	note, err := h.jobRepo.FindNote(noteID, jobID, organizationID)
+	if err != nil {
+		respondItemError(c, err, "Failed to update note")
+		return
+	}
+	if !canEditItem(c, note.CreatedByWorker) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Workers can only edit their own notes"})
+		return
+	}
+
+	note.Note = req.Note
+	if err := h.jobRepo.UpdateNote(note, organizationID); err != nil {
+		respondItemError(c, err, "Failed to update note")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"note": note})
+}
+
+func (h *JobHandler) DeleteNote(c *gin.Context) {
+	organizationID := c.GetUint("organization_id")
+
+	jobID, noteID, ok := parseJobItemIDs(c, "noteId")
+	if !ok {
+		return
+	}
+
+	note, err := h.jobRepo.FindNote(noteID, jobID, organizationID)
+	if err != nil {
+		respondItemError(c, err, "Failed to delete note")
+		return
+	}
+	if !canEditItem(c, note.CreatedByWorker) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Workers can only delete their own notes"})
+		return
+	}
+
+	if err := h.jobRepo.DeleteNote(noteID, jobID, organizationID); err != nil {
+		respondItemError(c, err, "Failed to delete note")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Note deleted successfully"})
+}
+
+// GetParts lists the materials used on a job together with their total
+func (h *JobHandler) GetParts(c *gin.Context) {
+	organizationID := c.GetUint("organization_id")
+
+	jobID, ok := parseJobID(c)
+	if !ok {
+		return
+	}
+
+	parts, err := h.jobRepo.GetParts(jobID, organizationID)
+	if err != nil {
+		respondItemError(c, err, "Failed to fetch parts")
+		return
+	}
+
+	total := 0.0
+	for _, part := range parts {
+		total += part.LineTotal
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"parts":       parts,
+		"parts_total": total,
+	})
+}
+
+func (h *JobHandler) AddPart(c *gin.Context) {
+	organizationID := c.GetUint("organization_id")
+
+	jobID, ok := parseJobID(c)
+	if !ok {
+		return
+	}
+
+	var req JobPartRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	part := &models.JobPart{
+		JobID:       jobID,
+		PartName:    req.PartName,
+		Description: req.Description,
+		Quantity:    req.Quantity,
+		UnitPrice:   req.UnitPrice,
+	}
+	part.AddedByUser, part.AddedByWorker = actorIDs(c)
+
+	if err := h.jobRepo.AddPart(part, organizationID); err != nil {
+		respondItemError(c, err, "Failed to add part")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"part": part})
+}
+
+func (h *JobHandler) UpdatePart(c *gin.Context) {
+	organizationID := c.GetUint("organization_id")
+
+	jobID, partID, ok := parseJobItemIDs(c, "partId")
+	if !ok {
+		return
+	}
+
+	var req JobPartRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	part, err := h.jobRepo.FindPart(partID, jobID, organizationID)
+	if err != nil {
+		respondItemError(c, err, "Failed to update part")
+		return
+	}
+	if !canEditItem(c, part.AddedByWorker) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Workers can only edit parts they added"})
+		return
+	}
+
+	part.PartName = req.PartName
+	part.Description = req.Description
+	part.Quantity = req.Quantity
+	part.UnitPrice = req.UnitPrice
+
+	if err := h.jobRepo.UpdatePart(part, organizationID); err != nil {
+		respondItemError(c, err, "Failed to update part")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"part": part})
+}
+
+func (h *JobHandler) DeletePart(c *gin.Context) {
+	organizationID := c.GetUint("organization_id")
+
+	jobID, partID, ok := parseJobItemIDs(c, "partId")
+	if !ok {
+		return
+	}
+
+	part, err := h.jobRepo.FindPart(partID, jobID, organizationID)
+	if err != nil {
+		respondItemError(c, err, "Failed to delete part")
+		return
+	}
+	if !canEditItem(c, part.AddedByWorker) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Workers can only delete parts they added"})
+		return
+	}
+
+	if err := h.jobRepo.DeletePart(partID, jobID, organizationID); err != nil {
+		respondItemError(c, err, "Failed to delete part")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Part deleted successfully"})
+}
+
+func parseJobID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid job ID"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func parseJobItemIDs(c *gin.Context, param string) (uint, uint, bool) {
+	jobID, ok := parseJobID(c)
+	if !ok {
+		return 0, 0, false
+	}
+
+	itemID, err := strconv.ParseUint(c.Param(param), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return 0, 0, false
+	}
+	return jobID, uint(itemID), true
+}
+
+// actorIDs splits the caller into the user or worker column of a record
+func actorIDs(c *gin.Context) (userID *uint, workerID *uint) {
+	id := c.GetUint("organization_user_id")
+	if c.GetString("user_type") == "worker" {
+		return nil, &id
+	}
+	return &id, nil
+}
+
+// canEditItem lets office users edit any item and workers only their own
+func canEditItem(c *gin.Context, ownerWorkerID *uint) bool {
+	if c.GetString("user_type") != "worker" {
+		return true
+	}
+	return ownerWorkerID != nil && *ownerWorkerID == c.GetUint("organization_user_id")
+}
+
+func respondItemError(c *gin.Context, err error, message string) {
+	switch err.Error() {
+	case "job not found":
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+	case "note not found":
+		c.JSON(http.StatusNotFound, gin.H{"error": "Note not found"})
+	case "part not found":
+		c.JSON(http.StatusNotFound, gin.H{"error": "Part not found"})
+	default:
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
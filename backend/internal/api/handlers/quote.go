@@ -0,0 +1,576 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/gin-gonic/gin"
+	"github.com/ireuven89/routewise/internal/events"
+	"github.com/ireuven89/routewise/internal/models"
+	"github.com/ireuven89/routewise/internal/repository"
+	"github.com/ireuven89/routewise/internal/scheduling"
+	"github.com/ireuven89/routewise/pkg/utils"
+	"github.com/shopspring/decimal"
+)
+
+// Approval links for quotes without a validity date last this long
+const defaultQuoteLinkTTL = 30 * 24 * time.Hour
+
+type QuoteHandler struct {
+	quoteRepo    *repository.QuoteRepository
+	customerRepo *repository.CustomerRepository
+	userRepo     *repository.OrganizationUserRepository
+	checker      *scheduling.Checker
+	events       events.Publisher
+}
+
+func NewQuoteHandler(db *sql.DB, checker *scheduling.Checker, publisher events.Publisher) *QuoteHandler {
+	return &QuoteHandler{
+		quoteRepo:    repository.NewQuoteRepository(db),
+		customerRepo: repository.NewCustomerRepository(db),
+		userRepo:     repository.NewUserRepository(db),
+		checker:      checker,
+		events:       publisher,
+	}
+}
+
+// Amounts may be sent as JSON numbers or strings; both are parsed exactly
+type QuoteLineRequest struct {
+	Kind            string          `json:"kind" binding:"required"`
+	Description     string          `json:"description" binding:"required"`
+	Quantity        decimal.Decimal `json:"quantity"`
+	UnitPrice       decimal.Decimal `json:"unit_price"`
+	DiscountPercent decimal.Decimal `json:"discount_percent"`
+	TaxRate         decimal.Decimal `json:"tax_rate"`
+}
+
+func (r QuoteLineRequest) pricing() models.LinePricing {
+	return models.LinePricing{
+		Quantity:        r.Quantity,
+		UnitPrice:       r.UnitPrice,
+		DiscountPercent: r.DiscountPercent,
+		TaxRate:         r.TaxRate,
+	}
+}
+
+type QuoteRequest struct {
+	CustomerID uint               `json:"customer_id" binding:"required"`
+	Title      string             `json:"title" binding:"required"`
+	Notes      string             `json:"notes"`
+	ValidUntil *time.Time         `json:"valid_until"`
+	LineItems  []QuoteLineRequest `json:"line_items" binding:"required,min=1,dive"`
+}
+
+type QuoteResponseRequest struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// ConvertQuoteRequest splits an accepted quote into jobs. A single job
+// without line_item_ids takes every line; otherwise each line must be
+// given to exactly one job.
+type ConvertQuoteRequest struct {
+	Jobs []QuoteJobRequest `json:"jobs" binding:"required,min=1,dive"`
+}
+
+type QuoteJobRequest struct {
+	Title           string    `json:"title"`
+	ScheduledAt     time.Time `json:"scheduled_at" binding:"required"`
+	DurationMinutes int       `json:"duration_minutes"`
+	TechnicianID    *uint     `json:"technician_id"`
+	LineItemIDs     []uint    `json:"line_item_ids"`
+}
+
+type PublicQuoteResponse struct {
+	Company       string                  `json:"company"`
+	CustomerName  string                  `json:"customer_name"`
+	Number        int                     `json:"number"`
+	Title         string                  `json:"title"`
+	Notes         string                  `json:"notes,omitempty"`
+	Status        string                  `json:"status"`
+	ValidUntil    *time.Time              `json:"valid_until,omitempty"`
+	LineItems     []*models.QuoteLineItem `json:"line_items"`
+	Subtotal      decimal.Decimal         `json:"subtotal"`
+	DiscountTotal decimal.Decimal         `json:"discount_total"`
+	TaxTotal      decimal.Decimal         `json:"tax_total"`
+	Total         decimal.Decimal         `json:"total"`
+}
+
+func (h *QuoteHandler) Create(c *gin.Context) {
+	organizationID := c.GetUint("organization_id")
+	organizationUserID := c.GetUint("organization_user_id")
+
+	var req QuoteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	quote := &models.Quote{
+		OrganizationID: organizationID,
+		Status:         models.QuoteDraft,
+		CreatedBy:      &organizationUserID,
+	}
+	if !h.applyRequest(c, quote, &req) {
+		return
+	}
+
+	if err := h.quoteRepo.Create(quote); err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create quote"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, quote)
+}
+
+func (h *QuoteHandler) GetAll(c *gin.Context) {
+	organizationID := c.GetUint("organization_id")
+
+	filters := make(map[string]interface{})
+	if status := c.Query("status"); status != "" {
+		filters["status"] = status
+	}
+	if customerIDStr := c.Query("customer_id"); customerIDStr != "" {
+		customerID, err := strconv.ParseUint(customerIDStr, 10, 32)
+		if err == nil {
+			filters["customer_id"] = uint(customerID)
+		}
+	}
+
+	quotes, err := h.quoteRepo.FindAll(organizationID, filters)
+	if err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch quotes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, quotes)
+}
+
+func (h *QuoteHandler) GetByID(c *gin.Context) {
+	quote, ok := h.findQuote(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, quote)
+}
+
+// Update replaces a draft quote's fields and line items
+func (h *QuoteHandler) Update(c *gin.Context) {
+	quote, ok := h.findQuote(c)
+	if !ok {
+		return
+	}
+	if quote.Status != models.QuoteDraft {
+		c.JSON(http.StatusConflict, gin.H{"error": models.ErrQuoteNotEditable.Error()})
+		return
+	}
+
+	var req QuoteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !h.applyRequest(c, quote, &req) {
+		return
+	}
+
+	if err := h.quoteRepo.Update(quote); err != nil {
+		respondQuoteError(c, err, "Failed to update quote")
+		return
+	}
+
+	c.JSON(http.StatusOK, quote)
+}
+
+func (h *QuoteHandler) Delete(c *gin.Context) {
+	organizationID := c.GetUint("organization_id")
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid quote ID"})
+		return
+	}
+
+	if err := h.quoteRepo.Delete(uint(id), organizationID); err != nil {
+		respondQuoteError(c, err, "Failed to delete quote")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Quote deleted successfully"})
+}
+
+// Send marks the quote as sent and returns a signed link the customer can
+// use to accept or decline it. Sending again issues a fresh link.
+func (h *QuoteHandler) Send(c *gin.Context) {
+	organizationID := c.GetUint("organization_id")
+
+	quote, ok := h.findQuote(c)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	if quote.IsExpired(now) {
+		c.JSON(http.StatusConflict, gin.H{"error": models.ErrQuoteExpired.Error()})
+		return
+	}
+
+	ttl := defaultQuoteLinkTTL
+	if quote.ValidUntil != nil {
+		ttl = quote.ValidUntil.Sub(now)
+	}
+
+	if err := h.quoteRepo.MarkSent(quote.ID, organizationID, now); err != nil {
+		respondQuoteError(c, err, "Failed to send quote")
+		return
+	}
+
+	token, expiresAt, err := utils.GeneratePublicToken(utils.ScopeQuoteApproval, organizationID, quote.ID, ttl)
+	if err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate quote link"})
+		return
+	}
+
+	quote.Status = models.QuoteSent
+	quote.SentAt = &now
+	h.events.Publish(organizationID, events.QuoteSent, quote)
+
+	c.JSON(http.StatusOK, gin.H{
+		"quote_url":  quoteURL(c, token),
+		"token":      token,
+		"expires_at": expiresAt,
+		"quote":      quote,
+	})
+}
+
+// Accept records an approval given outside the link, e.g. by phone
+func (h *QuoteHandler) Accept(c *gin.Context) {
+	h.respondFromOffice(c, true)
+}
+
+func (h *QuoteHandler) Decline(c *gin.Context) {
+	h.respondFromOffice(c, false)
+}
+
+func (h *QuoteHandler) respondFromOffice(c *gin.Context, accepted bool) {
+	organizationID := c.GetUint("organization_id")
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid quote ID"})
+		return
+	}
+
+	var req QuoteResponseRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.respond(c, organizationID, uint(id), accepted, req)
+}
+
+// Convert creates jobs from an accepted quote, priced from its line items
+func (h *QuoteHandler) Convert(c *gin.Context) {
+	organizationID := c.GetUint("organization_id")
+	organizationUserID := c.GetUint("organization_user_id")
+
+	quote, ok := h.findQuote(c)
+	if !ok {
+		return
+	}
+	switch {
+	case quote.Status != models.QuoteAccepted:
+		c.JSON(http.StatusConflict, gin.H{"error": models.ErrQuoteNotAccepted.Error()})
+		return
+	case quote.ConvertedAt != nil:
+		c.JSON(http.StatusConflict, gin.H{"error": models.ErrQuoteConverted.Error()})
+		return
+	}
+
+	var req ConvertQuoteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	groups, err := splitQuoteLines(quote, req.Jobs)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	jobs := make([]*models.Job, len(req.Jobs))
+	for i, jr := range req.Jobs {
+		title := jr.Title
+		if title == "" {
+			title = quote.Title
+			if len(req.Jobs) > 1 {
+				title = fmt.Sprintf("%s (%d/%d)", quote.Title, i+1, len(req.Jobs))
+			}
+		}
+
+		// The quote is priced in decimals; the job price column is the only float
+		total := decimal.Zero
+		descriptions := make([]string, 0, len(groups[i]))
+		for _, line := range groups[i] {
+			total = total.Add(line.Total)
+			descriptions = append(descriptions, fmt.Sprintf("%s x %s", line.Quantity.String(), line.Description))
+		}
+		price := total.InexactFloat64()
+
+		job := &models.Job{
+			OrganizationID:  organizationID,
+			CreatedBy:       &organizationUserID,
+			CustomerID:      quote.CustomerID,
+			TechnicianID:    jr.TechnicianID,
+			Title:           title,
+			Description:     strings.Join(descriptions, "\n"),
+			Status:          models.StatusScheduled,
+			ScheduledAt:     jr.ScheduledAt,
+			DurationMinutes: jr.DurationMinutes,
+			Price:           &price,
+		}
+		if job.DurationMinutes == 0 {
+			job.DurationMinutes = 60 // Default 1 hour
+		}
+
+		jobs[i] = job
+	}
+
+	if err := h.quoteRepo.Convert(quote.ID, organizationID, jobs, scheduleCheck(h.checker, organizationID, 0)); err != nil {
+		if !respondScheduleError(c, err) {
+			respondQuoteError(c, err, "Failed to convert quote")
+		}
+		return
+	}
+
+	for _, job := range jobs {
+		h.events.Publish(organizationID, events.JobCreated, job)
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"jobs": jobs})
+}
+
+// GetPublic shows the quote to the customer holding the link
+func (h *QuoteHandler) GetPublic(c *gin.Context) {
+	claims, err := utils.ValidatePublicToken(c.Param("token"), utils.ScopeQuoteApproval)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired link"})
+		return
+	}
+
+	quote, err := h.quoteRepo.FindByID(claims.ResourceID, claims.OrganizationID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Quote not found"})
+		return
+	}
+
+	response := PublicQuoteResponse{
+		Number:        quote.Number,
+		Title:         quote.Title,
+		Notes:         quote.Notes,
+		Status:        quote.Status,
+		ValidUntil:    quote.ValidUntil,
+		LineItems:     quote.LineItems,
+		Subtotal:      quote.Subtotal,
+		DiscountTotal: quote.DiscountTotal,
+		TaxTotal:      quote.TaxTotal,
+		Total:         quote.Total,
+	}
+	if org, err := h.userRepo.FindOrganizationByID(claims.OrganizationID); err == nil {
+		response.Company = org.Name
+	}
+	if customer, err := h.customerRepo.FindByID(quote.CustomerID, claims.OrganizationID); err == nil {
+		response.CustomerName = customer.Name
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// PublicAccept lets the customer accept through the link. The name they
+// type is recorded with the acceptance.
+func (h *QuoteHandler) PublicAccept(c *gin.Context) {
+	h.respondFromLink(c, true)
+}
+
+func (h *QuoteHandler) PublicDecline(c *gin.Context) {
+	h.respondFromLink(c, false)
+}
+
+func (h *QuoteHandler) respondFromLink(c *gin.Context, accepted bool) {
+	claims, err := utils.ValidatePublicToken(c.Param("token"), utils.ScopeQuoteApproval)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired link"})
+		return
+	}
+
+	var req QuoteResponseRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if accepted && strings.TrimSpace(req.Name) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Name is required to accept the quote"})
+		return
+	}
+
+	h.respond(c, claims.OrganizationID, claims.ResourceID, accepted, req)
+}
+
+func (h *QuoteHandler) respond(c *gin.Context, organizationID, id uint, accepted bool, req QuoteResponseRequest) {
+	name := strings.TrimSpace(req.Name)
+	if err := h.quoteRepo.Respond(id, organizationID, accepted, name, req.Reason, time.Now()); err != nil {
+		respondQuoteError(c, err, "Failed to record response")
+		return
+	}
+
+	quote, err := h.quoteRepo.FindByID(id, organizationID)
+	if err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch quote"})
+		return
+	}
+
+	eventType := events.QuoteDeclined
+	if accepted {
+		eventType = events.QuoteAccepted
+	}
+	h.events.Publish(organizationID, eventType, quote)
+
+	c.JSON(http.StatusOK, gin.H{"status": quote.Status, "responded_at": quote.RespondedAt})
+}
+
+// applyRequest copies a create or update request onto the quote and prices it
+func (h *QuoteHandler) applyRequest(c *gin.Context, quote *models.Quote, req *QuoteRequest) bool {
+	if _, err := h.customerRepo.FindByID(req.CustomerID, quote.OrganizationID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Customer not found"})
+		return false
+	}
+
+	lines := make([]*models.QuoteLineItem, len(req.LineItems))
+	for i, lr := range req.LineItems {
+		lines[i] = &models.QuoteLineItem{
+			Kind:        lr.Kind,
+			Description: strings.TrimSpace(lr.Description),
+			LinePricing: lr.pricing(),
+		}
+		if err := lines[i].Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("line %d: %v", i+1, err)})
+			return false
+		}
+	}
+
+	quote.CustomerID = req.CustomerID
+	quote.Title = req.Title
+	quote.Notes = req.Notes
+	quote.ValidUntil = req.ValidUntil
+	quote.LineItems = lines
+	quote.ComputeTotals()
+	if err := quote.DocumentTotals.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	return true
+}
+
+func (h *QuoteHandler) findQuote(c *gin.Context) (*models.Quote, bool) {
+	organizationID := c.GetUint("organization_id")
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid quote ID"})
+		return nil, false
+	}
+
+	quote, err := h.quoteRepo.FindByID(uint(id), organizationID)
+	if err != nil {
+		if err.Error() == "quote not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Quote not found"})
+			return nil, false
+		}
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch quote"})
+		return nil, false
+	}
+
+	return quote, true
+}
+
+// splitQuoteLines assigns the quote's lines to the requested jobs
+func splitQuoteLines(quote *models.Quote, jobs []QuoteJobRequest) ([][]*models.QuoteLineItem, error) {
+	if len(jobs) == 1 && len(jobs[0].LineItemIDs) == 0 {
+		return [][]*models.QuoteLineItem{quote.LineItems}, nil
+	}
+
+	byID := make(map[uint]*models.QuoteLineItem, len(quote.LineItems))
+	for _, line := range quote.LineItems {
+		byID[line.ID] = line
+	}
+
+	groups := make([][]*models.QuoteLineItem, len(jobs))
+	used := make(map[uint]bool)
+	for i, job := range jobs {
+		if len(job.LineItemIDs) == 0 {
+			return nil, fmt.Errorf("job %d has no line items", i+1)
+		}
+		for _, id := range job.LineItemIDs {
+			line, ok := byID[id]
+			if !ok {
+				return nil, fmt.Errorf("line item %d is not on this quote", id)
+			}
+			if used[id] {
+				return nil, fmt.Errorf("line item %d is assigned to more than one job", id)
+			}
+			used[id] = true
+			groups[i] = append(groups[i], line)
+		}
+	}
+	if len(used) != len(byID) {
+		return nil, errors.New("every line item must be assigned to a job")
+	}
+
+	return groups, nil
+}
+
+func respondQuoteError(c *gin.Context, err error, message string) {
+	switch {
+	case err.Error() == "quote not found":
+		c.JSON(http.StatusNotFound, gin.H{"error": "Quote not found"})
+	case errors.Is(err, models.ErrQuoteExpired):
+		c.JSON(http.StatusGone, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrQuoteNotEditable), errors.Is(err, models.ErrQuoteNotSent),
+		errors.Is(err, models.ErrQuoteAnswered), errors.Is(err, models.ErrQuoteNotAccepted),
+		errors.Is(err, models.ErrQuoteConverted):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
+
+// quoteURL builds the customer-facing approval link. PUBLIC_QUOTE_URL points
+// at the frontend page; without it the link goes straight to the public API.
+func quoteURL(c *gin.Context, token string) string {
+	if base := os.Getenv("PUBLIC_QUOTE_URL"); base != "" {
+		return strings.TrimRight(base, "/") + "/" + token
+	}
+
+	scheme := "https"
+	if c.Request.TLS == nil && c.GetHeader("X-Forwarded-Proto") != "https" {
+		scheme = "http"
+	}
+	return scheme + "://" + c.Request.Host + "/api/v1/public/quotes/" + token
+}
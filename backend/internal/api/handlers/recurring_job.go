@@ -0,0 +1,375 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/gin-gonic/gin"
+	"github.com/ireuven89/routewise/internal/models"
+	"github.com/ireuven89/routewise/internal/recurrence"
+	"github.com/ireuven89/routewise/internal/repository"
+)
+
+// Edit scopes for a job that belongs to a recurring series
+const (
+	scopeThis   = "this"
+	scopeFuture = "future"
+)
+
+const upcomingPreviewCount = 10
+
+type RecurringJobHandler struct {
+	templateRepo *repository.JobTemplateRepository
+	generator    *recurrence.Generator
+}
+
+func NewRecurringJobHandler(db *sql.DB, generator *recurrence.Generator) *RecurringJobHandler {
+	return &RecurringJobHandler{
+		templateRepo: repository.NewJobTemplateRepository(db),
+		generator:    generator,
+	}
+}
+
+// RecurringJobRequest takes the schedule either as a structured recurrence or
+// as an RRULE string
+type RecurringJobRequest struct {
+	CustomerID      uint             `json:"customer_id" binding:"required"`
+	TechnicianID    *uint            `json:"technician_id"`
+	Title           string           `json:"title" binding:"required"`
+	Description     string           `json:"description"`
+	DurationMinutes int              `json:"duration_minutes"`
+	Price           *float64         `json:"price"`
+	Metadata        models.JSON      `json:"metadata"`
+	StartsAt        time.Time        `json:"starts_at" binding:"required"`
+	Timezone        string           `json:"timezone"`
+	Recurrence      *recurrence.Rule `json:"recurrence"`
+	RRule           string           `json:"rrule"`
+}
+
+// apply validates the request and copies it onto t
+func (req *RecurringJobRequest) apply(t *models.JobTemplate) error {
+	var rule recurrence.Rule
+	switch {
+	case req.Recurrence != nil:
+		rule = *req.Recurrence
+		if err := rule.Validate(); err != nil {
+			return err
+		}
+	case req.RRule != "":
+		parsed, err := recurrence.Parse(req.RRule)
+		if err != nil {
+			return err
+		}
+		rule = parsed
+	default:
+		return errors.New("recurrence or rrule is required")
+	}
+
+	timezone := req.Timezone
+	if timezone == "" {
+		timezone = "UTC"
+	}
+	if _, err := time.LoadLocation(timezone); err != nil {
+		return errors.New("unknown timezone")
+	}
+
+	t.CustomerID = req.CustomerID
+	t.TechnicianID = req.TechnicianID
+	t.Title = req.Title
+	t.Description = req.Description
+	t.DurationMinutes = req.DurationMinutes
+	if t.DurationMinutes == 0 {
+		t.DurationMinutes = 60 // Default 1 hour
+	}
+	t.Price = req.Price
+	t.Metadata = req.Metadata
+	t.RRule = rule.String()
+	t.StartsAt = req.StartsAt
+	t.Timezone = timezone
+	return nil
+}
+
+type recurringJobResponse struct {
+	*models.JobTemplate
+	Recurrence recurrence.Rule `json:"recurrence"`
+	Upcoming   []time.Time     `json:"upcoming"`
+}
+
+func newRecurringJobResponse(t *models.JobTemplate) recurringJobResponse {
+	response := recurringJobResponse{JobTemplate: t, Upcoming: []time.Time{}}
+	if rule, _, err := recurrence.TemplateRule(t); err == nil {
+		response.Recurrence = rule
+	}
+	if t.Active {
+		if upcoming, err := recurrence.Preview(t, time.Now(), upcomingPreviewCount); err == nil {
+			response.Upcoming = upcoming
+		}
+	}
+	return response
+}
+
+func (h *RecurringJobHandler) Create(c *gin.Context) {
+	organizationID := c.GetUint("organization_id")
+	organizationUserID := c.GetUint("organization_user_id")
+
+	var req RecurringJobRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	template := &models.JobTemplate{
+		OrganizationID: organizationID,
+		CreatedBy:      &organizationUserID,
+		Active:         true,
+	}
+	if err := req.apply(template); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.templateRepo.Create(template); err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create recurring job"})
+		return
+	}
+
+	created, err := h.generator.Generate(template, time.Now())
+	if err != nil {
+		// The background generator retries on its next run
+		sentry.CaptureException(err)
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"recurring_job": newRecurringJobResponse(template),
+		"jobs_created":  created,
+	})
+}
+
+func (h *RecurringJobHandler) GetAll(c *gin.Context) {
+	organizationID := c.GetUint("organization_id")
+
+	templates, err := h.templateRepo.FindAll(organizationID, c.Query("include_inactive") == "true")
+	if err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch recurring jobs"})
+		return
+	}
+
+	response := make([]recurringJobResponse, 0, len(templates))
+	for _, t := range templates {
+		response = append(response, newRecurringJobResponse(t))
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *RecurringJobHandler) GetByID(c *gin.Context) {
+	template, ok := h.findTemplate(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, newRecurringJobResponse(template))
+}
+
+// Update edits the series for all future occurrences. Changing the schedule
+// replaces the unedited future occurrences; other changes are copied onto them.
+func (h *RecurringJobHandler) Update(c *gin.Context) {
+	template, ok := h.findTemplate(c)
+	if !ok {
+		return
+	}
+
+	var req RecurringJobRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	before := *template
+	if err := req.apply(template); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := time.Now()
+	scheduleChanged := template.RRule != before.RRule ||
+		!template.StartsAt.Equal(before.StartsAt) ||
+		template.Timezone != before.Timezone
+
+	if scheduleChanged {
+		template.GeneratedUntil = &now
+	}
+
+	updated, err := h.templateRepo.UpdateSeries(template, now, scheduleChanged)
+	if err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update recurring job"})
+		return
+	}
+
+	created := 0
+	if template.Active {
+		if created, err = h.generator.Generate(template, now); err != nil {
+			sentry.CaptureException(err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"recurring_job": newRecurringJobResponse(template),
+		"jobs_updated":  updated,
+		"jobs_created":  created,
+	})
+}
+
+// Delete stops the series. Past and already edited occurrences are kept.
+func (h *RecurringJobHandler) Delete(c *gin.Context) {
+	template, ok := h.findTemplate(c)
+	if !ok {
+		return
+	}
+
+	template.Active = false
+	deleted, err := h.templateRepo.EndSeries(template, time.Now())
+	if err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete recurring job"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":      "Recurring job stopped",
+		"jobs_deleted": deleted,
+	})
+}
+
+func (h *RecurringJobHandler) findTemplate(c *gin.Context) (*models.JobTemplate, bool) {
+	organizationID := c.GetUint("organization_id")
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recurring job ID"})
+		return nil, false
+	}
+
+	template, err := h.templateRepo.FindByID(uint(id), organizationID)
+	if err != nil {
+		if err.Error() == "job template not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Recurring job not found"})
+		} else {
+			sentry.CaptureException(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch recurring job"})
+		}
+		return nil, false
+	}
+
+	return template, true
+}
+
+// splitSeries applies the edit of job to it and every later occurrence: the
+// current series ends before it and a new series starts from it
+func (h *JobHandler) splitSeries(job *models.Job, change *models.StatusChange, check repository.ScheduleCheck) (*models.JobStatusUpdate, error) {
+	old, err := h.templateRepo.FindByID(*job.TemplateID, job.OrganizationID)
+	if err != nil {
+		return nil, err
+	}
+	_, dtstart, err := recurrence.TemplateRule(old)
+	if err != nil {
+		return nil, err
+	}
+
+	pivot := *job.OccurrenceAt
+	shift := job.ScheduledAt.Sub(pivot)
+	shiftDays := calendarDays(pivot.In(dtstart.Location()), job.ScheduledAt.In(dtstart.Location()))
+
+	nextRule, err := recurrence.ContinueFrom(old, pivot, shiftDays)
+	if err != nil {
+		return nil, err
+	}
+	endRule, err := recurrence.EndBefore(old, pivot)
+	if err != nil {
+		return nil, err
+	}
+
+	next := *old
+	next.ID = 0
+	next.ParentTemplateID = &old.ID
+	next.CustomerID = job.CustomerID
+	next.TechnicianID = job.TechnicianID
+	next.Title = job.Title
+	next.Description = job.Description
+	next.DurationMinutes = job.DurationMinutes
+	next.Price = job.Price
+	next.Metadata = job.Metadata
+	next.RRule = nextRule
+	next.StartsAt = pivot.Add(shift)
+	if old.GeneratedUntil != nil {
+		generatedUntil := old.GeneratedUntil.Add(shift)
+		next.GeneratedUntil = &generatedUntil
+	}
+
+	old.RRule = endRule
+	if !pivot.After(dtstart) {
+		old.Active = false // nothing is left of the old series
+	}
+
+	_, update, err := h.templateRepo.SplitSeries(old, &next, job, pivot, shift, change, check)
+	if err != nil {
+		return nil, err
+	}
+
+	occurrenceAt := pivot.Add(shift)
+	job.TemplateID = &next.ID
+	job.OccurrenceAt = &occurrenceAt
+	job.IsException = false
+	return update, nil
+}
+
+// endSeriesAt deletes job and every unedited later occurrence of its series
+func (h *JobHandler) endSeriesAt(job *models.Job) (int64, error) {
+	template, err := h.templateRepo.FindByID(*job.TemplateID, job.OrganizationID)
+	if err != nil {
+		return 0, err
+	}
+	_, dtstart, err := recurrence.TemplateRule(template)
+	if err != nil {
+		return 0, err
+	}
+
+	pivot := *job.OccurrenceAt
+	endRule, err := recurrence.EndBefore(template, pivot)
+	if err != nil {
+		return 0, err
+	}
+	template.RRule = endRule
+	if !pivot.After(dtstart) {
+		template.Active = false
+	}
+
+	deleted, err := h.templateRepo.EndSeries(template, pivot)
+	if err != nil {
+		return 0, err
+	}
+
+	// The job itself goes even if it was edited or already started
+	if err := h.jobRepo.Delete(job.ID, job.OrganizationID); err == nil {
+		deleted++
+	} else if err.Error() != "job not found" {
+		return deleted, err
+	}
+
+	return deleted, nil
+}
+
+func calendarDays(from, to time.Time) int {
+	fy, fm, fd := from.Date()
+	ty, tm, td := to.Date()
+	a := time.Date(fy, fm, fd, 0, 0, 0, 0, time.UTC)
+	b := time.Date(ty, tm, td, 0, 0, 0, 0, time.UTC)
+	return int(b.Sub(a).Hours() / 24)
+}
@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCalendarDays(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("time zone data not available")
+	}
+
+	tests := []struct {
+		name string
+		from time.Time
+		to   time.Time
+		want int
+	}{
+		{"same day", time.Date(2026, 3, 2, 9, 0, 0, 0, loc), time.Date(2026, 3, 2, 17, 0, 0, 0, loc), 0},
+		{"later the next day", time.Date(2026, 3, 2, 9, 0, 0, 0, loc), time.Date(2026, 3, 3, 8, 0, 0, 0, loc), 1},
+		{"earlier the next day", time.Date(2026, 3, 2, 23, 0, 0, 0, loc), time.Date(2026, 3, 3, 1, 0, 0, 0, loc), 1},
+		{"back a week", time.Date(2026, 3, 9, 9, 0, 0, 0, loc), time.Date(2026, 3, 2, 9, 0, 0, 0, loc), -7},
+		// Only 23 hours apart, as clocks moved forward in between
+		{"across spring forward", time.Date(2026, 3, 7, 9, 0, 0, 0, loc), time.Date(2026, 3, 8, 9, 0, 0, 0, loc), 1},
+		// 25 hours apart
+		{"across fall back", time.Date(2026, 10, 31, 23, 30, 0, 0, loc), time.Date(2026, 11, 1, 23, 30, 0, 0, loc), 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := calendarDays(tt.from, tt.to); got != tt.want {
+				t.Errorf("calendarDays() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,409 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/gin-gonic/gin"
+	"github.com/ireuven89/routewise/internal/events"
+	"github.com/ireuven89/routewise/internal/models"
+	"github.com/ireuven89/routewise/internal/repository"
+	"github.com/ireuven89/routewise/internal/routing"
+	"github.com/ireuven89/routewise/internal/scheduling"
+)
+
+var errInvalidCoordinates = errors.New("invalid coordinates")
+
+type RouteHandler struct {
+	checker      *scheduling.Checker
+	jobRepo      *repository.JobRepository
+	customerRepo *repository.CustomerRepository
+	workerRepo   *repository.WorkerRepository
+	events       events.Publisher
+}
+
+func NewRouteHandler(db *sql.DB, checker *scheduling.Checker, publisher events.Publisher) *RouteHandler {
+	return &RouteHandler{
+		checker:      checker,
+		jobRepo:      repository.NewJobRepository(db),
+		customerRepo: repository.NewCustomerRepository(db),
+		workerRepo:   repository.NewWorkerRepository(db),
+		events:       publisher,
+	}
+}
+
+type RouteStop struct {
+	Sequence     int         `json:"sequence"`
+	DistanceKm   float64     `json:"distance_km"`
+	CumulativeKm float64     `json:"cumulative_km"`
+	Job          *models.Job `json:"job"`
+}
+
+type WorkerRouteResponse struct {
+	WorkerID        uint          `json:"worker_id"`
+	Date            string        `json:"date"`
+	TotalDistanceKm float64       `json:"total_distance_km"`
+	Stops           []RouteStop   `json:"stops"`
+	Unrouted        []*models.Job `json:"unrouted"`
+}
+
+// GetWorkerRoute orders a worker's jobs for a day by travel distance
+func (h *RouteHandler) GetWorkerRoute(c *gin.Context) {
+	organizationID := c.GetUint("organization_id")
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid worker ID"})
+		return
+	}
+
+	date := c.Query("date")
+	if date == "" {
+		date = time.Now().Format(routeDateLayout)
+	}
+	if _, err := time.Parse(routeDateLayout, date); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date, expected YYYY-MM-DD"})
+		return
+	}
+
+	start, err := parseOptionalPoint(c.Query("start_lat"), c.Query("start_lng"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, err := h.workerRepo.FindByID(uint(id), organizationID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Worker not found"})
+		return
+	}
+
+	filters := map[string]interface{}{
+		"technician_id":  uint(id),
+		"scheduled_date": date,
+	}
+	jobs, err := h.jobRepo.FindAll(organizationID, filters, "scheduled_at")
+	if err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch jobs"})
+		return
+	}
+
+	customers, err := h.customerRepo.FindByIDs(jobCustomerIDs(jobs), organizationID)
+	if err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch customers"})
+		return
+	}
+
+	var routable []*models.Job
+	var stops []routing.Stop
+	unrouted := []*models.Job{}
+
+	for _, job := range jobs {
+		if job.Status == models.StatusCancelled || job.Status == models.StatusCompleted {
+			continue
+		}
+		customer, ok := customers[job.CustomerID]
+		if ok {
+			job.Customer = *customer
+		}
+		if !ok || customer.Latitude == nil || customer.Longitude == nil {
+			unrouted = append(unrouted, job)
+			continue
+		}
+		routable = append(routable, job)
+		stops = append(stops, routing.Stop{
+			ID:    job.ID,
+			Point: routing.Point{Lat: *customer.Latitude, Lng: *customer.Longitude},
+		})
+	}
+
+	route := routing.OptimizeRoute(start, stops)
+
+	response := WorkerRouteResponse{
+		WorkerID:        uint(id),
+		Date:            date,
+		TotalDistanceKm: route.TotalKm,
+		Stops:           make([]RouteStop, 0, len(route.Order)),
+		Unrouted:        unrouted,
+	}
+
+	cumulative := 0.0
+	for i, idx := range route.Order {
+		cumulative += route.LegsKm[i]
+		response.Stops = append(response.Stops, RouteStop{
+			Sequence:     i + 1,
+			DistanceKm:   route.LegsKm[i],
+			CumulativeKm: cumulative,
+			Job:          routable[idx],
+		})
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func jobCustomerIDs(jobs []*models.Job) []uint {
+	seen := make(map[uint]bool)
+	ids := []uint{}
+	for _, job := range jobs {
+		if !seen[job.CustomerID] {
+			seen[job.CustomerID] = true
+			ids = append(ids, job.CustomerID)
+		}
+	}
+	return ids
+}
+
+// parseOptionalPoint reads a lat/lng pair where both or neither must be set
+func parseOptionalPoint(latStr, lngStr string) (*routing.Point, error) {
+	if latStr == "" && lngStr == "" {
+		return nil, nil
+	}
+
+	lat, err := strconv.ParseFloat(latStr, 64)
+	if err != nil || lat < -90 || lat > 90 {
+		return nil, errInvalidCoordinates
+	}
+	lng, err := strconv.ParseFloat(lngStr, 64)
+	if err != nil || lng < -180 || lng > 180 {
+		return nil, errInvalidCoordinates
+	}
+
+	return &routing.Point{Lat: lat, Lng: lng}, nil
+}
+
+const (
+	defaultMaxShiftHours    = 8.0
+	defaultWindowMinutes    = 15
+	routeDateLayout         = "2006-01-02"
+	maxShiftHoursUpperLimit = 24.0
+)
+
+type FleetPlanResponse struct {
+	Date          string  `json:"date"`
+	MaxShiftHours float64 `json:"max_shift_hours"`
+	WindowMinutes int     `json:"window_minutes"`
+	SpeedKmh      float64 `json:"speed_kmh"`
+	*routing.FleetPlan
+}
+
+type AcceptFleetPlanRequest struct {
+	Assignments []FleetAssignment `json:"assignments" binding:"required,dive"`
+}
+
+type FleetAssignment struct {
+	WorkerID uint   `json:"worker_id" binding:"required"`
+	JobIDs   []uint `json:"job_ids" binding:"required"`
+}
+
+// ProposeFleetPlan builds a dry-run assignment of a day's unassigned jobs to
+// active workers. Nothing is written; see AcceptFleetPlan.
+func (h *RouteHandler) ProposeFleetPlan(c *gin.Context) {
+	organizationID := c.GetUint("organization_id")
+
+	date := c.Query("date")
+	if date == "" {
+		date = time.Now().Format(routeDateLayout)
+	}
+	if _, err := time.Parse(routeDateLayout, date); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date, expected YYYY-MM-DD"})
+		return
+	}
+
+	maxShiftHours := defaultMaxShiftHours
+	if v := c.Query("max_shift_hours"); v != "" {
+		parsed, err := strconv.ParseFloat(v, 64)
+		if err != nil || parsed <= 0 || parsed > maxShiftHoursUpperLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid max_shift_hours"})
+			return
+		}
+		maxShiftHours = parsed
+	}
+
+	windowMinutes := defaultWindowMinutes
+	if v := c.Query("window_minutes"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid window_minutes"})
+			return
+		}
+		windowMinutes = parsed
+	}
+
+	speedKmh := routing.DefaultSpeedKmh
+	if v := c.Query("speed_kmh"); v != "" {
+		parsed, err := strconv.ParseFloat(v, 64)
+		if err != nil || parsed <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid speed_kmh"})
+			return
+		}
+		speedKmh = parsed
+	}
+
+	workers, err := h.workerRepo.FindAll(organizationID, true)
+	if err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch workers"})
+		return
+	}
+
+	dayJobs, err := h.jobRepo.FindAll(organizationID, map[string]interface{}{"scheduled_date": date}, "scheduled_at")
+	if err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch jobs"})
+		return
+	}
+
+	customers, err := h.customerRepo.FindByIDs(jobCustomerIDs(dayJobs), organizationID)
+	if err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch customers"})
+		return
+	}
+
+	window := time.Duration(windowMinutes) * time.Minute
+	toFleetJob := func(job *models.Job) routing.FleetJob {
+		fj := routing.FleetJob{
+			ID:          job.ID,
+			WindowStart: job.ScheduledAt,
+			WindowEnd:   job.ScheduledAt.Add(window),
+			Duration:    time.Duration(job.DurationMinutes) * time.Minute,
+		}
+		if customer, ok := customers[job.CustomerID]; ok && customer.Latitude != nil && customer.Longitude != nil {
+			fj.Point = &routing.Point{Lat: *customer.Latitude, Lng: *customer.Longitude}
+		}
+		return fj
+	}
+
+	// Jobs already on a worker's day stay where they are
+	assigned := make(map[uint][]routing.FleetJob)
+	var unassigned []routing.FleetJob
+	for _, job := range dayJobs {
+		if job.Status == models.StatusCancelled {
+			continue
+		}
+		if job.TechnicianID != nil {
+			assigned[*job.TechnicianID] = append(assigned[*job.TechnicianID], toFleetJob(job))
+		} else if job.Status == models.StatusScheduled {
+			unassigned = append(unassigned, toFleetJob(job))
+		}
+	}
+
+	fleet := make([]routing.FleetWorker, 0, len(workers))
+	for _, w := range workers {
+		fleet = append(fleet, routing.FleetWorker{
+			ID:       w.ID,
+			MaxShift: time.Duration(maxShiftHours * float64(time.Hour)),
+			Assigned: assigned[w.ID],
+		})
+	}
+
+	plan := routing.PlanFleet(fleet, unassigned, routing.FleetOptions{SpeedKmh: speedKmh})
+
+	c.JSON(http.StatusOK, FleetPlanResponse{
+		Date:          date,
+		MaxShiftHours: maxShiftHours,
+		WindowMinutes: windowMinutes,
+		SpeedKmh:      speedKmh,
+		FleetPlan:     plan,
+	})
+}
+
+// AcceptFleetPlan applies a proposal from ProposeFleetPlan. Every job must
+// still be scheduled and unassigned, and pass the same availability checks
+// as assigning it on its own, otherwise nothing is written.
+func (h *RouteHandler) AcceptFleetPlan(c *gin.Context) {
+	organizationID := c.GetUint("organization_id")
+
+	var req AcceptFleetPlanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The version each job was checked at, so later changes are not overwritten
+	versions := make(map[uint]int)
+	for _, a := range req.Assignments {
+		worker, err := h.workerRepo.FindByID(a.WorkerID, organizationID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Worker %d not found", a.WorkerID)})
+			return
+		}
+		if !worker.IsActive {
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Worker %d is not active", a.WorkerID)})
+			return
+		}
+
+		for _, jobID := range a.JobIDs {
+			if _, ok := versions[jobID]; ok {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Job %d appears more than once", jobID)})
+				return
+			}
+
+			job, err := h.jobRepo.FindByID(jobID, organizationID)
+			if err != nil {
+				c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Job %d not found", jobID)})
+				return
+			}
+			if job.Status != models.StatusScheduled || job.TechnicianID != nil {
+				c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Job %d changed since the plan was proposed", jobID)})
+				return
+			}
+			versions[jobID] = job.Version
+		}
+	}
+
+	var assignments []models.JobAssignment
+	for _, a := range req.Assignments {
+		for _, jobID := range a.JobIDs {
+			assignments = append(assignments, models.JobAssignment{JobID: jobID, WorkerID: a.WorkerID, ExpectedVersion: versions[jobID]})
+		}
+	}
+
+	// The same checks as assigning one job; remember which job was blocked
+	var blockedJobID uint
+	check := func(jobID uint) repository.ScheduleCheck {
+		jobCheck := scheduleCheck(h.checker, organizationID, jobID)
+		return func(tx *sql.Tx, workerID uint, start time.Time, durationMinutes int) ([]models.ScheduleConflict, error) {
+			conflicts, err := jobCheck(tx, workerID, start, durationMinutes)
+			if err != nil {
+				blockedJobID = jobID
+			}
+			return conflicts, err
+		}
+	}
+
+	warnings, err := h.jobRepo.AssignAll(organizationID, assignments, check)
+	if err != nil {
+		var blocked *scheduleBlockedError
+		switch {
+		case errors.Is(err, models.ErrStaleJob):
+			c.JSON(http.StatusConflict, gin.H{"error": "A job changed since the plan was proposed"})
+		case errors.As(err, &blocked):
+			c.JSON(http.StatusConflict, gin.H{
+				"error":     fmt.Sprintf("Worker is not available for job %d", blockedJobID),
+				"job_id":    blockedJobID,
+				"conflicts": blocked.conflicts,
+			})
+		default:
+			sentry.CaptureException(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign jobs"})
+		}
+		return
+	}
+
+	for _, a := range assignments {
+		h.events.Publish(organizationID, events.JobAssigned, gin.H{"job_id": a.JobID, "technician_id": a.WorkerID})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Plan accepted",
+		"assigned_count": len(assignments),
+		"warnings":       warnings,
+	})
+}
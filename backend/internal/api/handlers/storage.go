@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/gin-gonic/gin"
+	"github.com/ireuven89/routewise/services"
+)
+
+// StorageHandler serves downloads and direct uploads for backends without
+// their own endpoint (local disk, memory). Requests are authorized by the
+// signed URL.
+type StorageHandler struct {
+	storage services.SelfServedStorage
+}
+
+func NewStorageHandler(storage services.SelfServedStorage) *StorageHandler {
+	return &StorageHandler{storage: storage}
+}
+
+func (h *StorageHandler) Download(c *gin.Context) {
+	key := strings.TrimPrefix(c.Param("key"), "/")
+
+	_, err := h.storage.Signer().Verify(http.MethodGet, key, c.Request.URL.Query(), time.Now())
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invalid or expired link"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	info, err := h.storage.StatFile(ctx, key)
+	if err != nil {
+		respondStorageError(c, err)
+		return
+	}
+	body, err := h.storage.DownloadFile(ctx, key)
+	if err != nil {
+		respondStorageError(c, err)
+		return
+	}
+	defer body.Close()
+
+	c.DataFromReader(http.StatusOK, info.Size, info.ContentType, body, map[string]string{
+		"Cache-Control":          "private, max-age=300",
+		"Content-Disposition":    fmt.Sprintf("inline; filename=%q", path.Base(key)),
+		"X-Content-Type-Options": "nosniff",
+		// Stored SVGs or HTML must not run script on the API origin
+		"Content-Security-Policy": "default-src 'none'; style-src 'unsafe-inline'; sandbox",
+	})
+}
+
+// Upload accepts the body of a presigned PUT. The link fixes the size, as an
+// S3 presigned PUT does.
+func (h *StorageHandler) Upload(c *gin.Context) {
+	key := strings.TrimPrefix(c.Param("key"), "/")
+
+	size, err := h.storage.Signer().Verify(http.MethodPut, key, c.Request.URL.Query(), time.Now())
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invalid or expired link"})
+		return
+	}
+	if c.Request.ContentLength != size {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Content-Length must be %d", size)})
+		return
+	}
+
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, size)
+	if err := h.storage.UploadFile(c.Request.Context(), body, key, c.ContentType()); err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store file"})
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+func respondStorageError(c *gin.Context, err error) {
+	if errors.Is(err, services.ErrObjectNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+	sentry.CaptureException(err)
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
+}
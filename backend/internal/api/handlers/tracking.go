@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/gin-gonic/gin"
+	"github.com/ireuven89/routewise/internal/models"
+	"github.com/ireuven89/routewise/internal/repository"
+	"github.com/ireuven89/routewise/internal/routing"
+	"github.com/ireuven89/routewise/pkg/utils"
+)
+
+const (
+	// Tracking links outlive the ETA so the customer can still see the visit status
+	defaultTrackingLinkTTL = 4 * time.Hour
+	// ETAs are not shown from positions older than this
+	maxLocationAgeForETA = 30 * time.Minute
+)
+
+type TrackingHandler struct {
+	jobRepo      *repository.JobRepository
+	customerRepo *repository.CustomerRepository
+	workerRepo   *repository.WorkerRepository
+	userRepo     *repository.OrganizationUserRepository
+	estimator    routing.TravelTimeEstimator
+}
+
+func NewTrackingHandler(db *sql.DB, estimator routing.TravelTimeEstimator) *TrackingHandler {
+	return &TrackingHandler{
+		jobRepo:      repository.NewJobRepository(db),
+		customerRepo: repository.NewCustomerRepository(db),
+		workerRepo:   repository.NewWorkerRepository(db),
+		userRepo:     repository.NewUserRepository(db),
+		estimator:    estimator,
+	}
+}
+
+type ETA struct {
+	DistanceKm   float64   `json:"distance_km"`
+	Minutes      int       `json:"minutes"`
+	ArrivalAt    time.Time `json:"arrival_at"`
+	LocationTime time.Time `json:"location_time"`
+}
+
+type PublicTrackingResponse struct {
+	Company     string           `json:"company"`
+	JobTitle    string           `json:"job_title"`
+	Status      models.JobStatus `json:"status"`
+	ScheduledAt time.Time        `json:"scheduled_at"`
+	CompletedAt *time.Time       `json:"completed_at,omitempty"`
+	WorkerName  string           `json:"worker_name,omitempty"`
+	ETA         *ETA             `json:"eta"`
+}
+
+// OnMyWay computes an ETA for the assigned worker and returns a shareable,
+// expiring tracking link for the customer
+func (h *TrackingHandler) OnMyWay(c *gin.Context) {
+	organizationID := c.GetUint("organization_id")
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid job ID"})
+		return
+	}
+
+	job, err := h.jobRepo.FindByID(uint(id), organizationID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	}
+	if job.TechnicianID == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Job has no assigned worker"})
+		return
+	}
+	if job.Status != models.StatusScheduled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Job is not scheduled"})
+		return
+	}
+
+	eta, err := h.computeETA(job, organizationID)
+	if err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute ETA"})
+		return
+	}
+
+	ttl := defaultTrackingLinkTTL
+	if eta != nil && time.Until(eta.ArrivalAt)+2*time.Hour > ttl {
+		ttl = time.Until(eta.ArrivalAt) + 2*time.Hour
+	}
+
+	token, expiresAt, err := utils.GeneratePublicToken(utils.ScopeJobTracking, organizationID, job.ID, ttl)
+	if err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate tracking link"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"tracking_url": trackingURL(c, token),
+		"token":        token,
+		"expires_at":   expiresAt,
+		"eta":          eta,
+	})
+}
+
+// GetPublicStatus serves the tracking page data. It is reachable without an
+// account; the token only grants access to this one job.
+func (h *TrackingHandler) GetPublicStatus(c *gin.Context) {
+	claims, err := utils.ValidatePublicToken(c.Param("token"), utils.ScopeJobTracking)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired link"})
+		return
+	}
+
+	job, err := h.jobRepo.FindByID(claims.ResourceID, claims.OrganizationID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	}
+
+	response := PublicTrackingResponse{
+		JobTitle:    job.Title,
+		Status:      job.Status,
+		ScheduledAt: job.ScheduledAt,
+		CompletedAt: job.CompletedAt,
+	}
+
+	if org, err := h.userRepo.FindOrganizationByID(claims.OrganizationID); err == nil {
+		response.Company = org.Name
+	}
+
+	if job.TechnicianID != nil {
+		if worker, err := h.workerRepo.FindByID(*job.TechnicianID, claims.OrganizationID); err == nil {
+			response.WorkerName = firstName(worker.Name)
+		}
+	}
+
+	if job.Status == models.StatusScheduled && job.TechnicianID != nil {
+		eta, err := h.computeETA(job, claims.OrganizationID)
+		if err != nil {
+			sentry.CaptureException(err)
+		}
+		response.ETA = eta
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// computeETA returns nil when the worker's position or the site is unknown
+func (h *TrackingHandler) computeETA(job *models.Job, organizationID uint) (*ETA, error) {
+	worker, err := h.workerRepo.FindByID(*job.TechnicianID, organizationID)
+	if err != nil {
+		return nil, err
+	}
+	if worker.LastLat == nil || worker.LastLng == nil || worker.LastSeenAt == nil {
+		return nil, nil
+	}
+	if time.Since(*worker.LastSeenAt) > maxLocationAgeForETA {
+		return nil, nil
+	}
+
+	customer, err := h.customerRepo.FindByID(job.CustomerID, organizationID)
+	if err != nil {
+		return nil, err
+	}
+	if customer.Latitude == nil || customer.Longitude == nil {
+		return nil, nil
+	}
+
+	now := time.Now()
+	estimate := h.estimator.Estimate(
+		routing.Point{Lat: *worker.LastLat, Lng: *worker.LastLng},
+		routing.Point{Lat: *customer.Latitude, Lng: *customer.Longitude},
+		now,
+	)
+
+	return &ETA{
+		DistanceKm:   estimate.DistanceKm,
+		Minutes:      estimate.Minutes,
+		ArrivalAt:    now.Add(estimate.Duration),
+		LocationTime: *worker.LastSeenAt,
+	}, nil
+}
+
+// trackingURL builds the customer-facing link. PUBLIC_TRACKING_URL points at
+// the frontend page; without it the link goes straight to the public API.
+func trackingURL(c *gin.Context, token string) string {
+	if base := os.Getenv("PUBLIC_TRACKING_URL"); base != "" {
+		return strings.TrimRight(base, "/") + "/" + token
+	}
+
+	scheme := "https"
+	if c.Request.TLS == nil && c.GetHeader("X-Forwarded-Proto") != "https" {
+		scheme = "http"
+	}
+	return scheme + "://" + c.Request.Host + "/api/v1/public/track/" + token
+}
+
+func firstName(name string) string {
+	if fields := strings.Fields(name); len(fields) > 0 {
+		return fields[0]
+	}
+	return ""
+}
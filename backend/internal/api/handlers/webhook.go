@@ -0,0 +1,329 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/gin-gonic/gin"
+	"github.com/ireuven89/routewise/internal/events"
+	"github.com/ireuven89/routewise/internal/models"
+	"github.com/ireuven89/routewise/internal/repository"
+	"github.com/ireuven89/routewise/internal/webhooks"
+)
+
+const (
+	defaultDeliveryLimit = 50
+	maxDeliveryLimit     = 500
+)
+
+type WebhookHandler struct {
+	webhookRepo *repository.WebhookRepository
+	dispatcher  *webhooks.Dispatcher
+}
+
+func NewWebhookHandler(db *sql.DB, dispatcher *webhooks.Dispatcher) *WebhookHandler {
+	return &WebhookHandler{
+		webhookRepo: repository.NewWebhookRepository(db),
+		dispatcher:  dispatcher,
+	}
+}
+
+type WebhookRequest struct {
+	URL         string   `json:"url" binding:"required"`
+	EventTypes  []string `json:"event_types"` // empty subscribes to every event
+	Description string   `json:"description"`
+	Secret      string   `json:"secret" binding:"omitempty,min=16,max=100"` // generated when empty
+	IsActive    *bool    `json:"is_active"`
+}
+
+// webhookWithSecret is only sent when the secret is new
+type webhookWithSecret struct {
+	*models.WebhookSubscription
+	Secret string `json:"secret"`
+}
+
+func (h *WebhookHandler) Create(c *gin.Context) {
+	if !rejectWorkers(c, "Workers cannot manage webhooks") {
+		return
+	}
+	organizationID := c.GetUint("organization_id")
+	organizationUserID := c.GetUint("organization_user_id")
+
+	var req WebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateWebhookRequest(c.Request.Context(), &req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	sub := &models.WebhookSubscription{
+		OrganizationID: organizationID,
+		URL:            req.URL,
+		EventTypes:     req.EventTypes,
+		Secret:         req.Secret,
+		Description:    req.Description,
+		IsActive:       req.IsActive == nil || *req.IsActive,
+		CreatedBy:      &organizationUserID,
+	}
+	if sub.Secret == "" {
+		secret, err := webhooks.GenerateSecret()
+		if err != nil {
+			sentry.CaptureException(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate secret"})
+			return
+		}
+		sub.Secret = secret
+	}
+
+	if err := h.webhookRepo.CreateSubscription(sub); err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create webhook"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, webhookWithSecret{WebhookSubscription: sub, Secret: sub.Secret})
+}
+
+func (h *WebhookHandler) GetAll(c *gin.Context) {
+	if !rejectWorkers(c, "Workers cannot manage webhooks") {
+		return
+	}
+	organizationID := c.GetUint("organization_id")
+
+	subs, err := h.webhookRepo.FindSubscriptions(organizationID)
+	if err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch webhooks"})
+		return
+	}
+
+	c.JSON(http.StatusOK, subs)
+}
+
+func (h *WebhookHandler) GetByID(c *gin.Context) {
+	sub, ok := h.findSubscription(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, sub)
+}
+
+// Update replaces the subscription's settings. The secret is kept unless a
+// new one is given.
+func (h *WebhookHandler) Update(c *gin.Context) {
+	sub, ok := h.findSubscription(c)
+	if !ok {
+		return
+	}
+
+	var req WebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateWebhookRequest(c.Request.Context(), &req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	sub.URL = req.URL
+	sub.EventTypes = req.EventTypes
+	sub.Description = req.Description
+	if req.Secret != "" {
+		sub.Secret = req.Secret
+	}
+	if req.IsActive != nil {
+		sub.IsActive = *req.IsActive
+	}
+
+	if err := h.webhookRepo.UpdateSubscription(sub); err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update webhook"})
+		return
+	}
+
+	c.JSON(http.StatusOK, sub)
+}
+
+// RotateSecret replaces the signing secret with a generated one
+func (h *WebhookHandler) RotateSecret(c *gin.Context) {
+	sub, ok := h.findSubscription(c)
+	if !ok {
+		return
+	}
+
+	secret, err := webhooks.GenerateSecret()
+	if err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate secret"})
+		return
+	}
+	sub.Secret = secret
+
+	if err := h.webhookRepo.UpdateSubscription(sub); err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update webhook"})
+		return
+	}
+
+	c.JSON(http.StatusOK, webhookWithSecret{WebhookSubscription: sub, Secret: sub.Secret})
+}
+
+func (h *WebhookHandler) Delete(c *gin.Context) {
+	if !rejectWorkers(c, "Workers cannot manage webhooks") {
+		return
+	}
+	organizationID := c.GetUint("organization_id")
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook ID"})
+		return
+	}
+
+	if err := h.webhookRepo.DeleteSubscription(uint(id), organizationID); err != nil {
+		if err.Error() == "webhook not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+			return
+		}
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete webhook"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook deleted successfully"})
+}
+
+// GetDeliveries returns the delivery log, newest first. Supports ?status= and ?limit=.
+func (h *WebhookHandler) GetDeliveries(c *gin.Context) {
+	sub, ok := h.findSubscription(c)
+	if !ok {
+		return
+	}
+
+	status := c.Query("status")
+	switch status {
+	case "", models.WebhookPending, models.WebhookSucceeded, models.WebhookFailed:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status"})
+		return
+	}
+
+	limit := defaultDeliveryLimit
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxDeliveryLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", maxDeliveryLimit)})
+			return
+		}
+		limit = n
+	}
+
+	deliveries, err := h.webhookRepo.FindDeliveries(sub.ID, sub.OrganizationID, status, limit)
+	if err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch deliveries"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"deliveries": deliveries})
+}
+
+// ReplayDelivery sends a logged delivery again as a new delivery and
+// returns it with the outcome of its first attempt
+func (h *WebhookHandler) ReplayDelivery(c *gin.Context) {
+	sub, ok := h.findSubscription(c)
+	if !ok {
+		return
+	}
+
+	deliveryID, err := strconv.ParseUint(c.Param("deliveryId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid delivery ID"})
+		return
+	}
+
+	original, err := h.webhookRepo.FindDelivery(uint(deliveryID), sub.OrganizationID)
+	if err != nil || original.SubscriptionID != sub.ID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Delivery not found"})
+		return
+	}
+	if !sub.IsActive {
+		c.JSON(http.StatusConflict, gin.H{"error": "Webhook is disabled"})
+		return
+	}
+
+	replay, err := h.dispatcher.Replay(c.Request.Context(), original)
+	if err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to replay delivery"})
+		return
+	}
+
+	c.JSON(http.StatusOK, replay)
+}
+
+func (h *WebhookHandler) findSubscription(c *gin.Context) (*models.WebhookSubscription, bool) {
+	if !rejectWorkers(c, "Workers cannot manage webhooks") {
+		return nil, false
+	}
+	organizationID := c.GetUint("organization_id")
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook ID"})
+		return nil, false
+	}
+
+	sub, err := h.webhookRepo.FindSubscription(uint(id), organizationID)
+	if err != nil {
+		if err.Error() == "webhook not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+			return nil, false
+		}
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch webhook"})
+		return nil, false
+	}
+
+	return sub, true
+}
+
+// rejectWorkers keeps office-only features such as webhook secrets and
+// billing away from worker logins
+func rejectWorkers(c *gin.Context, message string) bool {
+	if c.GetString("user_type") == "worker" {
+		c.JSON(http.StatusForbidden, gin.H{"error": message})
+		return false
+	}
+	return true
+}
+
+func validateWebhookRequest(ctx context.Context, req *WebhookRequest) error {
+	if err := webhooks.CheckURL(ctx, req.URL); err != nil {
+		return err
+	}
+
+	seen := make(map[string]bool)
+	types := []string{}
+	for _, t := range req.EventTypes {
+		if !events.IsType(t) {
+			return fmt.Errorf("unknown event type %q", t)
+		}
+		if !seen[t] {
+			seen[t] = true
+			types = append(types, t)
+		}
+	}
+	req.EventTypes = types
+
+	return nil
+}
@@ -2,22 +2,27 @@ package handlers
 
 import (
 	"database/sql"
+	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/getsentry/sentry-go"
 	"github.com/gin-gonic/gin"
+	"github.com/ireuven89/routewise/internal/geofence"
 	"github.com/ireuven89/routewise/internal/models"
 	"github.com/ireuven89/routewise/internal/repository"
 )
 
 type WorkerHandler struct {
 	workerRepo *repository.WorkerRepository
+	geofence   *geofence.Engine
 }
 
-func NewWorkerHandler(db *sql.DB) *WorkerHandler {
+func NewWorkerHandler(db *sql.DB, geofenceEngine *geofence.Engine) *WorkerHandler {
 	return &WorkerHandler{
 		workerRepo: repository.NewWorkerRepository(db),
+		geofence:   geofenceEngine,
 	}
 }
 
@@ -28,6 +33,37 @@ type CreateWorkerRequest struct {
 	IsActive bool   `json:"is_active"`
 }
 
+const (
+	maxLocationBatchSize       = 500
+	maxLocationClockSkew       = 5 * time.Minute
+	defaultStaleAfterMinutes   = 15
+	maxLocationHistoryRange    = 7 * 24 * time.Hour
+	defaultLocationHistorySpan = 24 * time.Hour
+)
+
+type LocationFix struct {
+	Latitude       *float64   `json:"latitude" binding:"required"`
+	Longitude      *float64   `json:"longitude" binding:"required"`
+	AccuracyMeters *float64   `json:"accuracy_meters"`
+	SpeedMps       *float64   `json:"speed_mps"`
+	Heading        *float64   `json:"heading"`
+	RecordedAt     *time.Time `json:"recorded_at"`
+}
+
+type ReportLocationsRequest struct {
+	Locations []LocationFix `json:"locations" binding:"required,min=1,dive"`
+}
+
+type WorkerLocationFeedItem struct {
+	WorkerID   uint       `json:"worker_id"`
+	Name       string     `json:"name"`
+	Phone      string     `json:"phone"`
+	Latitude   *float64   `json:"latitude"`
+	Longitude  *float64   `json:"longitude"`
+	LastSeenAt *time.Time `json:"last_seen_at"`
+	Stale      bool       `json:"stale"`
+}
+
 type UpdateWorkerRequest struct {
 	Name     string `json:"name"`
 	Email    string `json:"email"`
@@ -160,3 +196,169 @@ func (h *WorkerHandler) Delete(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"message": "Worker deleted successfully"})
 }
+
+// ReportLocations accepts a batch of position fixes from the worker app.
+// Only worker tokens may call it; the worker is taken from the token.
+func (h *WorkerHandler) ReportLocations(c *gin.Context) {
+	organizationID := c.GetUint("organization_id")
+
+	if c.GetString("user_type") != "worker" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only workers can report locations"})
+		return
+	}
+	workerID := c.GetUint("organization_user_id")
+
+	var req ReportLocationsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if len(req.Locations) > maxLocationBatchSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("At most %d locations per batch", maxLocationBatchSize)})
+		return
+	}
+
+	worker, err := h.workerRepo.FindByID(workerID, organizationID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Worker not found"})
+		return
+	}
+	if !worker.IsActive {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Worker is not active"})
+		return
+	}
+
+	now := time.Now()
+	locations := make([]*models.WorkerLocation, 0, len(req.Locations))
+
+	for i, fix := range req.Locations {
+		if *fix.Latitude < -90 || *fix.Latitude > 90 || *fix.Longitude < -180 || *fix.Longitude > 180 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid coordinates at index %d", i)})
+			return
+		}
+
+		recordedAt := now
+		if fix.RecordedAt != nil {
+			recordedAt = *fix.RecordedAt
+		}
+		if recordedAt.After(now.Add(maxLocationClockSkew)) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("recorded_at is in the future at index %d", i)})
+			return
+		}
+
+		locations = append(locations, &models.WorkerLocation{
+			Latitude:       *fix.Latitude,
+			Longitude:      *fix.Longitude,
+			AccuracyMeters: fix.AccuracyMeters,
+			SpeedMps:       fix.SpeedMps,
+			Heading:        fix.Heading,
+			RecordedAt:     recordedAt,
+		})
+	}
+
+	if err := h.workerRepo.RecordLocations(workerID, organizationID, locations); err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save locations"})
+		return
+	}
+
+	// Geofence rules are best effort; the fixes are already stored
+	if err := h.geofence.Process(organizationID, workerID, locations); err != nil {
+		sentry.CaptureException(err)
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":  "Locations recorded",
+		"accepted": len(locations),
+	})
+}
+
+// GetLocations returns the last-known position of every active worker
+func (h *WorkerHandler) GetLocations(c *gin.Context) {
+	organizationID := c.GetUint("organization_id")
+
+	staleAfter := defaultStaleAfterMinutes
+	if v := c.Query("stale_after_minutes"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid stale_after_minutes"})
+			return
+		}
+		staleAfter = parsed
+	}
+
+	workers, err := h.workerRepo.FindAll(organizationID, true)
+	if err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch workers"})
+		return
+	}
+
+	cutoff := time.Now().Add(-time.Duration(staleAfter) * time.Minute)
+	feed := make([]WorkerLocationFeedItem, 0, len(workers))
+
+	for _, w := range workers {
+		feed = append(feed, WorkerLocationFeedItem{
+			WorkerID:   w.ID,
+			Name:       w.Name,
+			Phone:      w.Phone,
+			Latitude:   w.LastLat,
+			Longitude:  w.LastLng,
+			LastSeenAt: w.LastSeenAt,
+			Stale:      w.LastSeenAt == nil || w.LastSeenAt.Before(cutoff),
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"workers":      feed,
+		"generated_at": time.Now(),
+	})
+}
+
+// GetLocationHistory returns a worker's trail between ?from and ?to (RFC 3339)
+func (h *WorkerHandler) GetLocationHistory(c *gin.Context) {
+	organizationID := c.GetUint("organization_id")
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid worker ID"})
+		return
+	}
+
+	to := time.Now()
+	if v := c.Query("to"); v != "" {
+		if to, err = time.Parse(time.RFC3339, v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to, expected RFC 3339"})
+			return
+		}
+	}
+	from := to.Add(-defaultLocationHistorySpan)
+	if v := c.Query("from"); v != "" {
+		if from, err = time.Parse(time.RFC3339, v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from, expected RFC 3339"})
+			return
+		}
+	}
+	if !from.Before(to) || to.Sub(from) > maxLocationHistoryRange {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid time range"})
+		return
+	}
+
+	if _, err := h.workerRepo.FindByID(uint(id), organizationID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Worker not found"})
+		return
+	}
+
+	locations, err := h.workerRepo.FindLocationHistory(uint(id), organizationID, from, to)
+	if err != nil {
+		sentry.CaptureException(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch locations"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"locations": locations,
+		"count":     len(locations),
+	})
+}
@@ -17,29 +17,77 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		// Expected format: "Bearer <token>"
-		parts := strings.Split(authHeader, " ")
-		if len(parts) != 2 || parts[0] != "Bearer" {
+		token, ok := bearerToken(authHeader)
+		if !ok {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization format"})
 			c.Abort()
 			return
 		}
 
-		token := parts[1]
-		claims, err := utils.ValidateToken(token)
+		authenticate(c, token)
+	}
+}
+
+// StreamAuthMiddleware is AuthMiddleware for event streams. Browsers cannot
+// set headers on an EventSource, so a short-lived stream token (see
+// utils.ScopeEventStream) may come as ?stream_token= instead. The API token
+// itself is never accepted in the URL.
+func StreamAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if authHeader := c.GetHeader("Authorization"); authHeader != "" {
+			token, ok := bearerToken(authHeader)
+			if !ok {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization format"})
+				c.Abort()
+				return
+			}
+			authenticate(c, token)
+			return
+		}
+
+		token := c.Query("stream_token")
+		if token == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization required"})
+			c.Abort()
+			return
+		}
+
+		claims, err := utils.ValidatePublicToken(token, utils.ScopeEventStream)
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired stream token"})
 			c.Abort()
 			return
 		}
 
-		// Set user and organization info in context
-		c.Set("organization_user_id", claims.OrganizationUserID)
+		c.Set("organization_user_id", claims.ResourceID)
 		c.Set("organization_id", claims.OrganizationID)
-		c.Set("user_email", claims.Email)
-		c.Set("user_type", claims.UserType)
-		c.Set("user_role", claims.Role)
-
 		c.Next()
 	}
 }
+
+// Expected format: "Bearer <token>"
+func bearerToken(authHeader string) (string, bool) {
+	parts := strings.Split(authHeader, " ")
+	if len(parts) != 2 || parts[0] != "Bearer" {
+		return "", false
+	}
+	return parts[1], true
+}
+
+func authenticate(c *gin.Context, token string) {
+	claims, err := utils.ValidateToken(token)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+		c.Abort()
+		return
+	}
+
+	// Set user and organization info in context
+	c.Set("organization_user_id", claims.OrganizationUserID)
+	c.Set("organization_id", claims.OrganizationID)
+	c.Set("user_email", claims.Email)
+	c.Set("user_type", claims.UserType)
+	c.Set("user_role", claims.Role)
+
+	c.Next()
+}
@@ -1,14 +1,28 @@
 package api
 
 import (
+	"context"
 	"database/sql"
 	"log"
+	"os"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/ireuven89/routewise/internal/api/handlers"
 	"github.com/ireuven89/routewise/internal/api/middleware"
+	"github.com/ireuven89/routewise/internal/billing"
+	"github.com/ireuven89/routewise/internal/events"
+	"github.com/ireuven89/routewise/internal/geofence"
+	"github.com/ireuven89/routewise/internal/media"
+	"github.com/ireuven89/routewise/internal/recurrence"
 	"github.com/ireuven89/routewise/internal/repository"
+	"github.com/ireuven89/routewise/internal/routing"
+	"github.com/ireuven89/routewise/internal/scheduling"
+	"github.com/ireuven89/routewise/internal/trash"
+	"github.com/ireuven89/routewise/internal/uploads"
+	"github.com/ireuven89/routewise/internal/usage"
+	"github.com/ireuven89/routewise/internal/webhooks"
 	"github.com/ireuven89/routewise/services"
 )
 
@@ -46,19 +60,96 @@ func SetupRoutes(router *gin.Engine, db *sql.DB) {
 	//initalize repositories
 	projectRepo := repository.NewJobRepository(db)
 	fileRepo := repository.NewFileRepository(db)
+	uploadRepo := repository.NewUploadRepository(db)
+	usageRepo := repository.NewUsageRepository(db)
+	geocodeRepo := repository.NewGeocodeRepository(db)
 
 	//initialize services
-	s3Service, err := services.NewS3Service()
+	storage, err := services.NewStorageFromEnv()
 	if err != nil {
-		log.Fatal("Failed to connect to S3:", err)
+		log.Fatal("Failed to configure storage:", err)
 	}
 
+	// Uploads are scanned for malware when SCANNER is set
+	scanner, err := services.NewScannerFromEnv()
+	if err != nil {
+		log.Fatal("Failed to configure scanner:", err)
+	}
+
+	geocoder, err := services.NewGeocoderFromEnv(geocodeRepo)
+	if err != nil {
+		log.Fatal("Failed to configure geocoder:", err)
+	}
+
+	// Live updates; each organization keeps this many recent events for resuming streams
+	eventBus := events.NewBus(envInt("EVENT_HISTORY_SIZE", 500))
+
+	// Webhook deliveries are recorded from the bus; retries are polled on an interval
+	webhookDispatcher := webhooks.NewDispatcher(db, nil)
+	eventBus.Listen(webhookDispatcher.Enqueue)
+	go webhookDispatcher.Run(context.Background(), time.Duration(envInt("WEBHOOK_RETRY_INTERVAL_SECONDS", 15))*time.Second)
+
+	// Completed jobs get a draft invoice; terms set the due date when sent
+	invoiceTermsDays := envInt("INVOICE_PAYMENT_TERMS_DAYS", 30)
+	invoiceDrafter := billing.NewDrafter(db, eventBus, invoiceTermsDays)
+	eventBus.Listen(invoiceDrafter.Enqueue)
+	go invoiceDrafter.Run(context.Background(), time.Duration(envInt("INVOICE_SWEEP_INTERVAL_MINUTES", 60))*time.Minute)
+
+	// Direct uploads that were never confirmed are deleted with their objects
+	uploadSweeper := uploads.NewSweeper(db, storage)
+	go uploadSweeper.Run(context.Background(), time.Duration(envInt("UPLOAD_SWEEP_INTERVAL_MINUTES", 15))*time.Minute)
+
+	// Deleted files can be restored until they are purged with their objects
+	trashRetention := time.Duration(envInt("FILE_TRASH_RETENTION_DAYS", 30)) * 24 * time.Hour
+	trashPurger := trash.NewPurger(db, storage, trashRetention)
+	go trashPurger.Run(context.Background(), time.Duration(envInt("TRASH_PURGE_INTERVAL_MINUTES", 60))*time.Minute)
+
+	// Recompute storage usage from storage listings, correcting any drift
+	usageReconciler := usage.NewReconciler(db, storage)
+	go usageReconciler.Run(context.Background(), time.Duration(envInt("USAGE_RECONCILE_INTERVAL_HOURS", 24))*time.Hour)
+
+	// Uploaded photos get EXIF metadata and renditions; missed ones are rescanned
+	photoProcessor := media.NewProcessor(db, storage, eventBus)
+	eventBus.Listen(photoProcessor.Enqueue)
+	go photoProcessor.Run(context.Background(), time.Duration(envInt("PHOTO_SCAN_INTERVAL_SECONDS", 60))*time.Second)
+
+	geofenceEngine := geofence.NewEngine(db, eventBus)
+
+	speedProfile := routing.ProfileUrban
+	if name := os.Getenv("ETA_SPEED_PROFILE"); name != "" {
+		profile, ok := routing.SpeedProfileByName(name)
+		if !ok {
+			log.Fatal("Unknown ETA_SPEED_PROFILE: ", name)
+		}
+		speedProfile = profile
+	}
+	etaEstimator := routing.NewHaversineEstimator(speedProfile)
+
+	// Recurring jobs are materialized this far ahead, checked on an interval
+	recurringHorizon := time.Duration(envInt("RECURRING_JOBS_HORIZON_DAYS", 60)) * 24 * time.Hour
+	recurringInterval := time.Duration(envInt("RECURRING_JOBS_INTERVAL_MINUTES", 60)) * time.Minute
+	recurringGenerator := recurrence.NewGenerator(db, eventBus, recurringHorizon)
+	go recurringGenerator.Run(context.Background(), recurringInterval)
+
 	// Initialize handlers
 	authHandler := handlers.NewAuthHandler(db)
-	jobHandler := handlers.NewJobHandler(db)
-	customerHandler := handlers.NewCustomerHandler(db)
-	technicianHandler := handlers.NewWorkerHandler(db)
-	filesHandler := handlers.NewFileHandler(fileRepo, projectRepo, s3Service)
+	scheduleChecker := scheduling.NewChecker(db)
+	jobHandler := handlers.NewJobHandler(db, scheduleChecker, eventBus)
+	customerHandler := handlers.NewCustomerHandler(db, geocoder, eventBus)
+	technicianHandler := handlers.NewWorkerHandler(db, geofenceEngine)
+	routeHandler := handlers.NewRouteHandler(db, scheduleChecker, eventBus)
+	geofenceHandler := handlers.NewGeofenceHandler(db, eventBus)
+	crewHandler := handlers.NewCrewHandler(db, scheduleChecker, eventBus)
+	recurringJobHandler := handlers.NewRecurringJobHandler(db, recurringGenerator)
+	availabilityHandler := handlers.NewAvailabilityHandler(db, scheduleChecker)
+	dispatchHandler := handlers.NewDispatchHandler(db, scheduleChecker, eventBus)
+	trackingHandler := handlers.NewTrackingHandler(db, etaEstimator)
+	filesHandler := handlers.NewFileHandler(fileRepo, projectRepo, uploadRepo, usageRepo, storage, scanner, eventBus, trashRetention)
+	eventHandler := handlers.NewEventHandler(eventBus)
+	webhookHandler := handlers.NewWebhookHandler(db, webhookDispatcher)
+	quoteHandler := handlers.NewQuoteHandler(db, scheduleChecker, eventBus)
+	invoiceHandler := handlers.NewInvoiceHandler(db, eventBus, invoiceTermsDays)
+	documentHandler := handlers.NewDocumentHandler(db, storage)
 
 	// API v1 routes
 	v1 := router.Group("/api/v1")
@@ -67,11 +158,32 @@ func SetupRoutes(router *gin.Engine, db *sql.DB) {
 		v1.POST("/register", authHandler.Register)
 		v1.POST("/login", authHandler.Login)
 
+		// Public customer-facing routes, authorized by scoped link tokens
+		public := v1.Group("/public")
+		{
+			public.GET("/track/:token", trackingHandler.GetPublicStatus)
+			public.GET("/quotes/:token", quoteHandler.GetPublic)
+			public.POST("/quotes/:token/accept", quoteHandler.PublicAccept)
+			public.POST("/quotes/:token/decline", quoteHandler.PublicDecline)
+			public.GET("/quotes/:token/pdf", documentHandler.PublicQuotePDF)
+		}
+
+		// Signed links for storage backends without their own endpoint (local, memory)
+		if served, ok := storage.(services.SelfServedStorage); ok {
+			storageHandler := handlers.NewStorageHandler(served)
+			v1.GET("/storage/*key", storageHandler.Download)
+			v1.PUT("/storage/*key", storageHandler.Upload)
+		}
+
+		// Event stream; also accepts ?stream_token= since EventSource cannot send headers
+		v1.GET("/events", middleware.StreamAuthMiddleware(), eventHandler.Stream)
+
 		// Protected routes
 		protected := v1.Group("")
 		protected.Use(middleware.AuthMiddleware())
 		{
 			protected.GET("/me", authHandler.GetProfile)
+			protected.POST("/events/token", eventHandler.IssueStreamToken)
 
 			// Jobs
 			protected.POST("/jobs", jobHandler.Create)
@@ -81,10 +193,72 @@ func SetupRoutes(router *gin.Engine, db *sql.DB) {
 			protected.DELETE("/jobs/:id", jobHandler.Delete)
 			protected.PATCH("/jobs/:id/assign", jobHandler.AssignTechnician)
 			protected.PATCH("/jobs/:id/status", jobHandler.UpdateStatus)
+			protected.GET("/jobs/:id/history", jobHandler.GetHistory)
+			protected.GET("/jobs/:id/notes", jobHandler.GetNotes)
+			protected.POST("/jobs/:id/notes", jobHandler.AddNote)
+			protected.PUT("/jobs/:id/notes/:noteId", jobHandler.UpdateNote)
+			protected.DELETE("/jobs/:id/notes/:noteId", jobHandler.DeleteNote)
+			protected.GET("/jobs/:id/parts", jobHandler.GetParts)
+			protected.POST("/jobs/:id/parts", jobHandler.AddPart)
+			protected.PUT("/jobs/:id/parts/:partId", jobHandler.UpdatePart)
+			protected.DELETE("/jobs/:id/parts/:partId", jobHandler.DeletePart)
+			protected.GET("/jobs/:id/geofence-events", geofenceHandler.GetJobEvents)
+			protected.POST("/jobs/:id/signature", filesHandler.UploadSignature)
+			protected.GET("/completion/settings", jobHandler.GetCompletionSettings)
+			protected.PUT("/completion/settings", jobHandler.UpdateCompletionSettings)
+			protected.GET("/jobs/:id/crew", crewHandler.GetCrew)
+			protected.POST("/jobs/:id/crew", crewHandler.AddMember)
+			protected.PATCH("/jobs/:id/crew/:workerId", crewHandler.UpdateRole)
+			protected.DELETE("/jobs/:id/crew/:workerId", crewHandler.RemoveMember)
+			protected.POST("/jobs/:id/on-my-way", trackingHandler.OnMyWay)
+			protected.POST("/jobs/:id/move", dispatchHandler.MoveJob)
+			protected.POST("/jobs/:id/invoice", invoiceHandler.CreateFromJob)
+			protected.GET("/jobs/:id/report", documentHandler.JobReportPDF)
+
+			// Dispatch board
+			protected.GET("/dispatch/board", dispatchHandler.GetBoard)
+
+			// Recurring jobs; PUT edits all future occurrences
+			protected.POST("/recurring-jobs", recurringJobHandler.Create)
+			protected.GET("/recurring-jobs", recurringJobHandler.GetAll)
+			protected.GET("/recurring-jobs/:id", recurringJobHandler.GetByID)
+			protected.PUT("/recurring-jobs/:id", recurringJobHandler.Update)
+			protected.DELETE("/recurring-jobs/:id", recurringJobHandler.Delete)
+
+			// Quotes
+			protected.POST("/quotes", quoteHandler.Create)
+			protected.GET("/quotes", quoteHandler.GetAll)
+			protected.GET("/quotes/:id", quoteHandler.GetByID)
+			protected.PUT("/quotes/:id", quoteHandler.Update)
+			protected.DELETE("/quotes/:id", quoteHandler.Delete)
+			protected.POST("/quotes/:id/send", quoteHandler.Send)
+			protected.POST("/quotes/:id/accept", quoteHandler.Accept)
+			protected.POST("/quotes/:id/decline", quoteHandler.Decline)
+			protected.POST("/quotes/:id/convert", quoteHandler.Convert)
+			protected.GET("/quotes/:id/pdf", documentHandler.QuotePDF)
+
+			// Invoices; payments are recorded manually
+			protected.GET("/invoices", invoiceHandler.GetAll)
+			protected.GET("/invoices/:id", invoiceHandler.GetByID)
+			protected.PUT("/invoices/:id", invoiceHandler.Update)
+			protected.DELETE("/invoices/:id", invoiceHandler.Delete)
+			protected.POST("/invoices/:id/send", invoiceHandler.Send)
+			protected.POST("/invoices/:id/void", invoiceHandler.Void)
+			protected.POST("/invoices/:id/payments", invoiceHandler.AddPayment)
+			protected.DELETE("/invoices/:id/payments/:paymentId", invoiceHandler.DeletePayment)
+			protected.GET("/invoices/:id/pdf", documentHandler.InvoicePDF)
+			protected.GET("/reports/aged-receivables", invoiceHandler.GetAgedReceivables)
+
+			// Branding for generated PDFs
+			protected.GET("/organization/branding", documentHandler.GetBranding)
+			protected.PUT("/organization/branding", documentHandler.UpdateBranding)
+			protected.POST("/organization/branding/logo", documentHandler.UploadLogo)
+			protected.DELETE("/organization/branding/logo", documentHandler.DeleteLogo)
 
 			// Customers
 			protected.POST("/customers", customerHandler.Create)
 			protected.GET("/customers", customerHandler.GetAll)
+			protected.POST("/customers/geocode/backfill", customerHandler.BackfillCoordinates)
 			protected.GET("/customers/:id", customerHandler.GetByID)
 			protected.PUT("/customers/:id", customerHandler.Update)
 			protected.DELETE("/customers/:id", customerHandler.Delete)
@@ -92,15 +266,78 @@ func SetupRoutes(router *gin.Engine, db *sql.DB) {
 			// Technicians
 			protected.POST("/workers", technicianHandler.Create)
 			protected.GET("/workers", technicianHandler.GetAll)
+			protected.GET("/workers/locations", technicianHandler.GetLocations)
+			protected.POST("/workers/me/location", technicianHandler.ReportLocations)
 			protected.GET("/workers/:id", technicianHandler.GetByID)
 			protected.PUT("/workers/:id", technicianHandler.Update)
 			protected.DELETE("/workers/:id", technicianHandler.Delete)
+			protected.GET("/workers/:id/locations", technicianHandler.GetLocationHistory)
+			protected.GET("/workers/:id/assignments", crewHandler.GetWorkerAssignments)
+
+			// Availability
+			protected.GET("/workers/:id/availability", availabilityHandler.GetAvailability)
+			protected.GET("/workers/:id/working-hours", availabilityHandler.GetWorkingHours)
+			protected.PUT("/workers/:id/working-hours", availabilityHandler.ReplaceWorkingHours)
+			protected.GET("/workers/:id/time-off", availabilityHandler.ListTimeOff)
+			protected.POST("/workers/:id/time-off", availabilityHandler.CreateTimeOff)
+			protected.DELETE("/workers/:id/time-off/:timeOffId", availabilityHandler.DeleteTimeOff)
+			protected.GET("/holidays", availabilityHandler.ListHolidays)
+			protected.POST("/holidays", availabilityHandler.CreateHoliday)
+			protected.DELETE("/holidays/:id", availabilityHandler.DeleteHoliday)
+			protected.GET("/scheduling/settings", availabilityHandler.GetSettings)
+			protected.PUT("/scheduling/settings", availabilityHandler.UpdateSettings)
+
+			// Routing
+			protected.GET("/workers/:id/route", routeHandler.GetWorkerRoute)
+			protected.GET("/routes/plan", routeHandler.ProposeFleetPlan)
+			protected.POST("/routes/plan/accept", routeHandler.AcceptFleetPlan)
+
+			// Geofencing
+			protected.GET("/geofence/settings", geofenceHandler.GetSettings)
+			protected.PUT("/geofence/settings", geofenceHandler.UpdateSettings)
+			protected.GET("/geofence/suggestions", geofenceHandler.ListSuggestions)
+			protected.POST("/geofence/suggestions/:id/accept", geofenceHandler.AcceptSuggestion)
+			protected.POST("/geofence/suggestions/:id/dismiss", geofenceHandler.DismissSuggestion)
+
+			// Webhooks
+			protected.POST("/webhooks", webhookHandler.Create)
+			protected.GET("/webhooks", webhookHandler.GetAll)
+			protected.GET("/webhooks/:id", webhookHandler.GetByID)
+			protected.PUT("/webhooks/:id", webhookHandler.Update)
+			protected.DELETE("/webhooks/:id", webhookHandler.Delete)
+			protected.POST("/webhooks/:id/rotate-secret", webhookHandler.RotateSecret)
+			protected.GET("/webhooks/:id/deliveries", webhookHandler.GetDeliveries)
+			protected.POST("/webhooks/:id/deliveries/:deliveryId/replay", webhookHandler.ReplayDelivery)
 
 			//files
 			protected.POST("/projects/:id/files", filesHandler.Upload)
+			protected.POST("/projects/:id/uploads", filesHandler.RequestUpload)
+			protected.POST("/uploads/:id/complete", filesHandler.CompleteUpload)
+			protected.DELETE("/uploads/:id", filesHandler.CancelUpload)
 			protected.GET("projects/:id/files", filesHandler.ListFiles)
+			protected.GET("/projects/:id/files/archive", filesHandler.DownloadArchive)
+			protected.GET("/projects/:id/files/trash", filesHandler.ListTrash)
+			protected.GET("/files/policy", filesHandler.GetUploadPolicy)
+			protected.PUT("/files/policy", filesHandler.UpdateUploadPolicy)
+			protected.GET("/files/quarantined", filesHandler.ListQuarantined)
+			protected.GET("/files/usage", filesHandler.GetStorageUsage)
 			protected.GET("/files/:id", filesHandler.GetFile)
 			protected.DELETE("/files/:id", filesHandler.DeleteFile)
+			protected.GET("/files/:id/versions", filesHandler.ListVersions)
+			protected.POST("/files/:id/restore", filesHandler.RestoreFile)
 		}
 	}
 }
+
+// envInt reads a positive integer setting, falling back to def
+func envInt(key string, def int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		log.Fatalf("Invalid %s: %q", key, v)
+	}
+	return n
+}
@@ -0,0 +1,89 @@
+package billing
+
+import (
+	"time"
+
+	"github.com/ireuven89/routewise/internal/models"
+	"github.com/shopspring/decimal"
+)
+
+// agingBuckets are the report columns, by days past due
+var agingBuckets = []struct {
+	label    string
+	min, max int // max < 0 is open-ended
+}{
+	{"current", 0, 0},
+	{"1-30", 1, 30},
+	{"31-60", 31, 60},
+	{"61-90", 61, 90},
+	{"90+", 91, -1},
+}
+
+// AgeReceivables groups open balances by how many days past due they are on
+// asOf, overall and per customer. Invoices not yet due are "current".
+func AgeReceivables(open []*models.OpenInvoice, asOf time.Time) *models.AgedReceivablesReport {
+	day := time.Date(asOf.Year(), asOf.Month(), asOf.Day(), 0, 0, 0, 0, time.UTC)
+
+	report := &models.AgedReceivablesReport{
+		AsOf:      day.Format("2006-01-02"),
+		Buckets:   newBuckets(),
+		Customers: []*models.CustomerReceivables{},
+		Total:     decimal.Zero,
+	}
+
+	byCustomer := make(map[uint]*models.CustomerReceivables)
+	for _, inv := range open {
+		i := bucketFor(daysPastDue(inv.DueDate, day))
+
+		customer, ok := byCustomer[inv.CustomerID]
+		if !ok {
+			customer = &models.CustomerReceivables{
+				CustomerID:   inv.CustomerID,
+				CustomerName: inv.CustomerName,
+				Buckets:      newBuckets(),
+				Total:        decimal.Zero,
+			}
+			byCustomer[inv.CustomerID] = customer
+			report.Customers = append(report.Customers, customer)
+		}
+
+		for _, b := range []*models.ReceivablesBucket{&report.Buckets[i], &customer.Buckets[i]} {
+			b.Amount = b.Amount.Add(inv.Balance)
+			b.Invoices++
+		}
+		customer.Total = customer.Total.Add(inv.Balance)
+		report.Total = report.Total.Add(inv.Balance)
+	}
+
+	return report
+}
+
+func daysPastDue(due, day time.Time) int {
+	due = time.Date(due.Year(), due.Month(), due.Day(), 0, 0, 0, 0, time.UTC)
+	days := int(day.Sub(due).Hours() / 24)
+	if days < 0 {
+		return 0
+	}
+	return days
+}
+
+func bucketFor(days int) int {
+	for i, b := range agingBuckets {
+		if days >= b.min && (b.max < 0 || days <= b.max) {
+			return i
+		}
+	}
+	return len(agingBuckets) - 1
+}
+
+func newBuckets() []models.ReceivablesBucket {
+	buckets := make([]models.ReceivablesBucket, len(agingBuckets))
+	for i, b := range agingBuckets {
+		buckets[i] = models.ReceivablesBucket{Label: b.label, MinDays: b.min, Amount: decimal.Zero}
+		if b.max >= 0 {
+			max := b.max
+			buckets[i].MaxDays = &max
+		}
+	}
+	return buckets
+}
@@ -0,0 +1,115 @@
+package billing
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/ireuven89/routewise/internal/events"
+	"github.com/ireuven89/routewise/internal/models"
+	"github.com/ireuven89/routewise/internal/repository"
+)
+
+const (
+	queueSize = 500
+
+	// The sweep drafts jobs completed this recently that still have no
+	// invoice, catching any the queue dropped or a restart lost
+	sweepLookback = 30 * 24 * time.Hour
+	sweepBatch    = 100
+)
+
+type completedJob struct {
+	organizationID uint
+	jobID          uint
+}
+
+// Drafter creates a draft invoice whenever a job is completed, so nothing
+// finished goes unbilled. The office reviews and sends the draft. Completed
+// jobs arrive through the event bus; a periodic sweep drafts any the queue
+// missed.
+type Drafter struct {
+	invoiceRepo *repository.InvoiceRepository
+	events      events.Publisher
+	termsDays   int
+	queue       chan completedJob
+}
+
+func NewDrafter(db *sql.DB, publisher events.Publisher, termsDays int) *Drafter {
+	return &Drafter{
+		invoiceRepo: repository.NewInvoiceRepository(db),
+		events:      publisher,
+		termsDays:   termsDays,
+		queue:       make(chan completedJob, queueSize),
+	}
+}
+
+// Enqueue is registered with Bus.Listen and only hands completed jobs to Run
+func (d *Drafter) Enqueue(event events.Event) {
+	if event.Type != events.JobStatusChanged {
+		return
+	}
+	update, ok := event.Data.(*models.JobStatusUpdate)
+	if !ok || update.NewStatus != models.StatusCompleted {
+		return
+	}
+
+	select {
+	case d.queue <- completedJob{organizationID: event.OrganizationID, jobID: update.JobID}:
+	default:
+		err := fmt.Errorf("invoice queue full, job %d left for the sweep", update.JobID)
+		sentry.CaptureException(err)
+		log.Print(err)
+	}
+}
+
+// Run drafts invoices for queued jobs, and sweeps for missed ones once
+// immediately and then on every tick, until ctx is done
+func (d *Drafter) Run(ctx context.Context, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+
+	d.Sweep(time.Now())
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case job := <-d.queue:
+			d.draft(job)
+		case <-ticker.C:
+			d.Sweep(time.Now())
+		}
+	}
+}
+
+// Sweep drafts invoices for recently completed jobs that have none
+func (d *Drafter) Sweep(now time.Time) {
+	jobs, err := d.invoiceRepo.FindUninvoicedJobs(now.Add(-sweepLookback), sweepBatch)
+	if err != nil {
+		sentry.CaptureException(err)
+		log.Printf("invoice sweep failed: %v", err)
+		return
+	}
+
+	for _, job := range jobs {
+		d.draft(completedJob{organizationID: job.OrganizationID, jobID: job.ID})
+	}
+}
+
+func (d *Drafter) draft(job completedJob) {
+	invoice, err := d.invoiceRepo.CreateFromJob(job.jobID, job.organizationID, nil, d.termsDays)
+	switch {
+	case err == nil:
+		d.events.Publish(job.organizationID, events.InvoiceCreated, invoice)
+	case errors.Is(err, models.ErrInvoiceExists), errors.Is(err, models.ErrJobNotBillable):
+		// A reopened and re-completed job keeps its first invoice, and one
+		// reopened before its turn is drafted when it is completed again
+	default:
+		sentry.CaptureException(err)
+		log.Printf("drafting invoice for job %d: %v", job.jobID, err)
+	}
+}
@@ -0,0 +1,352 @@
+// Package documents renders invoices, quotes and job reports as PDF. It is
+// pure Go and needs no external binaries or font files.
+package documents
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/go-pdf/fpdf"
+	"github.com/ireuven89/routewise/internal/models"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	margin     = 15.0 // mm
+	lineHeight = 5.0
+	logoHeight = 16.0
+	dateLayout = "Jan 2, 2006"
+
+	// Footer text longer than this is cut; it is for short payment or license details
+	maxFooterLines = 2
+)
+
+// Brand is the organization's letterhead
+type Brand struct {
+	CompanyName string
+	Phone       string
+	Logo        *Image
+	Branding    *models.OrganizationBranding
+	Location    *time.Location // dates are printed in the organization's timezone
+}
+
+// page wraps the PDF with the brand's letterhead, colors and footer
+type page struct {
+	pdf      *fpdf.Fpdf
+	brand    Brand
+	tr       func(string) string
+	primary  [3]int
+	accent   [3]int
+	width    float64 // printable width
+	imageSeq int
+}
+
+func newPage(brand Brand, title string) *page {
+	if brand.Location == nil {
+		brand.Location = time.UTC
+	}
+	if brand.Branding == nil {
+		brand.Branding = models.DefaultBranding(0)
+	}
+
+	pdf := fpdf.New("P", "mm", "Letter", "")
+	pdf.SetMargins(margin, margin, margin)
+	pdf.SetAutoPageBreak(true, margin+10)
+	pdf.AliasNbPages("{nb}")
+	pdf.SetTitle(title, true)
+	pdf.SetCreator("RouteWise", true)
+
+	w, _ := pdf.GetPageSize()
+	p := &page{
+		pdf:     pdf,
+		brand:   brand,
+		tr:      pdf.UnicodeTranslatorFromDescriptor(""),
+		primary: hexColor(brand.Branding.PrimaryColor, models.DefaultPrimaryColor),
+		accent:  hexColor(brand.Branding.AccentColor, models.DefaultAccentColor),
+		width:   w - 2*margin,
+	}
+
+	var logo string
+	if brand.Logo != nil {
+		logo, _ = p.register(*brand.Logo)
+	}
+
+	pdf.SetHeaderFunc(func() { p.header(logo, title) })
+	pdf.SetFooterFunc(p.footer)
+	pdf.AddPage()
+	return p
+}
+
+func (p *page) header(logo, title string) {
+	pdf := p.pdf
+	top := pdf.GetY()
+
+	if logo != "" {
+		pdf.ImageOptions(logo, margin, top, 0, logoHeight, false, fpdf.ImageOptions{}, 0, "")
+	}
+
+	pdf.SetFont("Helvetica", "B", 12)
+	pdf.SetTextColor(40, 40, 40)
+	pdf.SetXY(margin, top)
+	pdf.CellFormat(p.width, 6, p.tr(p.brand.CompanyName), "", 2, "R", false, 0, "")
+	if p.brand.Phone != "" {
+		pdf.SetFont("Helvetica", "", 9)
+		pdf.CellFormat(p.width, lineHeight, p.tr(p.brand.Phone), "", 2, "R", false, 0, "")
+	}
+
+	pdf.SetY(top + logoHeight + 4)
+	pdf.SetFont("Helvetica", "B", 18)
+	p.textColor(p.primary)
+	pdf.CellFormat(p.width, 9, p.tr(title), "", 1, "L", false, 0, "")
+
+	pdf.SetDrawColor(p.primary[0], p.primary[1], p.primary[2])
+	pdf.SetLineWidth(0.6)
+	pdf.Line(margin, pdf.GetY(), margin+p.width, pdf.GetY())
+	pdf.SetLineWidth(0.2)
+	pdf.Ln(4)
+	pdf.SetTextColor(40, 40, 40)
+}
+
+func (p *page) footer() {
+	pdf := p.pdf
+	_, h := pdf.GetPageSize()
+	pdf.SetY(h - margin - 8)
+	pdf.SetFont("Helvetica", "", 8)
+	pdf.SetTextColor(110, 110, 110)
+
+	textWidth := p.width - 25
+	lines := pdf.SplitText(p.tr(p.brand.Branding.FooterText), textWidth)
+	if len(lines) > maxFooterLines {
+		lines = lines[:maxFooterLines]
+	}
+	pdf.MultiCell(textWidth, 4, strings.Join(lines, "\n"), "", "L", false)
+
+	pdf.SetXY(margin+textWidth, h-margin-8)
+	pdf.CellFormat(25, 4, fmt.Sprintf("Page %d of {nb}", pdf.PageNo()), "", 0, "R", false, 0, "")
+}
+
+// register adds an image to the document and returns its name. Images that
+// cannot be embedded are reported as not ok and left out.
+func (p *page) register(img Image) (string, bool) {
+	img, _, err := prepare(img)
+	if err != nil {
+		return "", false
+	}
+
+	p.imageSeq++
+	name := fmt.Sprintf("img%d", p.imageSeq)
+	info := p.pdf.RegisterImageOptionsReader(name, fpdf.ImageOptions{ImageType: imageType(img.MimeType)}, bytes.NewReader(img.Data))
+	if info == nil || p.pdf.Err() {
+		// prepare should have caught it; the document is unusable now
+		return "", false
+	}
+	return name, true
+}
+
+// details prints label/value pairs in two columns
+func (p *page) details(left, right [][2]string) {
+	pdf := p.pdf
+	col := p.width / 2
+	top := pdf.GetY()
+	bottom := top
+
+	for i, rows := range [][][2]string{left, right} {
+		pdf.SetY(top)
+		for _, row := range rows {
+			if row[1] == "" {
+				continue
+			}
+			pdf.SetX(margin + float64(i)*col)
+			pdf.SetFont("Helvetica", "B", 9)
+			pdf.CellFormat(28, lineHeight, p.tr(row[0]), "", 0, "L", false, 0, "")
+			pdf.SetFont("Helvetica", "", 9)
+			pdf.MultiCell(col-30, lineHeight, p.tr(row[1]), "", "L", false)
+		}
+		if y := pdf.GetY(); y > bottom {
+			bottom = y
+		}
+	}
+
+	pdf.SetY(bottom + 4)
+}
+
+// section starts a titled block
+func (p *page) section(title string) {
+	pdf := p.pdf
+	pdf.Ln(2)
+	pdf.SetFont("Helvetica", "B", 11)
+	p.textColor(p.primary)
+	pdf.CellFormat(p.width, 7, p.tr(title), "B", 1, "L", false, 0, "")
+	pdf.SetTextColor(40, 40, 40)
+	pdf.Ln(1)
+}
+
+func (p *page) paragraph(text string) {
+	p.pdf.SetFont("Helvetica", "", 9)
+	p.pdf.MultiCell(p.width, lineHeight, p.tr(text), "", "L", false)
+}
+
+type column struct {
+	title string
+	width float64 // fraction of the printable width
+	align string
+}
+
+// table prints a header row in the primary color and striped body rows.
+// The first column wraps; the others are single line.
+func (p *page) table(columns []column, rows [][]string) {
+	pdf := p.pdf
+
+	head := func() {
+		pdf.SetFont("Helvetica", "B", 9)
+		pdf.SetFillColor(p.primary[0], p.primary[1], p.primary[2])
+		pdf.SetTextColor(255, 255, 255)
+		for _, col := range columns {
+			pdf.CellFormat(col.width*p.width, 7, p.tr(col.title), "", 0, col.align, true, 0, "")
+		}
+		pdf.Ln(-1)
+		pdf.SetTextColor(40, 40, 40)
+		pdf.SetFont("Helvetica", "", 9)
+	}
+	head()
+
+	_, pageHeight := pdf.GetPageSize()
+	for i, row := range rows {
+		first := pdf.SplitText(p.tr(row[0]), columns[0].width*p.width-2)
+		height := float64(len(first))*lineHeight + 2
+		if pdf.GetY()+height > pageHeight-margin-10 {
+			pdf.AddPage()
+			head()
+		}
+
+		fill := i%2 == 1
+		pdf.SetFillColor(p.accent[0], p.accent[1], p.accent[2])
+		x, y := pdf.GetXY()
+		if fill {
+			pdf.Rect(x, y, p.width, height, "F")
+		}
+
+		pdf.SetXY(x, y+1)
+		pdf.MultiCell(columns[0].width*p.width, lineHeight, strings.Join(first, "\n"), "", columns[0].align, false)
+		cx := x + columns[0].width*p.width
+		for j, col := range columns[1:] {
+			pdf.SetXY(cx, y+1)
+			pdf.CellFormat(col.width*p.width, lineHeight, p.tr(row[j+1]), "", 0, col.align, false, 0, "")
+			cx += col.width * p.width
+		}
+		pdf.SetXY(x, y+height)
+	}
+	pdf.Ln(2)
+}
+
+// totals prints right-aligned label/amount rows; the last one is emphasized
+func (p *page) totals(rows [][2]string) {
+	pdf := p.pdf
+	labelWidth, amountWidth := p.width*0.25, p.width*0.17
+	for i, row := range rows {
+		pdf.SetX(margin + p.width - labelWidth - amountWidth)
+		last := i == len(rows)-1
+		if last {
+			pdf.SetFont("Helvetica", "B", 10)
+			pdf.SetFillColor(p.accent[0], p.accent[1], p.accent[2])
+		} else {
+			pdf.SetFont("Helvetica", "", 9)
+		}
+		pdf.CellFormat(labelWidth, 6, p.tr(row[0]), "", 0, "R", last, 0, "")
+		pdf.CellFormat(amountWidth, 6, row[1], "", 1, "R", last, 0, "")
+	}
+	pdf.Ln(2)
+}
+
+func (p *page) textColor(c [3]int) {
+	p.pdf.SetTextColor(c[0], c[1], c[2])
+}
+
+func (p *page) date(t time.Time) string {
+	return t.In(p.brand.Location).Format(dateLayout)
+}
+
+func (p *page) dateTime(t time.Time) string {
+	return t.In(p.brand.Location).Format(dateLayout + " 3:04 PM")
+}
+
+func (p *page) write(w io.Writer) error {
+	return p.pdf.Output(w)
+}
+
+// lineColumns and lineRow lay out quote and invoice line items
+var lineColumns = []column{
+	{"Description", 0.43, "L"},
+	{"Qty", 0.09, "R"},
+	{"Unit price", 0.14, "R"},
+	{"Discount", 0.10, "R"},
+	{"Tax", 0.08, "R"},
+	{"Amount", 0.16, "R"},
+}
+
+func lineRow(kind, description string, l *models.LinePricing) []string {
+	discount := ""
+	if l.DiscountPercent.IsPositive() {
+		discount = l.DiscountPercent.String() + "%"
+	}
+	tax := ""
+	if l.TaxRate.IsPositive() {
+		tax = l.TaxRate.String() + "%"
+	}
+	if kind != "" && kind != models.LineLabor {
+		description = fmt.Sprintf("%s (%s)", description, kind)
+	}
+	return []string{description, l.Quantity.String(), money(l.UnitPrice), discount, tax, money(l.Total)}
+}
+
+func totalRows(t models.DocumentTotals) [][2]string {
+	rows := [][2]string{{"Subtotal", money(t.Subtotal)}}
+	if t.DiscountTotal.IsPositive() {
+		rows = append(rows, [2]string{"Discount", "-" + money(t.DiscountTotal)})
+	}
+	if t.TaxTotal.IsPositive() {
+		rows = append(rows, [2]string{"Tax", money(t.TaxTotal)})
+	}
+	return append(rows, [2]string{"Total", money(t.Total)})
+}
+
+// money formats an amount with two decimals and thousands separators
+func money(d decimal.Decimal) string {
+	s := d.StringFixed(2)
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	whole, frac := s[:len(s)-3], s[len(s)-3:]
+	var b strings.Builder
+	for i, r := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(r)
+	}
+	return sign + b.String() + frac
+}
+
+func hexColor(s, fallback string) [3]int {
+	r, g, b, err := models.ParseHexColor(s)
+	if err != nil {
+		r, g, b, _ = models.ParseHexColor(fallback)
+	}
+	return [3]int{r, g, b}
+}
+
+func customerRows(c *models.Customer) [][2]string {
+	if c == nil {
+		return nil
+	}
+	return [][2]string{
+		{"Customer", c.Name},
+		{"Address", c.Address},
+		{"Phone", c.Phone},
+		{"Email", c.Email},
+	}
+}
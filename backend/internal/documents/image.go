@@ -0,0 +1,155 @@
+package documents
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"strings"
+
+	"github.com/go-pdf/fpdf"
+)
+
+// SVGMimeType is accepted for signatures only: signature pads export their
+// strokes as simple SVG paths, which are drawn as vectors
+const SVGMimeType = "image/svg+xml"
+
+// Image is a picture placed in a document: a logo, a job photo or a signature
+type Image struct {
+	Data     []byte
+	MimeType string
+	Caption  string
+}
+
+// Supported reports whether images of this MIME type can be embedded
+func Supported(mimeType string) bool {
+	return imageType(mimeType) != ""
+}
+
+// CheckImage reports whether the image can be embedded, e.g. before a logo
+// or signature is accepted
+func CheckImage(img Image) error {
+	if img.MimeType == SVGMimeType {
+		_, err := parseSVG(img.Data)
+		return err
+	}
+	_, _, err := prepare(img)
+	return err
+}
+
+// parseSVG accepts the path-only SVG that signature pads produce. Anything
+// that could run in a browser when the stored file is opened is refused.
+func parseSVG(data []byte) (*fpdf.SVGBasicType, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	root := true
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if root && start.Name.Local != "svg" {
+			return nil, fmt.Errorf("not an SVG document")
+		}
+		root = false
+
+		switch strings.ToLower(start.Name.Local) {
+		case "script", "foreignobject", "iframe", "object", "embed", "image", "use", "a":
+			return nil, fmt.Errorf("SVG element %q is not allowed", start.Name.Local)
+		}
+		for _, attr := range start.Attr {
+			name := strings.ToLower(attr.Name.Local)
+			if strings.HasPrefix(name, "on") || name == "href" {
+				return nil, fmt.Errorf("SVG attribute %q is not allowed", attr.Name.Local)
+			}
+		}
+	}
+	if root {
+		return nil, fmt.Errorf("empty SVG document")
+	}
+
+	sig, err := fpdf.SVGBasicParse(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(sig.Segments) == 0 || sig.Wd <= 0 || sig.Ht <= 0 {
+		return nil, fmt.Errorf("SVG needs a width, a height and at least one path")
+	}
+	return &sig, nil
+}
+
+func imageType(mimeType string) string {
+	switch mimeType {
+	case "image/jpeg", "image/jpg", "image/pjpeg":
+		return "JPG"
+	case "image/png":
+		return "PNG"
+	case "image/gif":
+		return "GIF"
+	}
+	return ""
+}
+
+// prepare checks that the image decodes and rewrites PNGs the PDF writer
+// cannot embed as is (interlaced or 16 bits per channel). A bad image is
+// reported rather than failing the whole document.
+func prepare(img Image) (Image, image.Config, error) {
+	var decode func([]byte) (image.Config, error)
+	switch imageType(img.MimeType) {
+	case "JPG":
+		decode = func(b []byte) (image.Config, error) { return jpeg.DecodeConfig(bytes.NewReader(b)) }
+	case "PNG":
+		decode = func(b []byte) (image.Config, error) { return png.DecodeConfig(bytes.NewReader(b)) }
+	case "GIF":
+		decode = func(b []byte) (image.Config, error) { return gif.DecodeConfig(bytes.NewReader(b)) }
+	default:
+		return img, image.Config{}, fmt.Errorf("unsupported image type %q", img.MimeType)
+	}
+
+	cfg, err := decode(img.Data)
+	if err != nil {
+		return img, cfg, err
+	}
+	if cfg.Width == 0 || cfg.Height == 0 {
+		return img, cfg, fmt.Errorf("empty image")
+	}
+
+	if imageType(img.MimeType) == "PNG" && !plainPNG(img.Data) {
+		src, err := png.Decode(bytes.NewReader(img.Data))
+		if err != nil {
+			return img, cfg, err
+		}
+		dst := image.NewNRGBA(src.Bounds())
+		draw.Draw(dst, dst.Bounds(), src, src.Bounds().Min, draw.Src)
+
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, dst); err != nil {
+			return img, cfg, err
+		}
+		img.Data = buf.Bytes()
+	}
+
+	return img, cfg, nil
+}
+
+// plainPNG reads the IHDR chunk: 8 bits or fewer per channel, not interlaced
+func plainPNG(data []byte) bool {
+	// signature (8), chunk length (4), "IHDR" (4), width (4), height (4),
+	// bit depth, color type, compression, filter, interlace
+	if len(data) < 29 || string(data[12:16]) != "IHDR" || binary.BigEndian.Uint32(data[8:12]) != 13 {
+		return false
+	}
+	return data[24] <= 8 && data[28] == 0
+}
@@ -0,0 +1,80 @@
+package documents
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/ireuven89/routewise/internal/models"
+)
+
+// RenderInvoice writes the invoice with its line items, payments and balance
+func RenderInvoice(w io.Writer, brand Brand, inv *models.Invoice, customer *models.Customer, now time.Time) error {
+	title := "Draft invoice"
+	number := ""
+	if inv.Number != nil {
+		number = strconv.Itoa(*inv.Number)
+		title = "Invoice #" + number
+	}
+	p := newPage(brand, title)
+
+	status := inv.Status
+	if inv.IsOverdue(now) {
+		status = models.InvoiceOverdue
+	}
+	info := [][2]string{
+		{"Invoice", number},
+		{"Status", status},
+	}
+	if inv.IssuedAt != nil {
+		info = append(info, [2]string{"Issued", p.date(*inv.IssuedAt)})
+	}
+	if inv.DueDate != nil {
+		// Due dates are calendar dates, not instants
+		info = append(info, [2]string{"Due", inv.DueDate.Format(dateLayout)})
+	} else if inv.PaymentTermsDays > 0 {
+		info = append(info, [2]string{"Terms", fmt.Sprintf("Net %d", inv.PaymentTermsDays)})
+	}
+	p.details(customerRows(customer), info)
+
+	rows := make([][]string, len(inv.LineItems))
+	for i, l := range inv.LineItems {
+		rows[i] = lineRow(l.Kind, l.Description, &l.LinePricing)
+	}
+	p.table(lineColumns, rows)
+
+	totals := totalRows(inv.DocumentTotals)
+	if inv.AmountPaid.IsPositive() {
+		totals = append(totals, [2]string{"Paid", "-" + money(inv.AmountPaid)})
+	}
+	if inv.Status != models.InvoiceVoid {
+		totals = append(totals, [2]string{"Balance due", money(inv.Balance)})
+	}
+	p.totals(totals)
+
+	if len(inv.Payments) > 0 {
+		p.section("Payments")
+		rows := make([][]string, len(inv.Payments))
+		for i, pay := range inv.Payments {
+			rows[i] = []string{p.date(pay.PaidAt), pay.Method, pay.Reference, money(pay.Amount)}
+		}
+		p.table([]column{
+			{"Date", 0.3, "L"},
+			{"Method", 0.25, "L"},
+			{"Reference", 0.25, "L"},
+			{"Amount", 0.2, "R"},
+		}, rows)
+	}
+
+	if inv.Status == models.InvoiceVoid && inv.VoidReason != "" {
+		p.section("Void")
+		p.paragraph(inv.VoidReason)
+	}
+	if inv.Notes != "" {
+		p.section("Notes")
+		p.paragraph(inv.Notes)
+	}
+
+	return p.write(w)
+}
@@ -0,0 +1,226 @@
+package documents
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/go-pdf/fpdf"
+	"github.com/ireuven89/routewise/internal/models"
+)
+
+const (
+	photoColumns   = 2
+	photoGap       = 6.0
+	maxPhotoHeight = 85.0
+)
+
+// JobReport is everything shown on a job completion report
+type JobReport struct {
+	Job        *models.Job
+	Customer   *models.Customer
+	WorkerName string
+	Notes      []*models.JobNote
+	Parts      []*models.JobPart
+	Photos     []Image
+	Signature  *Signature
+}
+
+// Signature is the customer's sign-off. Without one the report has a blank
+// line to sign on paper.
+type Signature struct {
+	Image      Image
+	SignerName string
+	SignedAt   time.Time
+}
+
+// RenderJobReport writes the completion report. Photos that cannot be
+// embedded are left out and counted in a note.
+func RenderJobReport(w io.Writer, brand Brand, report *JobReport) error {
+	job := report.Job
+	p := newPage(brand, "Job report")
+
+	info := [][2]string{
+		{"Job", fmt.Sprintf("#%d %s", job.ID, job.Title)},
+		{"Status", string(job.Status)},
+		{"Scheduled", p.dateTime(job.ScheduledAt)},
+		{"Technician", report.WorkerName},
+	}
+	if job.CompletedAt != nil {
+		info = append(info, [2]string{"Completed", p.dateTime(*job.CompletedAt)})
+	}
+	p.details(customerRows(report.Customer), info)
+
+	if job.Description != "" {
+		p.section("Work description")
+		p.paragraph(job.Description)
+	}
+
+	if len(report.Notes) > 0 {
+		p.section("Notes")
+		for _, note := range report.Notes {
+			p.pdf.SetFont("Helvetica", "B", 8)
+			p.pdf.CellFormat(p.width, 4, p.dateTime(note.CreatedAt), "", 1, "L", false, 0, "")
+			p.paragraph(note.Note)
+			p.pdf.Ln(1)
+		}
+	}
+
+	if len(report.Parts) > 0 {
+		p.section("Parts used")
+		rows := make([][]string, len(report.Parts))
+		for i, part := range report.Parts {
+			name := part.PartName
+			if part.Description != "" {
+				name += " - " + part.Description
+			}
+			rows[i] = []string{name, strconv.Itoa(part.Quantity)}
+		}
+		p.table([]column{
+			{"Part", 0.85, "L"},
+			{"Qty", 0.15, "R"},
+		}, rows)
+	}
+
+	if len(report.Photos) > 0 {
+		p.section("Photos")
+		p.photos(report.Photos)
+	}
+
+	p.signature(report.Signature)
+
+	return p.write(w)
+}
+
+// photos lays the images out in a grid, scaled to the column width
+func (p *page) photos(photos []Image) {
+	pdf := p.pdf
+	_, pageHeight := pdf.GetPageSize()
+	cellWidth := (p.width - photoGap*(photoColumns-1)) / photoColumns
+
+	type placed struct {
+		name          string
+		width, height float64
+		caption       string
+	}
+	var images []placed
+	skipped := 0
+	for _, photo := range photos {
+		name, ok := p.register(photo)
+		if !ok {
+			skipped++
+			continue
+		}
+		info := pdf.GetImageInfo(name)
+		w, h := cellWidth, cellWidth*info.Height()/info.Width()
+		if h > maxPhotoHeight {
+			w, h = w*maxPhotoHeight/h, maxPhotoHeight
+		}
+		images = append(images, placed{name, w, h, photo.Caption})
+	}
+
+	for row := 0; row < len(images); row += photoColumns {
+		end := row + photoColumns
+		if end > len(images) {
+			end = len(images)
+		}
+
+		rowHeight := 0.0
+		for _, img := range images[row:end] {
+			if h := img.height + captionHeight(img.caption); h > rowHeight {
+				rowHeight = h
+			}
+		}
+		if pdf.GetY()+rowHeight > pageHeight-margin-10 {
+			pdf.AddPage()
+		}
+
+		top := pdf.GetY()
+		for i, img := range images[row:end] {
+			x := margin + float64(i)*(cellWidth+photoGap)
+			pdf.ImageOptions(img.name, x, top, img.width, img.height, false, fpdf.ImageOptions{}, 0, "")
+			if img.caption != "" {
+				pdf.SetXY(x, top+img.height+1)
+				pdf.SetFont("Helvetica", "", 8)
+				pdf.MultiCell(cellWidth, 4, p.tr(img.caption), "", "L", false)
+			}
+		}
+		pdf.SetY(top + rowHeight + 4)
+	}
+
+	if skipped > 0 {
+		pdf.SetFont("Helvetica", "I", 8)
+		pdf.CellFormat(p.width, 4, fmt.Sprintf("%d photo(s) could not be included.", skipped), "", 1, "L", false, 0, "")
+	}
+}
+
+func captionHeight(caption string) float64 {
+	if caption == "" {
+		return 0
+	}
+	return 9
+}
+
+func (p *page) signature(sig *Signature) {
+	pdf := p.pdf
+	_, pageHeight := pdf.GetPageSize()
+	const boxWidth, boxHeight = 70.0, 25.0
+
+	if pdf.GetY()+boxHeight+20 > pageHeight-margin-10 {
+		pdf.AddPage()
+	}
+	p.section("Customer sign-off")
+
+	top := pdf.GetY()
+	if sig != nil {
+		p.drawSignature(sig.Image, top, boxWidth, boxHeight)
+	}
+
+	pdf.SetDrawColor(80, 80, 80)
+	pdf.Line(margin, top+boxHeight+1, margin+boxWidth, top+boxHeight+1)
+	pdf.SetXY(margin, top+boxHeight+2)
+	pdf.SetFont("Helvetica", "", 8)
+	if sig == nil {
+		pdf.CellFormat(boxWidth, 4, "Signature", "", 1, "L", false, 0, "")
+		return
+	}
+	pdf.CellFormat(boxWidth, 4, p.tr(sig.SignerName), "", 1, "L", false, 0, "")
+	pdf.CellFormat(boxWidth, 4, "Signed "+p.dateTime(sig.SignedAt), "", 1, "L", false, 0, "")
+}
+
+// drawSignature fits the signature into the box, bottom-aligned on the line.
+// SVG strokes are drawn as vectors; PNGs are placed as images.
+func (p *page) drawSignature(img Image, top, boxWidth, boxHeight float64) {
+	pdf := p.pdf
+
+	fit := func(width, height float64) (float64, float64) {
+		w, h := boxWidth, boxWidth*height/width
+		if h > boxHeight {
+			w, h = w*boxHeight/h, boxHeight
+		}
+		return w, h
+	}
+
+	if img.MimeType == SVGMimeType {
+		sig, err := parseSVG(img.Data)
+		if err != nil {
+			return
+		}
+		w, h := fit(sig.Wd, sig.Ht)
+		pdf.SetDrawColor(20, 20, 60)
+		pdf.SetLineWidth(0.4)
+		pdf.SetLineCapStyle("round")
+		pdf.SetXY(margin, top+boxHeight-h)
+		pdf.SVGBasicWrite(sig, w/sig.Wd)
+		pdf.SetLineWidth(0.2)
+		pdf.SetLineCapStyle("butt")
+		return
+	}
+
+	if name, ok := p.register(img); ok {
+		info := pdf.GetImageInfo(name)
+		w, h := fit(info.Width(), info.Height())
+		pdf.ImageOptions(name, margin, top+boxHeight-h, w, h, false, fpdf.ImageOptions{}, 0, "")
+	}
+}
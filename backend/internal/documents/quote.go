@@ -0,0 +1,46 @@
+package documents
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/ireuven89/routewise/internal/models"
+)
+
+// RenderQuote writes the quote with its line items and totals
+func RenderQuote(w io.Writer, brand Brand, quote *models.Quote, customer *models.Customer) error {
+	p := newPage(brand, fmt.Sprintf("Quote #%d", quote.Number))
+
+	info := [][2]string{
+		{"Quote", fmt.Sprintf("%d", quote.Number)},
+		{"For", quote.Title},
+		{"Status", quote.Status},
+		{"Date", p.date(quote.CreatedAt)},
+	}
+	if quote.ValidUntil != nil {
+		info = append(info, [2]string{"Valid until", p.date(*quote.ValidUntil)})
+	}
+	p.details(customerRows(customer), info)
+
+	rows := make([][]string, len(quote.LineItems))
+	for i, l := range quote.LineItems {
+		rows[i] = lineRow(l.Kind, l.Description, &l.LinePricing)
+	}
+	p.table(lineColumns, rows)
+	p.totals(totalRows(quote.DocumentTotals))
+
+	if quote.Notes != "" {
+		p.section("Notes")
+		p.paragraph(quote.Notes)
+	}
+	if quote.Status == models.QuoteAccepted && quote.RespondedAt != nil {
+		p.section("Accepted")
+		accepted := "Accepted on " + p.dateTime(*quote.RespondedAt)
+		if quote.RespondedByName != "" {
+			accepted += " by " + quote.RespondedByName
+		}
+		p.paragraph(accepted)
+	}
+
+	return p.write(w)
+}
@@ -0,0 +1,219 @@
+package events
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event types published by the API
+const (
+	JobCreated       = "job.created"
+	JobUpdated       = "job.updated"
+	JobAssigned      = "job.assigned"
+	JobStatusChanged = "job.status_changed"
+	JobDeleted       = "job.deleted"
+	JobCrewAdded     = "job.crew_added"
+	JobCrewRemoved   = "job.crew_removed"
+	FileUploaded     = "file.uploaded"
+	FileProcessed    = "file.processed"
+	FileQuarantined  = "file.quarantined"
+	CustomerCreated  = "customer.created"
+	CustomerUpdated  = "customer.updated"
+	CustomerDeleted  = "customer.deleted"
+	QuoteSent        = "quote.sent"
+	QuoteAccepted    = "quote.accepted"
+	QuoteDeclined    = "quote.declined"
+	InvoiceCreated   = "invoice.created"
+	InvoiceSent      = "invoice.sent"
+	InvoicePaid      = "invoice.paid"
+	InvoiceVoided    = "invoice.voided"
+	PaymentRecorded  = "payment.recorded"
+)
+
+// Types lists every event type, for validating subscription filters
+var Types = []string{
+	JobCreated, JobUpdated, JobAssigned, JobStatusChanged, JobDeleted, JobCrewAdded, JobCrewRemoved,
+	FileUploaded, FileProcessed, FileQuarantined,
+	CustomerCreated, CustomerUpdated, CustomerDeleted,
+	QuoteSent, QuoteAccepted, QuoteDeclined,
+	InvoiceCreated, InvoiceSent, InvoicePaid, InvoiceVoided, PaymentRecorded,
+}
+
+func IsType(eventType string) bool {
+	for _, t := range Types {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// subscriberBuffer is how far a stream may fall behind before it is dropped.
+// A dropped client reconnects with Last-Event-ID and replays from history.
+const subscriberBuffer = 64
+
+// Event IDs are "<epoch>-<seq>". The epoch changes on every start, so a
+// client resuming from a previous process can tell its position is gone.
+type Event struct {
+	ID             string      `json:"id"`
+	OrganizationID uint        `json:"organization_id"`
+	Type           string      `json:"type"`
+	Data           interface{} `json:"data"`
+	OccurredAt     time.Time   `json:"occurred_at"`
+
+	seq uint64
+}
+
+// Publisher is what handlers and services depend on to emit events
+type Publisher interface {
+	Publish(organizationID uint, eventType string, data interface{}) Event
+}
+
+// Bus is an in-process, organization-scoped event bus. It keeps the most
+// recent events of each organization so reconnecting streams can resume.
+type Bus struct {
+	mu          sync.Mutex
+	epoch       int64
+	seq         uint64
+	historySize int
+	history     map[uint][]Event
+	evicted     map[uint]uint64 // last sequence number dropped from each history
+	subscribers map[*Subscription]struct{}
+	listeners   []func(Event)
+}
+
+func NewBus(historySize int) *Bus {
+	return &Bus{
+		epoch:       time.Now().UnixNano(),
+		historySize: historySize,
+		history:     make(map[uint][]Event),
+		evicted:     make(map[uint]uint64),
+		subscribers: make(map[*Subscription]struct{}),
+	}
+}
+
+// Subscription receives the live events of one organization. C is closed
+// when the subscription is closed or dropped for falling behind.
+type Subscription struct {
+	OrganizationID uint
+	C              <-chan Event
+
+	ch  chan Event
+	bus *Bus
+}
+
+// Publish records the event and fans it out. It never blocks on subscribers.
+func (b *Bus) Publish(organizationID uint, eventType string, data interface{}) Event {
+	b.mu.Lock()
+	b.seq++
+	event := Event{
+		ID:             fmt.Sprintf("%d-%d", b.epoch, b.seq),
+		OrganizationID: organizationID,
+		Type:           eventType,
+		Data:           data,
+		OccurredAt:     time.Now(),
+		seq:            b.seq,
+	}
+
+	history := append(b.history[organizationID], event)
+	if len(history) > b.historySize {
+		trim := len(history) - b.historySize
+		b.evicted[organizationID] = history[trim-1].seq
+		history = history[trim:]
+	}
+	b.history[organizationID] = history
+
+	for sub := range b.subscribers {
+		if sub.OrganizationID != organizationID {
+			continue
+		}
+		select {
+		case sub.ch <- event:
+		default:
+			b.drop(sub)
+		}
+	}
+	listeners := b.listeners
+	b.mu.Unlock()
+
+	for _, listen := range listeners {
+		listen(event)
+	}
+
+	return event
+}
+
+// Listen registers fn to be called for every event of every organization.
+// fn runs on the publishing goroutine and must not block.
+func (b *Bus) Listen(fn func(Event)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.listeners = append(b.listeners, fn)
+}
+
+// Subscribe starts a live subscription. With a lastEventID it also returns
+// the events published since then; complete is false when some of them are
+// no longer in history and the client should reload its state.
+func (b *Bus) Subscribe(organizationID uint, lastEventID string) (sub *Subscription, missed []Event, complete bool) {
+	ch := make(chan Event, subscriberBuffer)
+	sub = &Subscription{OrganizationID: organizationID, C: ch, ch: ch, bus: b}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.subscribers[sub] = struct{}{}
+
+	if lastEventID == "" {
+		return sub, nil, true
+	}
+
+	// An ID from before a restart cannot be resumed from at all
+	epoch, seq, ok := parseID(lastEventID)
+	if !ok || epoch != b.epoch {
+		return sub, nil, false
+	}
+
+	for _, event := range b.history[organizationID] {
+		if event.seq > seq {
+			missed = append(missed, event)
+		}
+	}
+	complete = b.evicted[organizationID] <= seq
+
+	return sub, missed, complete
+}
+
+// Close ends the subscription. It is safe to call more than once.
+func (s *Subscription) Close() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	s.bus.drop(s)
+}
+
+// drop must be called with b.mu held
+func (b *Bus) drop(sub *Subscription) {
+	if _, ok := b.subscribers[sub]; !ok {
+		return
+	}
+	delete(b.subscribers, sub)
+	close(sub.ch)
+}
+
+func parseID(id string) (epoch int64, seq uint64, ok bool) {
+	epochPart, seqPart, found := strings.Cut(id, "-")
+	if !found {
+		return 0, 0, false
+	}
+	epoch, err := strconv.ParseInt(epochPart, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	seq, err = strconv.ParseUint(seqPart, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return epoch, seq, true
+}
@@ -0,0 +1,271 @@
+package geofence
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/ireuven89/routewise/internal/events"
+	"github.com/ireuven89/routewise/internal/models"
+	"github.com/ireuven89/routewise/internal/repository"
+	"github.com/ireuven89/routewise/internal/routing"
+)
+
+// exitHysteresis widens the radius for leaving so GPS jitter at the edge
+// does not produce enter/exit flapping
+const exitHysteresis = 1.25
+
+// Engine turns worker location fixes into job status changes. Entering a
+// job's geofence starts the job; leaving after the minimum dwell time
+// suggests completing it. Every rule that fires is recorded as an event.
+type Engine struct {
+	jobRepo      jobStore
+	customerRepo customerStore
+	geofenceRepo geofenceStore
+	events       events.Publisher
+}
+
+// The engine's view of the repositories it uses
+type jobStore interface {
+	FindAll(organizationID uint, filters map[string]interface{}, sortBy string) ([]*models.Job, error)
+	FindByID(id uint, organizationID uint) (*models.Job, error)
+	UpdateStatus(jobID uint, organizationID uint, change models.StatusChange) (*models.JobStatusUpdate, error)
+}
+
+type customerStore interface {
+	FindByIDs(ids []uint, organizationID uint) (map[uint]*models.Customer, error)
+}
+
+type geofenceStore interface {
+	GetSettings(organizationID uint) (*models.GeofenceSettings, error)
+	FindOpenVisits(workerID uint) (map[uint]*models.GeofenceVisit, error)
+	OpenVisit(visit *models.GeofenceVisit) error
+	CloseVisit(id uint, exitedAt time.Time) error
+	CreateEvent(event *models.GeofenceEvent) error
+}
+
+func NewEngine(db *sql.DB, publisher events.Publisher) *Engine {
+	return &Engine{
+		jobRepo:      repository.NewJobRepository(db),
+		customerRepo: repository.NewCustomerRepository(db),
+		geofenceRepo: repository.NewGeofenceRepository(db),
+		events:       publisher,
+	}
+}
+
+type site struct {
+	job   *models.Job
+	point routing.Point
+}
+
+// Process evaluates a batch of fixes for one worker in chronological order
+func (e *Engine) Process(organizationID uint, workerID uint, fixes []*models.WorkerLocation) error {
+	if len(fixes) == 0 {
+		return nil
+	}
+
+	settings, err := e.geofenceRepo.GetSettings(organizationID)
+	if err != nil {
+		return err
+	}
+	if !settings.Enabled {
+		return nil
+	}
+
+	sorted := append([]*models.WorkerLocation(nil), fixes...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].RecordedAt.Before(sorted[j].RecordedAt) })
+
+	visits, err := e.geofenceRepo.FindOpenVisits(workerID)
+	if err != nil {
+		return err
+	}
+
+	sites, err := e.loadSites(organizationID, workerID, sorted, visits)
+	if err != nil {
+		return err
+	}
+
+	radius := float64(settings.RadiusMeters)
+	minDwell := time.Duration(settings.MinDwellMinutes) * time.Minute
+
+	for _, fix := range sorted {
+		here := routing.Point{Lat: fix.Latitude, Lng: fix.Longitude}
+
+		for _, s := range sites {
+			distance := routing.HaversineKm(here, s.point) * 1000
+			visit, inside := visits[s.job.ID]
+
+			switch {
+			case !inside && distance <= radius:
+				// A fix less precise than the fence itself cannot prove arrival
+				if fix.AccuracyMeters != nil && *fix.AccuracyMeters > radius {
+					continue
+				}
+				visit = &models.GeofenceVisit{JobID: s.job.ID, WorkerID: workerID, EnteredAt: fix.RecordedAt}
+				if err := e.geofenceRepo.OpenVisit(visit); err != nil {
+					return err
+				}
+				visits[s.job.ID] = visit
+
+				if err := e.onEnter(organizationID, workerID, s.job, fix, distance); err != nil {
+					return err
+				}
+
+			case inside && distance > radius*exitHysteresis:
+				if err := e.geofenceRepo.CloseVisit(visit.ID, fix.RecordedAt); err != nil {
+					return err
+				}
+				delete(visits, s.job.ID)
+
+				dwell := fix.RecordedAt.Sub(visit.EnteredAt)
+				if err := e.onExit(organizationID, workerID, s.job, fix, distance, dwell, minDwell); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// onEnter applies the arrival_start rule: a scheduled job moves to in_progress
+func (e *Engine) onEnter(organizationID, workerID uint, job *models.Job, fix *models.WorkerLocation, distance float64) error {
+	event := newEvent(organizationID, workerID, job, fix, distance, "entered")
+
+	if job.Status != models.StatusScheduled {
+		event.Outcome = models.GeofenceOutcomeRecorded
+		event.Detail = fmt.Sprintf("job already %s", job.Status)
+		return e.geofenceRepo.CreateEvent(event)
+	}
+
+	event.Rule = models.GeofenceRuleArrivalStart
+	from, to := job.Status, models.StatusInProgress
+	event.FromStatus, event.ToStatus = &from, &to
+
+	// The repository runs the same state machine as a manual update
+	update, err := e.jobRepo.UpdateStatus(job.ID, organizationID, models.StatusChange{
+		To:              to,
+		ChangedByWorker: &workerID,
+		Source:          models.StatusSourceGeofence,
+		Reason:          models.GeofenceRuleArrivalStart,
+	})
+	if err != nil {
+		event.Outcome = models.GeofenceOutcomeRejected
+		event.Detail = err.Error()
+		return e.geofenceRepo.CreateEvent(event)
+	}
+
+	job.Status = to
+	e.events.Publish(organizationID, events.JobStatusChanged, update)
+	event.Outcome = models.GeofenceOutcomeApplied
+	return e.geofenceRepo.CreateEvent(event)
+}
+
+// onExit applies the departure_complete rule: leaving an in-progress job after
+// the minimum dwell suggests completing it. It never completes on its own.
+func (e *Engine) onExit(organizationID, workerID uint, job *models.Job, fix *models.WorkerLocation, distance float64, dwell, minDwell time.Duration) error {
+	event := newEvent(organizationID, workerID, job, fix, distance, "exited")
+
+	if job.Status != models.StatusInProgress {
+		event.Outcome = models.GeofenceOutcomeRecorded
+		event.Detail = fmt.Sprintf("job is %s", job.Status)
+		return e.geofenceRepo.CreateEvent(event)
+	}
+	if dwell < minDwell {
+		event.Outcome = models.GeofenceOutcomeRecorded
+		event.Detail = fmt.Sprintf("left after %s, minimum dwell is %s", dwell.Round(time.Second), minDwell)
+		return e.geofenceRepo.CreateEvent(event)
+	}
+
+	event.Rule = models.GeofenceRuleDepartureComplete
+	from, to := job.Status, models.StatusCompleted
+	event.FromStatus, event.ToStatus = &from, &to
+
+	if err := models.JobStatusFlow.Validate(from, to, false); err != nil {
+		event.Outcome = models.GeofenceOutcomeRejected
+		event.Detail = err.Error()
+		return e.geofenceRepo.CreateEvent(event)
+	}
+
+	event.Outcome = models.GeofenceOutcomeSuggested
+	event.Detail = fmt.Sprintf("on site for %s", dwell.Round(time.Minute))
+	return e.geofenceRepo.CreateEvent(event)
+}
+
+// loadSites collects the worker's jobs for the days covered by the batch,
+// plus any job whose geofence the worker is still inside
+func (e *Engine) loadSites(organizationID, workerID uint, fixes []*models.WorkerLocation, visits map[uint]*models.GeofenceVisit) ([]site, error) {
+	jobs := make(map[uint]*models.Job)
+
+	dates := make(map[string]bool)
+	for _, fix := range fixes {
+		dates[fix.RecordedAt.Format("2006-01-02")] = true
+	}
+	for date := range dates {
+		dayJobs, err := e.jobRepo.FindAll(organizationID, map[string]interface{}{
+			"technician_id":  workerID,
+			"scheduled_date": date,
+		}, "scheduled_at")
+		if err != nil {
+			return nil, err
+		}
+		for _, job := range dayJobs {
+			jobs[job.ID] = job
+		}
+	}
+
+	for jobID := range visits {
+		if _, ok := jobs[jobID]; ok {
+			continue
+		}
+		job, err := e.jobRepo.FindByID(jobID, organizationID)
+		if err != nil {
+			continue // job was deleted; the visit is simply left open
+		}
+		jobs[jobID] = job
+	}
+
+	list := make([]*models.Job, 0, len(jobs))
+	for _, job := range jobs {
+		if job.Status == models.StatusCancelled {
+			continue
+		}
+		list = append(list, job)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ScheduledAt.Before(list[j].ScheduledAt) })
+
+	customerIDs := make([]uint, 0, len(list))
+	for _, job := range list {
+		customerIDs = append(customerIDs, job.CustomerID)
+	}
+	customers, err := e.customerRepo.FindByIDs(customerIDs, organizationID)
+	if err != nil {
+		return nil, err
+	}
+
+	sites := []site{}
+	for _, job := range list {
+		customer, ok := customers[job.CustomerID]
+		if !ok || customer.Latitude == nil || customer.Longitude == nil {
+			continue
+		}
+		sites = append(sites, site{job: job, point: routing.Point{Lat: *customer.Latitude, Lng: *customer.Longitude}})
+	}
+
+	return sites, nil
+}
+
+func newEvent(organizationID, workerID uint, job *models.Job, fix *models.WorkerLocation, distance float64, eventType string) *models.GeofenceEvent {
+	return &models.GeofenceEvent{
+		OrganizationID: organizationID,
+		JobID:          job.ID,
+		WorkerID:       workerID,
+		Rule:           models.GeofenceRulePresence,
+		EventType:      eventType,
+		Latitude:       fix.Latitude,
+		Longitude:      fix.Longitude,
+		DistanceMeters: distance,
+		OccurredAt:     fix.RecordedAt,
+	}
+}
@@ -0,0 +1,296 @@
+package geofence
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ireuven89/routewise/internal/events"
+	"github.com/ireuven89/routewise/internal/models"
+	"github.com/ireuven89/routewise/internal/routing"
+)
+
+const (
+	testOrg    uint = 1
+	testWorker uint = 2
+	testJob    uint = 3
+)
+
+var start = time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+
+// metersPerDegree is the length of a degree of longitude on the equator
+var metersPerDegree = routing.HaversineKm(routing.Point{}, routing.Point{Lng: 1}) * 1000
+
+// fixAt is a fix the given distance east of the job site, minutes into the day
+func fixAt(minutes int, meters float64) *models.WorkerLocation {
+	return &models.WorkerLocation{
+		WorkerID:   testWorker,
+		Longitude:  meters / metersPerDegree,
+		RecordedAt: start.Add(time.Duration(minutes) * time.Minute),
+	}
+}
+
+type fakeJobs struct {
+	job       *models.Job
+	updateErr error
+	changes   []models.StatusChange
+}
+
+func (f *fakeJobs) FindAll(organizationID uint, filters map[string]interface{}, sortBy string) ([]*models.Job, error) {
+	return []*models.Job{f.job}, nil
+}
+
+func (f *fakeJobs) FindByID(id uint, organizationID uint) (*models.Job, error) {
+	return f.job, nil
+}
+
+func (f *fakeJobs) UpdateStatus(jobID uint, organizationID uint, change models.StatusChange) (*models.JobStatusUpdate, error) {
+	if f.updateErr != nil {
+		return nil, f.updateErr
+	}
+	f.changes = append(f.changes, change)
+	return &models.JobStatusUpdate{JobID: jobID, OldStatus: f.job.Status, NewStatus: change.To}, nil
+}
+
+// fakeCustomers places every customer on the equator at the prime meridian
+type fakeCustomers struct{}
+
+func (fakeCustomers) FindByIDs(ids []uint, organizationID uint) (map[uint]*models.Customer, error) {
+	customers := make(map[uint]*models.Customer)
+	for _, id := range ids {
+		lat, lng := 0.0, 0.0
+		customers[id] = &models.Customer{ID: id, Latitude: &lat, Longitude: &lng}
+	}
+	return customers, nil
+}
+
+type fakeGeofence struct {
+	settings *models.GeofenceSettings
+	visits   map[uint]*models.GeofenceVisit
+	closed   []uint
+	events   []*models.GeofenceEvent
+}
+
+func (f *fakeGeofence) GetSettings(organizationID uint) (*models.GeofenceSettings, error) {
+	return f.settings, nil
+}
+
+func (f *fakeGeofence) FindOpenVisits(workerID uint) (map[uint]*models.GeofenceVisit, error) {
+	open := make(map[uint]*models.GeofenceVisit)
+	for jobID, visit := range f.visits {
+		open[jobID] = visit
+	}
+	return open, nil
+}
+
+func (f *fakeGeofence) OpenVisit(visit *models.GeofenceVisit) error {
+	visit.ID = uint(len(f.visits) + len(f.closed) + 1)
+	f.visits[visit.JobID] = visit
+	return nil
+}
+
+func (f *fakeGeofence) CloseVisit(id uint, exitedAt time.Time) error {
+	for jobID, visit := range f.visits {
+		if visit.ID == id {
+			delete(f.visits, jobID)
+			f.closed = append(f.closed, id)
+			return nil
+		}
+	}
+	return fmt.Errorf("visit %d is not open", id)
+}
+
+func (f *fakeGeofence) CreateEvent(event *models.GeofenceEvent) error {
+	f.events = append(f.events, event)
+	return nil
+}
+
+type fakePublisher struct{ published []string }
+
+func (f *fakePublisher) Publish(organizationID uint, eventType string, data interface{}) events.Event {
+	f.published = append(f.published, eventType)
+	return events.Event{}
+}
+
+func TestProcess(t *testing.T) {
+	imprecise := fixAt(1, 50)
+	accuracy := 200.0
+	imprecise.AccuracyMeters = &accuracy
+
+	tests := []struct {
+		name       string
+		status     models.JobStatus
+		enteredAt  *int // minutes into the day of a visit already open
+		disabled   bool
+		updateErr  error
+		fixes      []*models.WorkerLocation
+		wantEvents []string // event type, rule and outcome
+		wantStatus models.JobStatus
+		wantInside bool
+	}{
+		{
+			name:       "entering starts a scheduled job",
+			status:     models.StatusScheduled,
+			fixes:      []*models.WorkerLocation{fixAt(0, 500), fixAt(1, 50)},
+			wantEvents: []string{"entered arrival_start applied"},
+			wantStatus: models.StatusInProgress,
+			wantInside: true,
+		},
+		{
+			name:       "entering a job that is not scheduled is only recorded",
+			status:     models.StatusInProgress,
+			fixes:      []*models.WorkerLocation{fixAt(0, 50)},
+			wantEvents: []string{"entered presence recorded"},
+			wantStatus: models.StatusInProgress,
+			wantInside: true,
+		},
+		{
+			name:       "a start the job refuses is rejected",
+			status:     models.StatusScheduled,
+			updateErr:  errors.New("job not found"),
+			fixes:      []*models.WorkerLocation{fixAt(0, 50)},
+			wantEvents: []string{"entered arrival_start rejected"},
+			wantStatus: models.StatusScheduled,
+			wantInside: true,
+		},
+		{
+			name:       "a fix less precise than the fence does not enter",
+			status:     models.StatusScheduled,
+			fixes:      []*models.WorkerLocation{imprecise},
+			wantStatus: models.StatusScheduled,
+		},
+		{
+			name:       "leaving after the minimum dwell suggests completing",
+			status:     models.StatusInProgress,
+			enteredAt:  intPtr(0),
+			fixes:      []*models.WorkerLocation{fixAt(20, 300)},
+			wantEvents: []string{"exited departure_complete suggested"},
+			wantStatus: models.StatusInProgress,
+		},
+		{
+			name:       "leaving before the minimum dwell is only recorded",
+			status:     models.StatusInProgress,
+			enteredAt:  intPtr(0),
+			fixes:      []*models.WorkerLocation{fixAt(5, 300)},
+			wantEvents: []string{"exited presence recorded"},
+			wantStatus: models.StatusInProgress,
+		},
+		{
+			name:       "leaving a job that is not in progress is only recorded",
+			status:     models.StatusScheduled,
+			enteredAt:  intPtr(0),
+			fixes:      []*models.WorkerLocation{fixAt(20, 300)},
+			wantEvents: []string{"exited presence recorded"},
+			wantStatus: models.StatusScheduled,
+		},
+		{
+			name:       "drifting inside the hysteresis band neither exits nor re-enters",
+			status:     models.StatusInProgress,
+			enteredAt:  intPtr(0),
+			fixes:      []*models.WorkerLocation{fixAt(20, 110), fixAt(21, 120), fixAt(22, 90), fixAt(23, 115)},
+			wantStatus: models.StatusInProgress,
+			wantInside: true,
+		},
+		{
+			name:   "a whole visit, with fixes out of order, starts then suggests completing",
+			status: models.StatusScheduled,
+			fixes:  []*models.WorkerLocation{fixAt(30, 400), fixAt(0, 60), fixAt(15, 110)},
+			wantEvents: []string{
+				"entered arrival_start applied",
+				"exited departure_complete suggested",
+			},
+			wantStatus: models.StatusInProgress,
+		},
+		{
+			name:       "re-entering after leaving opens a new visit",
+			status:     models.StatusInProgress,
+			fixes:      []*models.WorkerLocation{fixAt(0, 50), fixAt(2, 200), fixAt(4, 50)},
+			wantEvents: []string{"entered presence recorded", "exited presence recorded", "entered presence recorded"},
+			wantStatus: models.StatusInProgress,
+			wantInside: true,
+		},
+		{
+			name:       "nothing happens while geofencing is disabled",
+			status:     models.StatusScheduled,
+			disabled:   true,
+			fixes:      []*models.WorkerLocation{fixAt(0, 50)},
+			wantStatus: models.StatusScheduled,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := &models.Job{ID: testJob, OrganizationID: testOrg, CustomerID: 4, Status: tt.status, ScheduledAt: start}
+			jobs := &fakeJobs{job: job, updateErr: tt.updateErr}
+			settings := models.DefaultGeofenceSettings(testOrg)
+			settings.RadiusMeters = 100
+			settings.Enabled = !tt.disabled
+			geofences := &fakeGeofence{settings: settings, visits: map[uint]*models.GeofenceVisit{}}
+			if tt.enteredAt != nil {
+				geofences.visits[testJob] = &models.GeofenceVisit{
+					ID: 100, JobID: testJob, WorkerID: testWorker,
+					EnteredAt: start.Add(time.Duration(*tt.enteredAt) * time.Minute),
+				}
+			}
+			publisher := &fakePublisher{}
+			engine := &Engine{jobRepo: jobs, customerRepo: fakeCustomers{}, geofenceRepo: geofences, events: publisher}
+
+			if err := engine.Process(testOrg, testWorker, tt.fixes); err != nil {
+				t.Fatalf("Process() error = %v", err)
+			}
+
+			var got []string
+			for _, event := range geofences.events {
+				got = append(got, strings.Join([]string{event.EventType, event.Rule, event.Outcome}, " "))
+			}
+			if strings.Join(got, ", ") != strings.Join(tt.wantEvents, ", ") {
+				t.Errorf("events = %v, want %v", got, tt.wantEvents)
+			}
+
+			if job.Status != tt.wantStatus {
+				t.Errorf("job status = %s, want %s", job.Status, tt.wantStatus)
+			}
+			if _, inside := geofences.visits[testJob]; inside != tt.wantInside {
+				t.Errorf("visit open = %v, want %v", inside, tt.wantInside)
+			}
+
+			// Only an applied start changes the job, through the state machine
+			started := tt.wantStatus != tt.status
+			if started != (len(jobs.changes) == 1) || len(publisher.published) != len(jobs.changes) {
+				t.Errorf("status changes = %v, published %v", jobs.changes, publisher.published)
+			}
+			for _, change := range jobs.changes {
+				if change.To != models.StatusInProgress || change.Source != models.StatusSourceGeofence || *change.ChangedByWorker != testWorker {
+					t.Errorf("status change = %+v, want in_progress from the geofence by worker %d", change, testWorker)
+				}
+			}
+		})
+	}
+}
+
+// Suggestions never complete the job; accepting one is a separate step
+func TestDepartureSuggestionDetail(t *testing.T) {
+	job := &models.Job{ID: testJob, Status: models.StatusInProgress}
+	geofences := &fakeGeofence{}
+	engine := &Engine{geofenceRepo: geofences}
+
+	fix := fixAt(42, 300)
+	if err := engine.onExit(testOrg, testWorker, job, fix, 300, 42*time.Minute, 10*time.Minute); err != nil {
+		t.Fatalf("onExit() error = %v", err)
+	}
+
+	event := geofences.events[0]
+	if event.FromStatus == nil || *event.FromStatus != models.StatusInProgress || event.ToStatus == nil || *event.ToStatus != models.StatusCompleted {
+		t.Errorf("transition = %v -> %v, want in_progress -> completed", event.FromStatus, event.ToStatus)
+	}
+	if event.Detail != "on site for 42m0s" {
+		t.Errorf("detail = %q, want %q", event.Detail, "on site for 42m0s")
+	}
+	if job.Status != models.StatusInProgress {
+		t.Errorf("job status = %s, want it left in_progress", job.Status)
+	}
+}
+
+func intPtr(n int) *int { return &n }
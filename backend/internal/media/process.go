@@ -0,0 +1,184 @@
+// Package media processes uploaded photos: it reads EXIF metadata and makes
+// smaller, correctly oriented renditions for galleries on mobile data
+package media
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif" // registered decoders
+	"image/jpeg"
+	_ "image/png"
+	"time"
+
+	"github.com/rwcarlsen/goexif/exif"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// maxPixels refuses images that would take too much memory to decode,
+// e.g. decompression bombs. 100 MP covers current phone cameras.
+const maxPixels = 100_000_000
+
+const renditionQuality = 80
+
+// Renditions are JPEGs whose longest side is at most this many pixels
+var (
+	Thumbnail = Size{Name: "thumb", MaxSide: 320}
+	Medium    = Size{Name: "medium", MaxSide: 1280}
+)
+
+// ErrNotImage is returned for data that is not a supported image or is too
+// large to process. Such photos are marked failed rather than retried.
+var ErrNotImage = errors.New("not a supported image")
+
+type Size struct {
+	Name    string
+	MaxSide int
+}
+
+// Metadata is what the photo says about itself. Fields the photo does not
+// carry are left nil.
+type Metadata struct {
+	TakenAt   *time.Time
+	Latitude  *float64
+	Longitude *float64
+	Width     int // after orientation
+	Height    int
+}
+
+// Result is a processed photo with its renditions, keyed by size name
+type Result struct {
+	Metadata   Metadata
+	Renditions map[string][]byte
+}
+
+// Process reads the photo's metadata and renders each size. EXIF times
+// without a zone are read in loc, the organization's timezone, as cameras
+// record local wall-clock time.
+func Process(data []byte, loc *time.Location, sizes ...Size) (*Result, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrNotImage
+	}
+	// Too large to ever process, so it fails for good rather than being retried
+	if int64(config.Width)*int64(config.Height) > maxPixels {
+		return nil, fmt.Errorf("%w: %dx%d is larger than %d pixels", ErrNotImage, config.Width, config.Height, maxPixels)
+	}
+
+	meta, orientation := readExif(data, loc)
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrNotImage
+	}
+
+	meta.Width, meta.Height = src.Bounds().Dx(), src.Bounds().Dy()
+	if orientation >= 5 { // rotated a quarter turn
+		meta.Width, meta.Height = meta.Height, meta.Width
+	}
+
+	result := &Result{Metadata: meta, Renditions: make(map[string][]byte)}
+	for _, size := range sizes {
+		scaled := scale(src, size.MaxSide)
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, orient(scaled, orientation), &jpeg.Options{Quality: renditionQuality}); err != nil {
+			return nil, err
+		}
+		result.Renditions[size.Name] = buf.Bytes()
+	}
+	return result, nil
+}
+
+// readExif returns the capture time, GPS position and orientation (1-8,
+// 1 when unknown). Photos without EXIF are normal.
+func readExif(data []byte, loc *time.Location) (Metadata, int) {
+	meta := Metadata{}
+	x, err := exif.Decode(bytes.NewReader(data))
+	if err != nil {
+		return meta, 1
+	}
+
+	if t, err := x.DateTime(); err == nil {
+		if _, err := x.TimeZone(); err != nil {
+			// No zone in the EXIF; goexif assumed the server's
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, loc)
+		}
+		if !t.IsZero() && t.Year() > 1970 {
+			utc := t.UTC()
+			meta.TakenAt = &utc
+		}
+	}
+
+	if lat, lng, err := x.LatLong(); err == nil && validCoordinates(lat, lng) {
+		meta.Latitude, meta.Longitude = &lat, &lng
+	}
+
+	orientation := 1
+	if tag, err := x.Get(exif.Orientation); err == nil {
+		if o, err := tag.Int(0); err == nil && o >= 1 && o <= 8 {
+			orientation = o
+		}
+	}
+	return meta, orientation
+}
+
+func validCoordinates(lat, lng float64) bool {
+	return lat >= -90 && lat <= 90 && lng >= -180 && lng <= 180 && (lat != 0 || lng != 0)
+}
+
+// scale fits src within maxSide onto white so transparent areas do not turn
+// black in the JPEG. Images are never enlarged.
+func scale(src image.Image, maxSide int) *image.RGBA {
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	longest := max(w, h)
+	if longest > maxSide {
+		w, h = max(1, w*maxSide/longest), max(1, h*maxSide/longest)
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, src.Bounds(), draw.Over, nil)
+	return dst
+}
+
+// orient applies an EXIF orientation so the image displays upright without
+// the viewer having to read the tag
+func orient(src *image.RGBA, orientation int) *image.RGBA {
+	if orientation <= 1 || orientation > 8 {
+		return src
+	}
+
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // mirrored
+				dx, dy = w-1-x, y
+			case 3: // upside down
+				dx, dy = w-1-x, h-1-y
+			case 4: // mirrored, upside down
+				dx, dy = x, h-1-y
+			case 5: // transposed
+				dx, dy = y, x
+			case 6: // rotated 90° clockwise to display
+				dx, dy = h-1-y, x
+			case 7: // transversed
+				dx, dy = h-1-y, w-1-x
+			case 8: // rotated 90° counter-clockwise to display
+				dx, dy = y, w-1-x
+			}
+			dst.SetRGBA(dx, dy, src.RGBAAt(x, y))
+		}
+	}
+	return dst
+}
@@ -0,0 +1,72 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+	"time"
+)
+
+// pngWithSize encodes a 1x1 PNG and rewrites its header to claim the given
+// dimensions, as a decompression bomb would
+func pngWithSize(t *testing.T, width, height uint32) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, 1, 1))
+	img.Set(0, 0, color.White)
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	// Signature (8), IHDR length (4), "IHDR" (4), then width and height
+	binary.BigEndian.PutUint32(data[16:], width)
+	binary.BigEndian.PutUint32(data[20:], height)
+	binary.BigEndian.PutUint32(data[29:], crc32.ChecksumIEEE(data[12:29]))
+	return data
+}
+
+func TestProcessRejectsOversizedImagesForGood(t *testing.T) {
+	tests := []struct {
+		name          string
+		width, height uint32
+	}{
+		{"over the pixel limit", 20000, 20000},
+		{"overflows int32", 1 << 20, 1 << 20},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Process(pngWithSize(t, tt.width, tt.height), time.UTC, Thumbnail)
+			if !errors.Is(err, ErrNotImage) {
+				t.Fatalf("Process() = %v, want ErrNotImage", err)
+			}
+		})
+	}
+}
+
+func TestProcessRendersSmallImages(t *testing.T) {
+	result, err := Process(pngWithSize(t, 1, 1), time.UTC, Thumbnail, Medium)
+	if err != nil {
+		t.Fatalf("Process() = %v", err)
+	}
+	if result.Metadata.Width != 1 || result.Metadata.Height != 1 {
+		t.Errorf("size = %dx%d, want 1x1", result.Metadata.Width, result.Metadata.Height)
+	}
+	for _, size := range []Size{Thumbnail, Medium} {
+		if _, _, err := image.Decode(bytes.NewReader(result.Renditions[size.Name])); err != nil {
+			t.Errorf("%s rendition: %v", size.Name, err)
+		}
+	}
+}
+
+func TestProcessRejectsNonImages(t *testing.T) {
+	if _, err := Process([]byte("%PDF-1.7"), time.UTC, Thumbnail); !errors.Is(err, ErrNotImage) {
+		t.Fatalf("Process() = %v, want ErrNotImage", err)
+	}
+}
@@ -0,0 +1,204 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/ireuven89/routewise/internal/events"
+	"github.com/ireuven89/routewise/internal/models"
+	"github.com/ireuven89/routewise/internal/repository"
+	"github.com/ireuven89/routewise/services"
+)
+
+const (
+	queueSize = 500
+	// Originals larger than this are not processed; the gallery shows the original
+	maxOriginalBytes = 64 << 20
+	// Photos still pending after this are picked up by the periodic scan, e.g.
+	// when the queue was full or the server restarted
+	pendingGrace = time.Minute
+	// A claim older than this is assumed abandoned
+	claimTimeout = 15 * time.Minute
+	scanBatch    = 20
+)
+
+type uploadedPhoto struct {
+	organizationID uint
+	fileID         uint
+}
+
+// Processor reads EXIF data from uploaded photos and stores thumbnail and
+// medium renditions next to the original, which is left untouched
+type Processor struct {
+	fileRepo         *repository.FileRepository
+	availabilityRepo *repository.AvailabilityRepository
+	storage          services.Storage
+	events           events.Publisher
+	queue            chan uploadedPhoto
+}
+
+func NewProcessor(db *sql.DB, storage services.Storage, publisher events.Publisher) *Processor {
+	return &Processor{
+		fileRepo:         repository.NewFileRepository(db),
+		availabilityRepo: repository.NewAvailabilityRepository(db),
+		storage:          storage,
+		events:           publisher,
+		queue:            make(chan uploadedPhoto, queueSize),
+	}
+}
+
+// Enqueue is registered with Bus.Listen and only hands photos to Run
+func (p *Processor) Enqueue(event events.Event) {
+	if event.Type != events.FileUploaded {
+		return
+	}
+	file, ok := event.Data.(*models.ProjectFile)
+	if !ok || file.ProcessingStatus != models.ProcessingPending {
+		return
+	}
+
+	select {
+	case p.queue <- uploadedPhoto{organizationID: event.OrganizationID, fileID: file.ID}:
+	default:
+		// The periodic scan will find it
+		log.Printf("photo queue full, file %d deferred", file.ID)
+	}
+}
+
+// Run processes queued photos until ctx is done, and every interval scans for
+// photos that were missed
+func (p *Processor) Run(ctx context.Context, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case photo := <-p.queue:
+			p.process(ctx, photo)
+		case <-ticker.C:
+			now := time.Now()
+			pending, err := p.fileRepo.FindPendingProcessing(now.Add(-pendingGrace), now.Add(-claimTimeout), scanBatch)
+			if err != nil {
+				sentry.CaptureException(err)
+				log.Printf("photo scan failed: %v", err)
+				continue
+			}
+			for fileID, organizationID := range pending {
+				p.process(ctx, uploadedPhoto{organizationID: organizationID, fileID: fileID})
+			}
+		}
+	}
+}
+
+func (p *Processor) process(ctx context.Context, photo uploadedPhoto) {
+	claimed, err := p.fileRepo.ClaimForProcessing(photo.fileID, time.Now().Add(-claimTimeout))
+	if err != nil || !claimed {
+		if err != nil {
+			sentry.CaptureException(err)
+			log.Printf("claiming photo %d: %v", photo.fileID, err)
+		}
+		return
+	}
+
+	file, err := p.fileRepo.FindByID(photo.fileID)
+	if err != nil {
+		return // deleted meanwhile
+	}
+
+	err = p.render(ctx, photo.organizationID, file)
+	switch {
+	case err == nil:
+		file.ProcessingStatus = models.ProcessingDone
+	case errors.Is(err, ErrNotImage) || errors.Is(err, services.ErrObjectNotFound):
+		log.Printf("photo %d not processed: %v", file.ID, err)
+		file.ProcessingStatus = models.ProcessingFailed
+	default:
+		// Left claimed; the scan retries it once the claim times out
+		sentry.CaptureException(err)
+		log.Printf("processing photo %d: %v", file.ID, err)
+		return
+	}
+
+	if err := p.fileRepo.SaveProcessing(file); err != nil {
+		sentry.CaptureException(err)
+		log.Printf("saving photo %d: %v", file.ID, err)
+		return
+	}
+	p.events.Publish(photo.organizationID, events.FileProcessed, file)
+}
+
+// render fills in the file's metadata and rendition keys
+func (p *Processor) render(ctx context.Context, organizationID uint, file *models.ProjectFile) error {
+	data, err := p.download(ctx, file.S3Key)
+	if err != nil {
+		return err
+	}
+
+	result, err := Process(data, p.location(organizationID), Thumbnail, Medium)
+	if err != nil {
+		return err
+	}
+
+	keys := map[string]*string{Thumbnail.Name: &file.ThumbnailS3Key, Medium.Name: &file.MediumS3Key}
+	file.RenditionsSize = 0
+	for name, key := range keys {
+		*key = RenditionKey(file.S3Key, name)
+		if err := p.storage.UploadFile(ctx, bytes.NewReader(result.Renditions[name]), *key, "image/jpeg"); err != nil {
+			return err
+		}
+		file.RenditionsSize += int64(len(result.Renditions[name]))
+	}
+
+	meta := result.Metadata
+	if file.TakenAt == nil {
+		file.TakenAt = meta.TakenAt
+	}
+	file.Latitude, file.Longitude = meta.Latitude, meta.Longitude
+	file.Width, file.Height = meta.Width, meta.Height
+	return nil
+}
+
+func (p *Processor) download(ctx context.Context, key string) ([]byte, error) {
+	body, err := p.storage.DownloadFile(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(body, maxOriginalBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxOriginalBytes {
+		return nil, fmt.Errorf("%w: larger than %d bytes", ErrNotImage, maxOriginalBytes)
+	}
+	return data, nil
+}
+
+// location is the organization's timezone, for EXIF times without one
+func (p *Processor) location(organizationID uint) *time.Location {
+	settings, err := p.availabilityRepo.GetSettings(organizationID)
+	if err != nil {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(settings.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// RenditionKey is where a rendition of the original is stored: next to it,
+// with the size name and a .jpg extension appended
+func RenditionKey(originalKey, name string) string {
+	return originalKey + "." + name + ".jpg"
+}
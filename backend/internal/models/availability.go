@@ -0,0 +1,77 @@
+package models
+
+import "time"
+
+const (
+	ConflictModeWarn   = "warn"
+	ConflictModeReject = "reject"
+)
+
+// Schedule conflict types
+const (
+	ConflictJobOverlap   = "job_overlap"
+	ConflictTimeOff      = "time_off"
+	ConflictHoliday      = "holiday"
+	ConflictOutsideHours = "outside_working_hours"
+)
+
+type SchedulingSettings struct {
+	OrganizationID      uint      `json:"organization_id"`
+	TravelBufferMinutes int       `json:"travel_buffer_minutes"`
+	ConflictMode        string    `json:"conflict_mode"`
+	Timezone            string    `json:"timezone"`
+	UpdatedAt           time.Time `json:"updated_at"`
+}
+
+func DefaultSchedulingSettings(organizationID uint) *SchedulingSettings {
+	return &SchedulingSettings{
+		OrganizationID:      organizationID,
+		TravelBufferMinutes: 15,
+		ConflictMode:        ConflictModeWarn,
+		Timezone:            "UTC",
+	}
+}
+
+// WorkingHours is one block of a worker's week. Times are "HH:MM" in the
+// organization's timezone; a day may have several blocks.
+type WorkingHours struct {
+	ID        uint   `json:"id"`
+	WorkerID  uint   `json:"worker_id"`
+	Weekday   int    `json:"weekday"` // 0 = Sunday
+	StartTime string `json:"start_time"`
+	EndTime   string `json:"end_time"`
+}
+
+type TimeOff struct {
+	ID        uint      `json:"id"`
+	WorkerID  uint      `json:"worker_id"`
+	StartsAt  time.Time `json:"starts_at"`
+	EndsAt    time.Time `json:"ends_at"`
+	Reason    string    `json:"reason,omitempty"`
+	CreatedBy *uint     `json:"created_by,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Holiday struct {
+	ID             uint      `json:"id"`
+	OrganizationID uint      `json:"organization_id"`
+	Date           string    `json:"date"` // YYYY-MM-DD
+	Name           string    `json:"name"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// BusyBlock is a job occupying a worker, as lead technician or crew member
+type BusyBlock struct {
+	JobID uint      `json:"job_id"`
+	Title string    `json:"title"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+type ScheduleConflict struct {
+	Type   string    `json:"type"`
+	JobID  *uint     `json:"job_id,omitempty"`
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+	Detail string    `json:"detail"`
+}
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+const (
+	DefaultPrimaryColor = "#1F3A5F"
+	DefaultAccentColor  = "#E8EEF5"
+)
+
+// OrganizationBranding styles the PDFs generated for an organization.
+// Colors are "#RRGGBB".
+type OrganizationBranding struct {
+	OrganizationID uint      `json:"organization_id"`
+	LogoS3Key      string    `json:"-"`
+	LogoURL        string    `json:"logo_url,omitempty"` // Presigned URL (temporary)
+	PrimaryColor   string    `json:"primary_color"`
+	AccentColor    string    `json:"accent_color"`
+	FooterText     string    `json:"footer_text,omitempty"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+func DefaultBranding(organizationID uint) *OrganizationBranding {
+	return &OrganizationBranding{
+		OrganizationID: organizationID,
+		PrimaryColor:   DefaultPrimaryColor,
+		AccentColor:    DefaultAccentColor,
+	}
+}
+
+// ParseHexColor parses "#RRGGBB" into its components
+func ParseHexColor(s string) (r, g, b int, err error) {
+	if len(s) != 7 || s[0] != '#' {
+		return 0, 0, 0, fmt.Errorf("color must be #RRGGBB")
+	}
+	v, err := strconv.ParseUint(s[1:], 16, 32)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("color must be #RRGGBB")
+	}
+	return int(v >> 16 & 0xff), int(v >> 8 & 0xff), int(v & 0xff), nil
+}
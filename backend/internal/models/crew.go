@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// Common crew roles. Role is free text, these are the ones the UI offers.
+const (
+	CrewRoleForeman     = "foreman"
+	CrewRoleElectrician = "electrician"
+	CrewRolePlumber     = "plumber"
+	CrewRoleLaborer     = "laborer"
+	CrewRoleTechnician  = "technician"
+)
+
+// CrewAssignment is one worker on a job's crew. RemovedAt is nil while the
+// worker is still assigned.
+type CrewAssignment struct {
+	ID         uint       `json:"id"`
+	JobID      uint       `json:"job_id"`
+	WorkerID   uint       `json:"worker_id"`
+	WorkerName string     `json:"worker_name,omitempty"`
+	Role       string     `json:"role"`
+	AssignedBy *uint      `json:"assigned_by,omitempty"`
+	AssignedAt time.Time  `json:"assigned_at"`
+	RemovedAt  *time.Time `json:"removed_at,omitempty"`
+}
+
+// WorkerAssignment is an active crew assignment seen from the worker's side
+type WorkerAssignment struct {
+	CrewAssignment
+	JobTitle        string    `json:"job_title"`
+	JobStatus       JobStatus `json:"job_status"`
+	ScheduledAt     time.Time `json:"scheduled_at"`
+	DurationMinutes int       `json:"duration_minutes"`
+}
@@ -0,0 +1,52 @@
+package models
+
+import "time"
+
+// FileUpload is a slot for a file the client uploads straight to storage.
+// Confirming the upload turns it into a ProjectFile.
+type FileUpload struct {
+	ID               uint       `json:"id"`
+	OrganizationID   uint       `json:"organization_id"`
+	ProjectID        uint       `json:"project_id"`
+	UploadedByUser   *uint      `json:"uploaded_by_user,omitempty"`
+	UploadedByWorker *uint      `json:"uploaded_by_worker,omitempty"`
+	FileType         string     `json:"file_type"`
+	FileCategory     string     `json:"file_category,omitempty"`
+	FileName         string     `json:"file_name"`
+	MimeType         string     `json:"mime_type"`
+	FileSize         int64      `json:"file_size"`
+	FileExtension    string     `json:"file_extension"`
+	Description      string     `json:"description,omitempty"`
+	TakenAt          *time.Time `json:"taken_at,omitempty"`
+	ReplacesFileID   *uint      `json:"replaces_file_id,omitempty"` // a new version of this file
+	S3Key            string     `json:"-"`
+	MultipartID      string     `json:"-"`
+	PartSize         int64      `json:"part_size,omitempty"` // multipart uploads only
+	ExpiresAt        time.Time  `json:"expires_at"`
+	CreatedAt        time.Time  `json:"created_at"`
+}
+
+// Multipart reports whether the file is uploaded in parts
+func (u *FileUpload) Multipart() bool {
+	return u.MultipartID != ""
+}
+
+// ProjectFile is the file the upload becomes once confirmed
+func (u *FileUpload) ProjectFile(bucket string) *ProjectFile {
+	return &ProjectFile{
+		ProjectID:        u.ProjectID,
+		UploadedByUser:   u.UploadedByUser,
+		UploadedByWorker: u.UploadedByWorker,
+		FileType:         u.FileType,
+		FileCategory:     u.FileCategory,
+		FileName:         u.FileName,
+		OriginalFileName: u.FileName,
+		MimeType:         u.MimeType,
+		FileSize:         u.FileSize,
+		FileExtension:    u.FileExtension,
+		S3Bucket:         bucket,
+		S3Key:            u.S3Key,
+		Description:      u.Description,
+		TakenAt:          u.TakenAt,
+	}
+}
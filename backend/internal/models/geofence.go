@@ -0,0 +1,62 @@
+package models
+
+import "time"
+
+const (
+	GeofenceRulePresence          = "presence"
+	GeofenceRuleArrivalStart      = "arrival_start"
+	GeofenceRuleDepartureComplete = "departure_complete"
+
+	GeofenceOutcomeApplied   = "applied"
+	GeofenceOutcomeSuggested = "suggested"
+	GeofenceOutcomeRejected  = "rejected"
+	GeofenceOutcomeRecorded  = "recorded"
+)
+
+type GeofenceSettings struct {
+	OrganizationID  uint      `json:"organization_id"`
+	Enabled         bool      `json:"enabled"`
+	RadiusMeters    int       `json:"radius_meters"`
+	MinDwellMinutes int       `json:"min_dwell_minutes"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// DefaultGeofenceSettings applies to organizations that never saved their own
+func DefaultGeofenceSettings(organizationID uint) *GeofenceSettings {
+	return &GeofenceSettings{
+		OrganizationID:  organizationID,
+		Enabled:         true,
+		RadiusMeters:    150,
+		MinDwellMinutes: 10,
+	}
+}
+
+// GeofenceVisit is a stay of a worker inside a job's geofence
+type GeofenceVisit struct {
+	ID        uint       `json:"id"`
+	JobID     uint       `json:"job_id"`
+	WorkerID  uint       `json:"worker_id"`
+	EnteredAt time.Time  `json:"entered_at"`
+	ExitedAt  *time.Time `json:"exited_at"`
+}
+
+// GeofenceEvent records a rule firing and what came of it
+type GeofenceEvent struct {
+	ID             uint       `json:"id"`
+	OrganizationID uint       `json:"organization_id"`
+	JobID          uint       `json:"job_id"`
+	WorkerID       uint       `json:"worker_id"`
+	Rule           string     `json:"rule"`
+	EventType      string     `json:"event_type"`
+	FromStatus     *JobStatus `json:"from_status"`
+	ToStatus       *JobStatus `json:"to_status"`
+	Outcome        string     `json:"outcome"`
+	Detail         string     `json:"detail,omitempty"`
+	Latitude       float64    `json:"latitude"`
+	Longitude      float64    `json:"longitude"`
+	DistanceMeters float64    `json:"distance_meters"`
+	OccurredAt     time.Time  `json:"occurred_at"`
+	Resolution     *string    `json:"resolution"`
+	ResolvedAt     *time.Time `json:"resolved_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
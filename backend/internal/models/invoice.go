@@ -0,0 +1,151 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+const (
+	InvoiceDraft = "draft"
+	InvoiceSent  = "sent"
+	InvoicePaid  = "paid"
+	InvoiceVoid  = "void"
+	// InvoiceOverdue is never stored: it is a sent invoice past its due date
+	InvoiceOverdue = "overdue"
+)
+
+// Payment methods for manually recorded payments
+const (
+	PaymentCash         = "cash"
+	PaymentCheck        = "check"
+	PaymentCard         = "card"
+	PaymentBankTransfer = "bank_transfer"
+	PaymentOther        = "other"
+)
+
+var (
+	ErrInvoiceExists      = errors.New("job already has an invoice")
+	ErrInvoiceNotEditable = errors.New("only draft invoices can be changed")
+	ErrInvoiceNotOpen     = errors.New("invoice is not awaiting payment")
+	ErrInvoiceHasPayments = errors.New("invoice has payments; remove them first")
+	ErrInvoiceVoid        = errors.New("invoice is void")
+	ErrOverpayment        = errors.New("payment is more than the balance due")
+	ErrJobNotBillable     = errors.New("only completed jobs can be invoiced")
+	ErrInvoiceEmpty       = errors.New("an invoice must total more than zero to be sent")
+)
+
+// Invoice amounts are decimals and serialize as strings. Number is assigned
+// when the invoice is sent, so numbers have no gaps from deleted drafts.
+type Invoice struct {
+	ID               uint               `json:"id"`
+	OrganizationID   uint               `json:"organization_id"`
+	CustomerID       uint               `json:"customer_id"`
+	JobID            *uint              `json:"job_id,omitempty"`
+	Number           *int               `json:"number"`
+	Status           string             `json:"status"`
+	Notes            string             `json:"notes,omitempty"`
+	PaymentTermsDays int                `json:"payment_terms_days"`
+	IssuedAt         *time.Time         `json:"issued_at,omitempty"`
+	DueDate          *time.Time         `json:"due_date,omitempty"`
+	AmountPaid       decimal.Decimal    `json:"amount_paid"`
+	Balance          decimal.Decimal    `json:"balance"`
+	PaidAt           *time.Time         `json:"paid_at,omitempty"`
+	VoidedAt         *time.Time         `json:"voided_at,omitempty"`
+	VoidReason       string             `json:"void_reason,omitempty"`
+	CreatedBy        *uint              `json:"created_by,omitempty"`
+	CreatedAt        time.Time          `json:"created_at"`
+	UpdatedAt        time.Time          `json:"updated_at"`
+	LineItems        []*InvoiceLineItem `json:"line_items,omitempty"` // not loaded in lists
+	Payments         []*InvoicePayment  `json:"payments,omitempty"`
+	DocumentTotals
+}
+
+type InvoiceLineItem struct {
+	ID          uint   `json:"id"`
+	InvoiceID   uint   `json:"invoice_id"`
+	Position    int    `json:"position"`
+	Kind        string `json:"kind"`
+	Description string `json:"description"`
+	LinePricing
+}
+
+func (l *InvoiceLineItem) Validate() error {
+	if err := validateLineKind(l.Kind, l.Description); err != nil {
+		return err
+	}
+	return l.LinePricing.Validate()
+}
+
+type InvoicePayment struct {
+	ID         uint            `json:"id"`
+	InvoiceID  uint            `json:"invoice_id"`
+	Amount     decimal.Decimal `json:"amount"`
+	Method     string          `json:"method"`
+	Reference  string          `json:"reference,omitempty"`
+	PaidAt     time.Time       `json:"paid_at"`
+	Notes      string          `json:"notes,omitempty"`
+	RecordedBy *uint           `json:"recorded_by,omitempty"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+func IsPaymentMethod(method string) bool {
+	switch method {
+	case PaymentCash, PaymentCheck, PaymentCard, PaymentBankTransfer, PaymentOther:
+		return true
+	}
+	return false
+}
+
+// ComputeTotals prices every line and sums them into the invoice
+func (inv *Invoice) ComputeTotals() {
+	inv.DocumentTotals = DocumentTotals{}
+	for i, line := range inv.LineItems {
+		line.Position = i + 1
+		inv.DocumentTotals.Add(&line.LinePricing)
+	}
+	inv.Balance = inv.Total.Sub(inv.AmountPaid)
+}
+
+// IsOverdue reports whether a sent invoice is past its due date on the day of now
+func (inv *Invoice) IsOverdue(now time.Time) bool {
+	if inv.Status != InvoiceSent || inv.DueDate == nil {
+		return false
+	}
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	return inv.DueDate.Before(today)
+}
+
+// ReceivablesBucket groups open balances by how far past due they are
+type ReceivablesBucket struct {
+	Label    string          `json:"label"`
+	MinDays  int             `json:"min_days"`           // days past due, inclusive; 0 is not yet due
+	MaxDays  *int            `json:"max_days,omitempty"` // nil for the last bucket
+	Amount   decimal.Decimal `json:"amount"`
+	Invoices int             `json:"invoices"`
+}
+
+type CustomerReceivables struct {
+	CustomerID   uint                `json:"customer_id"`
+	CustomerName string              `json:"customer_name"`
+	Buckets      []ReceivablesBucket `json:"buckets"`
+	Total        decimal.Decimal     `json:"total"`
+}
+
+type AgedReceivablesReport struct {
+	AsOf      string                 `json:"as_of"`
+	Buckets   []ReceivablesBucket    `json:"buckets"`
+	Customers []*CustomerReceivables `json:"customers"`
+	Total     decimal.Decimal        `json:"total"`
+}
+
+// OpenInvoice is a sent invoice with a balance, as used by the aging report
+type OpenInvoice struct {
+	InvoiceID    uint
+	Number       int
+	CustomerID   uint
+	CustomerName string
+	DueDate      time.Time
+	Balance      decimal.Decimal
+}
@@ -3,6 +3,7 @@ package models
 import (
 	"database/sql/driver"
 	"encoding/json"
+	"errors"
 	"time"
 )
 
@@ -15,24 +16,47 @@ const (
 	StatusCancelled  JobStatus = "cancelled"
 )
 
+// IsValid reports whether s is one of the known job statuses
+func (s JobStatus) IsValid() bool {
+	switch s {
+	case StatusScheduled, StatusInProgress, StatusCompleted, StatusCancelled:
+		return true
+	}
+	return false
+}
+
+var (
+	ErrStaleJob      = errors.New("job was changed by someone else")
+	ErrJobNotMovable = errors.New("only scheduled jobs can be moved")
+)
+
 type Job struct {
-	ID              uint       `json:"id" gorm:"primaryKey"`
-	OrganizationID  uint       `json:"organization_id" gorm:"not null"`
-	CreatedBy       *uint      `json:"created_by"`
-	CustomerID      uint       `json:"customer_id" gorm:"not null"`
-	TechnicianID    *uint      `json:"worker_id"`
-	Title           string     `json:"title" gorm:"not null"`
-	Description     string     `json:"description"`
-	Status          JobStatus  `json:"status" gorm:"default:'scheduled'"`
-	ScheduledAt     time.Time  `json:"scheduled_at" gorm:"not null"`
-	CompletedAt     *time.Time `json:"completed_at"`
-	DurationMinutes int        `json:"duration_minutes" gorm:"default:60"`
-	Price           *float64   `json:"price"`
-	Metadata        JSON       `json:"metadata" gorm:"type:jsonb"`
-	CreatedAt       time.Time  `json:"created_at"`
-	UpdatedAt       time.Time  `json:"updated_at"`
-	Customer        Customer   `json:"customer" gorm:"foreignKey:CustomerID"`
-	Worker          *Worker    `json:"worker,omitempty" gorm:"foreignKey:workerID"`
+	ID               uint               `json:"id" gorm:"primaryKey"`
+	OrganizationID   uint               `json:"organization_id" gorm:"not null"`
+	CreatedBy        *uint              `json:"created_by"`
+	CustomerID       uint               `json:"customer_id" gorm:"not null"`
+	TechnicianID     *uint              `json:"worker_id"`
+	Title            string             `json:"title" gorm:"not null"`
+	Description      string             `json:"description"`
+	Status           JobStatus          `json:"status" gorm:"default:'scheduled'"`
+	ScheduledAt      time.Time          `json:"scheduled_at" gorm:"not null"`
+	CompletedAt      *time.Time         `json:"completed_at"`
+	DurationMinutes  int                `json:"duration_minutes" gorm:"default:60"`
+	Price            *float64           `json:"price"`
+	PartsTotal       float64            `json:"parts_total"` // sum of job_parts quantity * unit price
+	TotalPrice       float64            `json:"total_price"` // price plus parts
+	Metadata         JSON               `json:"metadata" gorm:"type:jsonb"`
+	TemplateID       *uint              `json:"template_id,omitempty"`
+	OccurrenceAt     *time.Time         `json:"occurrence_at,omitempty"`
+	IsException      bool               `json:"is_exception"`
+	QuoteID          *uint              `json:"quote_id,omitempty"`
+	Version          int                `json:"version"` // bumped on every write, for optimistic locking
+	CreatedAt        time.Time          `json:"created_at"`
+	UpdatedAt        time.Time          `json:"updated_at"`
+	Customer         Customer           `json:"customer" gorm:"foreignKey:CustomerID"`
+	Worker           *Worker            `json:"worker,omitempty" gorm:"foreignKey:workerID"`
+	Crew             []*CrewAssignment  `json:"crew,omitempty"`
+	ScheduleWarnings []ScheduleConflict `json:"schedule_warnings,omitempty"` // conflicts the organization only warns about
 }
 
 // JSON type for JSONB support
@@ -49,3 +73,21 @@ func (j *JSON) Scan(value interface{}) error {
 	}
 	return json.Unmarshal(bytes, j)
 }
+
+// JobMove is a combined reschedule and reassign from the dispatch board
+type JobMove struct {
+	JobID           uint
+	OrganizationID  uint
+	WorkerID        *uint
+	ScheduledAt     time.Time
+	DurationMinutes int
+	ExpectedVersion int
+}
+
+// JobAssignment gives a job to a worker, provided the job is still at
+// ExpectedVersion
+type JobAssignment struct {
+	JobID           uint
+	WorkerID        uint
+	ExpectedVersion int
+}
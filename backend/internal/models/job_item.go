@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+type JobNote struct {
+	ID              uint      `json:"id"`
+	JobID           uint      `json:"job_id"`
+	CreatedByUser   *uint     `json:"created_by_user,omitempty"`
+	CreatedByWorker *uint     `json:"created_by_worker,omitempty"`
+	Note            string    `json:"note"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// JobPart is material used on a job. UnitPrice is per item.
+type JobPart struct {
+	ID            uint      `json:"id"`
+	JobID         uint      `json:"job_id"`
+	AddedByUser   *uint     `json:"added_by_user,omitempty"`
+	AddedByWorker *uint     `json:"added_by_worker,omitempty"`
+	PartName      string    `json:"part_name"`
+	Description   string    `json:"description,omitempty"`
+	Quantity      int       `json:"quantity"`
+	UnitPrice     float64   `json:"unit_price"`
+	LineTotal     float64   `json:"line_total"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
@@ -0,0 +1,127 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrInvalidTransition is wrapped by every TransitionError
+var ErrInvalidTransition = errors.New("invalid status transition")
+
+// ErrSignatureRequired blocks completion until the customer has signed, when
+// the organization's CompletionSettings ask for it
+var ErrSignatureRequired = errors.New("a customer signature is required before completing the job")
+
+type TransitionError struct {
+	From JobStatus
+	To   JobStatus
+	// NeedsReopen is set when the move is allowed only as an explicit reopen
+	NeedsReopen bool
+}
+
+func (e *TransitionError) Error() string {
+	if e.NeedsReopen {
+		return fmt.Sprintf("cannot move job from %s to %s without reopening it", e.From, e.To)
+	}
+	return fmt.Sprintf("cannot move job from %s to %s", e.From, e.To)
+}
+
+func (e *TransitionError) Unwrap() error {
+	return ErrInvalidTransition
+}
+
+// JobStatusMachine defines which status changes are legal. Regular transitions
+// follow the normal job flow; reopen transitions bring a finished job back and
+// must be requested explicitly.
+type JobStatusMachine struct {
+	transitions map[JobStatus][]JobStatus
+	reopen      map[JobStatus][]JobStatus
+}
+
+// JobStatusFlow is the state machine every status change goes through
+var JobStatusFlow = &JobStatusMachine{
+	transitions: map[JobStatus][]JobStatus{
+		StatusScheduled:  {StatusInProgress, StatusCompleted, StatusCancelled},
+		StatusInProgress: {StatusScheduled, StatusCompleted, StatusCancelled},
+	},
+	reopen: map[JobStatus][]JobStatus{
+		StatusCompleted: {StatusScheduled, StatusInProgress},
+		StatusCancelled: {StatusScheduled},
+	},
+}
+
+// Validate checks a move from one status to another
+func (m *JobStatusMachine) Validate(from, to JobStatus, reopen bool) error {
+	if !to.IsValid() {
+		return fmt.Errorf("%w: unknown status %q", ErrInvalidTransition, to)
+	}
+
+	if contains(m.transitions[from], to) {
+		return nil
+	}
+	if contains(m.reopen[from], to) {
+		if reopen {
+			return nil
+		}
+		return &TransitionError{From: from, To: to, NeedsReopen: true}
+	}
+
+	return &TransitionError{From: from, To: to}
+}
+
+// Next lists the statuses reachable from a status without reopening
+func (m *JobStatusMachine) Next(from JobStatus) []JobStatus {
+	return append([]JobStatus(nil), m.transitions[from]...)
+}
+
+// IsReopen reports whether moving from -> to is a reopen transition
+func (m *JobStatusMachine) IsReopen(from, to JobStatus) bool {
+	return contains(m.reopen[from], to)
+}
+
+func contains(statuses []JobStatus, s JobStatus) bool {
+	for _, candidate := range statuses {
+		if candidate == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Sources of a status change
+const (
+	StatusSourceManual   = "manual"
+	StatusSourceGeofence = "geofence"
+)
+
+// StatusChange is a request to move a job to a new status
+type StatusChange struct {
+	To              JobStatus
+	Reopen          bool
+	ChangedByUser   *uint
+	ChangedByWorker *uint
+	Source          string
+	Reason          string
+}
+
+// CompletionSettings is the organization's policy for completing jobs
+type CompletionSettings struct {
+	OrganizationID   uint      `json:"organization_id"`
+	RequireSignature bool      `json:"require_signature"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// JobStatusUpdate is one entry of a job's status history
+type JobStatusUpdate struct {
+	ID              uint      `json:"id"`
+	JobID           uint      `json:"job_id"`
+	OldStatus       JobStatus `json:"old_status"`
+	NewStatus       JobStatus `json:"new_status"`
+	ChangedByUser   *uint     `json:"changed_by_user,omitempty"`
+	ChangedByWorker *uint     `json:"changed_by_worker,omitempty"`
+	ChangedByName   string    `json:"changed_by_name,omitempty"`
+	Source          string    `json:"source"`
+	Reason          string    `json:"reason,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
+}
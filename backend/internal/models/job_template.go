@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// JobTemplate is the blueprint of a recurring job. RRule holds the schedule in
+// RFC 5545 form; the generator turns each occurrence into a Job.
+type JobTemplate struct {
+	ID               uint       `json:"id"`
+	OrganizationID   uint       `json:"organization_id"`
+	CreatedBy        *uint      `json:"created_by"`
+	CustomerID       uint       `json:"customer_id"`
+	TechnicianID     *uint      `json:"worker_id"`
+	Title            string     `json:"title"`
+	Description      string     `json:"description"`
+	DurationMinutes  int        `json:"duration_minutes"`
+	Price            *float64   `json:"price"`
+	Metadata         JSON       `json:"metadata"`
+	RRule            string     `json:"rrule"`
+	StartsAt         time.Time  `json:"starts_at"`
+	Timezone         string     `json:"timezone"`
+	GeneratedUntil   *time.Time `json:"generated_until,omitempty"`
+	Active           bool       `json:"active"`
+	ParentTemplateID *uint      `json:"parent_template_id,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+}
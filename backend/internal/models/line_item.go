@@ -0,0 +1,118 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/shopspring/decimal"
+)
+
+// Line item kinds on quotes and invoices
+const (
+	LineLabor = "labor"
+	LinePart  = "part"
+	LineFee   = "fee"
+)
+
+var ErrInvalidLineItem = errors.New("invalid line item")
+
+var hundred = decimal.NewFromInt(100)
+
+// Bounds of the NUMERIC(12, 3) quantity and NUMERIC(12, 2) amount columns
+var (
+	maxQuantity = decimal.New(1, 9)
+	maxAmount   = decimal.New(1, 10)
+)
+
+// HasScale reports whether d has at most places decimal places, whatever
+// its representation: "10.100" fits two places, "10.105" does not
+func HasScale(d decimal.Decimal, places int32) bool {
+	return d.Equal(d.Truncate(places))
+}
+
+// LinePricing prices a quote or invoice line as quantity * unit price, less
+// the discount percentage, plus tax on the discounted amount
+type LinePricing struct {
+	Quantity        decimal.Decimal `json:"quantity"`
+	UnitPrice       decimal.Decimal `json:"unit_price"`
+	DiscountPercent decimal.Decimal `json:"discount_percent"`
+	TaxRate         decimal.Decimal `json:"tax_rate"`
+	Subtotal        decimal.Decimal `json:"subtotal"`
+	Discount        decimal.Decimal `json:"discount"`
+	Tax             decimal.Decimal `json:"tax"`
+	Total           decimal.Decimal `json:"total"`
+}
+
+func (p *LinePricing) Validate() error {
+	switch {
+	case !p.Quantity.IsPositive():
+		return fmt.Errorf("%w: quantity must be positive", ErrInvalidLineItem)
+	case p.UnitPrice.IsNegative():
+		return fmt.Errorf("%w: unit price cannot be negative", ErrInvalidLineItem)
+	case p.DiscountPercent.IsNegative() || p.DiscountPercent.GreaterThan(hundred):
+		return fmt.Errorf("%w: discount must be between 0 and 100", ErrInvalidLineItem)
+	case p.TaxRate.IsNegative() || p.TaxRate.GreaterThan(hundred):
+		return fmt.Errorf("%w: tax rate must be between 0 and 100", ErrInvalidLineItem)
+	case !HasScale(p.Quantity, 3):
+		return fmt.Errorf("%w: quantity can have at most 3 decimal places", ErrInvalidLineItem)
+	case !HasScale(p.UnitPrice, 2):
+		return fmt.Errorf("%w: unit price can have at most 2 decimal places", ErrInvalidLineItem)
+	case !HasScale(p.DiscountPercent, 2):
+		return fmt.Errorf("%w: discount can have at most 2 decimal places", ErrInvalidLineItem)
+	case !HasScale(p.TaxRate, 2):
+		return fmt.Errorf("%w: tax rate can have at most 2 decimal places", ErrInvalidLineItem)
+	case p.Quantity.GreaterThanOrEqual(maxQuantity):
+		return fmt.Errorf("%w: quantity is too large", ErrInvalidLineItem)
+	case p.UnitPrice.GreaterThanOrEqual(maxAmount):
+		return fmt.Errorf("%w: unit price is too large", ErrInvalidLineItem)
+	case p.Quantity.Mul(p.UnitPrice).Round(2).GreaterThanOrEqual(maxAmount):
+		return fmt.Errorf("%w: line amount is too large", ErrInvalidLineItem)
+	}
+	return nil
+}
+
+// Compute fills the line's amounts. Each amount is rounded to cents so the
+// line and document totals always add up to what is printed.
+func (p *LinePricing) Compute() {
+	p.Subtotal = p.Quantity.Mul(p.UnitPrice).Round(2)
+	p.Discount = p.Subtotal.Mul(p.DiscountPercent).Div(hundred).Round(2)
+	p.Tax = p.Subtotal.Sub(p.Discount).Mul(p.TaxRate).Div(hundred).Round(2)
+	p.Total = p.Subtotal.Sub(p.Discount).Add(p.Tax)
+}
+
+// DocumentTotals are the summed amounts of a quote or invoice
+type DocumentTotals struct {
+	Subtotal      decimal.Decimal `json:"subtotal"`
+	DiscountTotal decimal.Decimal `json:"discount_total"`
+	TaxTotal      decimal.Decimal `json:"tax_total"`
+	Total         decimal.Decimal `json:"total"`
+}
+
+// Add prices the line and adds it to the totals
+func (t *DocumentTotals) Add(p *LinePricing) {
+	p.Compute()
+	t.Subtotal = t.Subtotal.Add(p.Subtotal)
+	t.DiscountTotal = t.DiscountTotal.Add(p.Discount)
+	t.TaxTotal = t.TaxTotal.Add(p.Tax)
+	t.Total = t.Total.Add(p.Total)
+}
+
+// Validate checks the summed amounts still fit their columns
+func (t *DocumentTotals) Validate() error {
+	if t.Subtotal.GreaterThanOrEqual(maxAmount) || t.Total.GreaterThanOrEqual(maxAmount) {
+		return fmt.Errorf("%w: total is too large", ErrInvalidLineItem)
+	}
+	return nil
+}
+
+func validateLineKind(kind, description string) error {
+	switch kind {
+	case LineLabor, LinePart, LineFee:
+	default:
+		return fmt.Errorf("%w: kind must be labor, part or fee", ErrInvalidLineItem)
+	}
+	if description == "" {
+		return fmt.Errorf("%w: description is required", ErrInvalidLineItem)
+	}
+	return nil
+}
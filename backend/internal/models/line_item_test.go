@@ -0,0 +1,153 @@
+package models
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func dec(s string) decimal.Decimal {
+	return decimal.RequireFromString(s)
+}
+
+func TestHasScale(t *testing.T) {
+	tests := []struct {
+		in     string
+		places int32
+		want   bool
+	}{
+		{"10", 2, true},
+		{"10.1", 2, true},
+		{"10.10", 2, true},
+		{"10.100", 2, true},
+		{"10.105", 2, false},
+		{"0.001", 3, true},
+		{"0.0001", 3, false},
+		{"-1.25", 2, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			if got := HasScale(dec(tt.in), tt.places); got != tt.want {
+				t.Errorf("HasScale(%s, %d) = %v, want %v", tt.in, tt.places, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLinePricingValidate(t *testing.T) {
+	valid := func() LinePricing {
+		return LinePricing{Quantity: dec("1.5"), UnitPrice: dec("19.99"), DiscountPercent: dec("10"), TaxRate: dec("8.25")}
+	}
+
+	tests := []struct {
+		name    string
+		edit    func(p *LinePricing)
+		wantErr bool
+	}{
+		{"valid", func(p *LinePricing) {}, false},
+		{"free line", func(p *LinePricing) { p.UnitPrice = decimal.Zero }, false},
+		{"trailing zeros", func(p *LinePricing) { p.Quantity = dec("2.5000"); p.UnitPrice = dec("3.100") }, false},
+		{"zero quantity", func(p *LinePricing) { p.Quantity = decimal.Zero }, true},
+		{"negative price", func(p *LinePricing) { p.UnitPrice = dec("-1") }, true},
+		{"discount over 100", func(p *LinePricing) { p.DiscountPercent = dec("100.01") }, true},
+		{"negative tax", func(p *LinePricing) { p.TaxRate = dec("-0.5") }, true},
+		{"quantity with 4 places", func(p *LinePricing) { p.Quantity = dec("1.0005") }, true},
+		{"price with 3 places", func(p *LinePricing) { p.UnitPrice = dec("19.999") }, true},
+		{"discount with 3 places", func(p *LinePricing) { p.DiscountPercent = dec("10.125") }, true},
+		{"tax with 3 places", func(p *LinePricing) { p.TaxRate = dec("8.255") }, true},
+		{"largest quantity", func(p *LinePricing) { p.Quantity = dec("999999999.999"); p.UnitPrice = dec("1") }, false},
+		{"quantity too large", func(p *LinePricing) { p.Quantity = dec("1000000000"); p.UnitPrice = dec("1") }, true},
+		{"unit price too large", func(p *LinePricing) { p.Quantity = dec("0.001"); p.UnitPrice = dec("10000000000") }, true},
+		{"amount too large", func(p *LinePricing) { p.Quantity = dec("1000"); p.UnitPrice = dec("10000000") }, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := valid()
+			tt.edit(&p)
+			err := p.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidLineItem) {
+				t.Errorf("Validate() error = %v, want %v", err, ErrInvalidLineItem)
+			}
+		})
+	}
+}
+
+func TestLinePricingCompute(t *testing.T) {
+	tests := []struct {
+		name                           string
+		quantity, unitPrice            string
+		discountPercent, taxRate       string
+		subtotal, discount, tax, total string
+	}{
+		{"whole numbers", "2", "50", "0", "0", "100", "0", "0", "100"},
+		{"no float drift", "3", "0.10", "0", "0", "0.3", "0", "0", "0.3"},
+		{"subtotal rounds half up", "1.5", "19.99", "0", "0", "29.99", "0", "0", "29.99"},
+		{"fractional quantity", "0.333", "3.00", "0", "0", "1", "0", "0", "1"},
+		{"discount then tax", "1.5", "19.99", "10", "8.25", "29.99", "3", "2.23", "29.22"},
+		{"full discount", "4", "12.50", "100", "20", "50", "50", "0", "0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := LinePricing{
+				Quantity:        dec(tt.quantity),
+				UnitPrice:       dec(tt.unitPrice),
+				DiscountPercent: dec(tt.discountPercent),
+				TaxRate:         dec(tt.taxRate),
+			}
+			p.Compute()
+
+			got := []decimal.Decimal{p.Subtotal, p.Discount, p.Tax, p.Total}
+			want := []string{tt.subtotal, tt.discount, tt.tax, tt.total}
+			names := []string{"Subtotal", "Discount", "Tax", "Total"}
+			for i := range got {
+				if !got[i].Equal(dec(want[i])) {
+					t.Errorf("%s = %s, want %s", names[i], got[i], want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestDocumentTotals(t *testing.T) {
+	lines := []*LinePricing{
+		{Quantity: dec("1.5"), UnitPrice: dec("19.99"), DiscountPercent: dec("10"), TaxRate: dec("8.25")},
+		{Quantity: dec("3"), UnitPrice: dec("0.10"), DiscountPercent: decimal.Zero, TaxRate: dec("8.25")},
+		{Quantity: dec("1"), UnitPrice: dec("45"), DiscountPercent: decimal.Zero, TaxRate: decimal.Zero},
+	}
+
+	var totals DocumentTotals
+	sum := decimal.Zero
+	for _, line := range lines {
+		totals.Add(line)
+		sum = sum.Add(line.Total)
+	}
+
+	if want := dec("75.29"); !totals.Subtotal.Equal(want) {
+		t.Errorf("Subtotal = %s, want %s", totals.Subtotal, want)
+	}
+	if want := dec("3"); !totals.DiscountTotal.Equal(want) {
+		t.Errorf("DiscountTotal = %s, want %s", totals.DiscountTotal, want)
+	}
+	if want := dec("2.25"); !totals.TaxTotal.Equal(want) {
+		t.Errorf("TaxTotal = %s, want %s", totals.TaxTotal, want)
+	}
+	// The printed line totals add up to the document total
+	if !totals.Total.Equal(sum) || !totals.Total.Equal(dec("74.54")) {
+		t.Errorf("Total = %s, want %s and 74.54", totals.Total, sum)
+	}
+	if err := totals.Validate(); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+
+	totals.Add(&LinePricing{Quantity: dec("1"), UnitPrice: dec("9999999999.99")})
+	if err := totals.Validate(); !errors.Is(err, ErrInvalidLineItem) {
+		t.Errorf("Validate() error = %v, want %v", err, ErrInvalidLineItem)
+	}
+}
@@ -2,6 +2,28 @@ package models
 
 import "time"
 
+const (
+	FileTypePhoto     = "photo"
+	FileTypeDocument  = "document"
+	FileTypeVideo     = "video"
+	FileTypeSignature = "signature"
+)
+
+// Photos are processed after upload: EXIF is read and renditions are made
+const (
+	ProcessingPending = "pending"
+	ProcessingRunning = "processing"
+	ProcessingDone    = "done"
+	ProcessingFailed  = "failed" // not a decodable image; the original is still served
+)
+
+// Uploads are scanned for malware when a scanner is configured
+const (
+	ScanClean       = "clean"
+	ScanSkipped     = "skipped"     // too large for the scanner
+	ScanQuarantined = "quarantined" // kept for review but never served
+)
+
 type ProjectFile struct {
 	ID               uint  `json:"id"`
 	ProjectID        uint  `json:"project_id"`
@@ -9,7 +31,7 @@ type ProjectFile struct {
 	UploadedByWorker *uint `json:"uploaded_by_worker,omitempty"`
 
 	// File info
-	FileType         string `json:"file_type"`     // 'photo', 'document', 'report'
+	FileType         string `json:"file_type"`     // 'photo', 'document', 'video', 'signature'
 	FileCategory     string `json:"file_category"` // 'progress', 'contract', 'site_photo', etc.
 	FileName         string `json:"file_name"`
 	OriginalFileName string `json:"original_file_name"`
@@ -26,7 +48,29 @@ type ProjectFile struct {
 
 	// Optional
 	Description string     `json:"description,omitempty"`
-	TakenAt     *time.Time `json:"taken_at,omitempty"`
+	TakenAt     *time.Time `json:"taken_at,omitempty"`    // for signatures, when it was signed
+	SignerName  string     `json:"signer_name,omitempty"` // signatures only
+
+	// Photo processing; location and size come from the image itself
+	Latitude         *float64 `json:"latitude,omitempty"`
+	Longitude        *float64 `json:"longitude,omitempty"`
+	Width            int      `json:"width,omitempty"` // as displayed, after orientation
+	Height           int      `json:"height,omitempty"`
+	ThumbnailS3Key   string   `json:"-"`
+	MediumS3Key      string   `json:"-"`
+	RenditionsSize   int64    `json:"-"`                       // bytes, counted in storage usage
+	ThumbnailURL     string   `json:"thumbnail_url,omitempty"` // Presigned URL (temporary)
+	MediumURL        string   `json:"medium_url,omitempty"`    // Presigned URL (temporary)
+	ProcessingStatus string   `json:"processing_status,omitempty"`
+
+	// Versions of a document share the first version's ID
+	DocumentID uint       `json:"document_id"`
+	Version    int        `json:"version"`
+	DeletedAt  *time.Time `json:"deleted_at,omitempty"` // in the trash until purged
+
+	// Malware scan; empty when no scanner is configured
+	ScanStatus    string `json:"scan_status,omitempty"`
+	ScanSignature string `json:"scan_signature,omitempty"`
 
 	// Timestamps
 	CreatedAt time.Time `json:"created_at"`
@@ -0,0 +1,76 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	QuoteDraft    = "draft"
+	QuoteSent     = "sent"
+	QuoteAccepted = "accepted"
+	QuoteDeclined = "declined"
+)
+
+var (
+	ErrQuoteNotEditable = errors.New("only draft quotes can be changed")
+	ErrQuoteNotSent     = errors.New("quote is not awaiting a response")
+	ErrQuoteAnswered    = errors.New("quote was already answered")
+	ErrQuoteExpired     = errors.New("quote has expired")
+	ErrQuoteNotAccepted = errors.New("only accepted quotes can be converted")
+	ErrQuoteConverted   = errors.New("quote was already converted")
+)
+
+// Quote amounts are decimals and serialize as strings, e.g. "149.5".
+// Totals are recomputed from the line items on every save.
+type Quote struct {
+	ID              uint             `json:"id"`
+	OrganizationID  uint             `json:"organization_id"`
+	CustomerID      uint             `json:"customer_id"`
+	Number          int              `json:"number"`
+	Title           string           `json:"title"`
+	Notes           string           `json:"notes,omitempty"`
+	Status          string           `json:"status"`
+	ValidUntil      *time.Time       `json:"valid_until,omitempty"`
+	SentAt          *time.Time       `json:"sent_at,omitempty"`
+	RespondedAt     *time.Time       `json:"responded_at,omitempty"`
+	RespondedByName string           `json:"responded_by_name,omitempty"`
+	DeclineReason   string           `json:"decline_reason,omitempty"`
+	ConvertedAt     *time.Time       `json:"converted_at,omitempty"`
+	CreatedBy       *uint            `json:"created_by,omitempty"`
+	CreatedAt       time.Time        `json:"created_at"`
+	UpdatedAt       time.Time        `json:"updated_at"`
+	LineItems       []*QuoteLineItem `json:"line_items,omitempty"` // not loaded in lists
+	JobIDs          []uint           `json:"job_ids,omitempty"`    // jobs created from the quote
+	DocumentTotals
+}
+
+type QuoteLineItem struct {
+	ID          uint   `json:"id"`
+	QuoteID     uint   `json:"quote_id"`
+	Position    int    `json:"position"`
+	Kind        string `json:"kind"`
+	Description string `json:"description"`
+	LinePricing
+}
+
+func (l *QuoteLineItem) Validate() error {
+	if err := validateLineKind(l.Kind, l.Description); err != nil {
+		return err
+	}
+	return l.LinePricing.Validate()
+}
+
+// ComputeTotals prices every line and sums them into the quote
+func (q *Quote) ComputeTotals() {
+	q.DocumentTotals = DocumentTotals{}
+	for i, line := range q.LineItems {
+		line.Position = i + 1
+		q.DocumentTotals.Add(&line.LinePricing)
+	}
+}
+
+// IsExpired reports whether the quote can no longer be accepted at now
+func (q *Quote) IsExpired(now time.Time) bool {
+	return q.ValidUntil != nil && now.After(*q.ValidUntil)
+}
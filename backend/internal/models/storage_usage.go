@@ -0,0 +1,43 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrStorageQuotaExceeded is returned when a file would take the
+// organization over its storage quota
+var ErrStorageQuotaExceeded = errors.New("storage quota exceeded")
+
+// StorageUsage is what an organization stores against its plan's quota.
+// Files in the trash count until they are purged.
+type StorageUsage struct {
+	OrganizationID uint       `json:"organization_id"`
+	Plan           string     `json:"plan"`
+	QuotaBytes     int64      `json:"quota_bytes"`
+	BytesUsed      int64      `json:"bytes_used"`
+	FileCount      int        `json:"file_count"`
+	ReconciledAt   *time.Time `json:"reconciled_at,omitempty"` // last recounted from the files
+}
+
+// Allows reports whether size more bytes fit in the quota
+func (u *StorageUsage) Allows(size int64) bool {
+	return u.BytesUsed+size <= u.QuotaBytes
+}
+
+// StorageUsageGroup is the usage of the files sharing a job, a file type or
+// an upload month; only the field grouped by is set
+type StorageUsageGroup struct {
+	JobID    uint   `json:"job_id,omitempty"`
+	JobTitle string `json:"job_title,omitempty"`
+	FileType string `json:"file_type,omitempty"`
+	Month    string `json:"month,omitempty"` // YYYY-MM
+	Bytes    int64  `json:"bytes"`
+	Files    int    `json:"files"`
+}
+
+type StorageUsageBreakdown struct {
+	ByJob      []StorageUsageGroup `json:"by_job"`
+	ByFileType []StorageUsageGroup `json:"by_file_type"`
+	ByMonth    []StorageUsageGroup `json:"by_month"`
+}
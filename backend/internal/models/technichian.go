@@ -18,14 +18,17 @@ type Technician struct {
 }
 
 type Worker struct {
-	ID             uint      `json:"id"`
-	OrganizationID uint      `json:"organization_id"`
-	Name           string    `json:"name"`
-	Phone          string    `json:"phone"`
-	Email          string    `json:"email,omitempty"`
-	Role           string    `json:"role,omitempty"` // 'foreman', 'electrician', etc.
-	IsActive       bool      `json:"is_active"`
-	CreatedBy      *uint     `json:"created_by,omitempty"`
-	CreatedAt      time.Time `json:"created_at"`
-	UpdatedAt      time.Time `json:"updated_at"`
+	ID             uint       `json:"id"`
+	OrganizationID uint       `json:"organization_id"`
+	Name           string     `json:"name"`
+	Phone          string     `json:"phone"`
+	Email          string     `json:"email,omitempty"`
+	Role           string     `json:"role,omitempty"` // 'foreman', 'electrician', etc.
+	IsActive       bool       `json:"is_active"`
+	LastLat        *float64   `json:"last_lat"`
+	LastLng        *float64   `json:"last_lng"`
+	LastSeenAt     *time.Time `json:"last_seen_at"`
+	CreatedBy      *uint      `json:"created_by,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
 }
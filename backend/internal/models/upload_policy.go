@@ -0,0 +1,68 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// DefaultMaxFileSize applies until an organization sets its own limit
+const DefaultMaxFileSize = 100 << 20
+
+// DefaultAllowedTypes are photos, PDFs, plain text and Office documents
+var DefaultAllowedTypes = []string{
+	"image/jpeg", "image/png", "image/gif", "image/webp", "image/heic", "image/heif",
+	"application/pdf",
+	"text/plain", "text/csv",
+	"application/msword",
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	"application/vnd.ms-excel",
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	"application/vnd.ms-powerpoint",
+	"application/vnd.openxmlformats-officedocument.presentationml.presentation",
+}
+
+// UploadPolicy is what an organization accepts as project files. Types are
+// matched against the type sniffed from the content, not the one the client
+// claims.
+type UploadPolicy struct {
+	OrganizationID    uint      `json:"organization_id"`
+	AllowedTypes      []string  `json:"allowed_types"`      // MIME types; "image/*" allows a whole family
+	AllowedCategories []string  `json:"allowed_categories"` // empty allows any; uncategorized files are always allowed
+	MaxFileSize       int64     `json:"max_file_size"`      // bytes
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+func DefaultUploadPolicy(organizationID uint) *UploadPolicy {
+	return &UploadPolicy{
+		OrganizationID:    organizationID,
+		AllowedTypes:      append([]string(nil), DefaultAllowedTypes...),
+		AllowedCategories: []string{},
+		MaxFileSize:       DefaultMaxFileSize,
+	}
+}
+
+// AllowsType reports whether mimeType, without parameters, is allowed
+func (p *UploadPolicy) AllowsType(mimeType string) bool {
+	mimeType, _, _ = strings.Cut(mimeType, ";")
+	mimeType = strings.ToLower(strings.TrimSpace(mimeType))
+	family, _, _ := strings.Cut(mimeType, "/")
+
+	for _, allowed := range p.AllowedTypes {
+		if allowed == mimeType || allowed == family+"/*" {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *UploadPolicy) AllowsCategory(category string) bool {
+	if category == "" || len(p.AllowedCategories) == 0 {
+		return true
+	}
+	for _, allowed := range p.AllowedCategories {
+		if allowed == category {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// WorkerLocation is a single position fix reported by a worker's device
+type WorkerLocation struct {
+	ID             uint      `json:"id"`
+	OrganizationID uint      `json:"organization_id"`
+	WorkerID       uint      `json:"worker_id"`
+	Latitude       float64   `json:"latitude"`
+	Longitude      float64   `json:"longitude"`
+	AccuracyMeters *float64  `json:"accuracy_meters,omitempty"`
+	SpeedMps       *float64  `json:"speed_mps,omitempty"`
+	Heading        *float64  `json:"heading,omitempty"`
+	RecordedAt     time.Time `json:"recorded_at"`
+	CreatedAt      time.Time `json:"created_at"`
+}
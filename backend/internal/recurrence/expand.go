@@ -0,0 +1,165 @@
+package recurrence
+
+import (
+	"sort"
+	"time"
+)
+
+// maxPeriods bounds expansion of rules whose filters never match
+const maxPeriods = 10000
+
+// Between returns the occurrences of the rule that fall in [from, to).
+// dtstart is the first occurrence; its location and wall-clock time are kept
+// for every occurrence, so a 9:00 visit stays at 9:00 across DST changes.
+// COUNT is counted from dtstart, not from from.
+func (r Rule) Between(dtstart, from, to time.Time) ([]time.Time, error) {
+	var out []time.Time
+	err := r.each(dtstart, func(t time.Time) bool {
+		if !t.Before(to) {
+			return false
+		}
+		if !t.Before(from) {
+			out = append(out, t)
+		}
+		return true
+	})
+	return out, err
+}
+
+// CountBefore returns how many occurrences happen before t
+func (r Rule) CountBefore(dtstart, t time.Time) (int, error) {
+	n := 0
+	err := r.each(dtstart, func(o time.Time) bool {
+		if !o.Before(t) {
+			return false
+		}
+		n++
+		return true
+	})
+	return n, err
+}
+
+// each calls fn for every occurrence in order until fn returns false or the
+// rule ends
+func (r Rule) each(dtstart time.Time, fn func(time.Time) bool) error {
+	if err := r.Validate(); err != nil {
+		return err
+	}
+	days, _ := r.days()
+
+	emitted := 0
+	for k := 0; k < maxPeriods; k++ {
+		for _, t := range r.period(dtstart, k, days) {
+			if t.Before(dtstart) {
+				continue
+			}
+			if r.Until != nil && t.After(*r.Until) {
+				return nil
+			}
+			if r.Count > 0 && emitted >= r.Count {
+				return nil
+			}
+			emitted++
+			if !fn(t) {
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// period returns the candidate occurrences of the k-th period, sorted
+func (r Rule) period(dtstart time.Time, k int, days []dayRule) []time.Time {
+	step := k * r.interval()
+	y, m, d := dtstart.Date()
+	hh, mm, ss := dtstart.Clock()
+	loc := dtstart.Location()
+	at := func(y int, m time.Month, d int) time.Time {
+		return time.Date(y, m, d, hh, mm, ss, 0, loc)
+	}
+
+	switch r.Frequency {
+	case Daily:
+		t := at(y, m, d+step)
+		if len(days) > 0 && !matchesWeekday(t.Weekday(), days) {
+			return nil
+		}
+		return []time.Time{t}
+
+	case Weekly:
+		weekStart := d - mondayOffset(dtstart.Weekday()) + 7*step
+		if len(days) == 0 {
+			return []time.Time{at(y, m, d+7*step)}
+		}
+		out := make([]time.Time, 0, len(days))
+		for _, day := range days {
+			out = append(out, at(y, m, weekStart+mondayOffset(day.weekday)))
+		}
+		return out
+
+	case Monthly:
+		first := time.Date(y, m+time.Month(step), 1, 0, 0, 0, 0, loc)
+		if len(days) == 0 {
+			t := at(first.Year(), first.Month(), d)
+			if t.Month() != first.Month() {
+				return nil // e.g. the 31st in a 30-day month
+			}
+			return []time.Time{t}
+		}
+		return monthlyByDay(first, days, at)
+
+	case Yearly:
+		t := at(y+step, m, d)
+		if t.Month() != m {
+			return nil // Feb 29 in a non-leap year
+		}
+		return []time.Time{t}
+	}
+	return nil
+}
+
+func monthlyByDay(first time.Time, days []dayRule, at func(int, time.Month, int) time.Time) []time.Time {
+	daysInMonth := time.Date(first.Year(), first.Month()+1, 0, 0, 0, 0, 0, first.Location()).Day()
+
+	seen := make(map[int]bool)
+	for _, day := range days {
+		var matches []int
+		for dom := 1; dom <= daysInMonth; dom++ {
+			if time.Date(first.Year(), first.Month(), dom, 0, 0, 0, 0, first.Location()).Weekday() == day.weekday {
+				matches = append(matches, dom)
+			}
+		}
+
+		switch {
+		case day.ordinal == 0:
+			for _, dom := range matches {
+				seen[dom] = true
+			}
+		case day.ordinal > 0 && day.ordinal <= len(matches):
+			seen[matches[day.ordinal-1]] = true
+		case day.ordinal < 0 && -day.ordinal <= len(matches):
+			seen[matches[len(matches)+day.ordinal]] = true
+		}
+	}
+
+	doms := make([]int, 0, len(seen))
+	for dom := range seen {
+		doms = append(doms, dom)
+	}
+	sort.Ints(doms)
+
+	out := make([]time.Time, 0, len(doms))
+	for _, dom := range doms {
+		out = append(out, at(first.Year(), first.Month(), dom))
+	}
+	return out
+}
+
+func matchesWeekday(w time.Weekday, days []dayRule) bool {
+	for _, d := range days {
+		if d.weekday == w {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,199 @@
+package recurrence
+
+import (
+	"testing"
+	"time"
+)
+
+// nineAM returns 09:00 UTC on the given day
+func nineAM(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 9, 0, 0, 0, time.UTC)
+}
+
+func equalTimes(a, b []time.Time) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].Equal(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestBetween(t *testing.T) {
+	monday := nineAM(2026, 3, 2)
+
+	tests := []struct {
+		name    string
+		rrule   string
+		dtstart time.Time
+		from    time.Time
+		to      time.Time
+		want    []time.Time
+	}{
+		{
+			name:  "daily with count",
+			rrule: "FREQ=DAILY;COUNT=3", dtstart: monday, from: monday, to: nineAM(2026, 4, 1),
+			want: []time.Time{nineAM(2026, 3, 2), nineAM(2026, 3, 3), nineAM(2026, 3, 4)},
+		},
+		{
+			name:  "count is counted from dtstart",
+			rrule: "FREQ=DAILY;COUNT=3", dtstart: monday, from: nineAM(2026, 3, 3), to: nineAM(2026, 4, 1),
+			want: []time.Time{nineAM(2026, 3, 3), nineAM(2026, 3, 4)},
+		},
+		{
+			name:  "daily filtered by weekday",
+			rrule: "FREQ=DAILY;BYDAY=MO,WE", dtstart: monday, from: monday, to: nineAM(2026, 3, 9),
+			want: []time.Time{nineAM(2026, 3, 2), nineAM(2026, 3, 4)},
+		},
+		{
+			name:  "to is exclusive",
+			rrule: "FREQ=DAILY", dtstart: monday, from: monday, to: nineAM(2026, 3, 4),
+			want: []time.Time{nineAM(2026, 3, 2), nineAM(2026, 3, 3)},
+		},
+		{
+			name:  "weekly on two days",
+			rrule: "FREQ=WEEKLY;BYDAY=MO,TH", dtstart: monday, from: monday, to: nineAM(2026, 3, 12),
+			want: []time.Time{nineAM(2026, 3, 2), nineAM(2026, 3, 5), nineAM(2026, 3, 9)},
+		},
+		{
+			name:  "days before dtstart in its week are skipped",
+			rrule: "FREQ=WEEKLY;BYDAY=MO,TH", dtstart: nineAM(2026, 3, 4), from: monday, to: nineAM(2026, 3, 10),
+			want: []time.Time{nineAM(2026, 3, 5), nineAM(2026, 3, 9)},
+		},
+		{
+			name:  "every other week",
+			rrule: "FREQ=WEEKLY;INTERVAL=2", dtstart: monday, from: monday, to: nineAM(2026, 4, 1),
+			want: []time.Time{nineAM(2026, 3, 2), nineAM(2026, 3, 16), nineAM(2026, 3, 30)},
+		},
+		{
+			name:  "until is inclusive",
+			rrule: "FREQ=WEEKLY;UNTIL=20260316T090000Z", dtstart: monday, from: monday, to: nineAM(2027, 1, 1),
+			want: []time.Time{nineAM(2026, 3, 2), nineAM(2026, 3, 9), nineAM(2026, 3, 16)},
+		},
+		{
+			name:  "date-only until includes the day",
+			rrule: "FREQ=DAILY;UNTIL=20260304", dtstart: monday, from: monday, to: nineAM(2027, 1, 1),
+			want: []time.Time{nineAM(2026, 3, 2), nineAM(2026, 3, 3), nineAM(2026, 3, 4)},
+		},
+		{
+			name:  "monthly skips months without the day",
+			rrule: "FREQ=MONTHLY", dtstart: nineAM(2026, 1, 31), from: nineAM(2026, 1, 1), to: nineAM(2026, 6, 1),
+			want: []time.Time{nineAM(2026, 1, 31), nineAM(2026, 3, 31), nineAM(2026, 5, 31)},
+		},
+		{
+			name:  "quarterly",
+			rrule: "FREQ=MONTHLY;INTERVAL=3", dtstart: nineAM(2026, 1, 15), from: nineAM(2026, 1, 1), to: nineAM(2027, 1, 1),
+			want: []time.Time{nineAM(2026, 1, 15), nineAM(2026, 4, 15), nineAM(2026, 7, 15), nineAM(2026, 10, 15)},
+		},
+		{
+			name:  "second Tuesday",
+			rrule: "FREQ=MONTHLY;BYDAY=2TU", dtstart: monday, from: monday, to: nineAM(2026, 5, 1),
+			want: []time.Time{nineAM(2026, 3, 10), nineAM(2026, 4, 14)},
+		},
+		{
+			name:  "last Friday",
+			rrule: "FREQ=MONTHLY;BYDAY=-1FR", dtstart: monday, from: monday, to: nineAM(2026, 5, 1),
+			want: []time.Time{nineAM(2026, 3, 27), nineAM(2026, 4, 24)},
+		},
+		{
+			name:  "leap day only in leap years",
+			rrule: "FREQ=YEARLY", dtstart: nineAM(2024, 2, 29), from: nineAM(2024, 1, 1), to: nineAM(2029, 1, 1),
+			want: []time.Time{nineAM(2024, 2, 29), nineAM(2028, 2, 29)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := Parse(tt.rrule)
+			if err != nil {
+				t.Fatalf("Parse(%q) error = %v", tt.rrule, err)
+			}
+			got, err := rule.Between(tt.dtstart, tt.from, tt.to)
+			if err != nil {
+				t.Fatalf("Between() error = %v", err)
+			}
+			if !equalTimes(got, tt.want) {
+				t.Errorf("Between() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBetweenAcrossDaylightSaving(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("time zone data not available")
+	}
+
+	tests := []struct {
+		name    string
+		rrule   string
+		dtstart time.Time
+		wantUTC []int // hour of each occurrence in UTC
+	}{
+		// Clocks moved forward on Sunday 2026-03-08
+		{"spring forward", "FREQ=DAILY;COUNT=4", time.Date(2026, 3, 6, 9, 0, 0, 0, loc), []int{14, 14, 13, 13}},
+		// and back on Sunday 2026-11-01
+		{"fall back", "FREQ=WEEKLY;COUNT=2", time.Date(2026, 10, 31, 9, 0, 0, 0, loc), []int{13, 14}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := Parse(tt.rrule)
+			if err != nil {
+				t.Fatalf("Parse(%q) error = %v", tt.rrule, err)
+			}
+			got, err := rule.Between(tt.dtstart, tt.dtstart, tt.dtstart.AddDate(1, 0, 0))
+			if err != nil {
+				t.Fatalf("Between() error = %v", err)
+			}
+			if len(got) != len(tt.wantUTC) {
+				t.Fatalf("Between() = %v, want %d occurrences", got, len(tt.wantUTC))
+			}
+			for i, o := range got {
+				if o.Hour() != 9 || o.Location() != loc {
+					t.Errorf("occurrence %d = %v, want 09:00 in %v", i, o, loc)
+				}
+				if o.UTC().Hour() != tt.wantUTC[i] {
+					t.Errorf("occurrence %d = %v, want %02d:00 UTC", i, o.UTC(), tt.wantUTC[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCountBefore(t *testing.T) {
+	monday := nineAM(2026, 3, 2)
+
+	tests := []struct {
+		name  string
+		rrule string
+		at    time.Time
+		want  int
+	}{
+		{"before the start", "FREQ=DAILY", nineAM(2026, 3, 1), 0},
+		{"at the start", "FREQ=DAILY", monday, 0},
+		{"excludes the occurrence at t", "FREQ=DAILY", nineAM(2026, 3, 5), 3},
+		{"stops at count", "FREQ=DAILY;COUNT=2", nineAM(2026, 3, 5), 2},
+		{"weekly on two days", "FREQ=WEEKLY;BYDAY=MO,TH", nineAM(2026, 3, 10), 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := Parse(tt.rrule)
+			if err != nil {
+				t.Fatalf("Parse(%q) error = %v", tt.rrule, err)
+			}
+			got, err := rule.CountBefore(monday, tt.at)
+			if err != nil {
+				t.Fatalf("CountBefore() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("CountBefore() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
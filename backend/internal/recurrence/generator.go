@@ -0,0 +1,141 @@
+package recurrence
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/ireuven89/routewise/internal/events"
+	"github.com/ireuven89/routewise/internal/models"
+	"github.com/ireuven89/routewise/internal/repository"
+)
+
+// Generator materializes recurring job templates into scheduled jobs, keeping
+// a rolling horizon of upcoming occurrences
+type Generator struct {
+	templateRepo *repository.JobTemplateRepository
+	events       events.Publisher
+	horizon      time.Duration
+}
+
+func NewGenerator(db *sql.DB, publisher events.Publisher, horizon time.Duration) *Generator {
+	return &Generator{
+		templateRepo: repository.NewJobTemplateRepository(db),
+		events:       publisher,
+		horizon:      horizon,
+	}
+}
+
+// Run generates once immediately and then on every tick until ctx is done
+func (g *Generator) Run(ctx context.Context, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+
+	for {
+		if _, err := g.GenerateAll(time.Now()); err != nil {
+			sentry.CaptureException(err)
+			log.Printf("recurring job generation failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// GenerateAll materializes every template that is behind the horizon. One
+// broken template does not stop the others.
+func (g *Generator) GenerateAll(now time.Time) (int, error) {
+	templates, err := g.templateRepo.FindDue(now.Add(g.horizon))
+	if err != nil {
+		return 0, err
+	}
+
+	total := 0
+	for _, t := range templates {
+		created, err := g.Generate(t, now)
+		if err != nil {
+			sentry.CaptureException(err)
+			log.Printf("recurring job template %d: %v", t.ID, err)
+			continue
+		}
+		total += created
+	}
+
+	return total, nil
+}
+
+// Generate creates the template's jobs up to now + horizon and publishes
+// each new one
+func (g *Generator) Generate(t *models.JobTemplate, now time.Time) (int, error) {
+	rule, dtstart, err := TemplateRule(t)
+	if err != nil {
+		return 0, err
+	}
+
+	until := now.Add(g.horizon)
+	from := startOfDay(now.In(dtstart.Location()))
+	if t.GeneratedUntil != nil {
+		from = *t.GeneratedUntil
+	}
+	if !from.Before(until) {
+		return 0, nil
+	}
+
+	occurrences, err := rule.Between(dtstart, from, until)
+	if err != nil {
+		return 0, err
+	}
+
+	created, err := g.templateRepo.Materialize(t, occurrences, until)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, job := range created {
+		g.events.Publish(job.OrganizationID, events.JobCreated, job)
+	}
+	return len(created), nil
+}
+
+// Preview lists the next n occurrences of a template after from
+func Preview(t *models.JobTemplate, from time.Time, n int) ([]time.Time, error) {
+	rule, dtstart, err := TemplateRule(t)
+	if err != nil {
+		return nil, err
+	}
+
+	out := []time.Time{}
+	err = rule.each(dtstart, func(o time.Time) bool {
+		if !o.Before(from) {
+			out = append(out, o)
+		}
+		return len(out) < n
+	})
+	return out, err
+}
+
+// TemplateRule parses the template's rule and returns its first occurrence in
+// the template's timezone
+func TemplateRule(t *models.JobTemplate) (Rule, time.Time, error) {
+	rule, err := Parse(t.RRule)
+	if err != nil {
+		return Rule{}, time.Time{}, err
+	}
+
+	loc, err := time.LoadLocation(t.Timezone)
+	if err != nil {
+		return Rule{}, time.Time{}, err
+	}
+
+	return rule, t.StartsAt.In(loc), nil
+}
+
+func startOfDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
@@ -0,0 +1,210 @@
+package recurrence
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Frequency string
+
+const (
+	Daily   Frequency = "DAILY"
+	Weekly  Frequency = "WEEKLY"
+	Monthly Frequency = "MONTHLY"
+	Yearly  Frequency = "YEARLY"
+)
+
+const untilLayout = "20060102T150405Z"
+
+var ErrInvalidRule = errors.New("invalid recurrence rule")
+
+var weekdayCodes = map[string]time.Weekday{
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+	"SU": time.Sunday,
+}
+
+// Rule is the subset of RFC 5545 RRULE the scheduler supports. A quarterly
+// filter change is {Frequency: MONTHLY, Interval: 3}; every Monday and
+// Thursday is {Frequency: WEEKLY, ByDay: [MO, TH]}. ByDay entries may carry an
+// ordinal for monthly rules, e.g. 2TU (second Tuesday) or -1FR (last Friday).
+type Rule struct {
+	Frequency Frequency  `json:"frequency"`
+	Interval  int        `json:"interval,omitempty"`
+	ByDay     []string   `json:"by_day,omitempty"`
+	Until     *time.Time `json:"until,omitempty"`
+	Count     int        `json:"count,omitempty"`
+}
+
+type dayRule struct {
+	ordinal int
+	weekday time.Weekday
+}
+
+// Parse reads an RRULE string such as "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH"
+func Parse(s string) (Rule, error) {
+	var rule Rule
+	s = strings.TrimPrefix(strings.TrimSpace(s), "RRULE:")
+	if s == "" {
+		return rule, fmt.Errorf("%w: empty", ErrInvalidRule)
+	}
+
+	for _, part := range strings.Split(s, ";") {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return rule, fmt.Errorf("%w: malformed part %q", ErrInvalidRule, part)
+		}
+
+		switch strings.ToUpper(key) {
+		case "FREQ":
+			rule.Frequency = Frequency(strings.ToUpper(value))
+		case "INTERVAL":
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return rule, fmt.Errorf("%w: bad INTERVAL", ErrInvalidRule)
+			}
+			rule.Interval = n
+		case "BYDAY":
+			rule.ByDay = strings.Split(strings.ToUpper(value), ",")
+		case "UNTIL":
+			until, err := parseUntil(value)
+			if err != nil {
+				return rule, err
+			}
+			rule.Until = &until
+		case "COUNT":
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return rule, fmt.Errorf("%w: bad COUNT", ErrInvalidRule)
+			}
+			rule.Count = n
+		default:
+			return rule, fmt.Errorf("%w: unsupported part %s", ErrInvalidRule, key)
+		}
+	}
+
+	return rule, rule.Validate()
+}
+
+func parseUntil(value string) (time.Time, error) {
+	if t, err := time.Parse(untilLayout, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse("20060102", value); err == nil {
+		// A date-only UNTIL includes the whole day
+		return t.Add(24*time.Hour - time.Second), nil
+	}
+	return time.Time{}, fmt.Errorf("%w: bad UNTIL", ErrInvalidRule)
+}
+
+// String renders the rule in RRULE form, the format it is stored in
+func (r Rule) String() string {
+	parts := []string{"FREQ=" + string(r.Frequency)}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if len(r.ByDay) > 0 {
+		parts = append(parts, "BYDAY="+strings.Join(r.ByDay, ","))
+	}
+	if r.Until != nil {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format(untilLayout))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	return strings.Join(parts, ";")
+}
+
+func (r Rule) Validate() error {
+	switch r.Frequency {
+	case Daily, Weekly, Monthly, Yearly:
+	default:
+		return fmt.Errorf("%w: unknown frequency %q", ErrInvalidRule, r.Frequency)
+	}
+	if r.Interval < 0 {
+		return fmt.Errorf("%w: interval must be positive", ErrInvalidRule)
+	}
+	if r.Count < 0 {
+		return fmt.Errorf("%w: count must be positive", ErrInvalidRule)
+	}
+	if r.Count > 0 && r.Until != nil {
+		return fmt.Errorf("%w: until and count are mutually exclusive", ErrInvalidRule)
+	}
+	if r.Frequency == Yearly && len(r.ByDay) > 0 {
+		return fmt.Errorf("%w: by_day is not supported for yearly rules", ErrInvalidRule)
+	}
+
+	days, err := r.days()
+	if err != nil {
+		return err
+	}
+	for _, d := range days {
+		if d.ordinal != 0 && r.Frequency != Monthly {
+			return fmt.Errorf("%w: ordinal by_day is only valid for monthly rules", ErrInvalidRule)
+		}
+	}
+	return nil
+}
+
+func (r Rule) interval() int {
+	if r.Interval < 1 {
+		return 1
+	}
+	return r.Interval
+}
+
+func (r Rule) days() ([]dayRule, error) {
+	days := make([]dayRule, 0, len(r.ByDay))
+	for _, raw := range r.ByDay {
+		code := strings.ToUpper(strings.TrimSpace(raw))
+		if len(code) < 2 {
+			return nil, fmt.Errorf("%w: bad by_day %q", ErrInvalidRule, raw)
+		}
+
+		weekday, ok := weekdayCodes[code[len(code)-2:]]
+		if !ok {
+			return nil, fmt.Errorf("%w: bad by_day %q", ErrInvalidRule, raw)
+		}
+
+		ordinal := 0
+		if prefix := code[:len(code)-2]; prefix != "" {
+			n, err := strconv.Atoi(prefix)
+			if err != nil || n == 0 || n < -5 || n > 5 {
+				return nil, fmt.Errorf("%w: bad by_day %q", ErrInvalidRule, raw)
+			}
+			ordinal = n
+		}
+
+		days = append(days, dayRule{ordinal: ordinal, weekday: weekday})
+	}
+
+	// Weeks start on Monday
+	sort.Slice(days, func(i, j int) bool {
+		return mondayOffset(days[i].weekday) < mondayOffset(days[j].weekday)
+	})
+	return days, nil
+}
+
+func (d dayRule) String() string {
+	for code, weekday := range weekdayCodes {
+		if weekday == d.weekday {
+			if d.ordinal != 0 {
+				return strconv.Itoa(d.ordinal) + code
+			}
+			return code
+		}
+	}
+	return ""
+}
+
+func mondayOffset(d time.Weekday) int {
+	return (int(d) + 6) % 7
+}
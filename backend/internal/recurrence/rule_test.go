@@ -0,0 +1,84 @@
+package recurrence
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want Rule
+	}{
+		{"daily", "FREQ=DAILY", Rule{Frequency: Daily}},
+		{"prefix and lower case", "RRULE:freq=weekly;byday=mo,th", Rule{Frequency: Weekly, ByDay: []string{"MO", "TH"}}},
+		{"interval and count", "FREQ=MONTHLY;INTERVAL=3;COUNT=4", Rule{Frequency: Monthly, Interval: 3, Count: 4}},
+		{"ordinals", "FREQ=MONTHLY;BYDAY=2TU,-1FR", Rule{Frequency: Monthly, ByDay: []string{"2TU", "-1FR"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.in)
+			if err != nil {
+				t.Fatalf("Parse(%q) error = %v", tt.in, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse(%q) = %+v, want %+v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+	}{
+		{"empty", ""},
+		{"malformed part", "FREQ=DAILY;COUNT"},
+		{"unknown frequency", "FREQ=HOURLY"},
+		{"unsupported part", "FREQ=MONTHLY;BYSETPOS=1"},
+		{"bad interval", "FREQ=DAILY;INTERVAL=x"},
+		{"negative count", "FREQ=DAILY;COUNT=-1"},
+		{"bad until", "FREQ=DAILY;UNTIL=tomorrow"},
+		{"until and count", "FREQ=DAILY;COUNT=2;UNTIL=20260101"},
+		{"yearly by day", "FREQ=YEARLY;BYDAY=MO"},
+		{"weekly ordinal", "FREQ=WEEKLY;BYDAY=2TU"},
+		{"ordinal out of range", "FREQ=MONTHLY;BYDAY=6MO"},
+		{"unknown weekday", "FREQ=WEEKLY;BYDAY=XX"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(tt.in); !errors.Is(err, ErrInvalidRule) {
+				t.Errorf("Parse(%q) error = %v, want %v", tt.in, err, ErrInvalidRule)
+			}
+		})
+	}
+}
+
+func TestRuleString(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"FREQ=DAILY;INTERVAL=1", "FREQ=DAILY"},
+		{"FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH;UNTIL=20260316T090000Z", "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH;UNTIL=20260316T090000Z"},
+		{"FREQ=WEEKLY;UNTIL=20260316", "FREQ=WEEKLY;UNTIL=20260316T235959Z"},
+		{"FREQ=MONTHLY;BYDAY=-1FR;COUNT=6", "FREQ=MONTHLY;BYDAY=-1FR;COUNT=6"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			rule, err := Parse(tt.in)
+			if err != nil {
+				t.Fatalf("Parse(%q) error = %v", tt.in, err)
+			}
+			if got := rule.String(); got != tt.want {
+				t.Errorf("String() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
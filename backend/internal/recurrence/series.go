@@ -0,0 +1,56 @@
+package recurrence
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ireuven89/routewise/internal/models"
+)
+
+// EndBefore returns the template's rule cut off just before pivot
+func EndBefore(t *models.JobTemplate, pivot time.Time) (string, error) {
+	rule, _, err := TemplateRule(t)
+	if err != nil {
+		return "", err
+	}
+
+	until := pivot.Add(-time.Second)
+	rule.Count = 0
+	rule.Until = &until
+	return rule.String(), nil
+}
+
+// ContinueFrom builds the rule of a series that takes over from t at pivot.
+// A COUNT limit carries over only the occurrences not yet used up, and
+// weekdays move along when the new series starts shiftDays later.
+func ContinueFrom(t *models.JobTemplate, pivot time.Time, shiftDays int) (string, error) {
+	rule, dtstart, err := TemplateRule(t)
+	if err != nil {
+		return "", err
+	}
+
+	if rule.Count > 0 {
+		used, err := rule.CountBefore(dtstart, pivot)
+		if err != nil {
+			return "", err
+		}
+		if used >= rule.Count {
+			return "", fmt.Errorf("%w: series has no occurrences left", ErrInvalidRule)
+		}
+		rule.Count -= used
+	}
+
+	if shiftDays%7 != 0 && len(rule.ByDay) > 0 {
+		days, err := rule.days()
+		if err != nil {
+			return "", err
+		}
+		rule.ByDay = make([]string, 0, len(days))
+		for _, d := range days {
+			d.weekday = time.Weekday(((int(d.weekday)+shiftDays)%7 + 7) % 7)
+			rule.ByDay = append(rule.ByDay, d.String())
+		}
+	}
+
+	return rule.String(), nil
+}
@@ -0,0 +1,68 @@
+package recurrence
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ireuven89/routewise/internal/models"
+)
+
+func TestEndBefore(t *testing.T) {
+	tests := []struct {
+		name  string
+		rrule string
+		want  string
+	}{
+		{"open ended", "FREQ=WEEKLY;BYDAY=MO,TH", "FREQ=WEEKLY;BYDAY=MO,TH;UNTIL=20260305T085959Z"},
+		{"count is replaced", "FREQ=DAILY;COUNT=10", "FREQ=DAILY;UNTIL=20260305T085959Z"},
+		{"earlier until is replaced", "FREQ=DAILY;UNTIL=20261231", "FREQ=DAILY;UNTIL=20260305T085959Z"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			template := &models.JobTemplate{RRule: tt.rrule, StartsAt: nineAM(2026, 3, 2), Timezone: "UTC"}
+			got, err := EndBefore(template, nineAM(2026, 3, 5))
+			if err != nil {
+				t.Fatalf("EndBefore() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("EndBefore() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestContinueFrom(t *testing.T) {
+	tests := []struct {
+		name      string
+		rrule     string
+		pivot     time.Time
+		shiftDays int
+		want      string
+		wantErr   error
+	}{
+		{"unchanged", "FREQ=WEEKLY;BYDAY=MO,TH", nineAM(2026, 3, 5), 0, "FREQ=WEEKLY;BYDAY=MO,TH", nil},
+		{"remaining count carries over", "FREQ=DAILY;COUNT=10", nineAM(2026, 3, 5), 0, "FREQ=DAILY;COUNT=7", nil},
+		{"count used up", "FREQ=DAILY;COUNT=3", nineAM(2026, 3, 5), 0, "", ErrInvalidRule},
+		{"a day later", "FREQ=WEEKLY;BYDAY=MO,TH", nineAM(2026, 3, 5), 1, "FREQ=WEEKLY;BYDAY=TU,FR", nil},
+		{"a day earlier", "FREQ=WEEKLY;BYDAY=MO,TH", nineAM(2026, 3, 5), -1, "FREQ=WEEKLY;BYDAY=SU,WE", nil},
+		{"wraps into next week", "FREQ=WEEKLY;BYDAY=SA", nineAM(2026, 3, 7), 2, "FREQ=WEEKLY;BYDAY=MO", nil},
+		{"whole weeks keep the days", "FREQ=WEEKLY;BYDAY=MO,TH", nineAM(2026, 3, 5), 14, "FREQ=WEEKLY;BYDAY=MO,TH", nil},
+		{"ordinal keeps its week", "FREQ=MONTHLY;BYDAY=2TU", nineAM(2026, 3, 10), 1, "FREQ=MONTHLY;BYDAY=2WE", nil},
+		{"no weekdays to move", "FREQ=MONTHLY", nineAM(2026, 4, 2), 3, "FREQ=MONTHLY", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			template := &models.JobTemplate{RRule: tt.rrule, StartsAt: nineAM(2026, 3, 2), Timezone: "UTC"}
+			got, err := ContinueFrom(template, tt.pivot, tt.shiftDays)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ContinueFrom() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ContinueFrom() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,298 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/ireuven89/routewise/internal/models"
+)
+
+type AvailabilityRepository struct {
+	db *sql.DB
+	q  dbtx // db, or the transaction given to WithTx
+}
+
+func NewAvailabilityRepository(db *sql.DB) *AvailabilityRepository {
+	return &AvailabilityRepository{db: db, q: db}
+}
+
+// WithTx returns a copy of the repository that reads and writes in tx
+func (r *AvailabilityRepository) WithTx(tx *sql.Tx) *AvailabilityRepository {
+	return &AvailabilityRepository{db: r.db, q: tx}
+}
+
+// dbtx is satisfied by both *sql.DB and *sql.Tx
+type dbtx interface {
+	querier
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// ScheduleCheck checks that the worker can take a job at start for
+// durationMinutes and returns the conflicts the organization only warns
+// about. Writes that give a worker a job run it inside their transaction
+// once the job and the worker are locked, so concurrent writes for the same
+// worker check and save one after the other.
+type ScheduleCheck func(tx *sql.Tx, workerID uint, start time.Time, durationMinutes int) ([]models.ScheduleConflict, error)
+
+// lockWorker locks the worker's row until tx ends. Jobs are locked before
+// workers everywhere, so writers cannot deadlock on the two.
+func lockWorker(tx *sql.Tx, workerID uint, organizationID uint) error {
+	var id uint
+	err := tx.QueryRow(
+		`SELECT id FROM workers WHERE id = $1 AND organization_id = $2 FOR UPDATE`,
+		workerID, organizationID,
+	).Scan(&id)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("worker not found")
+	}
+	return err
+}
+
+// checkWorker locks the worker, when there is one, and runs check for the slot
+func checkWorker(tx *sql.Tx, organizationID uint, workerID *uint, start time.Time, durationMinutes int, check ScheduleCheck) ([]models.ScheduleConflict, error) {
+	if workerID == nil {
+		return nil, nil
+	}
+	if err := lockWorker(tx, *workerID, organizationID); err != nil {
+		return nil, err
+	}
+	if check == nil {
+		return nil, nil
+	}
+	return check(tx, *workerID, start, durationMinutes)
+}
+
+// GetSettings returns the organization's settings, or the defaults if none were saved
+func (r *AvailabilityRepository) GetSettings(organizationID uint) (*models.SchedulingSettings, error) {
+	settings := &models.SchedulingSettings{}
+	err := r.q.QueryRow(`
+		SELECT organization_id, travel_buffer_minutes, conflict_mode, timezone, updated_at
+		FROM scheduling_settings
+		WHERE organization_id = $1
+	`, organizationID).Scan(
+		&settings.OrganizationID,
+		&settings.TravelBufferMinutes,
+		&settings.ConflictMode,
+		&settings.Timezone,
+		&settings.UpdatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return models.DefaultSchedulingSettings(organizationID), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return settings, nil
+}
+
+func (r *AvailabilityRepository) SaveSettings(settings *models.SchedulingSettings) error {
+	now := time.Now()
+	_, err := r.q.Exec(`
+		INSERT INTO scheduling_settings (organization_id, travel_buffer_minutes, conflict_mode, timezone, updated_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (organization_id) DO UPDATE
+		SET travel_buffer_minutes = EXCLUDED.travel_buffer_minutes, conflict_mode = EXCLUDED.conflict_mode,
+		    timezone = EXCLUDED.timezone, updated_at = EXCLUDED.updated_at
+	`, settings.OrganizationID, settings.TravelBufferMinutes, settings.ConflictMode, settings.Timezone, now)
+	if err != nil {
+		return err
+	}
+
+	settings.UpdatedAt = now
+	return nil
+}
+
+func (r *AvailabilityRepository) GetWorkingHours(workerID uint) ([]models.WorkingHours, error) {
+	rows, err := r.q.Query(`
+		SELECT id, worker_id, weekday, to_char(start_time, 'HH24:MI'), to_char(end_time, 'HH24:MI')
+		FROM worker_working_hours
+		WHERE worker_id = $1
+		ORDER BY weekday, start_time
+	`, workerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hours := []models.WorkingHours{}
+	for rows.Next() {
+		var h models.WorkingHours
+		if err := rows.Scan(&h.ID, &h.WorkerID, &h.Weekday, &h.StartTime, &h.EndTime); err != nil {
+			return nil, err
+		}
+		hours = append(hours, h)
+	}
+
+	return hours, rows.Err()
+}
+
+// ReplaceWorkingHours swaps the worker's whole week for hours
+func (r *AvailabilityRepository) ReplaceWorkingHours(workerID uint, hours []models.WorkingHours) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM worker_working_hours WHERE worker_id = $1`, workerID); err != nil {
+		return err
+	}
+
+	for i := range hours {
+		hours[i].WorkerID = workerID
+		err := tx.QueryRow(`
+			INSERT INTO worker_working_hours (worker_id, weekday, start_time, end_time)
+			VALUES ($1, $2, $3, $4)
+			RETURNING id
+		`, workerID, hours[i].Weekday, hours[i].StartTime, hours[i].EndTime).Scan(&hours[i].ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// FindTimeOff returns time off overlapping [from, to)
+func (r *AvailabilityRepository) FindTimeOff(workerID uint, from, to time.Time) ([]*models.TimeOff, error) {
+	rows, err := r.q.Query(`
+		SELECT id, worker_id, starts_at, ends_at, COALESCE(reason, ''), created_by, created_at
+		FROM worker_time_off
+		WHERE worker_id = $1 AND starts_at < $3 AND ends_at > $2
+		ORDER BY starts_at
+	`, workerID, from.UTC(), to.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []*models.TimeOff{}
+	for rows.Next() {
+		t := &models.TimeOff{}
+		var createdBy sql.NullInt64
+		if err := rows.Scan(&t.ID, &t.WorkerID, &t.StartsAt, &t.EndsAt, &t.Reason, &createdBy, &t.CreatedAt); err != nil {
+			return nil, err
+		}
+		if createdBy.Valid {
+			id := uint(createdBy.Int64)
+			t.CreatedBy = &id
+		}
+		entries = append(entries, t)
+	}
+
+	return entries, rows.Err()
+}
+
+func (r *AvailabilityRepository) CreateTimeOff(t *models.TimeOff) error {
+	return r.q.QueryRow(`
+		INSERT INTO worker_time_off (worker_id, starts_at, ends_at, reason, created_by)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at
+	`, t.WorkerID, t.StartsAt.UTC(), t.EndsAt.UTC(), t.Reason, t.CreatedBy).Scan(&t.ID, &t.CreatedAt)
+}
+
+func (r *AvailabilityRepository) DeleteTimeOff(id uint, workerID uint) error {
+	result, err := r.q.Exec(`DELETE FROM worker_time_off WHERE id = $1 AND worker_id = $2`, id, workerID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return fmt.Errorf("time off not found")
+	}
+
+	return nil
+}
+
+// FindHolidays returns holidays between two dates, inclusive
+func (r *AvailabilityRepository) FindHolidays(organizationID uint, from, to string) ([]*models.Holiday, error) {
+	rows, err := r.q.Query(`
+		SELECT id, organization_id, to_char(date, 'YYYY-MM-DD'), name, created_at
+		FROM organization_holidays
+		WHERE organization_id = $1 AND date BETWEEN $2 AND $3
+		ORDER BY date
+	`, organizationID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	holidays := []*models.Holiday{}
+	for rows.Next() {
+		h := &models.Holiday{}
+		if err := rows.Scan(&h.ID, &h.OrganizationID, &h.Date, &h.Name, &h.CreatedAt); err != nil {
+			return nil, err
+		}
+		holidays = append(holidays, h)
+	}
+
+	return holidays, rows.Err()
+}
+
+func (r *AvailabilityRepository) CreateHoliday(h *models.Holiday) error {
+	return r.q.QueryRow(`
+		INSERT INTO organization_holidays (organization_id, date, name)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (organization_id, date) DO UPDATE SET name = EXCLUDED.name
+		RETURNING id, created_at
+	`, h.OrganizationID, h.Date, h.Name).Scan(&h.ID, &h.CreatedAt)
+}
+
+func (r *AvailabilityRepository) DeleteHoliday(id uint, organizationID uint) error {
+	result, err := r.q.Exec(`DELETE FROM organization_holidays WHERE id = $1 AND organization_id = $2`, id, organizationID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return fmt.Errorf("holiday not found")
+	}
+
+	return nil
+}
+
+// FindBusy returns the open jobs that occupy the worker, as lead or crew
+// member, overlapping [from, to). excludeJobID leaves out the job being moved.
+func (r *AvailabilityRepository) FindBusy(workerID uint, organizationID uint, from, to time.Time, excludeJobID uint) ([]*models.BusyBlock, error) {
+	rows, err := r.q.Query(`
+		SELECT j.id, j.title, j.scheduled_at, j.scheduled_at + make_interval(mins => j.duration_minutes)
+		FROM jobs j
+		WHERE j.organization_id = $1
+		  AND j.id <> $2
+		  AND j.status IN ($3, $4)
+		  AND (j.technician_id = $5 OR EXISTS (
+		      SELECT 1 FROM project_assignments pa
+		      WHERE pa.project_id = j.id AND pa.worker_id = $5 AND pa.removed_at IS NULL))
+		  AND j.scheduled_at < $7
+		  AND j.scheduled_at + make_interval(mins => j.duration_minutes) > $6
+		ORDER BY j.scheduled_at
+	`, organizationID, excludeJobID, models.StatusScheduled, models.StatusInProgress, workerID, from.UTC(), to.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	blocks := []*models.BusyBlock{}
+	for rows.Next() {
+		b := &models.BusyBlock{}
+		if err := rows.Scan(&b.JobID, &b.Title, &b.Start, &b.End); err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, b)
+	}
+
+	return blocks, rows.Err()
+}
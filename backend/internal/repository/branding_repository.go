@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/ireuven89/routewise/internal/models"
+)
+
+type BrandingRepository struct {
+	db *sql.DB
+}
+
+func NewBrandingRepository(db *sql.DB) *BrandingRepository {
+	return &BrandingRepository{db: db}
+}
+
+// Get returns the organization's branding, or the defaults if none was saved
+func (r *BrandingRepository) Get(organizationID uint) (*models.OrganizationBranding, error) {
+	branding := &models.OrganizationBranding{}
+	err := r.db.QueryRow(`
+		SELECT organization_id, COALESCE(logo_s3_key, ''), primary_color, accent_color, COALESCE(footer_text, ''), updated_at
+		FROM organization_branding
+		WHERE organization_id = $1
+	`, organizationID).Scan(
+		&branding.OrganizationID,
+		&branding.LogoS3Key,
+		&branding.PrimaryColor,
+		&branding.AccentColor,
+		&branding.FooterText,
+		&branding.UpdatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return models.DefaultBranding(organizationID), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return branding, nil
+}
+
+func (r *BrandingRepository) Save(branding *models.OrganizationBranding) error {
+	now := time.Now()
+	_, err := r.db.Exec(`
+		INSERT INTO organization_branding (organization_id, logo_s3_key, primary_color, accent_color, footer_text, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (organization_id) DO UPDATE
+		SET logo_s3_key = EXCLUDED.logo_s3_key, primary_color = EXCLUDED.primary_color,
+		    accent_color = EXCLUDED.accent_color, footer_text = EXCLUDED.footer_text, updated_at = EXCLUDED.updated_at
+	`, branding.OrganizationID, nullIfEmpty(branding.LogoS3Key), branding.PrimaryColor, branding.AccentColor,
+		nullIfEmpty(branding.FooterText), now)
+	if err != nil {
+		return err
+	}
+
+	branding.UpdatedAt = now
+	return nil
+}
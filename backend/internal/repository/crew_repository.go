@@ -0,0 +1,191 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/ireuven89/routewise/internal/models"
+	"github.com/lib/pq"
+)
+
+type CrewRepository struct {
+	db *sql.DB
+}
+
+func NewCrewRepository(db *sql.DB) *CrewRepository {
+	return &CrewRepository{db: db}
+}
+
+// AddMember puts a worker on a job's crew. Both must belong to the
+// organization. check runs for the job's slot once the job and the worker
+// are locked; its warnings are returned.
+func (r *CrewRepository) AddMember(assignment *models.CrewAssignment, organizationID uint, check ScheduleCheck) ([]models.ScheduleConflict, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	job, err := lockJob(tx, assignment.JobID, organizationID)
+	if err != nil {
+		return nil, err
+	}
+	warnings, err := checkWorker(tx, organizationID, &assignment.WorkerID, job.ScheduledAt, job.DurationMinutes, check)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	err = tx.QueryRow(`
+		INSERT INTO project_assignments (project_id, worker_id, role, assigned_by, assigned_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id
+	`, assignment.JobID, assignment.WorkerID, assignment.Role, assignment.AssignedBy, now).Scan(&assignment.ID)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return nil, fmt.Errorf("worker already on crew")
+		}
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	assignment.AssignedAt = now
+	return warnings, nil
+}
+
+// UpdateRole changes the role of an active crew member
+func (r *CrewRepository) UpdateRole(jobID, workerID uint, role string, organizationID uint) error {
+	result, err := r.db.Exec(`
+		UPDATE project_assignments pa
+		SET role = $1
+		FROM jobs j
+		WHERE pa.project_id = $2 AND pa.worker_id = $3 AND pa.removed_at IS NULL
+		  AND j.id = pa.project_id AND j.organization_id = $4
+	`, role, jobID, workerID, organizationID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return fmt.Errorf("crew member not found")
+	}
+
+	return nil
+}
+
+// RemoveMember ends an active assignment and returns it. The row is kept for
+// history.
+func (r *CrewRepository) RemoveMember(jobID, workerID uint, organizationID uint) (*models.CrewAssignment, error) {
+	assignment := &models.CrewAssignment{JobID: jobID, WorkerID: workerID}
+	err := r.db.QueryRow(`
+		UPDATE project_assignments pa
+		SET removed_at = $1
+		FROM jobs j
+		WHERE pa.project_id = $2 AND pa.worker_id = $3 AND pa.removed_at IS NULL
+		  AND j.id = pa.project_id AND j.organization_id = $4
+		RETURNING pa.id, COALESCE(pa.role, ''), pa.assigned_by, pa.assigned_at, pa.removed_at
+	`, time.Now(), jobID, workerID, organizationID).Scan(
+		&assignment.ID, &assignment.Role, &assignment.AssignedBy, &assignment.AssignedAt, &assignment.RemovedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("crew member not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return assignment, nil
+}
+
+// FindByJob returns the crew of a job, optionally including past members
+func (r *CrewRepository) FindByJob(jobID uint, organizationID uint, includeRemoved bool) ([]*models.CrewAssignment, error) {
+	query := `
+		SELECT pa.id, pa.project_id, pa.worker_id, w.name, COALESCE(pa.role, ''),
+		       pa.assigned_by, pa.assigned_at, pa.removed_at
+		FROM project_assignments pa
+		JOIN jobs j ON j.id = pa.project_id
+		JOIN workers w ON w.id = pa.worker_id
+		WHERE pa.project_id = $1 AND j.organization_id = $2
+	`
+	if !includeRemoved {
+		query += " AND pa.removed_at IS NULL"
+	}
+	query += " ORDER BY pa.assigned_at ASC"
+
+	rows, err := r.db.Query(query, jobID, organizationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	crew := []*models.CrewAssignment{}
+	for rows.Next() {
+		a := &models.CrewAssignment{}
+		if err := scanAssignment(rows, a); err != nil {
+			return nil, err
+		}
+		crew = append(crew, a)
+	}
+
+	return crew, rows.Err()
+}
+
+// FindActiveByWorker returns the jobs a worker is currently on a crew for
+func (r *CrewRepository) FindActiveByWorker(workerID uint, organizationID uint) ([]*models.WorkerAssignment, error) {
+	rows, err := r.db.Query(`
+		SELECT pa.id, pa.project_id, pa.worker_id, w.name, COALESCE(pa.role, ''),
+		       pa.assigned_by, pa.assigned_at, pa.removed_at,
+		       j.title, j.status, j.scheduled_at, j.duration_minutes
+		FROM project_assignments pa
+		JOIN jobs j ON j.id = pa.project_id
+		JOIN workers w ON w.id = pa.worker_id
+		WHERE pa.worker_id = $1 AND j.organization_id = $2 AND pa.removed_at IS NULL
+		ORDER BY j.scheduled_at ASC
+	`, workerID, organizationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	assignments := []*models.WorkerAssignment{}
+	for rows.Next() {
+		a := &models.WorkerAssignment{}
+		if err := scanAssignment(rows, &a.CrewAssignment, &a.JobTitle, &a.JobStatus, &a.ScheduledAt, &a.DurationMinutes); err != nil {
+			return nil, err
+		}
+		assignments = append(assignments, a)
+	}
+
+	return assignments, rows.Err()
+}
+
+func scanAssignment(row rowScanner, a *models.CrewAssignment, extra ...interface{}) error {
+	var assignedBy sql.NullInt64
+	var removedAt sql.NullTime
+
+	dest := []interface{}{
+		&a.ID, &a.JobID, &a.WorkerID, &a.WorkerName, &a.Role,
+		&assignedBy, &a.AssignedAt, &removedAt,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return err
+	}
+
+	if assignedBy.Valid {
+		id := uint(assignedBy.Int64)
+		a.AssignedBy = &id
+	}
+	if removedAt.Valid {
+		a.RemovedAt = &removedAt.Time
+	}
+	return nil
+}
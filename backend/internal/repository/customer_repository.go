@@ -6,10 +6,11 @@ import (
 	"time"
 
 	"github.com/ireuven89/routewise/internal/models"
+	"github.com/lib/pq"
 )
 
 type customerDB struct {
-	ID             uint      `sql:"id""`
+	ID             uint      `sql:"id"`
 	OrganizationID uint      `sql:"organization_id" `
 	CreatedBy      *uint     `sql:"created_by"`
 	Name           string    `sql:"name" `
@@ -194,6 +195,153 @@ func (r *CustomerRepository) FindAll(organizationID uint, search string) ([]*mod
 	return customers, nil
 }
 
+// FindByIDs loads several customers at once, keyed by ID. Unknown IDs are skipped.
+func (r *CustomerRepository) FindByIDs(ids []uint, organizationID uint) (map[uint]*models.Customer, error) {
+	query := `
+		SELECT id, organization_id, created_by, name, email, phone, address, latitude, longitude, notes, created_at, updated_at
+		FROM customers
+		WHERE organization_id = $1 AND id = ANY($2)
+	`
+
+	idArray := make([]int64, len(ids))
+	for i, id := range ids {
+		idArray[i] = int64(id)
+	}
+
+	rows, err := r.db.Query(query, organizationID, pq.Array(idArray))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	customers := make(map[uint]*models.Customer, len(ids))
+
+	for rows.Next() {
+		customer := &models.Customer{}
+		var email, notes sql.NullString
+		var latitude, longitude sql.NullFloat64
+		var createdBy sql.NullInt64
+
+		err := rows.Scan(
+			&customer.ID,
+			&customer.OrganizationID,
+			&createdBy,
+			&customer.Name,
+			&email,
+			&customer.Phone,
+			&customer.Address,
+			&latitude,
+			&longitude,
+			&notes,
+			&customer.CreatedAt,
+			&customer.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if createdBy.Valid {
+			cb := uint(createdBy.Int64)
+			customer.CreatedBy = &cb
+		}
+		if email.Valid {
+			customer.Email = email.String
+		}
+		if latitude.Valid {
+			lat := latitude.Float64
+			customer.Latitude = &lat
+		}
+		if longitude.Valid {
+			lon := longitude.Float64
+			customer.Longitude = &lon
+		}
+		if notes.Valid {
+			customer.Notes = notes.String
+		}
+
+		customers[customer.ID] = customer
+	}
+
+	return customers, rows.Err()
+}
+
+// FindMissingCoordinates returns customers with an address but no
+// coordinates, leaving out those whose geocoding failed after failedBefore
+func (r *CustomerRepository) FindMissingCoordinates(organizationID uint, failedBefore time.Time, limit int) ([]*models.Customer, error) {
+	query := `
+		SELECT id, organization_id, name, address
+		FROM customers
+		WHERE organization_id = $1 AND (latitude IS NULL OR longitude IS NULL) AND address <> ''
+		  AND (geocode_failed_at IS NULL OR geocode_failed_at < $2)
+		ORDER BY id ASC
+		LIMIT $3
+	`
+
+	rows, err := r.db.Query(query, organizationID, failedBefore, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	customers := []*models.Customer{}
+	for rows.Next() {
+		customer := &models.Customer{}
+		if err := rows.Scan(&customer.ID, &customer.OrganizationID, &customer.Name, &customer.Address); err != nil {
+			return nil, err
+		}
+		customers = append(customers, customer)
+	}
+
+	return customers, rows.Err()
+}
+
+// CountMissingCoordinates counts what FindMissingCoordinates would return
+// without a limit
+func (r *CustomerRepository) CountMissingCoordinates(organizationID uint, failedBefore time.Time) (int, error) {
+	var count int
+	err := r.db.QueryRow(`
+		SELECT COUNT(*)
+		FROM customers
+		WHERE organization_id = $1 AND (latitude IS NULL OR longitude IS NULL) AND address <> ''
+		  AND (geocode_failed_at IS NULL OR geocode_failed_at < $2)
+	`, organizationID, failedBefore).Scan(&count)
+	return count, err
+}
+
+// MarkGeocodeFailed records that the customer's address could not be
+// geocoded, so backfills skip it for a while
+func (r *CustomerRepository) MarkGeocodeFailed(id uint, organizationID uint) error {
+	_, err := r.db.Exec(
+		`UPDATE customers SET geocode_failed_at = $1 WHERE id = $2 AND organization_id = $3`,
+		time.Now(), id, organizationID,
+	)
+	return err
+}
+
+func (r *CustomerRepository) UpdateCoordinates(id uint, organizationID uint, latitude, longitude float64) error {
+	query := `
+		UPDATE customers
+		SET latitude = $1, longitude = $2, updated_at = $3
+		WHERE id = $4 AND organization_id = $5
+	`
+
+	result, err := r.db.Exec(query, latitude, longitude, time.Now(), id, organizationID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return fmt.Errorf("customer not found")
+	}
+
+	return nil
+}
+
 func formatCustomer(db *customerDB) *models.Customer {
 
 	return &models.Customer{
@@ -216,7 +364,8 @@ func (r *CustomerRepository) Update(customer *models.Customer) error {
 	query := `
 		UPDATE customers
 		SET name = $1, email = $2, phone = $3, address = $4,
-		    latitude = $5, longitude = $6, notes = $7, updated_at = $8
+		    latitude = $5, longitude = $6, notes = $7, updated_at = $8,
+		    geocode_failed_at = CASE WHEN address = $4 THEN geocode_failed_at END
 		WHERE id = $9 AND organization_id = $10
 	`
 
@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"strings"
+	"testing"
+)
+
+// fakeCall is one statement the repository sent
+type fakeCall struct {
+	query string
+	args  []driver.Value
+}
+
+// fakeResult is what a statement containing match returns
+type fakeResult struct {
+	match   string
+	columns []string
+	rows    [][]driver.Value
+}
+
+// fakeConn records statements and answers queries from its results, so
+// repository code can be tested without a database
+type fakeConn struct {
+	calls   []fakeCall
+	results []fakeResult
+}
+
+// newFakeDB returns a database whose single connection is conn
+func newFakeDB(t *testing.T, results ...fakeResult) (*sql.DB, *fakeConn) {
+	conn := &fakeConn{results: results}
+	db := sql.OpenDB(fakeConnector{conn})
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	return db, conn
+}
+
+// argsOf returns the arguments of the first statement containing match
+func (c *fakeConn) argsOf(t *testing.T, match string) []driver.Value {
+	t.Helper()
+	for _, call := range c.calls {
+		if strings.Contains(call.query, match) {
+			return call.args
+		}
+	}
+	t.Fatalf("no statement containing %q was run", match)
+	return nil
+}
+
+type fakeConnector struct{ conn *fakeConn }
+
+func (f fakeConnector) Connect(context.Context) (driver.Conn, error) { return f.conn, nil }
+func (f fakeConnector) Driver() driver.Driver                        { return nil }
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{conn: c, query: query}, nil
+}
+func (c *fakeConn) Close() error              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) { return fakeTx{}, nil }
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeStmt struct {
+	conn  *fakeConn
+	query string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.conn.calls = append(s.conn.calls, fakeCall{query: s.query, args: args})
+	return driver.RowsAffected(1), nil
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.conn.calls = append(s.conn.calls, fakeCall{query: s.query, args: args})
+	for _, result := range s.conn.results {
+		if strings.Contains(s.query, result.match) {
+			return &fakeRows{columns: result.columns, rows: result.rows}, nil
+		}
+	}
+	return &fakeRows{}, nil
+}
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
@@ -2,6 +2,8 @@ package repository
 
 import (
 	"database/sql"
+	"fmt"
+	"time"
 
 	"github.com/ireuven89/routewise/internal/models"
 )
@@ -14,101 +16,364 @@ func NewFileRepository(db *sql.DB) *FileRepository {
 	return &FileRepository{db: db}
 }
 
+const fileColumns = `
+	id, project_id, uploaded_by_user, uploaded_by_worker,
+	file_type, file_category, file_name, original_file_name,
+	mime_type, file_size, file_extension,
+	s3_bucket, s3_key, description, taken_at, COALESCE(signer_name, ''),
+	latitude, longitude, COALESCE(width, 0), COALESCE(height, 0),
+	COALESCE(thumbnail_s3_key, ''), COALESCE(medium_s3_key, ''), renditions_size, COALESCE(processing_status, ''),
+	COALESCE(scan_status, ''), COALESCE(scan_signature, ''),
+	COALESCE(document_id, id), version, deleted_at,
+	created_at, updated_at`
+
+// Files that are neither deleted nor quarantined are visible
+const visible = `deleted_at IS NULL AND COALESCE(scan_status, '') <> '` + models.ScanQuarantined + `'`
+
+// listed files are the newest visible version of their document. Queries
+// using it select from project_files without an alias.
+const listed = visible + ` AND NOT EXISTS (
+		SELECT 1 FROM project_files newer
+		WHERE COALESCE(newer.document_id, newer.id) = COALESCE(project_files.document_id, project_files.id)
+		  AND newer.version > project_files.version
+		  AND newer.deleted_at IS NULL AND COALESCE(newer.scan_status, '') <> '` + models.ScanQuarantined + `')`
+
 func (r *FileRepository) Create(file *models.ProjectFile) error {
-	return r.db.QueryRow(`
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := insertProjectFile(tx, file); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// insertProjectFile records a file and charges it to the organization's
+// storage usage; it fails with ErrStorageQuotaExceeded if the file does not
+// fit, except for signatures, which are never turned away. A file with a
+// DocumentID becomes the next version of that document. Photos are queued
+// for processing unless quarantined. q must be a transaction, as the locks
+// taken here are what keep concurrent versions apart.
+func insertProjectFile(q querier, file *models.ProjectFile) error {
+	// The next version number is read from the existing ones, so concurrent
+	// uploads of the same document take turns. File rows are locked before
+	// the usage counter, as everywhere else.
+	if file.DocumentID != 0 {
+		var versions int
+		err := q.QueryRow(`
+			SELECT COUNT(*) FROM (
+				SELECT 1 FROM project_files WHERE COALESCE(document_id, id) = $1 FOR UPDATE
+			) locked
+		`, file.DocumentID).Scan(&versions)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := chargeStorage(q, file.ProjectID, file.FileSize, 1, file.FileType != models.FileTypeSignature); err != nil {
+		return err
+	}
+
+	if file.FileType == models.FileTypePhoto && file.ProcessingStatus == "" && file.ScanStatus != models.ScanQuarantined {
+		file.ProcessingStatus = models.ProcessingPending
+	}
+
+	return q.QueryRow(`
         INSERT INTO project_files (
             project_id, uploaded_by_user, uploaded_by_worker,
             file_type, file_category, file_name, original_file_name,
             mime_type, file_size, file_extension,
-            s3_bucket, s3_key, description, taken_at
-        ) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
-        RETURNING id, created_at, updated_at
+            s3_bucket, s3_key, description, taken_at, signer_name, processing_status,
+            scan_status, scan_signature, document_id, version
+        ) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19,
+            COALESCE((SELECT MAX(version) FROM project_files WHERE COALESCE(document_id, id) = $19), 0) + 1)
+        RETURNING id, COALESCE(document_id, id), version, created_at, updated_at
     `,
 		file.ProjectID, file.UploadedByUser, file.UploadedByWorker,
 		file.FileType, file.FileCategory, file.FileName, file.OriginalFileName,
 		file.MimeType, file.FileSize, file.FileExtension,
-		file.S3Bucket, file.S3Key, file.Description, file.TakenAt,
-	).Scan(&file.ID, &file.CreatedAt, &file.UpdatedAt)
+		file.S3Bucket, file.S3Key, file.Description, file.TakenAt, nullIfEmpty(file.SignerName),
+		nullIfEmpty(file.ProcessingStatus), nullIfEmpty(file.ScanStatus), nullIfEmpty(file.ScanSignature),
+		nullIfZero(int(file.DocumentID)),
+	).Scan(&file.ID, &file.DocumentID, &file.Version, &file.CreatedAt, &file.UpdatedAt)
 }
 
 func (r *FileRepository) FindByProjectID(projectID uint) ([]*models.ProjectFile, error) {
-	rows, err := r.db.Query(`
-        SELECT id, project_id, uploaded_by_user, uploaded_by_worker,
-               file_type, file_category, file_name, original_file_name,
-               mime_type, file_size, file_extension,
-               s3_bucket, s3_key, description, taken_at,
-               created_at, updated_at
+	return r.findFiles(`
+        SELECT `+fileColumns+`
         FROM project_files
-        WHERE project_id = $1
+        WHERE project_id = $1 AND `+listed+`
         ORDER BY created_at DESC
     `, projectID)
+}
 
+func (r *FileRepository) FindByID(id uint) (*models.ProjectFile, error) {
+	file, err := scanFile(r.db.QueryRow(`
+        SELECT `+fileColumns+`
+        FROM project_files
+        WHERE id = $1
+    `, id))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("file not found")
+	}
+	return file, err
+}
+
+// Delete removes the record for good and releases its storage usage; see
+// Trash for user deletes
+func (r *FileRepository) Delete(id uint) error {
+	tx, err := r.db.Begin()
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer rows.Close()
+	defer tx.Rollback()
 
-	var files []*models.ProjectFile
-	for rows.Next() {
-		var f models.ProjectFile
-		err := rows.Scan(
-			&f.ID, &f.ProjectID, &f.UploadedByUser, &f.UploadedByWorker,
-			&f.FileType, &f.FileCategory, &f.FileName, &f.OriginalFileName,
-			&f.MimeType, &f.FileSize, &f.FileExtension,
-			&f.S3Bucket, &f.S3Key, &f.Description, &f.TakenAt,
-			&f.CreatedAt, &f.UpdatedAt,
-		)
-		if err != nil {
-			return nil, err
-		}
-		files = append(files, &f)
+	var projectID uint
+	var size int64
+	err = tx.QueryRow(`
+		DELETE FROM project_files WHERE id = $1
+		RETURNING project_id, file_size + renditions_size
+	`, id).Scan(&projectID, &size)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
 	}
 
-	return files, nil
+	if err := chargeStorage(tx, projectID, -size, -1, false); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
-func (r *FileRepository) FindByID(id uint) (*models.ProjectFile, error) {
-	var file models.ProjectFile
-	err := r.db.QueryRow(`
-        SELECT id, project_id, uploaded_by_user, uploaded_by_worker,
-               file_type, file_category, file_name, original_file_name,
-               mime_type, file_size, file_extension,
-               s3_bucket, s3_key, description, taken_at,
-               created_at, updated_at
-        FROM project_files
-        WHERE id = $1
-    `, id).Scan(
-		&file.ID, &file.ProjectID, &file.UploadedByUser, &file.UploadedByWorker,
-		&file.FileType, &file.FileCategory, &file.FileName, &file.OriginalFileName,
-		&file.MimeType, &file.FileSize, &file.FileExtension,
-		&file.S3Bucket, &file.S3Key, &file.Description, &file.TakenAt,
-		&file.CreatedAt, &file.UpdatedAt,
-	)
+// Trash soft-deletes a file along with every other version of its document,
+// so trashing the newest version does not bring back the one before it. The
+// versions share a deletion time, which is how Restore finds them again.
+// Their objects stay in storage until they are purged.
+func (r *FileRepository) Trash(file *models.ProjectFile) error {
+	rows, err := r.db.Query(`
+		UPDATE project_files
+		SET deleted_at = NOW(), updated_at = NOW()
+		WHERE COALESCE(document_id, id) = $1 AND deleted_at IS NULL
+		RETURNING id, deleted_at, updated_at
+	`, file.DocumentID)
+	if err != nil {
+		return err
+	}
+	return scanVersionChange(rows, file)
+}
 
+// Restore takes a file out of the trash along with the versions that were
+// trashed with it. Versions trashed on their own stay in the trash.
+func (r *FileRepository) Restore(file *models.ProjectFile) error {
+	rows, err := r.db.Query(`
+		UPDATE project_files
+		SET deleted_at = NULL, updated_at = NOW()
+		WHERE COALESCE(document_id, id) = $1
+		  AND deleted_at = (SELECT deleted_at FROM project_files WHERE id = $2)
+		RETURNING id, deleted_at, updated_at
+	`, file.DocumentID, file.ID)
 	if err != nil {
-		return nil, err
+		return err
 	}
+	return scanVersionChange(rows, file)
+}
+
+// scanVersionChange reads the versions updated by Trash or Restore into
+// file. It fails with "file not found" if file itself was not among them.
+func scanVersionChange(rows *sql.Rows, file *models.ProjectFile) error {
+	defer rows.Close()
 
-	return &file, nil
+	found := false
+	for rows.Next() {
+		var id uint
+		var deletedAt *time.Time
+		var updatedAt time.Time
+		if err := rows.Scan(&id, &deletedAt, &updatedAt); err != nil {
+			return err
+		}
+		if id == file.ID {
+			file.DeletedAt, file.UpdatedAt = deletedAt, updatedAt
+			found = true
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("file not found")
+	}
+	return nil
 }
 
-func (r *FileRepository) Delete(id uint) error {
-	_, err := r.db.Exec(`DELETE FROM project_files WHERE id = $1`, id)
-	return err
+// FindTrash returns the project's deleted files, most recently deleted first.
+// Versions trashed together are listed once, by the newest of them.
+func (r *FileRepository) FindTrash(projectID uint) ([]*models.ProjectFile, error) {
+	return r.findFiles(`
+		SELECT `+fileColumns+`
+		FROM project_files
+		WHERE project_id = $1 AND deleted_at IS NOT NULL
+		  AND NOT EXISTS (
+			SELECT 1 FROM project_files newer
+			WHERE COALESCE(newer.document_id, newer.id) = COALESCE(project_files.document_id, project_files.id)
+			  AND newer.version > project_files.version
+			  AND newer.deleted_at = project_files.deleted_at)
+		ORDER BY deleted_at DESC
+	`, projectID)
+}
+
+// FindTrashedBefore returns up to limit files deleted before the given time,
+// oldest first
+func (r *FileRepository) FindTrashedBefore(before time.Time, limit int) ([]*models.ProjectFile, error) {
+	return r.findFiles(`
+		SELECT `+fileColumns+`
+		FROM project_files
+		WHERE deleted_at < $1
+		ORDER BY deleted_at
+		LIMIT $2
+	`, before, limit)
+}
+
+// FindVersions returns the visible versions of a document, newest first
+func (r *FileRepository) FindVersions(documentID uint) ([]*models.ProjectFile, error) {
+	return r.findFiles(`
+		SELECT `+fileColumns+`
+		FROM project_files
+		WHERE COALESCE(document_id, id) = $1 AND `+visible+`
+		ORDER BY version DESC
+	`, documentID)
+}
+
+// FindCurrentByName returns the listed file of the given type and name in a
+// project, the newest one if there are several
+func (r *FileRepository) FindCurrentByName(projectID uint, fileType, originalFileName string) (*models.ProjectFile, error) {
+	file, err := scanFile(r.db.QueryRow(`
+		SELECT `+fileColumns+`
+		FROM project_files
+		WHERE project_id = $1 AND file_type = $2 AND original_file_name = $3 AND `+listed+`
+		ORDER BY created_at DESC
+		LIMIT 1
+	`, projectID, fileType, originalFileName))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("file not found")
+	}
+	return file, err
 }
 
 func (r *FileRepository) FindByType(projectID uint, fileType string) ([]*models.ProjectFile, error) {
-	rows, err := r.db.Query(`
-        SELECT id, project_id, uploaded_by_user, uploaded_by_worker,
-               file_type, file_category, file_name, original_file_name,
-               mime_type, file_size, file_extension,
-               s3_bucket, s3_key, description, taken_at,
-               created_at, updated_at
+	return r.findFiles(`
+        SELECT `+fileColumns+`
         FROM project_files
-        WHERE project_id = $1 AND file_type = $2
+        WHERE project_id = $1 AND file_type = $2 AND `+listed+`
         ORDER BY created_at DESC
     `, projectID, fileType)
+}
+
+// FindQuarantined returns the organization's quarantined files, newest first
+func (r *FileRepository) FindQuarantined(organizationID uint) ([]*models.ProjectFile, error) {
+	return r.findFiles(`
+		SELECT `+fileColumns+`
+		FROM project_files
+		WHERE scan_status = $1 AND deleted_at IS NULL
+		  AND project_id IN (SELECT id FROM jobs WHERE organization_id = $2)
+		ORDER BY created_at DESC
+	`, models.ScanQuarantined, organizationID)
+}
+
+// ClaimForProcessing marks a pending photo as being processed. It reports
+// false if another worker has it. A claim older than staleBefore is taken
+// over, as its worker is assumed to have died.
+func (r *FileRepository) ClaimForProcessing(id uint, staleBefore time.Time) (bool, error) {
+	result, err := r.db.Exec(`
+		UPDATE project_files
+		SET processing_status = $2, updated_at = NOW()
+		WHERE id = $1
+		  AND (processing_status = $3 OR (processing_status = $2 AND updated_at < $4))
+	`, id, models.ProcessingRunning, models.ProcessingPending, staleBefore)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+// FindPendingProcessing returns up to limit photos that are waiting for
+// processing since before createdBefore, or whose claim went stale, mapped
+// to their organization
+func (r *FileRepository) FindPendingProcessing(createdBefore, staleBefore time.Time, limit int) (map[uint]uint, error) {
+	rows, err := r.db.Query(`
+		SELECT f.id, j.organization_id
+		FROM project_files f
+		JOIN jobs j ON j.id = f.project_id
+		WHERE ((f.processing_status = $1 AND f.created_at < $3)
+		    OR (f.processing_status = $2 AND f.updated_at < $4))
+		  AND f.deleted_at IS NULL
+		ORDER BY f.created_at
+		LIMIT $5
+	`, models.ProcessingPending, models.ProcessingRunning, createdBefore, staleBefore, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pending := make(map[uint]uint)
+	for rows.Next() {
+		var fileID, organizationID uint
+		if err := rows.Scan(&fileID, &organizationID); err != nil {
+			return nil, err
+		}
+		pending[fileID] = organizationID
+	}
+	return pending, rows.Err()
+}
 
+// SaveProcessing stores the result of processing a photo and charges its
+// renditions to storage usage. A capture time given at upload is kept over
+// the one from EXIF.
+func (r *FileRepository) SaveProcessing(file *models.ProjectFile) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Renditions replace any from an earlier run
+	var previousSize int64
+	err = tx.QueryRow(`
+		UPDATE project_files f
+		SET processing_status = $2,
+		    taken_at = COALESCE(f.taken_at, $3),
+		    latitude = $4, longitude = $5,
+		    width = $6, height = $7,
+		    thumbnail_s3_key = $8, medium_s3_key = $9,
+		    renditions_size = $10,
+		    updated_at = NOW()
+		FROM (SELECT renditions_size FROM project_files WHERE id = $1 FOR UPDATE) previous
+		WHERE f.id = $1
+		RETURNING f.taken_at, f.updated_at, previous.renditions_size
+	`,
+		file.ID, file.ProcessingStatus, file.TakenAt,
+		file.Latitude, file.Longitude,
+		nullIfZero(file.Width), nullIfZero(file.Height),
+		nullIfEmpty(file.ThumbnailS3Key), nullIfEmpty(file.MediumS3Key),
+		file.RenditionsSize,
+	).Scan(&file.TakenAt, &file.UpdatedAt, &previousSize)
+	if err != nil {
+		return err
+	}
+
+	if err := chargeStorage(tx, file.ProjectID, file.RenditionsSize-previousSize, 0, false); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *FileRepository) findFiles(query string, args ...interface{}) ([]*models.ProjectFile, error) {
+	rows, err := r.db.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -116,19 +381,38 @@ func (r *FileRepository) FindByType(projectID uint, fileType string) ([]*models.
 
 	var files []*models.ProjectFile
 	for rows.Next() {
-		var f models.ProjectFile
-		err := rows.Scan(
-			&f.ID, &f.ProjectID, &f.UploadedByUser, &f.UploadedByWorker,
-			&f.FileType, &f.FileCategory, &f.FileName, &f.OriginalFileName,
-			&f.MimeType, &f.FileSize, &f.FileExtension,
-			&f.S3Bucket, &f.S3Key, &f.Description, &f.TakenAt,
-			&f.CreatedAt, &f.UpdatedAt,
-		)
+		f, err := scanFile(rows)
 		if err != nil {
 			return nil, err
 		}
-		files = append(files, &f)
+		files = append(files, f)
+	}
+
+	return files, rows.Err()
+}
+
+func scanFile(row rowScanner) (*models.ProjectFile, error) {
+	var f models.ProjectFile
+	err := row.Scan(
+		&f.ID, &f.ProjectID, &f.UploadedByUser, &f.UploadedByWorker,
+		&f.FileType, &f.FileCategory, &f.FileName, &f.OriginalFileName,
+		&f.MimeType, &f.FileSize, &f.FileExtension,
+		&f.S3Bucket, &f.S3Key, &f.Description, &f.TakenAt, &f.SignerName,
+		&f.Latitude, &f.Longitude, &f.Width, &f.Height,
+		&f.ThumbnailS3Key, &f.MediumS3Key, &f.RenditionsSize, &f.ProcessingStatus,
+		&f.ScanStatus, &f.ScanSignature,
+		&f.DocumentID, &f.Version, &f.DeletedAt,
+		&f.CreatedAt, &f.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
 	}
+	return &f, nil
+}
 
-	return files, nil
+func nullIfZero(n int) interface{} {
+	if n == 0 {
+		return nil
+	}
+	return n
 }
@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"database/sql/driver"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ireuven89/routewise/internal/models"
+)
+
+// Trashing the newest version of a document must not bring the one before it
+// back into the listing, so Trash and Restore work on the whole document
+func TestTrashAndRestoreWholeDocument(t *testing.T) {
+	deletedAt := time.Date(2026, 3, 2, 7, 0, 0, 0, time.UTC)
+	updatedAt := deletedAt
+	columns := []string{"id", "deleted_at", "updated_at"}
+
+	tests := []struct {
+		name    string
+		restore bool
+		rows    [][]driver.Value
+		wantErr string
+		wantAt  *time.Time
+	}{
+		{
+			name:   "trash every version",
+			rows:   [][]driver.Value{{int64(7), deletedAt, updatedAt}, {int64(9), deletedAt, updatedAt}},
+			wantAt: &deletedAt,
+		},
+		{
+			name:    "trash a file already in the trash",
+			wantErr: "file not found",
+		},
+		{
+			name:    "restore the versions trashed together",
+			restore: true,
+			rows:    [][]driver.Value{{int64(7), nil, updatedAt}, {int64(9), nil, updatedAt}},
+		},
+		{
+			name:    "restore a file not in the trash",
+			restore: true,
+			wantErr: "file not found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, conn := newFakeDB(t, fakeResult{match: "UPDATE project_files", columns: columns, rows: tt.rows})
+			repo := NewFileRepository(db)
+			file := &models.ProjectFile{ID: 9, DocumentID: 7, Version: 2}
+			if tt.restore {
+				file.DeletedAt = &deletedAt
+			}
+
+			var err error
+			if tt.restore {
+				err = repo.Restore(file)
+			} else {
+				err = repo.Trash(file)
+			}
+
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error = %v", err)
+			}
+
+			call := conn.calls[0]
+			if !strings.Contains(call.query, "WHERE COALESCE(document_id, id) = $1") {
+				t.Errorf("statement does not select the document's versions:\n%s", call.query)
+			}
+			if got := call.args[0]; got != int64(file.DocumentID) {
+				t.Errorf("document bound as %v, want %d", got, file.DocumentID)
+			}
+			if (file.DeletedAt == nil) != (tt.wantAt == nil) || (tt.wantAt != nil && !file.DeletedAt.Equal(*tt.wantAt)) {
+				t.Errorf("DeletedAt = %v, want %v", file.DeletedAt, tt.wantAt)
+			}
+		})
+	}
+}
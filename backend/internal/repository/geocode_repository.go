@@ -0,0 +1,45 @@
+package repository
+
+import (
+	"database/sql"
+
+	"github.com/ireuven89/routewise/services"
+)
+
+// GeocodeRepository persists geocoding results; it implements services.GeocodeCache
+type GeocodeRepository struct {
+	db *sql.DB
+}
+
+func NewGeocodeRepository(db *sql.DB) *GeocodeRepository {
+	return &GeocodeRepository{db: db}
+}
+
+func (r *GeocodeRepository) GetGeocode(addressKey string) (*services.GeocodeResult, error) {
+	result := &services.GeocodeResult{}
+	err := r.db.QueryRow(`
+        SELECT latitude, longitude, provider
+        FROM geocode_cache
+        WHERE address_key = $1
+    `, addressKey).Scan(&result.Latitude, &result.Longitude, &result.Provider)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (r *GeocodeRepository) SaveGeocode(addressKey string, result *services.GeocodeResult) error {
+	_, err := r.db.Exec(`
+        INSERT INTO geocode_cache (address_key, latitude, longitude, provider)
+        VALUES ($1, $2, $3, $4)
+        ON CONFLICT (address_key) DO UPDATE
+        SET latitude = EXCLUDED.latitude, longitude = EXCLUDED.longitude,
+            provider = EXCLUDED.provider, created_at = CURRENT_TIMESTAMP
+    `, addressKey, result.Latitude, result.Longitude, result.Provider)
+	return err
+}
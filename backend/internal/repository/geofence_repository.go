@@ -0,0 +1,244 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/ireuven89/routewise/internal/models"
+)
+
+type GeofenceRepository struct {
+	db *sql.DB
+}
+
+func NewGeofenceRepository(db *sql.DB) *GeofenceRepository {
+	return &GeofenceRepository{db: db}
+}
+
+// GetSettings returns the organization's settings, or the defaults if none were saved
+func (r *GeofenceRepository) GetSettings(organizationID uint) (*models.GeofenceSettings, error) {
+	settings := &models.GeofenceSettings{}
+	err := r.db.QueryRow(`
+		SELECT organization_id, enabled, radius_meters, min_dwell_minutes, updated_at
+		FROM geofence_settings
+		WHERE organization_id = $1
+	`, organizationID).Scan(
+		&settings.OrganizationID,
+		&settings.Enabled,
+		&settings.RadiusMeters,
+		&settings.MinDwellMinutes,
+		&settings.UpdatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return models.DefaultGeofenceSettings(organizationID), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return settings, nil
+}
+
+func (r *GeofenceRepository) SaveSettings(settings *models.GeofenceSettings) error {
+	now := time.Now()
+	_, err := r.db.Exec(`
+		INSERT INTO geofence_settings (organization_id, enabled, radius_meters, min_dwell_minutes, updated_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (organization_id) DO UPDATE
+		SET enabled = EXCLUDED.enabled, radius_meters = EXCLUDED.radius_meters,
+		    min_dwell_minutes = EXCLUDED.min_dwell_minutes, updated_at = EXCLUDED.updated_at
+	`, settings.OrganizationID, settings.Enabled, settings.RadiusMeters, settings.MinDwellMinutes, now)
+	if err != nil {
+		return err
+	}
+
+	settings.UpdatedAt = now
+	return nil
+}
+
+// FindOpenVisits returns the geofences the worker is currently inside, keyed by job
+func (r *GeofenceRepository) FindOpenVisits(workerID uint) (map[uint]*models.GeofenceVisit, error) {
+	rows, err := r.db.Query(`
+		SELECT id, job_id, worker_id, entered_at
+		FROM job_geofence_visits
+		WHERE worker_id = $1 AND exited_at IS NULL
+	`, workerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	visits := make(map[uint]*models.GeofenceVisit)
+	for rows.Next() {
+		v := &models.GeofenceVisit{}
+		if err := rows.Scan(&v.ID, &v.JobID, &v.WorkerID, &v.EnteredAt); err != nil {
+			return nil, err
+		}
+		visits[v.JobID] = v
+	}
+
+	return visits, rows.Err()
+}
+
+func (r *GeofenceRepository) OpenVisit(visit *models.GeofenceVisit) error {
+	return r.db.QueryRow(`
+		INSERT INTO job_geofence_visits (job_id, worker_id, entered_at)
+		VALUES ($1, $2, $3)
+		RETURNING id
+	`, visit.JobID, visit.WorkerID, visit.EnteredAt).Scan(&visit.ID)
+}
+
+func (r *GeofenceRepository) CloseVisit(id uint, exitedAt time.Time) error {
+	_, err := r.db.Exec(`UPDATE job_geofence_visits SET exited_at = $1 WHERE id = $2`, exitedAt, id)
+	return err
+}
+
+func (r *GeofenceRepository) CreateEvent(event *models.GeofenceEvent) error {
+	return r.db.QueryRow(`
+		INSERT INTO job_geofence_events (
+			organization_id, job_id, worker_id, rule, event_type, from_status, to_status,
+			outcome, detail, latitude, longitude, distance_meters, occurred_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		RETURNING id, created_at
+	`,
+		event.OrganizationID, event.JobID, event.WorkerID, event.Rule, event.EventType,
+		event.FromStatus, event.ToStatus, event.Outcome, event.Detail,
+		event.Latitude, event.Longitude, event.DistanceMeters, event.OccurredAt,
+	).Scan(&event.ID, &event.CreatedAt)
+}
+
+const geofenceEventColumns = `
+	id, organization_id, job_id, worker_id, rule, event_type, from_status, to_status,
+	outcome, COALESCE(detail, ''), latitude, longitude, distance_meters, occurred_at,
+	resolution, resolved_at, created_at
+`
+
+func (r *GeofenceRepository) FindEventsByJob(jobID uint, organizationID uint) ([]*models.GeofenceEvent, error) {
+	return r.queryEvents(`
+		SELECT `+geofenceEventColumns+`
+		FROM job_geofence_events
+		WHERE job_id = $1 AND organization_id = $2
+		ORDER BY occurred_at ASC
+	`, jobID, organizationID)
+}
+
+// FindPendingSuggestions returns suggested transitions nobody has acted on yet
+func (r *GeofenceRepository) FindPendingSuggestions(organizationID uint) ([]*models.GeofenceEvent, error) {
+	return r.queryEvents(`
+		SELECT `+geofenceEventColumns+`
+		FROM job_geofence_events
+		WHERE organization_id = $1 AND outcome = $2 AND resolved_at IS NULL
+		ORDER BY occurred_at DESC
+	`, organizationID, models.GeofenceOutcomeSuggested)
+}
+
+func (r *GeofenceRepository) FindEventByID(id uint, organizationID uint) (*models.GeofenceEvent, error) {
+	events, err := r.queryEvents(`
+		SELECT `+geofenceEventColumns+`
+		FROM job_geofence_events
+		WHERE id = $1 AND organization_id = $2
+	`, id, organizationID)
+	if err != nil {
+		return nil, err
+	}
+	if len(events) == 0 {
+		return nil, fmt.Errorf("geofence event not found")
+	}
+	return events[0], nil
+}
+
+// DismissSuggestion resolves a pending suggestion without acting on it
+func (r *GeofenceRepository) DismissSuggestion(id uint, organizationID uint) error {
+	_, err := resolveSuggestion(r.db, id, organizationID, "dismissed")
+	return err
+}
+
+// AcceptSuggestion resolves a pending suggestion and applies change to its
+// job in one transaction, so a refused status change leaves it pending
+func (r *GeofenceRepository) AcceptSuggestion(id uint, organizationID uint, change models.StatusChange) (*models.JobStatusUpdate, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	jobID, err := resolveSuggestion(tx, id, organizationID, "accepted")
+	if err != nil {
+		return nil, err
+	}
+	update, err := changeStatus(tx, jobID, organizationID, change)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return update, nil
+}
+
+// resolveSuggestion marks an unresolved suggestion resolved and returns its
+// job. Events that were applied or only recorded are not suggestions and are
+// never resolved.
+func resolveSuggestion(q querier, id uint, organizationID uint, resolution string) (uint, error) {
+	var jobID uint
+	err := q.QueryRow(`
+		UPDATE job_geofence_events
+		SET resolution = $1, resolved_at = $2
+		WHERE id = $3 AND organization_id = $4 AND outcome = $5 AND resolved_at IS NULL
+		RETURNING job_id
+	`, resolution, time.Now(), id, organizationID, models.GeofenceOutcomeSuggested).Scan(&jobID)
+	if err == sql.ErrNoRows {
+		return 0, fmt.Errorf("geofence event not found")
+	}
+	return jobID, err
+}
+
+func (r *GeofenceRepository) queryEvents(query string, args ...interface{}) ([]*models.GeofenceEvent, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []*models.GeofenceEvent{}
+	for rows.Next() {
+		e := &models.GeofenceEvent{}
+		var fromStatus, toStatus, resolution sql.NullString
+		var resolvedAt sql.NullTime
+		var lat, lng, distance sql.NullFloat64
+
+		err := rows.Scan(
+			&e.ID, &e.OrganizationID, &e.JobID, &e.WorkerID, &e.Rule, &e.EventType,
+			&fromStatus, &toStatus, &e.Outcome, &e.Detail, &lat, &lng, &distance,
+			&e.OccurredAt, &resolution, &resolvedAt, &e.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if fromStatus.Valid {
+			s := models.JobStatus(fromStatus.String)
+			e.FromStatus = &s
+		}
+		if toStatus.Valid {
+			s := models.JobStatus(toStatus.String)
+			e.ToStatus = &s
+		}
+		if resolution.Valid {
+			e.Resolution = &resolution.String
+		}
+		if resolvedAt.Valid {
+			e.ResolvedAt = &resolvedAt.Time
+		}
+		e.Latitude = lat.Float64
+		e.Longitude = lng.Float64
+		e.DistanceMeters = distance.Float64
+
+		events = append(events, e)
+	}
+
+	return events, rows.Err()
+}
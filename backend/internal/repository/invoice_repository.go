@@ -0,0 +1,640 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/ireuven89/routewise/internal/models"
+	"github.com/shopspring/decimal"
+)
+
+type InvoiceRepository struct {
+	db *sql.DB
+}
+
+func NewInvoiceRepository(db *sql.DB) *InvoiceRepository {
+	return &InvoiceRepository{db: db}
+}
+
+const invoiceColumns = `
+	id, organization_id, customer_id, job_id, number, status, COALESCE(notes, ''), payment_terms_days,
+	issued_at, due_date, subtotal, discount_total, tax_total, total, amount_paid,
+	paid_at, voided_at, COALESCE(void_reason, ''), created_by, created_at, updated_at
+`
+
+// CreateFromJob drafts an invoice for a completed job: the job price as a
+// labor line plus one line per part used. A job with an open invoice gets
+// models.ErrInvoiceExists.
+func (r *InvoiceRepository) CreateFromJob(jobID uint, organizationID uint, createdBy *uint, termsDays int) (*models.Invoice, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var customerID uint
+	var title string
+	var status models.JobStatus
+	var price decimal.NullDecimal
+	err = tx.QueryRow(
+		`SELECT customer_id, title, status, price FROM jobs WHERE id = $1 AND organization_id = $2 FOR UPDATE`,
+		jobID, organizationID,
+	).Scan(&customerID, &title, &status, &price)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("job not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if status != models.StatusCompleted {
+		return nil, models.ErrJobNotBillable
+	}
+
+	inv := &models.Invoice{
+		OrganizationID:   organizationID,
+		CustomerID:       customerID,
+		JobID:            &jobID,
+		Status:           models.InvoiceDraft,
+		PaymentTermsDays: termsDays,
+		CreatedBy:        createdBy,
+		LineItems:        []*models.InvoiceLineItem{},
+	}
+
+	if price.Valid && price.Decimal.IsPositive() {
+		inv.LineItems = append(inv.LineItems, &models.InvoiceLineItem{
+			Kind:        models.LineLabor,
+			Description: title,
+			LinePricing: models.LinePricing{Quantity: decimal.NewFromInt(1), UnitPrice: price.Decimal},
+		})
+	}
+
+	rows, err := tx.Query(`
+		SELECT part_name, COALESCE(description, ''), quantity, price
+		FROM job_parts
+		WHERE job_id = $1
+		ORDER BY created_at, id
+	`, jobID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var name, description string
+		line := &models.InvoiceLineItem{Kind: models.LinePart}
+		if err := rows.Scan(&name, &description, &line.Quantity, &line.UnitPrice); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		line.Description = name
+		if description != "" {
+			line.Description += " - " + description
+		}
+		inv.LineItems = append(inv.LineItems, line)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	inv.ComputeTotals()
+
+	now := time.Now()
+	err = tx.QueryRow(`
+		INSERT INTO invoices (
+			organization_id, customer_id, job_id, status, payment_terms_days,
+			subtotal, discount_total, tax_total, total, created_by, created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $11)
+		ON CONFLICT (job_id) WHERE status <> 'void' DO NOTHING
+		RETURNING id
+	`,
+		inv.OrganizationID, inv.CustomerID, inv.JobID, inv.Status, inv.PaymentTermsDays,
+		inv.Subtotal, inv.DiscountTotal, inv.TaxTotal, inv.Total, inv.CreatedBy, now,
+	).Scan(&inv.ID)
+	if err == sql.ErrNoRows {
+		return nil, models.ErrInvoiceExists
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := insertInvoiceLines(tx, inv); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	inv.CreatedAt = now
+	inv.UpdatedAt = now
+	return inv, nil
+}
+
+// FindUninvoicedJobs returns jobs completed since the given time that have
+// never had an invoice, oldest first. A job whose invoice was voided is not
+// returned; the office decides whether to bill it again.
+func (r *InvoiceRepository) FindUninvoicedJobs(completedSince time.Time, limit int) ([]*models.Job, error) {
+	rows, err := r.db.Query(`
+		SELECT j.id, j.organization_id
+		FROM jobs j
+		WHERE j.status = $1 AND j.completed_at >= $2
+		  AND NOT EXISTS (SELECT 1 FROM invoices i WHERE i.job_id = j.id)
+		ORDER BY j.completed_at
+		LIMIT $3
+	`, models.StatusCompleted, completedSince, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []*models.Job
+	for rows.Next() {
+		job := &models.Job{}
+		if err := rows.Scan(&job.ID, &job.OrganizationID); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// FindByID returns the invoice with its line items and payments
+func (r *InvoiceRepository) FindByID(id uint, organizationID uint) (*models.Invoice, error) {
+	inv, err := scanInvoice(r.db.QueryRow(`
+		SELECT `+invoiceColumns+`
+		FROM invoices
+		WHERE id = $1 AND organization_id = $2
+	`, id, organizationID))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("invoice not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if inv.LineItems, err = r.findLines(inv.ID); err != nil {
+		return nil, err
+	}
+	if inv.Payments, err = r.findPayments(inv.ID); err != nil {
+		return nil, err
+	}
+
+	return inv, nil
+}
+
+// FindAll lists invoices without lines or payments. Supported filters are
+// "status" (including the derived "overdue"), "customer_id" and "job_id".
+func (r *InvoiceRepository) FindAll(organizationID uint, filters map[string]interface{}) ([]*models.Invoice, error) {
+	query := `
+		SELECT ` + invoiceColumns + `
+		FROM invoices
+		WHERE organization_id = $1
+	`
+	args := []interface{}{organizationID}
+
+	if status, ok := filters["status"]; ok {
+		if status == models.InvoiceOverdue {
+			args = append(args, models.InvoiceSent)
+			query += fmt.Sprintf(" AND status = $%d AND due_date < CURRENT_DATE", len(args))
+		} else {
+			args = append(args, status)
+			query += fmt.Sprintf(" AND status = $%d", len(args))
+		}
+	}
+	if customerID, ok := filters["customer_id"]; ok {
+		args = append(args, customerID)
+		query += fmt.Sprintf(" AND customer_id = $%d", len(args))
+	}
+	if jobID, ok := filters["job_id"]; ok {
+		args = append(args, jobID)
+		query += fmt.Sprintf(" AND job_id = $%d", len(args))
+	}
+	query += " ORDER BY created_at DESC, id DESC"
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invoices := []*models.Invoice{}
+	for rows.Next() {
+		inv, err := scanInvoice(rows)
+		if err != nil {
+			return nil, err
+		}
+		invoices = append(invoices, inv)
+	}
+
+	return invoices, rows.Err()
+}
+
+// Update saves a draft invoice and replaces its line items
+func (r *InvoiceRepository) Update(inv *models.Invoice) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	result, err := tx.Exec(`
+		UPDATE invoices
+		SET notes = $1, payment_terms_days = $2, due_date = $3,
+		    subtotal = $4, discount_total = $5, tax_total = $6, total = $7, updated_at = $8
+		WHERE id = $9 AND organization_id = $10 AND status = $11
+	`,
+		nullIfEmpty(inv.Notes), inv.PaymentTermsDays, dateOrNil(inv.DueDate),
+		inv.Subtotal, inv.DiscountTotal, inv.TaxTotal, inv.Total, now,
+		inv.ID, inv.OrganizationID, models.InvoiceDraft,
+	)
+	if err := rowChanged(tx, result, err, "invoices", "invoice", inv.ID, inv.OrganizationID, models.ErrInvoiceNotEditable); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM invoice_line_items WHERE invoice_id = $1`, inv.ID); err != nil {
+		return err
+	}
+	if err := insertInvoiceLines(tx, inv); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	inv.UpdatedAt = now
+	return nil
+}
+
+// Delete removes a draft. Sent invoices have a number and can only be voided.
+func (r *InvoiceRepository) Delete(id uint, organizationID uint) error {
+	result, err := r.db.Exec(`
+		DELETE FROM invoices WHERE id = $1 AND organization_id = $2 AND status = $3
+	`, id, organizationID, models.InvoiceDraft)
+	return rowChanged(r.db, result, err, "invoices", "invoice", id, organizationID, models.ErrInvoiceNotEditable)
+}
+
+// Send issues a draft: it takes the next invoice number and fixes the due
+// date from the payment terms unless one was set. A draft totalling zero
+// could never be paid, so it is refused with models.ErrInvoiceEmpty.
+func (r *InvoiceRepository) Send(id uint, organizationID uint, at time.Time) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var status string
+	var termsDays int
+	var dueDate sql.NullTime
+	var total decimal.Decimal
+	err = tx.QueryRow(
+		`SELECT status, payment_terms_days, due_date, total FROM invoices WHERE id = $1 AND organization_id = $2 FOR UPDATE`,
+		id, organizationID,
+	).Scan(&status, &termsDays, &dueDate, &total)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("invoice not found")
+	}
+	if err != nil {
+		return err
+	}
+	if status != models.InvoiceDraft {
+		return models.ErrInvoiceNotEditable
+	}
+	if !total.IsPositive() {
+		return models.ErrInvoiceEmpty
+	}
+
+	number, err := nextDocumentNumber(tx, organizationID, "invoice")
+	if err != nil {
+		return err
+	}
+
+	due := dueDate.Time
+	if !dueDate.Valid {
+		due = at.AddDate(0, 0, termsDays)
+	}
+
+	_, err = tx.Exec(`
+		UPDATE invoices
+		SET status = $1, number = $2, issued_at = $3, due_date = $4, updated_at = $3
+		WHERE id = $5
+	`, models.InvoiceSent, number, at, due.Format("2006-01-02"), id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Void cancels an unpaid invoice. The row and its number are kept.
+func (r *InvoiceRepository) Void(id uint, organizationID uint, reason string, at time.Time) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	status, amountPaid, err := lockInvoice(tx, id, organizationID)
+	if err != nil {
+		return err
+	}
+	switch {
+	case status == models.InvoiceVoid:
+		return models.ErrInvoiceVoid
+	case amountPaid.IsPositive():
+		return models.ErrInvoiceHasPayments
+	}
+
+	_, err = tx.Exec(`
+		UPDATE invoices SET status = $1, voided_at = $2, void_reason = $3, updated_at = $2 WHERE id = $4
+	`, models.InvoiceVoid, at, nullIfEmpty(reason), id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// AddPayment records a payment against a sent invoice. Paying off the
+// balance marks the invoice paid.
+func (r *InvoiceRepository) AddPayment(payment *models.InvoicePayment, organizationID uint) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var status string
+	var total, amountPaid decimal.Decimal
+	err = tx.QueryRow(
+		`SELECT status, total, amount_paid FROM invoices WHERE id = $1 AND organization_id = $2 FOR UPDATE`,
+		payment.InvoiceID, organizationID,
+	).Scan(&status, &total, &amountPaid)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("invoice not found")
+	}
+	if err != nil {
+		return err
+	}
+	switch status {
+	case models.InvoiceSent:
+	case models.InvoiceVoid:
+		return models.ErrInvoiceVoid
+	default:
+		return models.ErrInvoiceNotOpen
+	}
+
+	paid := amountPaid.Add(payment.Amount)
+	if paid.GreaterThan(total) {
+		return models.ErrOverpayment
+	}
+
+	now := time.Now()
+	err = tx.QueryRow(`
+		INSERT INTO invoice_payments (invoice_id, amount, method, reference, paid_at, notes, recorded_by, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id
+	`, payment.InvoiceID, payment.Amount, payment.Method, nullIfEmpty(payment.Reference), payment.PaidAt,
+		nullIfEmpty(payment.Notes), payment.RecordedBy, now).Scan(&payment.ID)
+	if err != nil {
+		return err
+	}
+
+	newStatus := models.InvoiceSent
+	var paidAt interface{}
+	if paid.Equal(total) {
+		newStatus = models.InvoicePaid
+		paidAt = payment.PaidAt
+	}
+	_, err = tx.Exec(`
+		UPDATE invoices SET amount_paid = $1, status = $2, paid_at = $3, updated_at = $4 WHERE id = $5
+	`, paid, newStatus, paidAt, now, payment.InvoiceID)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	payment.CreatedAt = now
+	return nil
+}
+
+// DeletePayment removes a payment recorded by mistake and reopens the invoice
+func (r *InvoiceRepository) DeletePayment(paymentID, invoiceID uint, organizationID uint) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	status, amountPaid, err := lockInvoice(tx, invoiceID, organizationID)
+	if err != nil {
+		return err
+	}
+	if status == models.InvoiceVoid {
+		return models.ErrInvoiceVoid
+	}
+
+	var amount decimal.Decimal
+	err = tx.QueryRow(
+		`DELETE FROM invoice_payments WHERE id = $1 AND invoice_id = $2 RETURNING amount`, paymentID, invoiceID,
+	).Scan(&amount)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("payment not found")
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE invoices SET amount_paid = $1, status = $2, paid_at = NULL, updated_at = $3 WHERE id = $4
+	`, amountPaid.Sub(amount), models.InvoiceSent, time.Now(), invoiceID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// FindOpenAsOf returns invoices with a balance at the end of the given day:
+// issued by then, less the payments made by then
+func (r *InvoiceRepository) FindOpenAsOf(organizationID uint, asOf time.Time) ([]*models.OpenInvoice, error) {
+	end := time.Date(asOf.Year(), asOf.Month(), asOf.Day(), 0, 0, 0, 0, time.UTC).AddDate(0, 0, 1)
+
+	rows, err := r.db.Query(`
+		SELECT id, number, customer_id, customer_name, due_date, balance
+		FROM (
+			SELECT i.id, i.number, i.customer_id, c.name AS customer_name, i.due_date,
+			       i.total - COALESCE((
+			           SELECT SUM(p.amount) FROM invoice_payments p
+			           WHERE p.invoice_id = i.id AND p.paid_at < $2
+			       ), 0) AS balance
+			FROM invoices i
+			JOIN customers c ON c.id = i.customer_id
+			WHERE i.organization_id = $1 AND i.status IN ($3, $4) AND i.issued_at < $2
+		) open
+		WHERE balance > 0
+		ORDER BY customer_name, due_date
+	`, organizationID, end, models.InvoiceSent, models.InvoicePaid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invoices := []*models.OpenInvoice{}
+	for rows.Next() {
+		inv := &models.OpenInvoice{}
+		err := rows.Scan(&inv.InvoiceID, &inv.Number, &inv.CustomerID, &inv.CustomerName, &inv.DueDate, &inv.Balance)
+		if err != nil {
+			return nil, err
+		}
+		invoices = append(invoices, inv)
+	}
+
+	return invoices, rows.Err()
+}
+
+func (r *InvoiceRepository) findLines(invoiceID uint) ([]*models.InvoiceLineItem, error) {
+	rows, err := r.db.Query(`
+		SELECT id, invoice_id, position, kind, description, quantity, unit_price, discount_percent, tax_rate
+		FROM invoice_line_items
+		WHERE invoice_id = $1
+		ORDER BY position
+	`, invoiceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lines := []*models.InvoiceLineItem{}
+	for rows.Next() {
+		l := &models.InvoiceLineItem{}
+		err := rows.Scan(
+			&l.ID, &l.InvoiceID, &l.Position, &l.Kind, &l.Description,
+			&l.Quantity, &l.UnitPrice, &l.DiscountPercent, &l.TaxRate,
+		)
+		if err != nil {
+			return nil, err
+		}
+		l.Compute()
+		lines = append(lines, l)
+	}
+
+	return lines, rows.Err()
+}
+
+func (r *InvoiceRepository) findPayments(invoiceID uint) ([]*models.InvoicePayment, error) {
+	rows, err := r.db.Query(`
+		SELECT id, invoice_id, amount, method, COALESCE(reference, ''), paid_at, COALESCE(notes, ''), recorded_by, created_at
+		FROM invoice_payments
+		WHERE invoice_id = $1
+		ORDER BY paid_at, id
+	`, invoiceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	payments := []*models.InvoicePayment{}
+	for rows.Next() {
+		p := &models.InvoicePayment{}
+		var recordedBy sql.NullInt64
+		err := rows.Scan(&p.ID, &p.InvoiceID, &p.Amount, &p.Method, &p.Reference, &p.PaidAt, &p.Notes, &recordedBy, &p.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if recordedBy.Valid {
+			id := uint(recordedBy.Int64)
+			p.RecordedBy = &id
+		}
+		payments = append(payments, p)
+	}
+
+	return payments, rows.Err()
+}
+
+func insertInvoiceLines(q querier, inv *models.Invoice) error {
+	for _, l := range inv.LineItems {
+		l.InvoiceID = inv.ID
+		err := q.QueryRow(`
+			INSERT INTO invoice_line_items (
+				invoice_id, position, kind, description, quantity, unit_price, discount_percent, tax_rate, total
+			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+			RETURNING id
+		`, l.InvoiceID, l.Position, l.Kind, l.Description, l.Quantity, l.UnitPrice, l.DiscountPercent, l.TaxRate, l.Total).Scan(&l.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func lockInvoice(tx *sql.Tx, id uint, organizationID uint) (string, decimal.Decimal, error) {
+	var status string
+	var amountPaid decimal.Decimal
+	err := tx.QueryRow(
+		`SELECT status, amount_paid FROM invoices WHERE id = $1 AND organization_id = $2 FOR UPDATE`,
+		id, organizationID,
+	).Scan(&status, &amountPaid)
+	if err == sql.ErrNoRows {
+		return "", decimal.Zero, fmt.Errorf("invoice not found")
+	}
+	return status, amountPaid, err
+}
+
+func dateOrNil(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return t.Format("2006-01-02")
+}
+
+func scanInvoice(row rowScanner) (*models.Invoice, error) {
+	inv := &models.Invoice{}
+	var jobID, number, createdBy sql.NullInt64
+	var issuedAt, dueDate, paidAt, voidedAt sql.NullTime
+
+	err := row.Scan(
+		&inv.ID, &inv.OrganizationID, &inv.CustomerID, &jobID, &number, &inv.Status, &inv.Notes, &inv.PaymentTermsDays,
+		&issuedAt, &dueDate, &inv.Subtotal, &inv.DiscountTotal, &inv.TaxTotal, &inv.Total, &inv.AmountPaid,
+		&paidAt, &voidedAt, &inv.VoidReason, &createdBy, &inv.CreatedAt, &inv.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if jobID.Valid {
+		id := uint(jobID.Int64)
+		inv.JobID = &id
+	}
+	if number.Valid {
+		n := int(number.Int64)
+		inv.Number = &n
+	}
+	if issuedAt.Valid {
+		inv.IssuedAt = &issuedAt.Time
+	}
+	if dueDate.Valid {
+		inv.DueDate = &dueDate.Time
+	}
+	if paidAt.Valid {
+		inv.PaidAt = &paidAt.Time
+	}
+	if voidedAt.Valid {
+		inv.VoidedAt = &voidedAt.Time
+	}
+	if createdBy.Valid {
+		id := uint(createdBy.Int64)
+		inv.CreatedBy = &id
+	}
+	inv.Balance = inv.Total.Sub(inv.AmountPaid)
+	if inv.Status == models.InvoiceVoid {
+		inv.Balance = decimal.Zero
+	}
+
+	return inv, nil
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"fmt"
 	"github.com/ireuven89/routewise/internal/models"
+	"sort"
 	"time"
 )
 
@@ -15,15 +16,42 @@ func NewJobRepository(db *sql.DB) *JobRepository {
 	return &JobRepository{db: db}
 }
 
-func (r *JobRepository) Create(job *models.Job) error {
+// Create saves a new job. When it has a worker, check runs once the worker
+// is locked and its warnings are set on the job.
+func (r *JobRepository) Create(job *models.Job, check ScheduleCheck) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	warnings, err := checkWorker(tx, job.OrganizationID, job.TechnicianID, job.ScheduledAt, job.DurationMinutes, check)
+	if err != nil {
+		return err
+	}
+	if err := insertJob(tx, job); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	job.ScheduleWarnings = warnings
+	return nil
+}
+
+// insertJob is shared with the repositories that create jobs inside their own transaction
+func insertJob(q querier, job *models.Job) error {
 	query := `
-		INSERT INTO jobs (organization_id, created_by, customer_id, technician_id, title, description, status, scheduled_at, duration_minutes, price, metadata, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
-		RETURNING id
+		INSERT INTO jobs (organization_id, created_by, customer_id, technician_id, title, description, status, scheduled_at, duration_minutes, price, metadata, quote_id, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+		RETURNING id, version
 	`
 
+	// scheduled_at has no time zone, so every job time is stored in UTC
+	job.ScheduledAt = job.ScheduledAt.UTC()
 	now := time.Now()
-	err := r.db.QueryRow(
+	err := q.QueryRow(
 		query,
 		job.OrganizationID,
 		job.CreatedBy,
@@ -36,9 +64,10 @@ func (r *JobRepository) Create(job *models.Job) error {
 		job.DurationMinutes,
 		job.Price,
 		job.Metadata,
+		job.QuoteID,
 		now,
 		now,
-	).Scan(&job.ID)
+	).Scan(&job.ID, &job.Version)
 
 	if err != nil {
 		return err
@@ -52,14 +81,16 @@ func (r *JobRepository) Create(job *models.Job) error {
 func (r *JobRepository) FindByID(id uint, organizationID uint) (*models.Job, error) {
 	query := `
 		SELECT id, organization_id, created_by, customer_id, technician_id, title, description, status,
-		       scheduled_at, completed_at, duration_minutes, price, metadata, created_at, updated_at
+		       scheduled_at, completed_at, duration_minutes, price, metadata, created_at, updated_at,
+		       COALESCE((SELECT SUM(p.quantity * p.price) FROM job_parts p WHERE p.job_id = jobs.id), 0),
+		       template_id, occurrence_at, is_exception, version, quote_id
 		FROM jobs
 		WHERE id = $1 AND organization_id = $2
 	`
 
 	job := &models.Job{}
-	var technicianID, createdBy sql.NullInt64
-	var completedAt sql.NullTime
+	var technicianID, createdBy, templateID, quoteID sql.NullInt64
+	var completedAt, occurrenceAt sql.NullTime
 	var price sql.NullFloat64
 	var metadata sql.NullString
 
@@ -79,6 +110,12 @@ func (r *JobRepository) FindByID(id uint, organizationID uint) (*models.Job, err
 		&metadata,
 		&job.CreatedAt,
 		&job.UpdatedAt,
+		&job.PartsTotal,
+		&templateID,
+		&occurrenceAt,
+		&job.IsException,
+		&job.Version,
+		&quoteID,
 	)
 
 	if err == sql.ErrNoRows {
@@ -103,6 +140,21 @@ func (r *JobRepository) FindByID(id uint, organizationID uint) (*models.Job, err
 	if price.Valid {
 		job.Price = &price.Float64
 	}
+	if templateID.Valid {
+		tid := uint(templateID.Int64)
+		job.TemplateID = &tid
+	}
+	if occurrenceAt.Valid {
+		job.OccurrenceAt = &occurrenceAt.Time
+	}
+	if quoteID.Valid {
+		qid := uint(quoteID.Int64)
+		job.QuoteID = &qid
+	}
+	job.TotalPrice = job.PartsTotal
+	if job.Price != nil {
+		job.TotalPrice += *job.Price
+	}
 
 	return job, nil
 }
@@ -110,7 +162,9 @@ func (r *JobRepository) FindByID(id uint, organizationID uint) (*models.Job, err
 func (r *JobRepository) FindAll(organizationID uint, filters map[string]interface{}, sortBy string) ([]*models.Job, error) {
 	query := `
 		SELECT id, organization_id, created_by, customer_id, technician_id, title, description, status,
-		       scheduled_at, completed_at, duration_minutes, price, metadata, created_at, updated_at
+		       scheduled_at, completed_at, duration_minutes, price, metadata, created_at, updated_at,
+		       COALESCE((SELECT SUM(p.quantity * p.price) FROM job_parts p WHERE p.job_id = jobs.id), 0),
+		       template_id, occurrence_at, is_exception, version, quote_id
 		FROM jobs
 		WHERE organization_id = $1
 	`
@@ -131,12 +185,43 @@ func (r *JobRepository) FindAll(organizationID uint, filters map[string]interfac
 		args = append(args, techID)
 	}
 
+	// Matches the lead technician or any active crew member
+	if crewWorkerID, ok := filters["crew_worker_id"]; ok {
+		paramCount++
+		query += fmt.Sprintf(` AND (technician_id = $%d OR EXISTS (
+			SELECT 1 FROM project_assignments pa
+			WHERE pa.project_id = jobs.id AND pa.worker_id = $%d AND pa.removed_at IS NULL))`, paramCount, paramCount)
+		args = append(args, crewWorkerID)
+	}
+
+	if unassigned, ok := filters["unassigned"]; ok && unassigned == true {
+		query += " AND technician_id IS NULL"
+	}
+
 	if date, ok := filters["scheduled_date"]; ok {
 		paramCount++
 		query += fmt.Sprintf(" AND DATE(scheduled_at) = $%d", paramCount)
 		args = append(args, date)
 	}
 
+	if from, ok := filters["scheduled_from"]; ok {
+		paramCount++
+		query += fmt.Sprintf(" AND scheduled_at >= $%d", paramCount)
+		args = append(args, from)
+	}
+
+	if to, ok := filters["scheduled_to"]; ok {
+		paramCount++
+		query += fmt.Sprintf(" AND scheduled_at < $%d", paramCount)
+		args = append(args, to)
+	}
+
+	if excluded, ok := filters["exclude_status"]; ok {
+		paramCount++
+		query += fmt.Sprintf(" AND status <> $%d", paramCount)
+		args = append(args, excluded)
+	}
+
 	// Add sorting
 	switch sortBy {
 	case "scheduled_at":
@@ -157,8 +242,8 @@ func (r *JobRepository) FindAll(organizationID uint, filters map[string]interfac
 
 	for rows.Next() {
 		job := &models.Job{}
-		var technicianID, createdBy sql.NullInt64
-		var completedAt sql.NullTime
+		var technicianID, createdBy, templateID, quoteID sql.NullInt64
+		var completedAt, occurrenceAt sql.NullTime
 		var price sql.NullFloat64
 		var metadata sql.NullString
 
@@ -178,6 +263,12 @@ func (r *JobRepository) FindAll(organizationID uint, filters map[string]interfac
 			&metadata,
 			&job.CreatedAt,
 			&job.UpdatedAt,
+			&job.PartsTotal,
+			&templateID,
+			&occurrenceAt,
+			&job.IsException,
+			&job.Version,
+			&quoteID,
 		)
 
 		if err != nil {
@@ -199,6 +290,21 @@ func (r *JobRepository) FindAll(organizationID uint, filters map[string]interfac
 		if price.Valid {
 			job.Price = &price.Float64
 		}
+		if templateID.Valid {
+			tid := uint(templateID.Int64)
+			job.TemplateID = &tid
+		}
+		if occurrenceAt.Valid {
+			job.OccurrenceAt = &occurrenceAt.Time
+		}
+		if quoteID.Valid {
+			qid := uint(quoteID.Int64)
+			job.QuoteID = &qid
+		}
+		job.TotalPrice = job.PartsTotal
+		if job.Price != nil {
+			job.TotalPrice += *job.Price
+		}
 
 		jobs = append(jobs, job)
 	}
@@ -206,134 +312,504 @@ func (r *JobRepository) FindAll(organizationID uint, filters map[string]interfac
 	return jobs, nil
 }
 
-func (r *JobRepository) Update(job *models.Job) error {
+// Update saves the job's fields and, when change is set, moves it to a new
+// status in the same transaction, so a refused status change leaves the job
+// as it was. The status update is returned when there is one. job.Version
+// must be the version the edit was made against, otherwise models.ErrStaleJob
+// is returned. check, when set, runs for the job's worker and new slot once
+// both are locked.
+func (r *JobRepository) Update(job *models.Job, change *models.StatusChange, check ScheduleCheck) (*models.JobStatusUpdate, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	locked, err := lockJob(tx, job.ID, job.OrganizationID)
+	if err != nil {
+		return nil, err
+	}
+	if locked.Version != job.Version {
+		return nil, models.ErrStaleJob
+	}
+	if check != nil {
+		if job.ScheduleWarnings, err = checkWorker(tx, job.OrganizationID, locked.TechnicianID, job.ScheduledAt, job.DurationMinutes, check); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := updateJob(tx, job); err != nil {
+		return nil, err
+	}
+
+	var update *models.JobStatusUpdate
+	if change != nil {
+		if update, err = changeStatus(tx, job.ID, job.OrganizationID, *change); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	if update != nil {
+		job.Status = update.NewStatus
+		job.Version++
+	}
+	return update, nil
+}
+
+func updateJob(q querier, job *models.Job) error {
 	query := `
 		UPDATE jobs
 		SET title = $1, description = $2, scheduled_at = $3, duration_minutes = $4,
-		    price = $5, status = $6, metadata = $7, updated_at = $8
+		    price = $5, metadata = $6, is_exception = $7, version = version + 1, updated_at = $8
 		WHERE id = $9 AND organization_id = $10
+		RETURNING version
 	`
 
-	result, err := r.db.Exec(
+	// Status is deliberately not written here; it only changes through changeStatus
+	job.ScheduledAt = job.ScheduledAt.UTC()
+	err := q.QueryRow(
 		query,
 		job.Title,
 		job.Description,
 		job.ScheduledAt,
 		job.DurationMinutes,
 		job.Price,
-		job.Status,
 		job.Metadata,
+		job.IsException,
 		time.Now(),
 		job.ID,
 		job.OrganizationID,
-	)
+	).Scan(&job.Version)
+
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("job not found")
+	}
+
+	return err
+}
 
+// AssignTechnician gives the job to a worker, or unassigns it when
+// technicianID is nil. The stored version must equal expectedVersion,
+// otherwise models.ErrStaleJob is returned. check runs for the job's slot
+// once the job and the worker are locked; its warnings are returned.
+func (r *JobRepository) AssignTechnician(jobID uint, organizationID uint, technicianID *uint, expectedVersion int, check ScheduleCheck) ([]models.ScheduleConflict, error) {
+	tx, err := r.db.Begin()
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer tx.Rollback()
 
-	rows, err := result.RowsAffected()
+	warnings, err := assignTechnician(tx, jobID, organizationID, technicianID, expectedVersion, check)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if rows == 0 {
-		return fmt.Errorf("job not found")
+	return warnings, tx.Commit()
+}
+
+// AssignAll saves every assignment or none. Any job no longer at its
+// expected version fails the whole batch with models.ErrStaleJob. All jobs
+// and then all workers are locked in id order first, so batches that share
+// jobs or workers cannot deadlock. check, when set, gives the conflict check
+// for each job; it sees the assignments made before it in the batch, and
+// its warnings are returned by job id.
+func (r *JobRepository) AssignAll(organizationID uint, assignments []models.JobAssignment, check func(jobID uint) ScheduleCheck) (map[uint][]models.ScheduleConflict, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	sorted := append([]models.JobAssignment(nil), assignments...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].JobID < sorted[j].JobID })
+	seen := make(map[uint]bool)
+	var workerIDs []uint
+	for _, a := range sorted {
+		if _, err := lockJob(tx, a.JobID, organizationID); err != nil {
+			return nil, err
+		}
+		if !seen[a.WorkerID] {
+			seen[a.WorkerID] = true
+			workerIDs = append(workerIDs, a.WorkerID)
+		}
+	}
+	sort.Slice(workerIDs, func(i, j int) bool { return workerIDs[i] < workerIDs[j] })
+	for _, workerID := range workerIDs {
+		if err := lockWorker(tx, workerID, organizationID); err != nil {
+			return nil, err
+		}
 	}
 
-	return nil
+	warnings := make(map[uint][]models.ScheduleConflict)
+	for _, a := range sorted {
+		var jobCheck ScheduleCheck
+		if check != nil {
+			jobCheck = check(a.JobID)
+		}
+		workerID := a.WorkerID
+		conflicts, err := assignTechnician(tx, a.JobID, organizationID, &workerID, a.ExpectedVersion, jobCheck)
+		if err != nil {
+			return nil, err
+		}
+		if len(conflicts) > 0 {
+			warnings[a.JobID] = conflicts
+		}
+	}
+
+	return warnings, tx.Commit()
 }
 
-func (r *JobRepository) AssignTechnician(jobID uint, organizationID uint, technicianID *uint) error {
-	query := `
+func assignTechnician(tx *sql.Tx, jobID uint, organizationID uint, technicianID *uint, expectedVersion int, check ScheduleCheck) ([]models.ScheduleConflict, error) {
+	job, err := lockJob(tx, jobID, organizationID)
+	if err != nil {
+		return nil, err
+	}
+	if job.Version != expectedVersion {
+		return nil, models.ErrStaleJob
+	}
+
+	warnings, err := checkWorker(tx, organizationID, technicianID, job.ScheduledAt, job.DurationMinutes, check)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`
 		UPDATE jobs
-		SET technician_id = $1, updated_at = $2
+		SET technician_id = $1, version = version + 1, updated_at = $2
 		WHERE id = $3 AND organization_id = $4
-	`
+	`, technicianID, time.Now(), jobID, organizationID)
+	if err != nil {
+		return nil, err
+	}
 
-	result, err := r.db.Exec(query, technicianID, time.Now(), jobID, organizationID)
+	return warnings, nil
+}
+
+// lockJob locks the job's row until tx ends and returns the fields that
+// writes check before changing it. Lock the job before any worker.
+func lockJob(tx *sql.Tx, jobID uint, organizationID uint) (*models.Job, error) {
+	job := &models.Job{ID: jobID, OrganizationID: organizationID}
+	var technicianID sql.NullInt64
+	err := tx.QueryRow(`
+		SELECT technician_id, status, scheduled_at, duration_minutes, version
+		FROM jobs
+		WHERE id = $1 AND organization_id = $2
+		FOR UPDATE
+	`, jobID, organizationID).Scan(&technicianID, &job.Status, &job.ScheduledAt, &job.DurationMinutes, &job.Version)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("job not found")
+	}
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	rows, err := result.RowsAffected()
+	if technicianID.Valid {
+		id := uint(technicianID.Int64)
+		job.TechnicianID = &id
+	}
+	return job, nil
+}
+
+// Move reschedules and reassigns a scheduled job in one transaction. The
+// stored version must equal move.ExpectedVersion, otherwise models.ErrStaleJob
+// is returned. check runs inside the transaction once the job and the target
+// worker are locked, so concurrent moves onto the same worker are checked one
+// after the other; its warnings are returned.
+func (r *JobRepository) Move(move *models.JobMove, check ScheduleCheck) ([]models.ScheduleConflict, error) {
+	tx, err := r.db.Begin()
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer tx.Rollback()
 
-	if rows == 0 {
-		return fmt.Errorf("job not found")
+	job, err := lockJob(tx, move.JobID, move.OrganizationID)
+	if err != nil {
+		return nil, err
+	}
+	if job.Version != move.ExpectedVersion {
+		return nil, models.ErrStaleJob
+	}
+	if job.Status != models.StatusScheduled {
+		return nil, models.ErrJobNotMovable
 	}
 
-	return nil
+	warnings, err := checkWorker(tx, move.OrganizationID, move.WorkerID, move.ScheduledAt, move.DurationMinutes, check)
+	if err != nil {
+		return nil, err
+	}
+
+	// A moved occurrence of a recurring job no longer follows its series
+	_, err = tx.Exec(`
+		UPDATE jobs
+		SET technician_id = $1, scheduled_at = $2, duration_minutes = $3,
+		    is_exception = (template_id IS NOT NULL), version = version + 1, updated_at = $4
+		WHERE id = $5 AND organization_id = $6
+	`, move.WorkerID, move.ScheduledAt.UTC(), move.DurationMinutes, time.Now(), move.JobID, move.OrganizationID)
+	if err != nil {
+		return nil, err
+	}
+
+	return warnings, tx.Commit()
+}
+
+// UpdateStatus moves a job to a new status. The change is validated against
+// models.JobStatusFlow and written to job_status_updates in one transaction.
+func (r *JobRepository) UpdateStatus(jobID uint, organizationID uint, change models.StatusChange) (*models.JobStatusUpdate, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	update, err := changeStatus(tx, jobID, organizationID, change)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return update, nil
 }
 
-func (r *JobRepository) UpdateStatus(jobID uint, organizationID uint, status models.JobStatus) error {
+// changeStatus moves the job through the state machine and records the
+// change in its history, within the caller's transaction
+func changeStatus(tx *sql.Tx, jobID uint, organizationID uint, change models.StatusChange) (*models.JobStatusUpdate, error) {
+	var current models.JobStatus
+	err := tx.QueryRow(
+		`SELECT status FROM jobs WHERE id = $1 AND organization_id = $2 FOR UPDATE`,
+		jobID, organizationID,
+	).Scan(&current)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("job not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := models.JobStatusFlow.Validate(current, change.To, change.Reopen); err != nil {
+		return nil, err
+	}
+
+	if change.To == models.StatusCompleted {
+		var missing bool
+		err := tx.QueryRow(`
+			SELECT COALESCE((SELECT require_signature FROM completion_settings WHERE organization_id = $1), false)
+			       AND NOT EXISTS (SELECT 1 FROM project_files WHERE project_id = $2 AND file_type = $3 AND deleted_at IS NULL)
+		`, organizationID, jobID, models.FileTypeSignature).Scan(&missing)
+		if err != nil {
+			return nil, err
+		}
+		if missing {
+			return nil, models.ErrSignatureRequired
+		}
+	}
+
+	now := time.Now()
 	query := `
 		UPDATE jobs
-		SET status = $1, updated_at = $2
+		SET status = $1, version = version + 1, updated_at = $2
 		WHERE id = $3 AND organization_id = $4
 	`
+	args := []interface{}{change.To, now, jobID, organizationID}
 
-	// If status is completed, also set completed_at
-	if status == models.StatusCompleted {
+	if change.To == models.StatusCompleted {
 		query = `
 			UPDATE jobs
-			SET status = $1, completed_at = $2, updated_at = $3
-			WHERE id = $4 AND organization_id = $5
+			SET status = $1, completed_at = $2, version = version + 1, updated_at = $2
+			WHERE id = $3 AND organization_id = $4
 		`
-		result, err := r.db.Exec(query, status, time.Now(), time.Now(), jobID, organizationID)
-		if err != nil {
-			return err
-		}
+	} else if current == models.StatusCompleted {
+		// Reopened jobs are no longer complete
+		query = `
+			UPDATE jobs
+			SET status = $1, completed_at = NULL, version = version + 1, updated_at = $2
+			WHERE id = $3 AND organization_id = $4
+		`
+	}
 
-		rows, err := result.RowsAffected()
-		if err != nil {
-			return err
-		}
+	if _, err := tx.Exec(query, args...); err != nil {
+		return nil, err
+	}
 
-		if rows == 0 {
-			return fmt.Errorf("job not found")
-		}
+	source := change.Source
+	if source == "" {
+		source = models.StatusSourceManual
+	}
 
-		return nil
+	update := &models.JobStatusUpdate{
+		JobID:           jobID,
+		OldStatus:       current,
+		NewStatus:       change.To,
+		ChangedByUser:   change.ChangedByUser,
+		ChangedByWorker: change.ChangedByWorker,
+		Source:          source,
+		Reason:          change.Reason,
+		CreatedAt:       now,
 	}
 
-	result, err := r.db.Exec(query, status, time.Now(), jobID, organizationID)
+	err = tx.QueryRow(`
+		INSERT INTO job_status_updates (job_id, old_status, new_status, changed_by_user, changed_by_worker, source, reason, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id
+	`,
+		jobID,
+		current,
+		change.To,
+		change.ChangedByUser,
+		change.ChangedByWorker,
+		source,
+		nullIfEmpty(change.Reason),
+		now,
+	).Scan(&update.ID)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	rows, err := result.RowsAffected()
+	return update, nil
+}
+
+// GetCompletionSettings returns the organization's completion policy, or
+// the default (no signature required) if none was saved
+func (r *JobRepository) GetCompletionSettings(organizationID uint) (*models.CompletionSettings, error) {
+	settings := &models.CompletionSettings{}
+	err := r.db.QueryRow(`
+		SELECT organization_id, require_signature, updated_at
+		FROM completion_settings
+		WHERE organization_id = $1
+	`, organizationID).Scan(&settings.OrganizationID, &settings.RequireSignature, &settings.UpdatedAt)
+
+	if err == sql.ErrNoRows {
+		return &models.CompletionSettings{OrganizationID: organizationID}, nil
+	}
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if rows == 0 {
-		return fmt.Errorf("job not found")
+	return settings, nil
+}
+
+func (r *JobRepository) SaveCompletionSettings(settings *models.CompletionSettings) error {
+	now := time.Now()
+	_, err := r.db.Exec(`
+		INSERT INTO completion_settings (organization_id, require_signature, updated_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (organization_id) DO UPDATE
+		SET require_signature = EXCLUDED.require_signature, updated_at = EXCLUDED.updated_at
+	`, settings.OrganizationID, settings.RequireSignature, now)
+	if err != nil {
+		return err
 	}
 
+	settings.UpdatedAt = now
 	return nil
 }
 
-func (r *JobRepository) Delete(id uint, organizationID uint) error {
-	query := `DELETE FROM jobs WHERE id = $1 AND organization_id = $2`
+// FindStatusHistory returns a job's status changes, oldest first
+func (r *JobRepository) FindStatusHistory(jobID uint, organizationID uint) ([]*models.JobStatusUpdate, error) {
+	query := `
+		SELECT u.id, u.job_id, u.old_status, u.new_status, u.changed_by_user, u.changed_by_worker,
+		       COALESCE(ou.name, w.name, ''), u.source, COALESCE(u.reason, ''), u.created_at
+		FROM job_status_updates u
+		JOIN jobs j ON j.id = u.job_id
+		LEFT JOIN organization_users ou ON ou.id = u.changed_by_user
+		LEFT JOIN workers w ON w.id = u.changed_by_worker
+		WHERE u.job_id = $1 AND j.organization_id = $2
+		ORDER BY u.created_at ASC, u.id ASC
+	`
 
-	result, err := r.db.Exec(query, id, organizationID)
+	rows, err := r.db.Query(query, jobID, organizationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := []*models.JobStatusUpdate{}
+
+	for rows.Next() {
+		u := &models.JobStatusUpdate{}
+		var oldStatus sql.NullString
+		var changedByUser, changedByWorker sql.NullInt64
+
+		err := rows.Scan(
+			&u.ID,
+			&u.JobID,
+			&oldStatus,
+			&u.NewStatus,
+			&changedByUser,
+			&changedByWorker,
+			&u.ChangedByName,
+			&u.Source,
+			&u.Reason,
+			&u.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		u.OldStatus = models.JobStatus(oldStatus.String)
+		if changedByUser.Valid {
+			id := uint(changedByUser.Int64)
+			u.ChangedByUser = &id
+		}
+		if changedByWorker.Valid {
+			id := uint(changedByWorker.Int64)
+			u.ChangedByWorker = &id
+		}
+
+		history = append(history, u)
+	}
+
+	return history, rows.Err()
+}
+
+// Delete removes the job. Its files go with it, so their storage usage is
+// released in the same transaction; the objects left in storage are removed
+// by the usage reconciler.
+func (r *JobRepository) Delete(id uint, organizationID uint) error {
+	tx, err := r.db.Begin()
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	rows, err := result.RowsAffected()
+	// Locking the job keeps new files from being added to it meanwhile
+	if _, err := lockJob(tx, id, organizationID); err != nil {
+		return err
+	}
+
+	var bytes int64
+	var files int
+	err = tx.QueryRow(`
+		SELECT COALESCE(SUM(size), 0), COUNT(*)
+		FROM (
+			SELECT file_size + renditions_size AS size
+			FROM project_files
+			WHERE project_id = $1
+			FOR UPDATE
+		) locked
+	`, id).Scan(&bytes, &files)
 	if err != nil {
 		return err
 	}
 
-	if rows == 0 {
-		return fmt.Errorf("job not found")
+	// Before the delete, as the charge finds the organization through the job
+	if files > 0 {
+		if err := chargeStorage(tx, id, -bytes, -files, false); err != nil {
+			return err
+		}
 	}
 
-	return nil
+	if _, err := tx.Exec(`DELETE FROM jobs WHERE id = $1 AND organization_id = $2`, id, organizationID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
 // Photo methods
@@ -409,41 +885,48 @@ func (r *JobRepository) GetPhotos(jobID uint, organizationID uint) ([]map[string
 }
 
 // Part methods
-func (r *JobRepository) AddPart(jobID uint, organizationID uint, name string, quantity int, price float64) error {
-	// First verify the job belongs to the organization
-	var exists bool
-	checkQuery := `SELECT EXISTS(SELECT 1 FROM jobs WHERE id = $1 AND organization_id = $2)`
-	err := r.db.QueryRow(checkQuery, jobID, organizationID).Scan(&exists)
-	if err != nil {
+func (r *JobRepository) AddPart(part *models.JobPart, organizationID uint) error {
+	if err := r.checkJobExists(part.JobID, organizationID); err != nil {
 		return err
 	}
-	if !exists {
-		return fmt.Errorf("job not found")
-	}
 
 	query := `
-		INSERT INTO job_parts (job_id, name, quantity, price, created_at)
-		VALUES ($1, $2, $3, $4, $5)
+		INSERT INTO job_parts (job_id, added_by_user, added_by_worker, part_name, description, quantity, price, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id
 	`
 
-	_, err = r.db.Exec(query, jobID, name, quantity, price, time.Now())
-	return err
+	now := time.Now()
+	err := r.db.QueryRow(
+		query,
+		part.JobID,
+		part.AddedByUser,
+		part.AddedByWorker,
+		part.PartName,
+		part.Description,
+		part.Quantity,
+		part.UnitPrice,
+		now,
+		now,
+	).Scan(&part.ID)
+	if err != nil {
+		return err
+	}
+
+	part.LineTotal = float64(part.Quantity) * part.UnitPrice
+	part.CreatedAt = now
+	part.UpdatedAt = now
+	return nil
 }
 
-func (r *JobRepository) GetParts(jobID uint, organizationID uint) ([]map[string]interface{}, error) {
-	// First verify the job belongs to the organization
-	var exists bool
-	checkQuery := `SELECT EXISTS(SELECT 1 FROM jobs WHERE id = $1 AND organization_id = $2)`
-	err := r.db.QueryRow(checkQuery, jobID, organizationID).Scan(&exists)
-	if err != nil {
+func (r *JobRepository) GetParts(jobID uint, organizationID uint) ([]*models.JobPart, error) {
+	if err := r.checkJobExists(jobID, organizationID); err != nil {
 		return nil, err
 	}
-	if !exists {
-		return nil, fmt.Errorf("job not found")
-	}
 
 	query := `
-		SELECT id, job_id, name, quantity, price, created_at
+		SELECT id, job_id, added_by_user, added_by_worker, part_name, COALESCE(description, ''),
+		       quantity, price, created_at, updated_at
 		FROM job_parts
 		WHERE job_id = $1
 		ORDER BY created_at DESC
@@ -455,70 +938,130 @@ func (r *JobRepository) GetParts(jobID uint, organizationID uint) ([]map[string]
 	}
 	defer rows.Close()
 
-	parts := []map[string]interface{}{}
-
+	parts := []*models.JobPart{}
 	for rows.Next() {
-		var id, jobID uint
-		var name string
-		var quantity int
-		var price float64
-		var createdAt time.Time
-
-		err := rows.Scan(&id, &jobID, &name, &quantity, &price, &createdAt)
+		part, err := scanPart(rows)
 		if err != nil {
 			return nil, err
 		}
-
-		part := map[string]interface{}{
-			"id":         id,
-			"job_id":     jobID,
-			"name":       name,
-			"quantity":   quantity,
-			"price":      price,
-			"created_at": createdAt,
-		}
 		parts = append(parts, part)
 	}
 
-	return parts, nil
+	return parts, rows.Err()
 }
 
-// Note methods
-func (r *JobRepository) AddNote(jobID uint, organizationID uint, createdBy uint, note string) error {
-	// First verify the job belongs to the organization
-	var exists bool
-	checkQuery := `SELECT EXISTS(SELECT 1 FROM jobs WHERE id = $1 AND organization_id = $2)`
-	err := r.db.QueryRow(checkQuery, jobID, organizationID).Scan(&exists)
+func (r *JobRepository) FindPart(partID uint, jobID uint, organizationID uint) (*models.JobPart, error) {
+	query := `
+		SELECT p.id, p.job_id, p.added_by_user, p.added_by_worker, p.part_name, COALESCE(p.description, ''),
+		       p.quantity, p.price, p.created_at, p.updated_at
+		FROM job_parts p
+		JOIN jobs j ON j.id = p.job_id
+		WHERE p.id = $1 AND p.job_id = $2 AND j.organization_id = $3
+	`
+
+	part, err := scanPart(r.db.QueryRow(query, partID, jobID, organizationID))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("part not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return part, nil
+}
+
+func (r *JobRepository) UpdatePart(part *models.JobPart, organizationID uint) error {
+	query := `
+		UPDATE job_parts p
+		SET part_name = $1, description = $2, quantity = $3, price = $4, updated_at = $5
+		FROM jobs j
+		WHERE p.id = $6 AND p.job_id = $7 AND j.id = p.job_id AND j.organization_id = $8
+	`
+
+	now := time.Now()
+	result, err := r.db.Exec(
+		query,
+		part.PartName,
+		part.Description,
+		part.Quantity,
+		part.UnitPrice,
+		now,
+		part.ID,
+		part.JobID,
+		organizationID,
+	)
 	if err != nil {
 		return err
 	}
-	if !exists {
-		return fmt.Errorf("job not found")
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
 	}
 
+	if rows == 0 {
+		return fmt.Errorf("part not found")
+	}
+
+	part.LineTotal = float64(part.Quantity) * part.UnitPrice
+	part.UpdatedAt = now
+	return nil
+}
+
+func (r *JobRepository) DeletePart(partID uint, jobID uint, organizationID uint) error {
 	query := `
-		INSERT INTO job_notes (job_id, created_by, note, created_at)
-		VALUES ($1, $2, $3, $4)
+		DELETE FROM job_parts p
+		USING jobs j
+		WHERE p.id = $1 AND p.job_id = $2 AND j.id = p.job_id AND j.organization_id = $3
 	`
 
-	_, err = r.db.Exec(query, jobID, createdBy, note, time.Now())
-	return err
+	result, err := r.db.Exec(query, partID, jobID, organizationID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return fmt.Errorf("part not found")
+	}
+
+	return nil
 }
 
-func (r *JobRepository) GetNotes(jobID uint, organizationID uint) ([]map[string]interface{}, error) {
-	// First verify the job belongs to the organization
-	var exists bool
-	checkQuery := `SELECT EXISTS(SELECT 1 FROM jobs WHERE id = $1 AND organization_id = $2)`
-	err := r.db.QueryRow(checkQuery, jobID, organizationID).Scan(&exists)
+// Note methods
+func (r *JobRepository) AddNote(note *models.JobNote, organizationID uint) error {
+	if err := r.checkJobExists(note.JobID, organizationID); err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO job_notes (job_id, created_by_user, created_by_worker, note, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id
+	`
+
+	now := time.Now()
+	err := r.db.QueryRow(query, note.JobID, note.CreatedByUser, note.CreatedByWorker, note.Note, now, now).Scan(&note.ID)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	if !exists {
-		return nil, fmt.Errorf("job not found")
+
+	note.CreatedAt = now
+	note.UpdatedAt = now
+	return nil
+}
+
+func (r *JobRepository) GetNotes(jobID uint, organizationID uint) ([]*models.JobNote, error) {
+	if err := r.checkJobExists(jobID, organizationID); err != nil {
+		return nil, err
 	}
 
 	query := `
-		SELECT id, job_id, created_by, note, created_at
+		SELECT id, job_id, created_by_user, created_by_worker, note, created_at, updated_at
 		FROM job_notes
 		WHERE job_id = $1
 		ORDER BY created_at DESC
@@ -530,27 +1073,170 @@ func (r *JobRepository) GetNotes(jobID uint, organizationID uint) ([]map[string]
 	}
 	defer rows.Close()
 
-	notes := []map[string]interface{}{}
-
+	notes := []*models.JobNote{}
 	for rows.Next() {
-		var id, jobID, createdBy uint
-		var note string
-		var createdAt time.Time
-
-		err := rows.Scan(&id, &jobID, &createdBy, &note, &createdAt)
+		note, err := scanNote(rows)
 		if err != nil {
 			return nil, err
 		}
+		notes = append(notes, note)
+	}
 
-		noteItem := map[string]interface{}{
-			"id":         id,
-			"job_id":     jobID,
-			"created_by": createdBy,
-			"note":       note,
-			"created_at": createdAt,
-		}
-		notes = append(notes, noteItem)
+	return notes, rows.Err()
+}
+
+func (r *JobRepository) FindNote(noteID uint, jobID uint, organizationID uint) (*models.JobNote, error) {
+	query := `
+		SELECT n.id, n.job_id, n.created_by_user, n.created_by_worker, n.note, n.created_at, n.updated_at
+		FROM job_notes n
+		JOIN jobs j ON j.id = n.job_id
+		WHERE n.id = $1 AND n.job_id = $2 AND j.organization_id = $3
+	`
+
+	note, err := scanNote(r.db.QueryRow(query, noteID, jobID, organizationID))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("note not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return note, nil
+}
+
+func (r *JobRepository) UpdateNote(note *models.JobNote, organizationID uint) error {
+	query := `
+		UPDATE job_notes n
+		SET note = $1, updated_at = $2
+		FROM jobs j
+		WHERE n.id = $3 AND n.job_id = $4 AND j.id = n.job_id AND j.organization_id = $5
+	`
+
+	now := time.Now()
+	result, err := r.db.Exec(query, note.Note, now, note.ID, note.JobID, organizationID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return fmt.Errorf("note not found")
 	}
 
-	return notes, nil
+	note.UpdatedAt = now
+	return nil
+}
+
+func (r *JobRepository) DeleteNote(noteID uint, jobID uint, organizationID uint) error {
+	query := `
+		DELETE FROM job_notes n
+		USING jobs j
+		WHERE n.id = $1 AND n.job_id = $2 AND j.id = n.job_id AND j.organization_id = $3
+	`
+
+	result, err := r.db.Exec(query, noteID, jobID, organizationID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return fmt.Errorf("note not found")
+	}
+
+	return nil
+}
+
+func (r *JobRepository) checkJobExists(jobID uint, organizationID uint) error {
+	var exists bool
+	checkQuery := `SELECT EXISTS(SELECT 1 FROM jobs WHERE id = $1 AND organization_id = $2)`
+	if err := r.db.QueryRow(checkQuery, jobID, organizationID).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("job not found")
+	}
+	return nil
+}
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanPart(row rowScanner) (*models.JobPart, error) {
+	part := &models.JobPart{}
+	var addedByUser, addedByWorker sql.NullInt64
+
+	err := row.Scan(
+		&part.ID,
+		&part.JobID,
+		&addedByUser,
+		&addedByWorker,
+		&part.PartName,
+		&part.Description,
+		&part.Quantity,
+		&part.UnitPrice,
+		&part.CreatedAt,
+		&part.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if addedByUser.Valid {
+		id := uint(addedByUser.Int64)
+		part.AddedByUser = &id
+	}
+	if addedByWorker.Valid {
+		id := uint(addedByWorker.Int64)
+		part.AddedByWorker = &id
+	}
+	part.LineTotal = float64(part.Quantity) * part.UnitPrice
+
+	return part, nil
+}
+
+func scanNote(row rowScanner) (*models.JobNote, error) {
+	note := &models.JobNote{}
+	var createdByUser, createdByWorker sql.NullInt64
+
+	err := row.Scan(
+		&note.ID,
+		&note.JobID,
+		&createdByUser,
+		&createdByWorker,
+		&note.Note,
+		&note.CreatedAt,
+		&note.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if createdByUser.Valid {
+		id := uint(createdByUser.Int64)
+		note.CreatedByUser = &id
+	}
+	if createdByWorker.Valid {
+		id := uint(createdByWorker.Int64)
+		note.CreatedByWorker = &id
+	}
+
+	return note, nil
+}
+
+func nullIfEmpty(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
 }
@@ -0,0 +1,133 @@
+package repository
+
+import (
+	"database/sql/driver"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ireuven89/routewise/internal/models"
+)
+
+// lockedJobResult answers lockJob with a scheduled, unassigned job at version 3
+func lockedJobResult(scheduledAt time.Time) fakeResult {
+	return fakeResult{
+		match:   "SELECT technician_id, status",
+		columns: []string{"technician_id", "status", "scheduled_at", "duration_minutes", "version"},
+		rows:    [][]driver.Value{{nil, string(models.StatusScheduled), scheduledAt, int64(60), int64(3)}},
+	}
+}
+
+// Job times are stored in a TIMESTAMP column, which keeps the wall clock and
+// drops the offset, while the conflict checks compare in UTC
+func TestJobWritesStoreUTC(t *testing.T) {
+	want := time.Date(2026, 3, 2, 7, 0, 0, 0, time.UTC)
+	zones := []*time.Location{
+		time.UTC,
+		time.FixedZone("UTC+2", 2*60*60),
+		time.FixedZone("UTC-5", -5*60*60),
+		time.FixedZone("UTC+5:30", 5*60*60+30*60),
+	}
+
+	// checkStored fails unless the bound value is want, in UTC
+	checkStored := func(t *testing.T, got driver.Value) {
+		t.Helper()
+		at, ok := got.(time.Time)
+		if !ok || !at.Equal(want) || at.Location() != time.UTC {
+			t.Errorf("scheduled_at bound as %v, want %v", got, want)
+		}
+	}
+
+	lockedJob := lockedJobResult(want)
+
+	for _, zone := range zones {
+		sent := want.In(zone)
+
+		t.Run("create "+zone.String(), func(t *testing.T) {
+			db, conn := newFakeDB(t, fakeResult{match: "RETURNING id, version", columns: []string{"id", "version"}, rows: [][]driver.Value{{int64(1), int64(1)}}})
+			job := &models.Job{OrganizationID: 1, Status: models.StatusScheduled, ScheduledAt: sent, DurationMinutes: 60}
+			if err := NewJobRepository(db).Create(job, nil); err != nil {
+				t.Fatalf("Create() error = %v", err)
+			}
+			checkStored(t, conn.argsOf(t, "INSERT INTO jobs")[7])
+			checkStored(t, job.ScheduledAt)
+		})
+
+		t.Run("update "+zone.String(), func(t *testing.T) {
+			db, conn := newFakeDB(t, lockedJob, fakeResult{match: "RETURNING version", columns: []string{"version"}, rows: [][]driver.Value{{int64(4)}}})
+			job := &models.Job{ID: 5, OrganizationID: 1, ScheduledAt: sent, DurationMinutes: 60, Version: 3}
+			if _, err := NewJobRepository(db).Update(job, nil, nil); err != nil {
+				t.Fatalf("Update() error = %v", err)
+			}
+			checkStored(t, conn.argsOf(t, "UPDATE jobs")[2])
+			checkStored(t, job.ScheduledAt)
+		})
+
+		t.Run("move "+zone.String(), func(t *testing.T) {
+			db, conn := newFakeDB(t, lockedJob)
+			move := &models.JobMove{JobID: 5, OrganizationID: 1, ScheduledAt: sent, DurationMinutes: 60, ExpectedVersion: 3}
+			if _, err := NewJobRepository(db).Move(move, nil); err != nil {
+				t.Fatalf("Move() error = %v", err)
+			}
+			checkStored(t, conn.argsOf(t, "UPDATE jobs")[1])
+		})
+	}
+}
+
+func TestDeleteReleasesStorage(t *testing.T) {
+	tests := []struct {
+		name        string
+		bytes       int64
+		files       int64
+		wantRelease bool
+	}{
+		{"job with files", 1500, 3, true},
+		{"job without files", 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, conn := newFakeDB(t,
+				lockedJobResult(time.Now()),
+				fakeResult{match: "SUM(size)", columns: []string{"sum", "count"}, rows: [][]driver.Value{{tt.bytes, tt.files}}},
+			)
+			if err := NewJobRepository(db).Delete(5, 1); err != nil {
+				t.Fatalf("Delete() error = %v", err)
+			}
+
+			var order []string
+			for _, call := range conn.calls {
+				switch {
+				case strings.Contains(call.query, "UPDATE storage_usage"):
+					order = append(order, "release")
+					if call.args[1] != -tt.bytes || call.args[2] != -tt.files {
+						t.Errorf("released %v bytes and %v files, want %d and %d", call.args[1], call.args[2], tt.bytes, tt.files)
+					}
+				case strings.Contains(call.query, "DELETE FROM jobs"):
+					order = append(order, "delete")
+				}
+			}
+
+			want := []string{"delete"}
+			if tt.wantRelease {
+				// The charge finds the organization through the job, so it goes first
+				want = []string{"release", "delete"}
+			}
+			if strings.Join(order, ",") != strings.Join(want, ",") {
+				t.Errorf("statements = %v, want %v", order, want)
+			}
+		})
+	}
+
+	t.Run("job not found", func(t *testing.T) {
+		db, conn := newFakeDB(t)
+		if err := NewJobRepository(db).Delete(5, 1); err == nil || err.Error() != "job not found" {
+			t.Fatalf("Delete() error = %v, want job not found", err)
+		}
+		for _, call := range conn.calls {
+			if strings.Contains(call.query, "DELETE FROM jobs") {
+				t.Errorf("job deleted after it was not found")
+			}
+		}
+	})
+}
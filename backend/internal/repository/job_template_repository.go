@@ -0,0 +1,411 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/ireuven89/routewise/internal/models"
+)
+
+type JobTemplateRepository struct {
+	db *sql.DB
+}
+
+func NewJobTemplateRepository(db *sql.DB) *JobTemplateRepository {
+	return &JobTemplateRepository{db: db}
+}
+
+const jobTemplateColumns = `
+	id, organization_id, created_by, customer_id, technician_id, title, COALESCE(description, ''),
+	duration_minutes, price, metadata, rrule, starts_at, timezone, generated_until, active,
+	parent_template_id, created_at, updated_at
+`
+
+func (r *JobTemplateRepository) Create(t *models.JobTemplate) error {
+	return createTemplate(r.db, t)
+}
+
+func createTemplate(q querier, t *models.JobTemplate) error {
+	now := time.Now()
+	err := q.QueryRow(`
+		INSERT INTO job_templates (
+			organization_id, created_by, customer_id, technician_id, title, description, duration_minutes,
+			price, metadata, rrule, starts_at, timezone, generated_until, active, parent_template_id,
+			created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)
+		RETURNING id
+	`,
+		t.OrganizationID, t.CreatedBy, t.CustomerID, t.TechnicianID, t.Title, t.Description, t.DurationMinutes,
+		t.Price, t.Metadata, t.RRule, t.StartsAt.UTC(), t.Timezone, utcOrNil(t.GeneratedUntil), t.Active, t.ParentTemplateID,
+		now, now,
+	).Scan(&t.ID)
+	if err != nil {
+		return err
+	}
+
+	t.CreatedAt = now
+	t.UpdatedAt = now
+	return nil
+}
+
+func (r *JobTemplateRepository) FindByID(id uint, organizationID uint) (*models.JobTemplate, error) {
+	templates, err := r.query(`
+		SELECT `+jobTemplateColumns+`
+		FROM job_templates
+		WHERE id = $1 AND organization_id = $2
+	`, id, organizationID)
+	if err != nil {
+		return nil, err
+	}
+	if len(templates) == 0 {
+		return nil, fmt.Errorf("job template not found")
+	}
+	return templates[0], nil
+}
+
+func (r *JobTemplateRepository) FindAll(organizationID uint, includeInactive bool) ([]*models.JobTemplate, error) {
+	query := `
+		SELECT ` + jobTemplateColumns + `
+		FROM job_templates
+		WHERE organization_id = $1
+	`
+	if !includeInactive {
+		query += " AND active"
+	}
+	query += " ORDER BY created_at DESC"
+
+	return r.query(query, organizationID)
+}
+
+// FindDue returns active templates, across all organizations, whose jobs
+// have not been generated up to horizon yet
+func (r *JobTemplateRepository) FindDue(horizon time.Time) ([]*models.JobTemplate, error) {
+	return r.query(`
+		SELECT `+jobTemplateColumns+`
+		FROM job_templates
+		WHERE active AND (generated_until IS NULL OR generated_until < $1)
+		ORDER BY id
+	`, horizon.UTC())
+}
+
+// Update saves the template itself; it does not touch generated jobs
+func (r *JobTemplateRepository) Update(t *models.JobTemplate) error {
+	return updateTemplate(r.db, t)
+}
+
+func updateTemplate(q querier, t *models.JobTemplate) error {
+	now := time.Now()
+	result, err := q.Exec(`
+		UPDATE job_templates
+		SET customer_id = $1, technician_id = $2, title = $3, description = $4, duration_minutes = $5,
+		    price = $6, metadata = $7, rrule = $8, starts_at = $9, timezone = $10, generated_until = $11,
+		    active = $12, updated_at = $13
+		WHERE id = $14 AND organization_id = $15
+	`,
+		t.CustomerID, t.TechnicianID, t.Title, t.Description, t.DurationMinutes,
+		t.Price, t.Metadata, t.RRule, t.StartsAt.UTC(), t.Timezone, utcOrNil(t.GeneratedUntil),
+		t.Active, now, t.ID, t.OrganizationID,
+	)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return fmt.Errorf("job template not found")
+	}
+
+	t.UpdatedAt = now
+	return nil
+}
+
+// Materialize creates a scheduled job for each occurrence and advances
+// generated_until. Occurrences that already have a job are skipped, so running
+// it twice over the same window is harmless. Returns the jobs created.
+func (r *JobTemplateRepository) Materialize(t *models.JobTemplate, occurrences []time.Time, generatedUntil time.Time) ([]*models.Job, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	var created []*models.Job
+	for _, occurrence := range occurrences {
+		at := occurrence.UTC()
+		job := &models.Job{
+			OrganizationID:  t.OrganizationID,
+			CreatedBy:       t.CreatedBy,
+			CustomerID:      t.CustomerID,
+			TechnicianID:    t.TechnicianID,
+			Title:           t.Title,
+			Description:     t.Description,
+			Status:          models.StatusScheduled,
+			ScheduledAt:     at,
+			DurationMinutes: t.DurationMinutes,
+			Price:           t.Price,
+			Metadata:        t.Metadata,
+			TemplateID:      &t.ID,
+			OccurrenceAt:    &at,
+			CreatedAt:       now,
+			UpdatedAt:       now,
+		}
+		err := tx.QueryRow(`
+			INSERT INTO jobs (
+				organization_id, created_by, customer_id, technician_id, title, description, status,
+				scheduled_at, duration_minutes, price, metadata, template_id, occurrence_at, created_at, updated_at
+			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+			ON CONFLICT (template_id, occurrence_at) WHERE template_id IS NOT NULL DO NOTHING
+			RETURNING id, version
+		`,
+			job.OrganizationID, job.CreatedBy, job.CustomerID, job.TechnicianID, job.Title, job.Description, job.Status,
+			at, job.DurationMinutes, job.Price, job.Metadata, t.ID, at, now, now,
+		).Scan(&job.ID, &job.Version)
+		if err == sql.ErrNoRows {
+			continue // already materialized
+		}
+		if err != nil {
+			return nil, err
+		}
+		created = append(created, job)
+	}
+
+	if _, err := tx.Exec(`UPDATE job_templates SET generated_until = $1 WHERE id = $2`, generatedUntil.UTC(), t.ID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	t.GeneratedUntil = &generatedUntil
+	return created, nil
+}
+
+// UpdateSeries saves the template and brings its scheduled, unedited
+// occurrences from the given time on in line with it, in one transaction.
+// When the schedule changed those occurrences are deleted so they can be
+// generated again from the new rule; otherwise the template's fields are
+// copied onto them. Returns how many occurrences were updated.
+func (r *JobTemplateRepository) UpdateSeries(t *models.JobTemplate, from time.Time, scheduleChanged bool) (int64, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if scheduleChanged {
+		if _, err := deleteFutureOccurrences(tx, t.ID, t.OrganizationID, from); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := updateTemplate(tx, t); err != nil {
+		return 0, err
+	}
+
+	updated, err := applyToFutureOccurrences(tx, t, from)
+	if err != nil {
+		return 0, err
+	}
+
+	return updated, tx.Commit()
+}
+
+// applyToFutureOccurrences copies the template's fields onto its scheduled
+// occurrences from the given time on. Occurrences edited on their own are
+// left alone.
+func applyToFutureOccurrences(q querier, t *models.JobTemplate, from time.Time) (int64, error) {
+	result, err := q.Exec(`
+		UPDATE jobs
+		SET customer_id = $1, technician_id = $2, title = $3, description = $4, duration_minutes = $5,
+		    price = $6, metadata = $7, version = version + 1, updated_at = $8
+		WHERE template_id = $9 AND organization_id = $10 AND occurrence_at >= $11
+		  AND status = $12 AND NOT is_exception
+	`,
+		t.CustomerID, t.TechnicianID, t.Title, t.Description, t.DurationMinutes,
+		t.Price, t.Metadata, time.Now(), t.ID, t.OrganizationID, from.UTC(), models.StatusScheduled,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// deleteFutureOccurrences removes scheduled, unedited occurrences from the
+// given time on
+func deleteFutureOccurrences(q querier, templateID uint, organizationID uint, from time.Time) (int64, error) {
+	result, err := q.Exec(`
+		DELETE FROM jobs
+		WHERE template_id = $1 AND organization_id = $2 AND occurrence_at >= $3
+		  AND status = $4 AND NOT is_exception
+	`, templateID, organizationID, from.UTC(), models.StatusScheduled)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// EndSeries stops a template at the given time: its rule is saved with the
+// new end, and scheduled occurrences from then on are deleted
+func (r *JobTemplateRepository) EndSeries(t *models.JobTemplate, from time.Time) (int64, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if err := updateTemplate(tx, t); err != nil {
+		return 0, err
+	}
+
+	deleted, err := deleteFutureOccurrences(tx, t.ID, t.OrganizationID, from)
+	if err != nil {
+		return 0, err
+	}
+
+	return deleted, tx.Commit()
+}
+
+// SplitSeries ends the old template before the pivot occurrence and moves the
+// pivot job and the unedited scheduled occurrences after it to next. Moved
+// occurrences are shifted by shift; the pivot job gets its own scheduled time
+// and, when change is set, its new status. next must be filled in but not
+// yet saved. pivotJob.Version must be the version the edit was made against,
+// otherwise models.ErrStaleJob is returned. check, when set, runs for the
+// pivot job's worker and new slot once both are locked.
+func (r *JobTemplateRepository) SplitSeries(old *models.JobTemplate, next *models.JobTemplate, pivotJob *models.Job, pivot time.Time, shift time.Duration, change *models.StatusChange, check ScheduleCheck) (int64, *models.JobStatusUpdate, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, nil, err
+	}
+	defer tx.Rollback()
+
+	locked, err := lockJob(tx, pivotJob.ID, pivotJob.OrganizationID)
+	if err != nil {
+		return 0, nil, err
+	}
+	if locked.Version != pivotJob.Version {
+		return 0, nil, models.ErrStaleJob
+	}
+	if check != nil {
+		if pivotJob.ScheduleWarnings, err = checkWorker(tx, pivotJob.OrganizationID, next.TechnicianID, pivotJob.ScheduledAt, pivotJob.DurationMinutes, check); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	if err := updateTemplate(tx, old); err != nil {
+		return 0, nil, err
+	}
+	if err := createTemplate(tx, next); err != nil {
+		return 0, nil, err
+	}
+
+	result, err := tx.Exec(`
+		UPDATE jobs
+		SET template_id = $1, customer_id = $2, technician_id = $3, title = $4, description = $5,
+		    duration_minutes = $6, price = $7, metadata = $8,
+		    scheduled_at = CASE WHEN id = $9 THEN $10 ELSE occurrence_at + make_interval(secs => $11) END,
+		    occurrence_at = occurrence_at + make_interval(secs => $11),
+		    is_exception = FALSE, version = version + 1, updated_at = $12
+		WHERE template_id = $13 AND organization_id = $14
+		  AND (id = $9 OR (occurrence_at >= $15 AND status = $16 AND NOT is_exception))
+	`,
+		next.ID, next.CustomerID, next.TechnicianID, next.Title, next.Description,
+		next.DurationMinutes, next.Price, next.Metadata,
+		pivotJob.ID, pivotJob.ScheduledAt.UTC(), shift.Seconds(), time.Now(),
+		old.ID, old.OrganizationID, pivot.UTC(), models.StatusScheduled,
+	)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	moved, err := result.RowsAffected()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var update *models.JobStatusUpdate
+	if change != nil {
+		if update, err = changeStatus(tx, pivotJob.ID, pivotJob.OrganizationID, *change); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, nil, err
+	}
+
+	pivotJob.Version++
+	if update != nil {
+		pivotJob.Status = update.NewStatus
+		pivotJob.Version++
+	}
+	return moved, update, nil
+}
+
+func (r *JobTemplateRepository) query(query string, args ...interface{}) ([]*models.JobTemplate, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	templates := []*models.JobTemplate{}
+	for rows.Next() {
+		t := &models.JobTemplate{}
+		var createdBy, technicianID, parentID sql.NullInt64
+		var price sql.NullFloat64
+		var generatedUntil sql.NullTime
+
+		err := rows.Scan(
+			&t.ID, &t.OrganizationID, &createdBy, &t.CustomerID, &technicianID, &t.Title, &t.Description,
+			&t.DurationMinutes, &price, &t.Metadata, &t.RRule, &t.StartsAt, &t.Timezone, &generatedUntil, &t.Active,
+			&parentID, &t.CreatedAt, &t.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if createdBy.Valid {
+			id := uint(createdBy.Int64)
+			t.CreatedBy = &id
+		}
+		if technicianID.Valid {
+			id := uint(technicianID.Int64)
+			t.TechnicianID = &id
+		}
+		if parentID.Valid {
+			id := uint(parentID.Int64)
+			t.ParentTemplateID = &id
+		}
+		if price.Valid {
+			t.Price = &price.Float64
+		}
+		if generatedUntil.Valid {
+			t.GeneratedUntil = &generatedUntil.Time
+		}
+
+		templates = append(templates, t)
+	}
+
+	return templates, rows.Err()
+}
+
+// querier is satisfied by both *sql.DB and *sql.Tx
+type querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+func utcOrNil(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return t.UTC()
+}
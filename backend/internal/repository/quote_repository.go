@@ -0,0 +1,426 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/ireuven89/routewise/internal/models"
+)
+
+type QuoteRepository struct {
+	db *sql.DB
+}
+
+func NewQuoteRepository(db *sql.DB) *QuoteRepository {
+	return &QuoteRepository{db: db}
+}
+
+const quoteColumns = `
+	id, organization_id, customer_id, number, title, COALESCE(notes, ''), status, valid_until,
+	subtotal, discount_total, tax_total, total, sent_at, responded_at,
+	COALESCE(responded_by_name, ''), COALESCE(decline_reason, ''), converted_at,
+	created_by, created_at, updated_at
+`
+
+// Create numbers the quote and saves it with its line items. Totals must
+// already be computed.
+func (r *QuoteRepository) Create(q *models.Quote) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	number, err := nextDocumentNumber(tx, q.OrganizationID, "quote")
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	err = tx.QueryRow(`
+		INSERT INTO quotes (
+			organization_id, customer_id, number, title, notes, status, valid_until,
+			subtotal, discount_total, tax_total, total, created_by, created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $13)
+		RETURNING id
+	`,
+		q.OrganizationID, q.CustomerID, number, q.Title, nullIfEmpty(q.Notes), q.Status, utcOrNil(q.ValidUntil),
+		q.Subtotal, q.DiscountTotal, q.TaxTotal, q.Total, q.CreatedBy, now,
+	).Scan(&q.ID)
+	if err != nil {
+		return err
+	}
+
+	if err := insertLineItems(tx, q); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	q.Number = number
+	q.CreatedAt = now
+	q.UpdatedAt = now
+	return nil
+}
+
+// FindByID returns the quote with its line items and the jobs created from it
+func (r *QuoteRepository) FindByID(id uint, organizationID uint) (*models.Quote, error) {
+	q, err := scanQuote(r.db.QueryRow(`
+		SELECT `+quoteColumns+`
+		FROM quotes
+		WHERE id = $1 AND organization_id = $2
+	`, id, organizationID))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("quote not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if q.LineItems, err = r.findLineItems(q.ID); err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.Query(`SELECT id FROM jobs WHERE quote_id = $1 ORDER BY scheduled_at, id`, q.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var jobID uint
+		if err := rows.Scan(&jobID); err != nil {
+			return nil, err
+		}
+		q.JobIDs = append(q.JobIDs, jobID)
+	}
+
+	return q, rows.Err()
+}
+
+// FindAll lists quotes without their line items. Supported filters are
+// "status" and "customer_id".
+func (r *QuoteRepository) FindAll(organizationID uint, filters map[string]interface{}) ([]*models.Quote, error) {
+	query := `
+		SELECT ` + quoteColumns + `
+		FROM quotes
+		WHERE organization_id = $1
+	`
+	args := []interface{}{organizationID}
+
+	if status, ok := filters["status"]; ok {
+		args = append(args, status)
+		query += fmt.Sprintf(" AND status = $%d", len(args))
+	}
+	if customerID, ok := filters["customer_id"]; ok {
+		args = append(args, customerID)
+		query += fmt.Sprintf(" AND customer_id = $%d", len(args))
+	}
+	query += " ORDER BY number DESC"
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	quotes := []*models.Quote{}
+	for rows.Next() {
+		q, err := scanQuote(rows)
+		if err != nil {
+			return nil, err
+		}
+		quotes = append(quotes, q)
+	}
+
+	return quotes, rows.Err()
+}
+
+// Update saves a draft quote and replaces its line items
+func (r *QuoteRepository) Update(q *models.Quote) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	result, err := tx.Exec(`
+		UPDATE quotes
+		SET customer_id = $1, title = $2, notes = $3, valid_until = $4,
+		    subtotal = $5, discount_total = $6, tax_total = $7, total = $8, updated_at = $9
+		WHERE id = $10 AND organization_id = $11 AND status = $12
+	`,
+		q.CustomerID, q.Title, nullIfEmpty(q.Notes), utcOrNil(q.ValidUntil),
+		q.Subtotal, q.DiscountTotal, q.TaxTotal, q.Total, now,
+		q.ID, q.OrganizationID, models.QuoteDraft,
+	)
+	if err := rowChanged(tx, result, err, "quotes", "quote", q.ID, q.OrganizationID, models.ErrQuoteNotEditable); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM quote_line_items WHERE quote_id = $1`, q.ID); err != nil {
+		return err
+	}
+	if err := insertLineItems(tx, q); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	q.UpdatedAt = now
+	return nil
+}
+
+// Delete removes a draft quote. Quotes a customer has seen are kept.
+func (r *QuoteRepository) Delete(id uint, organizationID uint) error {
+	result, err := r.db.Exec(`
+		DELETE FROM quotes WHERE id = $1 AND organization_id = $2 AND status = $3
+	`, id, organizationID, models.QuoteDraft)
+	return rowChanged(r.db, result, err, "quotes", "quote", id, organizationID, models.ErrQuoteNotEditable)
+}
+
+// MarkSent moves a draft to sent. Sending again only updates sent_at.
+func (r *QuoteRepository) MarkSent(id uint, organizationID uint, at time.Time) error {
+	result, err := r.db.Exec(`
+		UPDATE quotes
+		SET status = $1, sent_at = $2, updated_at = $2
+		WHERE id = $3 AND organization_id = $4 AND status IN ($5, $1)
+	`, models.QuoteSent, at, id, organizationID, models.QuoteDraft)
+	return rowChanged(r.db, result, err, "quotes", "quote", id, organizationID, models.ErrQuoteAnswered)
+}
+
+// Respond records the customer's answer to a sent, unexpired quote
+func (r *QuoteRepository) Respond(id uint, organizationID uint, accepted bool, name, reason string, at time.Time) error {
+	at = at.UTC() // valid_until is stored in UTC
+	status := models.QuoteDeclined
+	if accepted {
+		status = models.QuoteAccepted
+		reason = ""
+	}
+
+	result, err := r.db.Exec(`
+		UPDATE quotes
+		SET status = $1, responded_at = $2, responded_by_name = $3, decline_reason = $4, updated_at = $2
+		WHERE id = $5 AND organization_id = $6 AND status = $7 AND (valid_until IS NULL OR valid_until >= $2)
+	`, status, at, nullIfEmpty(name), nullIfEmpty(reason), id, organizationID, models.QuoteSent)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows > 0 {
+		return nil
+	}
+
+	// Work out which condition failed
+	var current string
+	var validUntil sql.NullTime
+	err = r.db.QueryRow(
+		`SELECT status, valid_until FROM quotes WHERE id = $1 AND organization_id = $2`, id, organizationID,
+	).Scan(&current, &validUntil)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("quote not found")
+	}
+	if err != nil {
+		return err
+	}
+	if current == models.QuoteSent && validUntil.Valid && at.After(validUntil.Time) {
+		return models.ErrQuoteExpired
+	}
+	return models.ErrQuoteNotSent
+}
+
+// Convert creates jobs from an accepted quote. It can only happen once.
+// check runs for each job that has a worker before it is inserted, so it
+// also sees the jobs created before it from the same quote.
+func (r *QuoteRepository) Convert(id uint, organizationID uint, jobs []*models.Job, check ScheduleCheck) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var status string
+	var convertedAt sql.NullTime
+	err = tx.QueryRow(
+		`SELECT status, converted_at FROM quotes WHERE id = $1 AND organization_id = $2 FOR UPDATE`,
+		id, organizationID,
+	).Scan(&status, &convertedAt)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("quote not found")
+	}
+	if err != nil {
+		return err
+	}
+	if status != models.QuoteAccepted {
+		return models.ErrQuoteNotAccepted
+	}
+	if convertedAt.Valid {
+		return models.ErrQuoteConverted
+	}
+
+	// Lock the workers in id order, so conversions sharing workers cannot deadlock
+	workerIDs := []uint{}
+	for _, job := range jobs {
+		if job.TechnicianID != nil {
+			workerIDs = append(workerIDs, *job.TechnicianID)
+		}
+	}
+	sort.Slice(workerIDs, func(i, j int) bool { return workerIDs[i] < workerIDs[j] })
+	for _, workerID := range workerIDs {
+		if err := lockWorker(tx, workerID, organizationID); err != nil {
+			return err
+		}
+	}
+
+	for _, job := range jobs {
+		job.QuoteID = &id
+		if job.ScheduleWarnings, err = checkWorker(tx, organizationID, job.TechnicianID, job.ScheduledAt, job.DurationMinutes, check); err != nil {
+			return err
+		}
+		if err := insertJob(tx, job); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	if _, err := tx.Exec(
+		`UPDATE quotes SET converted_at = $1, updated_at = $1 WHERE id = $2`, now, id,
+	); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *QuoteRepository) findLineItems(quoteID uint) ([]*models.QuoteLineItem, error) {
+	rows, err := r.db.Query(`
+		SELECT id, quote_id, position, kind, description, quantity, unit_price, discount_percent, tax_rate
+		FROM quote_line_items
+		WHERE quote_id = $1
+		ORDER BY position
+	`, quoteID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lines := []*models.QuoteLineItem{}
+	for rows.Next() {
+		l := &models.QuoteLineItem{}
+		err := rows.Scan(
+			&l.ID, &l.QuoteID, &l.Position, &l.Kind, &l.Description,
+			&l.Quantity, &l.UnitPrice, &l.DiscountPercent, &l.TaxRate,
+		)
+		if err != nil {
+			return nil, err
+		}
+		l.Compute()
+		lines = append(lines, l)
+	}
+
+	return lines, rows.Err()
+}
+
+func insertLineItems(q querier, quote *models.Quote) error {
+	for _, l := range quote.LineItems {
+		l.QuoteID = quote.ID
+		err := q.QueryRow(`
+			INSERT INTO quote_line_items (
+				quote_id, position, kind, description, quantity, unit_price, discount_percent, tax_rate, total
+			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+			RETURNING id
+		`, l.QuoteID, l.Position, l.Kind, l.Description, l.Quantity, l.UnitPrice, l.DiscountPercent, l.TaxRate, l.Total).Scan(&l.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rowChanged turns a conditional write that matched no rows into
+// "<name> not found" or, when the row exists, statusErr
+func rowChanged(q querier, result sql.Result, err error, table, name string, id, organizationID uint, statusErr error) error {
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows > 0 {
+		return nil
+	}
+
+	var exists bool
+	err = q.QueryRow(
+		`SELECT EXISTS(SELECT 1 FROM `+table+` WHERE id = $1 AND organization_id = $2)`, id, organizationID,
+	).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("%s not found", name)
+	}
+	return statusErr
+}
+
+// nextDocumentNumber hands out gap-free numbers per organization and kind.
+// The row lock is held until the caller's transaction ends.
+func nextDocumentNumber(q querier, organizationID uint, kind string) (int, error) {
+	var number int
+	err := q.QueryRow(`
+		INSERT INTO document_sequences (organization_id, kind, last_number)
+		VALUES ($1, $2, 1)
+		ON CONFLICT (organization_id, kind) DO UPDATE
+		SET last_number = document_sequences.last_number + 1
+		RETURNING last_number
+	`, organizationID, kind).Scan(&number)
+	return number, err
+}
+
+func scanQuote(row rowScanner) (*models.Quote, error) {
+	q := &models.Quote{}
+	var validUntil, sentAt, respondedAt, convertedAt sql.NullTime
+	var createdBy sql.NullInt64
+
+	err := row.Scan(
+		&q.ID, &q.OrganizationID, &q.CustomerID, &q.Number, &q.Title, &q.Notes, &q.Status, &validUntil,
+		&q.Subtotal, &q.DiscountTotal, &q.TaxTotal, &q.Total, &sentAt, &respondedAt,
+		&q.RespondedByName, &q.DeclineReason, &convertedAt,
+		&createdBy, &q.CreatedAt, &q.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if validUntil.Valid {
+		q.ValidUntil = &validUntil.Time
+	}
+	if sentAt.Valid {
+		q.SentAt = &sentAt.Time
+	}
+	if respondedAt.Valid {
+		q.RespondedAt = &respondedAt.Time
+	}
+	if convertedAt.Valid {
+		q.ConvertedAt = &convertedAt.Time
+	}
+	if createdBy.Valid {
+		id := uint(createdBy.Int64)
+		q.CreatedBy = &id
+	}
+
+	return q, nil
+}
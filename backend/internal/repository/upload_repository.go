@@ -0,0 +1,173 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/ireuven89/routewise/internal/models"
+	"github.com/lib/pq"
+)
+
+type UploadRepository struct {
+	db *sql.DB
+}
+
+func NewUploadRepository(db *sql.DB) *UploadRepository {
+	return &UploadRepository{db: db}
+}
+
+const uploadColumns = `
+	id, organization_id, project_id, uploaded_by_user, uploaded_by_worker,
+	file_type, COALESCE(file_category, ''), file_name, mime_type, file_size,
+	COALESCE(file_extension, ''), COALESCE(description, ''), taken_at, replaces_file_id,
+	s3_key, COALESCE(multipart_upload_id, ''), COALESCE(part_size, 0),
+	expires_at, created_at`
+
+func (r *UploadRepository) Create(u *models.FileUpload) error {
+	var partSize interface{}
+	if u.Multipart() {
+		partSize = u.PartSize
+	}
+
+	return r.db.QueryRow(`
+		INSERT INTO file_uploads (
+			organization_id, project_id, uploaded_by_user, uploaded_by_worker,
+			file_type, file_category, file_name, mime_type, file_size,
+			file_extension, description, taken_at, replaces_file_id,
+			s3_key, multipart_upload_id, part_size, expires_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)
+		RETURNING id, created_at
+	`,
+		u.OrganizationID, u.ProjectID, u.UploadedByUser, u.UploadedByWorker,
+		u.FileType, nullIfEmpty(u.FileCategory), u.FileName, u.MimeType, u.FileSize,
+		nullIfEmpty(u.FileExtension), nullIfEmpty(u.Description), u.TakenAt, u.ReplacesFileID,
+		u.S3Key, nullIfEmpty(u.MultipartID), partSize, u.ExpiresAt,
+	).Scan(&u.ID, &u.CreatedAt)
+}
+
+func (r *UploadRepository) FindByID(id uint, organizationID uint) (*models.FileUpload, error) {
+	u, err := scanUpload(r.db.QueryRow(`
+		SELECT `+uploadColumns+`
+		FROM file_uploads
+		WHERE id = $1 AND organization_id = $2
+	`, id, organizationID))
+
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("upload not found")
+	}
+	return u, err
+}
+
+// Complete removes the slot and records the uploaded file in one
+// transaction, so a slot is confirmed at most once
+func (r *UploadRepository) Complete(u *models.FileUpload, file *models.ProjectFile) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`DELETE FROM file_uploads WHERE id = $1 AND organization_id = $2`, u.ID, u.OrganizationID)
+	if err != nil {
+		return err
+	}
+	if rows, err := result.RowsAffected(); err != nil {
+		return err
+	} else if rows == 0 {
+		return fmt.Errorf("upload not found")
+	}
+
+	if err := insertProjectFile(tx, file); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *UploadRepository) Delete(id uint) error {
+	_, err := r.db.Exec(`DELETE FROM file_uploads WHERE id = $1`, id)
+	return err
+}
+
+// FindExpired returns up to limit slots that expired before the given time,
+// oldest first
+func (r *UploadRepository) FindExpired(before time.Time, limit int) ([]*models.FileUpload, error) {
+	rows, err := r.db.Query(`
+		SELECT `+uploadColumns+`
+		FROM file_uploads
+		WHERE expires_at < $1
+		ORDER BY expires_at
+		LIMIT $2
+	`, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	uploads := []*models.FileUpload{}
+	for rows.Next() {
+		u, err := scanUpload(rows)
+		if err != nil {
+			return nil, err
+		}
+		uploads = append(uploads, u)
+	}
+	return uploads, rows.Err()
+}
+
+// GetPolicy returns the organization's upload policy, or the default if
+// none was saved
+func (r *UploadRepository) GetPolicy(organizationID uint) (*models.UploadPolicy, error) {
+	var allowedTypes, allowedCategories pq.StringArray
+	policy := &models.UploadPolicy{}
+	err := r.db.QueryRow(`
+		SELECT organization_id, allowed_types, allowed_categories, max_file_size, updated_at
+		FROM upload_policies
+		WHERE organization_id = $1
+	`, organizationID).Scan(&policy.OrganizationID, &allowedTypes, &allowedCategories, &policy.MaxFileSize, &policy.UpdatedAt)
+
+	if err == sql.ErrNoRows {
+		return models.DefaultUploadPolicy(organizationID), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	policy.AllowedTypes = []string(allowedTypes)
+	policy.AllowedCategories = []string(allowedCategories)
+	return policy, nil
+}
+
+func (r *UploadRepository) SavePolicy(policy *models.UploadPolicy) error {
+	now := time.Now()
+	_, err := r.db.Exec(`
+		INSERT INTO upload_policies (organization_id, allowed_types, allowed_categories, max_file_size, updated_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (organization_id) DO UPDATE
+		SET allowed_types = EXCLUDED.allowed_types,
+		    allowed_categories = EXCLUDED.allowed_categories,
+		    max_file_size = EXCLUDED.max_file_size,
+		    updated_at = EXCLUDED.updated_at
+	`, policy.OrganizationID, pq.Array(policy.AllowedTypes), pq.Array(policy.AllowedCategories), policy.MaxFileSize, now)
+	if err != nil {
+		return err
+	}
+
+	policy.UpdatedAt = now
+	return nil
+}
+
+func scanUpload(row rowScanner) (*models.FileUpload, error) {
+	u := &models.FileUpload{}
+	err := row.Scan(
+		&u.ID, &u.OrganizationID, &u.ProjectID, &u.UploadedByUser, &u.UploadedByWorker,
+		&u.FileType, &u.FileCategory, &u.FileName, &u.MimeType, &u.FileSize,
+		&u.FileExtension, &u.Description, &u.TakenAt, &u.ReplacesFileID,
+		&u.S3Key, &u.MultipartID, &u.PartSize,
+		&u.ExpiresAt, &u.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
@@ -0,0 +1,219 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/ireuven89/routewise/internal/models"
+)
+
+type UsageRepository struct {
+	db *sql.DB
+}
+
+func NewUsageRepository(db *sql.DB) *UsageRepository {
+	return &UsageRepository{db: db}
+}
+
+// GetUsage returns the organization's usage and the quota of its plan, or
+// the organization's own quota where one is set
+func (r *UsageRepository) GetUsage(organizationID uint) (*models.StorageUsage, error) {
+	usage := &models.StorageUsage{}
+	err := r.db.QueryRow(`
+		SELECT o.id, o.storage_plan, COALESCE(o.storage_quota_bytes, p.quota_bytes),
+		       COALESCE(u.bytes_used, 0), COALESCE(u.file_count, 0), u.reconciled_at
+		FROM organizations o
+		JOIN storage_plans p ON p.name = o.storage_plan
+		LEFT JOIN storage_usage u ON u.organization_id = o.id
+		WHERE o.id = $1
+	`, organizationID).Scan(
+		&usage.OrganizationID, &usage.Plan, &usage.QuotaBytes,
+		&usage.BytesUsed, &usage.FileCount, &usage.ReconciledAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("organization not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+// GetBreakdown splits the organization's file usage by job, file type and
+// the month files were uploaded, largest first and months newest first
+func (r *UsageRepository) GetBreakdown(organizationID uint) (*models.StorageUsageBreakdown, error) {
+	rows, err := r.db.Query(`
+		SELECT GROUPING(f.project_id), GROUPING(f.file_type),
+		       COALESCE(f.project_id, 0), COALESCE(MAX(j.title), ''), COALESCE(f.file_type, ''),
+		       COALESCE(TO_CHAR(DATE_TRUNC('month', f.created_at), 'YYYY-MM'), ''),
+		       SUM(f.file_size + f.renditions_size), COUNT(*)
+		FROM project_files f
+		JOIN jobs j ON j.id = f.project_id
+		WHERE j.organization_id = $1
+		GROUP BY GROUPING SETS ((f.project_id), (f.file_type), (DATE_TRUNC('month', f.created_at)))
+		ORDER BY 1, 2, DATE_TRUNC('month', f.created_at) DESC NULLS LAST, SUM(f.file_size + f.renditions_size) DESC
+	`, organizationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	breakdown := &models.StorageUsageBreakdown{
+		ByJob:      []models.StorageUsageGroup{},
+		ByFileType: []models.StorageUsageGroup{},
+		ByMonth:    []models.StorageUsageGroup{},
+	}
+	for rows.Next() {
+		var notByJob, notByType int
+		var group models.StorageUsageGroup
+		err := rows.Scan(
+			&notByJob, &notByType,
+			&group.JobID, &group.JobTitle, &group.FileType, &group.Month,
+			&group.Bytes, &group.Files,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case notByJob == 0:
+			breakdown.ByJob = append(breakdown.ByJob, group)
+		case notByType == 0:
+			breakdown.ByFileType = append(breakdown.ByFileType, group)
+		default:
+			breakdown.ByMonth = append(breakdown.ByMonth, group)
+		}
+	}
+	return breakdown, rows.Err()
+}
+
+// FindOrganizationIDs returns every organization, for reconciliation
+func (r *UsageRepository) FindOrganizationIDs() ([]uint, error) {
+	rows, err := r.db.Query(`SELECT id FROM organizations ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []uint
+	for rows.Next() {
+		var id uint
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// FindObjectKeys returns every key the organization's project files and
+// open upload slots refer to, originals and renditions alike. It is read in
+// one statement, so an upload completing meanwhile is found either way.
+func (r *UsageRepository) FindObjectKeys(organizationID uint) (map[string]bool, error) {
+	rows, err := r.db.Query(`
+		SELECT k.key
+		FROM project_files f
+		JOIN jobs j ON j.id = f.project_id
+		CROSS JOIN LATERAL (VALUES (f.s3_key), (f.thumbnail_s3_key), (f.medium_s3_key)) AS k(key)
+		WHERE j.organization_id = $1 AND k.key IS NOT NULL
+		UNION ALL
+		SELECT s3_key FROM file_uploads WHERE organization_id = $1
+	`, organizationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := make(map[string]bool)
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys[key] = true
+	}
+	return keys, rows.Err()
+}
+
+// Recount sets the organization's usage to what its project files add up
+// to, trashed files included, and returns the bytes used before and after.
+// The counter row is locked before the files are summed, so a file charged
+// meanwhile is either committed before the sum or charged on top of it.
+func (r *UsageRepository) Recount(organizationID uint) (before, after int64, err error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO storage_usage (organization_id) VALUES ($1)
+		ON CONFLICT (organization_id) DO NOTHING
+	`, organizationID)
+	if err != nil {
+		return 0, 0, err
+	}
+	err = tx.QueryRow(
+		`SELECT bytes_used FROM storage_usage WHERE organization_id = $1 FOR UPDATE`, organizationID,
+	).Scan(&before)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// A statement of its own, so it sees what committed while the lock was awaited
+	err = tx.QueryRow(`
+		UPDATE storage_usage u
+		SET bytes_used = totals.bytes, file_count = totals.files, reconciled_at = NOW(), updated_at = NOW()
+		FROM (
+			SELECT COALESCE(SUM(f.file_size + f.renditions_size), 0) AS bytes, COUNT(*) AS files
+			FROM project_files f
+			JOIN jobs j ON j.id = f.project_id
+			WHERE j.organization_id = $1
+		) totals
+		WHERE u.organization_id = $1
+		RETURNING u.bytes_used
+	`, organizationID).Scan(&after)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return before, after, tx.Commit()
+}
+
+// chargeStorage adds bytes and files to the usage of the project's
+// organization. With enforce, it fails with ErrStorageQuotaExceeded rather
+// than go over the quota. The counter row is locked until the transaction
+// ends, so concurrent uploads cannot both take the last of the quota.
+func chargeStorage(q querier, projectID uint, bytes int64, files int, enforce bool) error {
+	_, err := q.Exec(`
+		INSERT INTO storage_usage (organization_id)
+		SELECT organization_id FROM jobs WHERE id = $1
+		ON CONFLICT (organization_id) DO NOTHING
+	`, projectID)
+	if err != nil {
+		return err
+	}
+
+	result, err := q.Exec(`
+		UPDATE storage_usage u
+		SET bytes_used = GREATEST(u.bytes_used + $2, 0),
+		    file_count = GREATEST(u.file_count + $3, 0),
+		    updated_at = NOW()
+		FROM jobs j
+		JOIN organizations o ON o.id = j.organization_id
+		JOIN storage_plans p ON p.name = o.storage_plan
+		WHERE j.id = $1 AND u.organization_id = j.organization_id
+		  AND (NOT $4 OR $2 <= 0 OR u.bytes_used + $2 <= COALESCE(o.storage_quota_bytes, p.quota_bytes))
+	`, projectID, bytes, files, enforce)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 && enforce {
+		return models.ErrStorageQuotaExceeded
+	}
+	return nil
+}
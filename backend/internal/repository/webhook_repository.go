@@ -0,0 +1,319 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/ireuven89/routewise/internal/models"
+	"github.com/lib/pq"
+)
+
+type WebhookRepository struct {
+	db *sql.DB
+}
+
+func NewWebhookRepository(db *sql.DB) *WebhookRepository {
+	return &WebhookRepository{db: db}
+}
+
+const webhookSubscriptionColumns = `
+	id, organization_id, url, event_types, secret, COALESCE(description, ''),
+	is_active, created_by, created_at, updated_at
+`
+
+func (r *WebhookRepository) CreateSubscription(sub *models.WebhookSubscription) error {
+	now := time.Now()
+	err := r.db.QueryRow(`
+		INSERT INTO webhook_subscriptions (organization_id, url, event_types, secret, description, is_active, created_by, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $8)
+		RETURNING id
+	`, sub.OrganizationID, sub.URL, pq.Array(sub.EventTypes), sub.Secret, nullIfEmpty(sub.Description),
+		sub.IsActive, sub.CreatedBy, now).Scan(&sub.ID)
+	if err != nil {
+		return err
+	}
+
+	sub.CreatedAt = now
+	sub.UpdatedAt = now
+	return nil
+}
+
+func (r *WebhookRepository) FindSubscription(id uint, organizationID uint) (*models.WebhookSubscription, error) {
+	sub, err := scanSubscription(r.db.QueryRow(`
+		SELECT `+webhookSubscriptionColumns+`
+		FROM webhook_subscriptions
+		WHERE id = $1 AND organization_id = $2
+	`, id, organizationID))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("webhook not found")
+	}
+	return sub, err
+}
+
+func (r *WebhookRepository) FindSubscriptions(organizationID uint) ([]*models.WebhookSubscription, error) {
+	return r.querySubscriptions(`
+		SELECT `+webhookSubscriptionColumns+`
+		FROM webhook_subscriptions
+		WHERE organization_id = $1
+		ORDER BY created_at ASC
+	`, organizationID)
+}
+
+// FindActiveSubscriptions returns the subscriptions that receive eventType
+func (r *WebhookRepository) FindActiveSubscriptions(organizationID uint, eventType string) ([]*models.WebhookSubscription, error) {
+	return r.querySubscriptions(`
+		SELECT `+webhookSubscriptionColumns+`
+		FROM webhook_subscriptions
+		WHERE organization_id = $1 AND is_active = true
+		  AND (cardinality(event_types) = 0 OR $2 = ANY(event_types))
+	`, organizationID, eventType)
+}
+
+func (r *WebhookRepository) UpdateSubscription(sub *models.WebhookSubscription) error {
+	now := time.Now()
+	result, err := r.db.Exec(`
+		UPDATE webhook_subscriptions
+		SET url = $1, event_types = $2, secret = $3, description = $4, is_active = $5, updated_at = $6
+		WHERE id = $7 AND organization_id = $8
+	`, sub.URL, pq.Array(sub.EventTypes), sub.Secret, nullIfEmpty(sub.Description), sub.IsActive, now,
+		sub.ID, sub.OrganizationID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return fmt.Errorf("webhook not found")
+	}
+
+	sub.UpdatedAt = now
+	return nil
+}
+
+// DeleteSubscription removes the subscription together with its delivery log
+func (r *WebhookRepository) DeleteSubscription(id uint, organizationID uint) error {
+	result, err := r.db.Exec(`DELETE FROM webhook_subscriptions WHERE id = $1 AND organization_id = $2`, id, organizationID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return fmt.Errorf("webhook not found")
+	}
+
+	return nil
+}
+
+func (r *WebhookRepository) querySubscriptions(query string, args ...interface{}) ([]*models.WebhookSubscription, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subs := []*models.WebhookSubscription{}
+	for rows.Next() {
+		sub, err := scanSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, sub)
+	}
+
+	return subs, rows.Err()
+}
+
+func scanSubscription(row rowScanner) (*models.WebhookSubscription, error) {
+	sub := &models.WebhookSubscription{}
+	var eventTypes pq.StringArray
+	var createdBy sql.NullInt64
+
+	err := row.Scan(
+		&sub.ID, &sub.OrganizationID, &sub.URL, &eventTypes, &sub.Secret, &sub.Description,
+		&sub.IsActive, &createdBy, &sub.CreatedAt, &sub.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	sub.EventTypes = []string(eventTypes)
+	if sub.EventTypes == nil {
+		sub.EventTypes = []string{}
+	}
+	if createdBy.Valid {
+		id := uint(createdBy.Int64)
+		sub.CreatedBy = &id
+	}
+
+	return sub, nil
+}
+
+// CreateDelivery queues a delivery, due immediately unless NextAttemptAt is set
+func (r *WebhookRepository) CreateDelivery(delivery *models.WebhookDelivery) error {
+	now := time.Now()
+	if delivery.NextAttemptAt == nil {
+		delivery.NextAttemptAt = &now
+	}
+
+	err := r.db.QueryRow(`
+		INSERT INTO webhook_deliveries (
+			subscription_id, organization_id, event_id, event_type, payload,
+			status, next_attempt_at, replay_of, created_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id
+	`, delivery.SubscriptionID, delivery.OrganizationID, delivery.EventID, delivery.EventType,
+		[]byte(delivery.Payload), models.WebhookPending, *delivery.NextAttemptAt, delivery.ReplayOf, now).Scan(&delivery.ID)
+	if err != nil {
+		return err
+	}
+
+	delivery.Status = models.WebhookPending
+	delivery.CreatedAt = now
+	return nil
+}
+
+const webhookDeliveryColumns = `
+	id, subscription_id, organization_id, event_id, event_type, payload, status, attempts,
+	next_attempt_at, last_attempt_at, last_status_code, COALESCE(last_error, ''),
+	delivered_at, replay_of, created_at
+`
+
+func (r *WebhookRepository) FindDelivery(id uint, organizationID uint) (*models.WebhookDelivery, error) {
+	delivery, err := scanDelivery(r.db.QueryRow(`
+		SELECT `+webhookDeliveryColumns+`
+		FROM webhook_deliveries
+		WHERE id = $1 AND organization_id = $2
+	`, id, organizationID))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("delivery not found")
+	}
+	return delivery, err
+}
+
+// FindDeliveries returns a subscription's log, newest first. status may be empty.
+func (r *WebhookRepository) FindDeliveries(subscriptionID uint, organizationID uint, status string, limit int) ([]*models.WebhookDelivery, error) {
+	rows, err := r.db.Query(`
+		SELECT `+webhookDeliveryColumns+`
+		FROM webhook_deliveries
+		WHERE subscription_id = $1 AND organization_id = $2 AND ($3 = '' OR status = $3)
+		ORDER BY created_at DESC, id DESC
+		LIMIT $4
+	`, subscriptionID, organizationID, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return collectDeliveries(rows)
+}
+
+// ClaimDue takes up to limit pending deliveries whose next attempt is due and
+// pushes their next attempt back by lease, so other instances skip them while
+// this one is sending. The attempt outcome then sets the real schedule.
+func (r *WebhookRepository) ClaimDue(now time.Time, lease time.Duration, limit int) ([]*models.WebhookDelivery, error) {
+	rows, err := r.db.Query(`
+		UPDATE webhook_deliveries
+		SET next_attempt_at = $2
+		WHERE id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE status = $3 AND next_attempt_at <= $1
+			ORDER BY next_attempt_at
+			LIMIT $4
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+webhookDeliveryColumns,
+		now, now.Add(lease), models.WebhookPending, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return collectDeliveries(rows)
+}
+
+// RecordAttempt stores the outcome of an attempt. A nil nextAttemptAt ends
+// the delivery: succeeded when delivered, failed otherwise.
+func (r *WebhookRepository) RecordAttempt(id uint, statusCode int, attemptErr string, at time.Time, delivered bool, nextAttemptAt *time.Time) error {
+	status := models.WebhookPending
+	var deliveredAt interface{}
+	switch {
+	case delivered:
+		status = models.WebhookSucceeded
+		deliveredAt = at
+	case nextAttemptAt == nil:
+		status = models.WebhookFailed
+	}
+
+	var code interface{}
+	if statusCode != 0 {
+		code = statusCode
+	}
+
+	_, err := r.db.Exec(`
+		UPDATE webhook_deliveries
+		SET attempts = attempts + 1, status = $1, last_attempt_at = $2, last_status_code = $3,
+		    last_error = $4, next_attempt_at = $5, delivered_at = $6
+		WHERE id = $7
+	`, status, at, code, nullIfEmpty(attemptErr), nextAttemptAt, deliveredAt, id)
+	return err
+}
+
+func collectDeliveries(rows *sql.Rows) ([]*models.WebhookDelivery, error) {
+	deliveries := []*models.WebhookDelivery{}
+	for rows.Next() {
+		delivery, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, rows.Err()
+}
+
+func scanDelivery(row rowScanner) (*models.WebhookDelivery, error) {
+	d := &models.WebhookDelivery{}
+	var payload []byte
+	var nextAttemptAt, lastAttemptAt, deliveredAt sql.NullTime
+	var lastStatusCode, replayOf sql.NullInt64
+
+	err := row.Scan(
+		&d.ID, &d.SubscriptionID, &d.OrganizationID, &d.EventID, &d.EventType, &payload, &d.Status, &d.Attempts,
+		&nextAttemptAt, &lastAttemptAt, &lastStatusCode, &d.LastError,
+		&deliveredAt, &replayOf, &d.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	d.Payload = payload
+	if nextAttemptAt.Valid {
+		d.NextAttemptAt = &nextAttemptAt.Time
+	}
+	if lastAttemptAt.Valid {
+		d.LastAttemptAt = &lastAttemptAt.Time
+	}
+	if lastStatusCode.Valid {
+		code := int(lastStatusCode.Int64)
+		d.LastStatusCode = &code
+	}
+	if deliveredAt.Valid {
+		d.DeliveredAt = &deliveredAt.Time
+	}
+	if replayOf.Valid {
+		id := uint(replayOf.Int64)
+		d.ReplayOf = &id
+	}
+
+	return d, nil
+}
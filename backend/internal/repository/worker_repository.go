@@ -46,7 +46,7 @@ func (r *WorkerRepository) Create(worker *models.Worker) error {
 
 func (r *WorkerRepository) FindByID(id uint, organizationID uint) (*models.Worker, error) {
 	query := `
-		SELECT id, organization_id, created_by, name, email, phone, is_active, created_at, updated_at
+		SELECT id, organization_id, created_by, name, email, phone, is_active, last_lat, last_lng, last_seen_at, created_at, updated_at
 		FROM workers
 		WHERE id = $1 AND organization_id = $2
 	`
@@ -54,6 +54,8 @@ func (r *WorkerRepository) FindByID(id uint, organizationID uint) (*models.Worke
 	worker := &models.Worker{}
 	var email sql.NullString
 	var createdBy sql.NullInt64
+	var lastLat, lastLng sql.NullFloat64
+	var lastSeenAt sql.NullTime
 
 	err := r.db.QueryRow(query, id, organizationID).Scan(
 		&worker.ID,
@@ -63,6 +65,9 @@ func (r *WorkerRepository) FindByID(id uint, organizationID uint) (*models.Worke
 		&email,
 		&worker.Phone,
 		&worker.IsActive,
+		&lastLat,
+		&lastLng,
+		&lastSeenAt,
 		&worker.CreatedAt,
 		&worker.UpdatedAt,
 	)
@@ -81,13 +86,14 @@ func (r *WorkerRepository) FindByID(id uint, organizationID uint) (*models.Worke
 	if email.Valid {
 		worker.Email = email.String
 	}
+	setLastLocation(worker, lastLat, lastLng, lastSeenAt)
 
 	return worker, nil
 }
 
 func (r *WorkerRepository) FindByPhone(phone string, organizationID uint) (*models.Worker, error) {
 	query := `
-		SELECT id, organization_id, created_by, name, email, phone, is_active, created_at, updated_at
+		SELECT id, organization_id, created_by, name, email, phone, is_active, last_lat, last_lng, last_seen_at, created_at, updated_at
 		FROM workers
 		WHERE phone = $1 AND organization_id = $2
 	`
@@ -95,6 +101,8 @@ func (r *WorkerRepository) FindByPhone(phone string, organizationID uint) (*mode
 	worker := &models.Worker{}
 	var email sql.NullString
 	var createdBy sql.NullInt64
+	var lastLat, lastLng sql.NullFloat64
+	var lastSeenAt sql.NullTime
 
 	err := r.db.QueryRow(query, phone, organizationID).Scan(
 		&worker.ID,
@@ -104,6 +112,9 @@ func (r *WorkerRepository) FindByPhone(phone string, organizationID uint) (*mode
 		&email,
 		&worker.Phone,
 		&worker.IsActive,
+		&lastLat,
+		&lastLng,
+		&lastSeenAt,
 		&worker.CreatedAt,
 		&worker.UpdatedAt,
 	)
@@ -122,13 +133,14 @@ func (r *WorkerRepository) FindByPhone(phone string, organizationID uint) (*mode
 	if email.Valid {
 		worker.Email = email.String
 	}
+	setLastLocation(worker, lastLat, lastLng, lastSeenAt)
 
 	return worker, nil
 }
 
 func (r *WorkerRepository) FindAll(organizationID uint, activeOnly bool) ([]*models.Worker, error) {
 	query := `
-		SELECT id, organization_id, created_by, name, email, phone, is_active, created_at, updated_at
+		SELECT id, organization_id, created_by, name, email, phone, is_active, last_lat, last_lng, last_seen_at, created_at, updated_at
 		FROM workers
 		WHERE organization_id = $1
 	`
@@ -153,6 +165,8 @@ func (r *WorkerRepository) FindAll(organizationID uint, activeOnly bool) ([]*mod
 		worker := &models.Worker{}
 		var email sql.NullString
 		var createdBy sql.NullInt64
+		var lastLat, lastLng sql.NullFloat64
+		var lastSeenAt sql.NullTime
 
 		err := rows.Scan(
 			&worker.ID,
@@ -162,6 +176,9 @@ func (r *WorkerRepository) FindAll(organizationID uint, activeOnly bool) ([]*mod
 			&email,
 			&worker.Phone,
 			&worker.IsActive,
+			&lastLat,
+			&lastLng,
+			&lastSeenAt,
 			&worker.CreatedAt,
 			&worker.UpdatedAt,
 		)
@@ -177,6 +194,7 @@ func (r *WorkerRepository) FindAll(organizationID uint, activeOnly bool) ([]*mod
 		if email.Valid {
 			worker.Email = email.String
 		}
+		setLastLocation(worker, lastLat, lastLng, lastSeenAt)
 
 		workers = append(workers, worker)
 	}
@@ -237,3 +255,130 @@ func (r *WorkerRepository) Delete(id uint, organizationID uint) error {
 
 	return nil
 }
+
+// RecordLocations stores a batch of position fixes and moves the worker's
+// last-known position forward to the newest one
+func (r *WorkerRepository) RecordLocations(workerID uint, organizationID uint, locations []*models.WorkerLocation) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO worker_locations (organization_id, worker_id, latitude, longitude, accuracy_meters, speed_mps, heading, recorded_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	now := time.Now()
+	var latest *models.WorkerLocation
+
+	for _, loc := range locations {
+		loc.OrganizationID = organizationID
+		loc.WorkerID = workerID
+		loc.CreatedAt = now
+
+		err := stmt.QueryRow(
+			organizationID,
+			workerID,
+			loc.Latitude,
+			loc.Longitude,
+			loc.AccuracyMeters,
+			loc.SpeedMps,
+			loc.Heading,
+			loc.RecordedAt,
+			now,
+		).Scan(&loc.ID)
+		if err != nil {
+			return err
+		}
+
+		if latest == nil || loc.RecordedAt.After(latest.RecordedAt) {
+			latest = loc
+		}
+	}
+
+	if latest != nil {
+		// Late-arriving batches must not overwrite a newer position
+		_, err = tx.Exec(`
+			UPDATE workers
+			SET last_lat = $1, last_lng = $2, last_seen_at = $3
+			WHERE id = $4 AND organization_id = $5 AND (last_seen_at IS NULL OR last_seen_at < $3)
+		`, latest.Latitude, latest.Longitude, latest.RecordedAt, workerID, organizationID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// FindLocationHistory returns a worker's position fixes between from and to, oldest first
+func (r *WorkerRepository) FindLocationHistory(workerID uint, organizationID uint, from, to time.Time) ([]*models.WorkerLocation, error) {
+	query := `
+		SELECT id, organization_id, worker_id, latitude, longitude, accuracy_meters, speed_mps, heading, recorded_at, created_at
+		FROM worker_locations
+		WHERE worker_id = $1 AND organization_id = $2 AND recorded_at >= $3 AND recorded_at < $4
+		ORDER BY recorded_at ASC
+	`
+
+	rows, err := r.db.Query(query, workerID, organizationID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	locations := []*models.WorkerLocation{}
+
+	for rows.Next() {
+		loc := &models.WorkerLocation{}
+		var accuracy, speed, heading sql.NullFloat64
+
+		err := rows.Scan(
+			&loc.ID,
+			&loc.OrganizationID,
+			&loc.WorkerID,
+			&loc.Latitude,
+			&loc.Longitude,
+			&accuracy,
+			&speed,
+			&heading,
+			&loc.RecordedAt,
+			&loc.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if accuracy.Valid {
+			loc.AccuracyMeters = &accuracy.Float64
+		}
+		if speed.Valid {
+			loc.SpeedMps = &speed.Float64
+		}
+		if heading.Valid {
+			loc.Heading = &heading.Float64
+		}
+
+		locations = append(locations, loc)
+	}
+
+	return locations, rows.Err()
+}
+
+func setLastLocation(worker *models.Worker, lastLat, lastLng sql.NullFloat64, lastSeenAt sql.NullTime) {
+	if lastLat.Valid && lastLng.Valid {
+		lat, lng := lastLat.Float64, lastLng.Float64
+		worker.LastLat = &lat
+		worker.LastLng = &lng
+	}
+	if lastSeenAt.Valid {
+		seen := lastSeenAt.Time
+		worker.LastSeenAt = &seen
+	}
+}
@@ -0,0 +1,60 @@
+package routing
+
+import "time"
+
+// TravelTimeEstimator predicts how long it takes to drive between two points
+type TravelTimeEstimator interface {
+	Estimate(from, to Point, departAt time.Time) Estimate
+}
+
+type Estimate struct {
+	DistanceKm float64       `json:"distance_km"`
+	Duration   time.Duration `json:"-"`
+	Minutes    int           `json:"minutes"`
+}
+
+// SpeedProfile describes typical driving conditions. DetourFactor scales the
+// straight-line distance up to an approximate road distance.
+type SpeedProfile struct {
+	Name         string
+	SpeedKmh     float64
+	DetourFactor float64
+}
+
+var (
+	ProfileUrban    = SpeedProfile{Name: "urban", SpeedKmh: 30, DetourFactor: 1.4}
+	ProfileSuburban = SpeedProfile{Name: "suburban", SpeedKmh: 45, DetourFactor: 1.3}
+	ProfileRural    = SpeedProfile{Name: "rural", SpeedKmh: 70, DetourFactor: 1.2}
+)
+
+// SpeedProfileByName looks up one of the built-in profiles
+func SpeedProfileByName(name string) (SpeedProfile, bool) {
+	for _, p := range []SpeedProfile{ProfileUrban, ProfileSuburban, ProfileRural} {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return SpeedProfile{}, false
+}
+
+// HaversineEstimator is the default estimator: great-circle distance
+// stretched by the detour factor, driven at the profile speed
+type HaversineEstimator struct {
+	Profile SpeedProfile
+}
+
+func NewHaversineEstimator(profile SpeedProfile) *HaversineEstimator {
+	return &HaversineEstimator{Profile: profile}
+}
+
+func (e *HaversineEstimator) Estimate(from, to Point, departAt time.Time) Estimate {
+	km := HaversineKm(from, to)
+	if e.Profile.DetourFactor > 0 {
+		km *= e.Profile.DetourFactor
+	}
+
+	d := TravelDuration(km, e.Profile.SpeedKmh)
+	minutes := int((d + time.Minute - 1) / time.Minute) // round up
+
+	return Estimate{DistanceKm: km, Duration: d, Minutes: minutes}
+}
@@ -0,0 +1,73 @@
+package routing
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestTravelDuration(t *testing.T) {
+	tests := []struct {
+		name     string
+		km       float64
+		speedKmh float64
+		want     time.Duration
+	}{
+		{"an hour", 40, 40, time.Hour},
+		{"half an hour", 15, 30, 30 * time.Minute},
+		{"nowhere to go", 0, 40, 0},
+		{"speed defaults", 20, 0, 30 * time.Minute},
+		{"negative speed defaults", 20, -5, 30 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := TravelDuration(tt.km, tt.speedKmh); got != tt.want {
+				t.Errorf("TravelDuration(%v, %v) = %v, want %v", tt.km, tt.speedKmh, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHaversineEstimator(t *testing.T) {
+	from := Point{Lat: 0, Lng: 0}
+	to := Point{Lat: 0, Lng: 0.1} // about 11.12 km
+
+	tests := []struct {
+		profile     SpeedProfile
+		wantKm      float64
+		wantMinutes int
+	}{
+		{ProfileUrban, 15.57, 32},
+		{ProfileSuburban, 14.45, 20},
+		{ProfileRural, 13.34, 12},
+		{SpeedProfile{Name: "straight", SpeedKmh: 60}, 11.12, 12},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.profile.Name, func(t *testing.T) {
+			got := NewHaversineEstimator(tt.profile).Estimate(from, to, time.Now())
+			if math.Abs(got.DistanceKm-tt.wantKm) > 0.01 {
+				t.Errorf("DistanceKm = %.2f, want %.2f", got.DistanceKm, tt.wantKm)
+			}
+			if got.Minutes != tt.wantMinutes {
+				t.Errorf("Minutes = %d, want %d", got.Minutes, tt.wantMinutes)
+			}
+			// Minutes round up, so the estimate is never optimistic
+			if time.Duration(got.Minutes)*time.Minute < got.Duration {
+				t.Errorf("Minutes = %d is less than %v", got.Minutes, got.Duration)
+			}
+		})
+	}
+}
+
+func TestSpeedProfileByName(t *testing.T) {
+	for _, name := range []string{"urban", "suburban", "rural"} {
+		if p, ok := SpeedProfileByName(name); !ok || p.Name != name {
+			t.Errorf("SpeedProfileByName(%q) = %+v, %v", name, p, ok)
+		}
+	}
+	if _, ok := SpeedProfileByName("highway"); ok {
+		t.Errorf("SpeedProfileByName(%q) found a profile", "highway")
+	}
+}
@@ -0,0 +1,33 @@
+package routing
+
+import (
+	"math"
+	"testing"
+)
+
+func TestHaversineKm(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b Point
+		want float64
+	}{
+		{"same point", Point{Lat: 51.5, Lng: -0.12}, Point{Lat: 51.5, Lng: -0.12}, 0},
+		{"one degree of latitude", Point{Lat: 0, Lng: 0}, Point{Lat: 1, Lng: 0}, 111.19},
+		{"one degree of longitude on the equator", Point{Lat: 0, Lng: 0}, Point{Lat: 0, Lng: 1}, 111.19},
+		{"london to paris", Point{Lat: 51.5074, Lng: -0.1278}, Point{Lat: 48.8566, Lng: 2.3522}, 343.56},
+		{"across the antimeridian", Point{Lat: 0, Lng: 179.5}, Point{Lat: 0, Lng: -179.5}, 111.19},
+		{"antipodes", Point{Lat: 0, Lng: 0}, Point{Lat: 0, Lng: 180}, math.Pi * earthRadiusKm},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := HaversineKm(tt.a, tt.b)
+			if math.Abs(got-tt.want) > 0.05 {
+				t.Errorf("HaversineKm() = %.2f, want %.2f", got, tt.want)
+			}
+			if back := HaversineKm(tt.b, tt.a); math.Abs(back-got) > 1e-9 {
+				t.Errorf("HaversineKm() is not symmetric: %.6f and %.6f", got, back)
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package routing
+
+// Stop is a location that has to be visited once
+type Stop struct {
+	ID    uint
+	Point Point
+}
+
+// Route is a visiting order over a list of stops
+type Route struct {
+	// Order holds indexes into the stops passed to OptimizeRoute
+	Order []int
+	// LegsKm[i] is the distance travelled to reach Order[i]. The first leg is
+	// measured from the start point, or is zero when there is none.
+	LegsKm  []float64
+	TotalKm float64
+}
+
+// maxTwoOptPasses bounds the improvement loop for pathological inputs
+const maxTwoOptPasses = 100
+
+// OptimizeRoute orders stops as an open path (no return to the start) using a
+// nearest-neighbour construction followed by 2-opt improvement. When start is
+// nil the path may begin at any stop.
+func OptimizeRoute(start *Point, stops []Stop) *Route {
+	route := &Route{Order: []int{}, LegsKm: []float64{}}
+	if len(stops) == 0 {
+		return route
+	}
+
+	// Node 0 is the start point when one is given, stops follow
+	points := make([]Point, 0, len(stops)+1)
+	offset := 0
+	if start != nil {
+		points = append(points, *start)
+		offset = 1
+	}
+	for _, s := range stops {
+		points = append(points, s.Point)
+	}
+	dist := distanceMatrix(points)
+
+	var path []int
+	if start != nil {
+		path = nearestNeighbour(dist, 0)
+		twoOpt(dist, path, true)
+	} else {
+		// Without a fixed start, try every stop as the first one
+		bestLen := -1.0
+		for first := range points {
+			candidate := nearestNeighbour(dist, first)
+			twoOpt(dist, candidate, false)
+			if l := pathLength(dist, candidate); bestLen < 0 || l < bestLen {
+				bestLen = l
+				path = candidate
+			}
+		}
+	}
+
+	prev := -1
+	for _, node := range path {
+		leg := 0.0
+		if prev >= 0 {
+			leg = dist[prev][node]
+		}
+		prev = node
+		if node < offset {
+			continue // the start point itself is not a stop
+		}
+		route.Order = append(route.Order, node-offset)
+		route.LegsKm = append(route.LegsKm, leg)
+		route.TotalKm += leg
+	}
+
+	return route
+}
+
+func distanceMatrix(points []Point) [][]float64 {
+	dist := make([][]float64, len(points))
+	for i := range points {
+		dist[i] = make([]float64, len(points))
+		for j := range points {
+			if i != j {
+				dist[i][j] = HaversineKm(points[i], points[j])
+			}
+		}
+	}
+	return dist
+}
+
+func nearestNeighbour(dist [][]float64, first int) []int {
+	n := len(dist)
+	visited := make([]bool, n)
+	path := make([]int, 0, n)
+
+	current := first
+	visited[current] = true
+	path = append(path, current)
+
+	for len(path) < n {
+		next := -1
+		for j := 0; j < n; j++ {
+			if visited[j] {
+				continue
+			}
+			if next < 0 || dist[current][j] < dist[current][next] {
+				next = j
+			}
+		}
+		visited[next] = true
+		path = append(path, next)
+		current = next
+	}
+
+	return path
+}
+
+// twoOpt reverses path segments in place while that shortens the open path.
+// With fixedStart the first node never moves.
+func twoOpt(dist [][]float64, path []int, fixedStart bool) {
+	n := len(path)
+	lo := 0
+	if fixedStart {
+		lo = 1
+	}
+
+	for pass := 0; pass < maxTwoOptPasses; pass++ {
+		improved := false
+		for i := lo; i < n-1; i++ {
+			for k := i + 1; k < n; k++ {
+				delta := 0.0
+				if i > 0 {
+					delta += dist[path[i-1]][path[k]] - dist[path[i-1]][path[i]]
+				}
+				if k < n-1 {
+					delta += dist[path[i]][path[k+1]] - dist[path[k]][path[k+1]]
+				}
+				if delta < -1e-9 {
+					reverse(path[i : k+1])
+					improved = true
+				}
+			}
+		}
+		if !improved {
+			return
+		}
+	}
+}
+
+func pathLength(dist [][]float64, path []int) float64 {
+	total := 0.0
+	for i := 1; i < len(path); i++ {
+		total += dist[path[i-1]][path[i]]
+	}
+	return total
+}
+
+func reverse(s []int) {
+	for i, j := 0, len(s)-1; i < j; i, j = i+1, j-1 {
+		s[i], s[j] = s[j], s[i]
+	}
+}
@@ -0,0 +1,157 @@
+package routing
+
+import (
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// east returns a point on the equator, about 11.12 km per step east of 0,0
+func east(steps int) Point {
+	return Point{Lat: 0, Lng: 0.1 * float64(steps)}
+}
+
+func stopsAt(points ...Point) []Stop {
+	stops := make([]Stop, len(points))
+	for i, p := range points {
+		stops[i] = Stop{ID: uint(i + 1), Point: p}
+	}
+	return stops
+}
+
+// bruteForceKm is the length of the shortest open path over the stops
+func bruteForceKm(start *Point, stops []Stop) float64 {
+	order := make([]int, len(stops))
+	for i := range order {
+		order[i] = i
+	}
+
+	best := math.Inf(1)
+	var permute func(k int)
+	permute = func(k int) {
+		if k == len(order) {
+			total := 0.0
+			for i, idx := range order {
+				switch {
+				case i > 0:
+					total += HaversineKm(stops[order[i-1]].Point, stops[idx].Point)
+				case start != nil:
+					total += HaversineKm(*start, stops[idx].Point)
+				}
+			}
+			best = math.Min(best, total)
+			return
+		}
+		for i := k; i < len(order); i++ {
+			order[k], order[i] = order[i], order[k]
+			permute(k + 1)
+			order[k], order[i] = order[i], order[k]
+		}
+	}
+	permute(0)
+	return best
+}
+
+func checkRoute(t *testing.T, route *Route, stops []Stop) {
+	t.Helper()
+	if len(route.Order) != len(stops) || len(route.LegsKm) != len(stops) {
+		t.Fatalf("OptimizeRoute() = %+v, want %d stops", route, len(stops))
+	}
+	seen := make(map[int]bool)
+	sum := 0.0
+	for i, idx := range route.Order {
+		if idx < 0 || idx >= len(stops) || seen[idx] {
+			t.Fatalf("OptimizeRoute() order %v is not a permutation of the stops", route.Order)
+		}
+		seen[idx] = true
+		sum += route.LegsKm[i]
+	}
+	if math.Abs(sum-route.TotalKm) > 1e-9 {
+		t.Errorf("TotalKm = %f, want the sum of the legs %f", route.TotalKm, sum)
+	}
+}
+
+func TestOptimizeRoute(t *testing.T) {
+	origin := east(0)
+
+	tests := []struct {
+		name      string
+		start     *Point
+		stops     []Stop
+		wantOrder [][]int // any of these
+	}{
+		{"no stops", &origin, nil, [][]int{{}}},
+		{"one stop", &origin, stopsAt(east(3)), [][]int{{0}}},
+		{"along a road from the start", &origin, stopsAt(east(3), east(1), east(4), east(2)), [][]int{{1, 3, 0, 2}}},
+		{"start in the middle goes to the nearer end first", ptr(east(2)), stopsAt(east(0), east(1), east(5), east(6), east(7)), [][]int{{1, 0, 2, 3, 4}}},
+		{"no start begins at either end", nil, stopsAt(east(3), east(1), east(4), east(2)), [][]int{{1, 3, 0, 2}, {2, 0, 3, 1}}},
+		{
+			"corners of a square are not crossed",
+			&origin,
+			stopsAt(Point{Lat: 0.1, Lng: 0.1}, Point{Lat: 0.1, Lng: 0}, Point{Lat: 0, Lng: 0.1}),
+			[][]int{{1, 0, 2}, {2, 0, 1}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			route := OptimizeRoute(tt.start, tt.stops)
+			checkRoute(t, route, tt.stops)
+
+			found := false
+			for _, want := range tt.wantOrder {
+				if reflect.DeepEqual(route.Order, want) {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("OptimizeRoute() order = %v, want one of %v", route.Order, tt.wantOrder)
+			}
+			if want := bruteForceKm(tt.start, tt.stops); math.Abs(route.TotalKm-want) > 1e-6 {
+				t.Errorf("TotalKm = %f, want the shortest %f", route.TotalKm, want)
+			}
+		})
+	}
+}
+
+func TestOptimizeRouteLegs(t *testing.T) {
+	origin := east(0)
+	stops := stopsAt(east(2), east(1))
+
+	route := OptimizeRoute(&origin, stops)
+	if want := HaversineKm(origin, east(1)); math.Abs(route.LegsKm[0]-want) > 1e-9 {
+		t.Errorf("first leg = %f, want the distance from the start %f", route.LegsKm[0], want)
+	}
+
+	route = OptimizeRoute(nil, stops)
+	if route.LegsKm[0] != 0 {
+		t.Errorf("first leg without a start = %f, want 0", route.LegsKm[0])
+	}
+}
+
+// The heuristic is not exact, but on small random days it stays close to
+// the best order
+func TestOptimizeRouteNearOptimal(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for run := 0; run < 50; run++ {
+		points := make([]Point, 7)
+		for i := range points {
+			points[i] = Point{Lat: 51.4 + rng.Float64()*0.2, Lng: -0.2 + rng.Float64()*0.3}
+		}
+		start := Point{Lat: 51.5, Lng: -0.05}
+		stops := stopsAt(points...)
+
+		for _, s := range []*Point{&start, nil} {
+			route := OptimizeRoute(s, stops)
+			checkRoute(t, route, stops)
+			if best := bruteForceKm(s, stops); route.TotalKm > best*1.1+1e-9 {
+				t.Errorf("run %d: TotalKm = %.2f, more than 10%% over the shortest %.2f", run, route.TotalKm, best)
+			}
+		}
+	}
+}
+
+func ptr(p Point) *Point {
+	return &p
+}
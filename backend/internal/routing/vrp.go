@@ -0,0 +1,211 @@
+package routing
+
+import (
+	"sort"
+	"time"
+)
+
+// DefaultSpeedKmh is the average travel speed used when none is configured
+const DefaultSpeedKmh = 40.0
+
+// FleetJob is a job to be placed on a worker's day. Service has to start
+// within [WindowStart, WindowEnd].
+type FleetJob struct {
+	ID          uint
+	Point       *Point // nil when the location is unknown
+	WindowStart time.Time
+	WindowEnd   time.Time
+	Duration    time.Duration
+}
+
+// FleetWorker is a worker available for the plan. Assigned holds jobs the
+// worker already has that day; they stay on the route as fixed commitments.
+type FleetWorker struct {
+	ID       uint
+	Start    *Point
+	MaxShift time.Duration
+	Assigned []FleetJob
+}
+
+type FleetOptions struct {
+	SpeedKmh float64
+}
+
+// Visit is a planned stop on a worker's route
+type Visit struct {
+	JobID        uint      `json:"job_id"`
+	Fixed        bool      `json:"fixed"` // already assigned before planning
+	TravelKm     float64   `json:"travel_km"`
+	Arrival      time.Time `json:"arrival"`
+	ServiceStart time.Time `json:"service_start"`
+	ServiceEnd   time.Time `json:"service_end"`
+}
+
+type WorkerPlan struct {
+	WorkerID   uint       `json:"worker_id"`
+	Visits     []Visit    `json:"visits"`
+	TotalKm    float64    `json:"total_km"`
+	ShiftStart *time.Time `json:"shift_start"`
+	ShiftEnd   *time.Time `json:"shift_end"`
+}
+
+type UnassignedJob struct {
+	JobID  uint   `json:"job_id"`
+	Reason string `json:"reason"`
+}
+
+type FleetPlan struct {
+	Plans      []WorkerPlan    `json:"plans"`
+	Unassigned []UnassignedJob `json:"unassigned"`
+}
+
+// PlanFleet assigns jobs to workers with a cheapest-insertion heuristic.
+// Jobs are taken in order of their window start and inserted at the position
+// (across all workers) that adds the least travel while keeping every time
+// window and the worker's maximum shift length satisfied.
+func PlanFleet(workers []FleetWorker, jobs []FleetJob, opts FleetOptions) *FleetPlan {
+	if opts.SpeedKmh <= 0 {
+		opts.SpeedKmh = DefaultSpeedKmh
+	}
+
+	routes := make([][]routeEntry, len(workers))
+	for i, w := range workers {
+		fixed := append([]FleetJob(nil), w.Assigned...)
+		sort.Slice(fixed, func(a, b int) bool { return fixed[a].WindowStart.Before(fixed[b].WindowStart) })
+		for _, job := range fixed {
+			routes[i] = append(routes[i], routeEntry{job: job, fixed: true})
+		}
+	}
+
+	pending := append([]FleetJob(nil), jobs...)
+	sort.SliceStable(pending, func(a, b int) bool { return pending[a].WindowStart.Before(pending[b].WindowStart) })
+
+	plan := &FleetPlan{Plans: []WorkerPlan{}, Unassigned: []UnassignedJob{}}
+
+	for _, job := range pending {
+		if job.Point == nil {
+			plan.Unassigned = append(plan.Unassigned, UnassignedJob{JobID: job.ID, Reason: "customer has no coordinates"})
+			continue
+		}
+
+		bestWorker, bestPos := -1, -1
+		bestCost := 0.0
+
+		for wi, w := range workers {
+			base, ok := simulate(w, routes[wi], opts)
+			if !ok {
+				continue
+			}
+			for pos := 0; pos <= len(routes[wi]); pos++ {
+				candidate := insertAt(routes[wi], pos, routeEntry{job: job})
+				sched, ok := simulate(w, candidate, opts)
+				if !ok {
+					continue
+				}
+				cost := sched.TotalKm - base.TotalKm
+				// Prefer the cheaper insertion, then the less loaded worker
+				if bestWorker < 0 || cost < bestCost-1e-9 ||
+					(cost < bestCost+1e-9 && len(routes[wi]) < len(routes[bestWorker])) {
+					bestWorker, bestPos, bestCost = wi, pos, cost
+				}
+			}
+		}
+
+		if bestWorker < 0 {
+			plan.Unassigned = append(plan.Unassigned, UnassignedJob{JobID: job.ID, Reason: "no worker can reach it within its time window and shift limit"})
+			continue
+		}
+		routes[bestWorker] = insertAt(routes[bestWorker], bestPos, routeEntry{job: job})
+	}
+
+	for wi, w := range workers {
+		sched, _ := simulate(w, routes[wi], opts)
+		sched.WorkerID = w.ID
+		plan.Plans = append(plan.Plans, sched)
+	}
+
+	return plan
+}
+
+type routeEntry struct {
+	job   FleetJob
+	fixed bool
+}
+
+func insertAt(route []routeEntry, pos int, entry routeEntry) []routeEntry {
+	out := make([]routeEntry, 0, len(route)+1)
+	out = append(out, route[:pos]...)
+	out = append(out, entry)
+	return append(out, route[pos:]...)
+}
+
+// simulate walks a route and reports whether all windows and the shift limit hold
+func simulate(w FleetWorker, route []routeEntry, opts FleetOptions) (WorkerPlan, bool) {
+	plan := WorkerPlan{Visits: []Visit{}}
+	if len(route) == 0 {
+		return plan, true
+	}
+
+	feasible := true
+	var shiftStart, prevEnd time.Time
+	prevPoint := w.Start
+
+	for i, entry := range route {
+		job := entry.job
+		km := 0.0
+		if prevPoint != nil && job.Point != nil {
+			km = HaversineKm(*prevPoint, *job.Point)
+		}
+		travel := TravelDuration(km, opts.SpeedKmh)
+
+		var arrival time.Time
+		if i == 0 {
+			// Leave just in time to arrive at the window start
+			arrival = job.WindowStart
+			shiftStart = arrival.Add(-travel)
+		} else {
+			arrival = prevEnd.Add(travel)
+		}
+
+		serviceStart := arrival
+		if serviceStart.Before(job.WindowStart) {
+			serviceStart = job.WindowStart
+		}
+		if serviceStart.After(job.WindowEnd) {
+			feasible = false
+		}
+
+		serviceEnd := serviceStart.Add(job.Duration)
+		plan.Visits = append(plan.Visits, Visit{
+			JobID:        job.ID,
+			Fixed:        entry.fixed,
+			TravelKm:     km,
+			Arrival:      arrival,
+			ServiceStart: serviceStart,
+			ServiceEnd:   serviceEnd,
+		})
+		plan.TotalKm += km
+
+		prevEnd = serviceEnd
+		if job.Point != nil {
+			prevPoint = job.Point
+		}
+	}
+
+	plan.ShiftStart = &shiftStart
+	plan.ShiftEnd = &prevEnd
+
+	if w.MaxShift > 0 && prevEnd.Sub(shiftStart) > w.MaxShift {
+		feasible = false
+	}
+
+	return plan, feasible
+}
+
+// TravelDuration converts a distance to a travel time at the given speed
+func TravelDuration(km float64, speedKmh float64) time.Duration {
+	if speedKmh <= 0 {
+		speedKmh = DefaultSpeedKmh
+	}
+	return time.Duration(km / speedKmh * float64(time.Hour))
+}
@@ -0,0 +1,193 @@
+package routing
+
+import (
+	"testing"
+	"time"
+)
+
+// nine is 09:00 on the planned day
+var nine = time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+
+func fleetJob(id uint, p *Point, startHour, windowMinutes, durationMinutes int) FleetJob {
+	start := nine.Add(time.Duration(startHour-9) * time.Hour)
+	return FleetJob{
+		ID:          id,
+		Point:       p,
+		WindowStart: start,
+		WindowEnd:   start.Add(time.Duration(windowMinutes) * time.Minute),
+		Duration:    time.Duration(durationMinutes) * time.Minute,
+	}
+}
+
+// assignments maps each planned job to its worker
+func assignments(plan *FleetPlan) map[uint]uint {
+	out := make(map[uint]uint)
+	for _, p := range plan.Plans {
+		for _, v := range p.Visits {
+			out[v.JobID] = p.WorkerID
+		}
+	}
+	return out
+}
+
+func unassigned(plan *FleetPlan) map[uint]string {
+	out := make(map[uint]string)
+	for _, u := range plan.Unassigned {
+		out[u.JobID] = u.Reason
+	}
+	return out
+}
+
+func TestPlanFleet(t *testing.T) {
+	west, eastEnd := ptr(east(0)), ptr(east(10))
+
+	tests := []struct {
+		name           string
+		workers        []FleetWorker
+		jobs           []FleetJob
+		wantAssigned   map[uint]uint
+		wantUnassigned []uint
+	}{
+		{
+			name:         "nothing to plan",
+			workers:      []FleetWorker{{ID: 1, Start: west}},
+			wantAssigned: map[uint]uint{},
+		},
+		{
+			name:           "no coordinates",
+			workers:        []FleetWorker{{ID: 1, Start: west}},
+			jobs:           []FleetJob{fleetJob(10, nil, 9, 60, 30)},
+			wantAssigned:   map[uint]uint{},
+			wantUnassigned: []uint{10},
+		},
+		{
+			name:           "no workers",
+			jobs:           []FleetJob{fleetJob(10, west, 9, 60, 30)},
+			wantAssigned:   map[uint]uint{},
+			wantUnassigned: []uint{10},
+		},
+		{
+			name:    "jobs go to the nearer worker",
+			workers: []FleetWorker{{ID: 1, Start: west}, {ID: 2, Start: eastEnd}},
+			jobs: []FleetJob{
+				fleetJob(10, ptr(east(9)), 9, 60, 30),
+				fleetJob(11, ptr(east(1)), 9, 60, 30),
+				fleetJob(12, ptr(east(2)), 11, 60, 30),
+				fleetJob(13, ptr(east(8)), 11, 60, 30),
+			},
+			wantAssigned: map[uint]uint{10: 2, 11: 1, 12: 1, 13: 2},
+		},
+		{
+			name:    "equal cost goes to the less loaded worker",
+			workers: []FleetWorker{{ID: 1, Start: west}, {ID: 2, Start: west}},
+			jobs: []FleetJob{
+				fleetJob(10, west, 9, 0, 60),
+				fleetJob(11, west, 9, 0, 60),
+			},
+			wantAssigned: map[uint]uint{10: 1, 11: 2},
+		},
+		{
+			name:    "windows that cannot both be met",
+			workers: []FleetWorker{{ID: 1, Start: west}},
+			jobs: []FleetJob{
+				fleetJob(10, ptr(east(1)), 9, 0, 60),
+				fleetJob(11, ptr(east(5)), 9, 30, 60),
+			},
+			wantAssigned:   map[uint]uint{10: 1},
+			wantUnassigned: []uint{11},
+		},
+		{
+			name:    "shift limit",
+			workers: []FleetWorker{{ID: 1, Start: west, MaxShift: 3*time.Hour + 30*time.Minute}},
+			jobs: []FleetJob{
+				fleetJob(10, ptr(east(1)), 9, 0, 60),
+				fleetJob(11, ptr(east(1)), 11, 0, 60),
+				fleetJob(12, ptr(east(1)), 14, 0, 60),
+			},
+			wantAssigned:   map[uint]uint{10: 1, 11: 1},
+			wantUnassigned: []uint{12},
+		},
+		{
+			name: "assigned jobs stay and block their time",
+			workers: []FleetWorker{
+				{ID: 1, Start: west, Assigned: []FleetJob{fleetJob(1, ptr(east(1)), 9, 0, 180)}},
+				{ID: 2, Start: eastEnd},
+			},
+			jobs: []FleetJob{
+				fleetJob(10, ptr(east(1)), 10, 30, 60),
+				fleetJob(11, ptr(east(2)), 13, 60, 60),
+			},
+			wantAssigned: map[uint]uint{1: 1, 10: 2, 11: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := PlanFleet(tt.workers, tt.jobs, FleetOptions{})
+
+			got := assignments(plan)
+			if len(got) != len(tt.wantAssigned) {
+				t.Errorf("assigned = %v, want %v", got, tt.wantAssigned)
+			}
+			for jobID, workerID := range tt.wantAssigned {
+				if got[jobID] != workerID {
+					t.Errorf("job %d went to worker %d, want %d", jobID, got[jobID], workerID)
+				}
+			}
+
+			left := unassigned(plan)
+			if len(left) != len(tt.wantUnassigned) {
+				t.Errorf("unassigned = %v, want %v", left, tt.wantUnassigned)
+			}
+			for _, jobID := range tt.wantUnassigned {
+				if left[jobID] == "" {
+					t.Errorf("job %d is not reported unassigned", jobID)
+				}
+			}
+
+			if len(plan.Plans) != len(tt.workers) {
+				t.Errorf("len(Plans) = %d, want one per worker", len(plan.Plans))
+			}
+		})
+	}
+}
+
+func TestPlanFleetTimes(t *testing.T) {
+	start, a, b := ptr(east(0)), ptr(east(1)), ptr(east(2))
+	workers := []FleetWorker{{ID: 1, Start: start, Assigned: []FleetJob{fleetJob(1, b, 10, 120, 30)}}}
+	jobs := []FleetJob{fleetJob(10, a, 9, 30, 30)}
+
+	plan := PlanFleet(workers, jobs, FleetOptions{SpeedKmh: 40})
+	visits := plan.Plans[0].Visits
+	if len(visits) != 2 || visits[0].JobID != 10 || visits[1].JobID != 1 {
+		t.Fatalf("Visits = %+v, want job 10 then the assigned job 1", visits)
+	}
+
+	leg := TravelDuration(HaversineKm(*a, *b), 40)
+	tests := []struct {
+		name string
+		got  interface{}
+		want interface{}
+	}{
+		{"new job is not fixed", visits[0].Fixed, false},
+		{"assigned job is fixed", visits[1].Fixed, true},
+		{"first arrival is the window start", visits[0].Arrival, nine},
+		{"shift starts in time to get there", *plan.Plans[0].ShiftStart, nine.Add(-TravelDuration(HaversineKm(*start, *a), 40))},
+		{"first service ends", visits[0].ServiceEnd, nine.Add(30 * time.Minute)},
+		{"next arrival after the drive", visits[1].Arrival, nine.Add(30*time.Minute + leg)},
+		{"early arrival waits for the window", visits[1].ServiceStart, nine.Add(time.Hour)},
+		{"shift ends after the last job", *plan.Plans[0].ShiftEnd, nine.Add(90 * time.Minute)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.want {
+				t.Errorf("got %v, want %v", tt.got, tt.want)
+			}
+		})
+	}
+
+	wantKm := HaversineKm(*start, *a) + HaversineKm(*a, *b)
+	if plan.Plans[0].TotalKm != wantKm {
+		t.Errorf("TotalKm = %f, want %f", plan.Plans[0].TotalKm, wantKm)
+	}
+}
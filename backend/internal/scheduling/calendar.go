@@ -0,0 +1,243 @@
+package scheduling
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/ireuven89/routewise/internal/models"
+)
+
+const clockLayout = "15:04"
+
+type Interval struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+func (i Interval) overlaps(o Interval) bool {
+	return i.Start.Before(o.End) && o.Start.Before(i.End)
+}
+
+// DefaultWorkingHours is used for workers who have none configured:
+// Monday to Friday, 08:00-17:00
+func DefaultWorkingHours() []models.WorkingHours {
+	hours := make([]models.WorkingHours, 0, 5)
+	for day := time.Monday; day <= time.Friday; day++ {
+		hours = append(hours, models.WorkingHours{Weekday: int(day), StartTime: "08:00", EndTime: "17:00"})
+	}
+	return hours
+}
+
+// Calendar is everything known about one worker's time in a date range
+type Calendar struct {
+	Location *time.Location
+	Hours    []models.WorkingHours
+	TimeOff  []*models.TimeOff
+	Holidays []*models.Holiday
+	Busy     []*models.BusyBlock
+	// Buffer is the travel time kept clear before and after every job
+	Buffer time.Duration
+}
+
+// Working returns the worker's working hours in [from, to), with holidays removed
+func (c *Calendar) Working(from, to time.Time) []Interval {
+	holidays := make(map[string]bool, len(c.Holidays))
+	for _, h := range c.Holidays {
+		holidays[h.Date] = true
+	}
+
+	var out []Interval
+	day := startOfDay(from.In(c.Location))
+	for day.Before(to) {
+		if !holidays[day.Format("2006-01-02")] {
+			for _, h := range c.Hours {
+				if time.Weekday(h.Weekday) != day.Weekday() {
+					continue
+				}
+				start, err1 := clockOn(day, h.StartTime)
+				end, err2 := clockOn(day, h.EndTime)
+				if err1 != nil || err2 != nil {
+					continue
+				}
+				if block, ok := clip(Interval{start, end}, from, to); ok {
+					out = append(out, block)
+				}
+			}
+		}
+		day = time.Date(day.Year(), day.Month(), day.Day()+1, 0, 0, 0, 0, c.Location)
+	}
+
+	return merge(out)
+}
+
+// Blocked returns the time the worker cannot take new work: time off, and
+// jobs widened by the travel buffer
+func (c *Calendar) Blocked() []Interval {
+	var out []Interval
+	for _, t := range c.TimeOff {
+		out = append(out, Interval{t.StartsAt, t.EndsAt})
+	}
+	for _, b := range c.Busy {
+		out = append(out, Interval{b.Start.Add(-c.Buffer), b.End.Add(c.Buffer)})
+	}
+	return merge(out)
+}
+
+// Free returns the slots of at least minLength inside working hours that
+// are not blocked
+func (c *Calendar) Free(from, to time.Time, minLength time.Duration) []Interval {
+	free := subtract(c.Working(from, to), c.Blocked())
+
+	out := []Interval{}
+	for _, slot := range free {
+		if slot.End.Sub(slot.Start) >= minLength {
+			out = append(out, slot)
+		}
+	}
+	return out
+}
+
+// Conflicts lists every reason the worker cannot do a job at [start, end)
+func (c *Calendar) Conflicts(start, end time.Time) []models.ScheduleConflict {
+	slot := Interval{start, end}
+	conflicts := []models.ScheduleConflict{}
+
+	for _, b := range c.Busy {
+		padded := Interval{b.Start.Add(-c.Buffer), b.End.Add(c.Buffer)}
+		if !slot.overlaps(padded) {
+			continue
+		}
+		jobID := b.JobID
+		detail := fmt.Sprintf("overlaps %q", b.Title)
+		if !slot.overlaps(Interval{b.Start, b.End}) {
+			detail = fmt.Sprintf("less than %s travel time from %q", c.Buffer, b.Title)
+		}
+		conflicts = append(conflicts, models.ScheduleConflict{
+			Type:   models.ConflictJobOverlap,
+			JobID:  &jobID,
+			Start:  b.Start,
+			End:    b.End,
+			Detail: detail,
+		})
+	}
+
+	for _, t := range c.TimeOff {
+		if slot.overlaps(Interval{t.StartsAt, t.EndsAt}) {
+			conflicts = append(conflicts, models.ScheduleConflict{
+				Type:   models.ConflictTimeOff,
+				Start:  t.StartsAt,
+				End:    t.EndsAt,
+				Detail: nonEmpty(t.Reason, "time off"),
+			})
+		}
+	}
+
+	for _, h := range c.Holidays {
+		day, err := time.ParseInLocation("2006-01-02", h.Date, c.Location)
+		if err != nil {
+			continue
+		}
+		holiday := Interval{day, day.AddDate(0, 0, 1)}
+		if slot.overlaps(holiday) {
+			conflicts = append(conflicts, models.ScheduleConflict{
+				Type:   models.ConflictHoliday,
+				Start:  holiday.Start,
+				End:    holiday.End,
+				Detail: h.Name,
+			})
+		}
+	}
+
+	// The slot must fit inside working hours
+	if len(subtract([]Interval{slot}, c.Working(start, end))) > 0 {
+		conflicts = append(conflicts, models.ScheduleConflict{
+			Type:   models.ConflictOutsideHours,
+			Start:  start,
+			End:    end,
+			Detail: "outside working hours",
+		})
+	}
+
+	return conflicts
+}
+
+func clockOn(day time.Time, clock string) (time.Time, error) {
+	t, err := time.Parse(clockLayout, clock)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Date(day.Year(), day.Month(), day.Day(), t.Hour(), t.Minute(), 0, 0, day.Location()), nil
+}
+
+func startOfDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+func clip(i Interval, from, to time.Time) (Interval, bool) {
+	if i.Start.Before(from) {
+		i.Start = from
+	}
+	if i.End.After(to) {
+		i.End = to
+	}
+	return i, i.Start.Before(i.End)
+}
+
+// merge sorts intervals and joins the ones that touch or overlap
+func merge(in []Interval) []Interval {
+	if len(in) == 0 {
+		return nil
+	}
+	sorted := append([]Interval(nil), in...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Start.Before(sorted[j].Start) })
+
+	out := []Interval{sorted[0]}
+	for _, i := range sorted[1:] {
+		last := &out[len(out)-1]
+		if !i.Start.After(last.End) {
+			if i.End.After(last.End) {
+				last.End = i.End
+			}
+			continue
+		}
+		out = append(out, i)
+	}
+	return out
+}
+
+// subtract removes every interval in cut from base
+func subtract(base, cut []Interval) []Interval {
+	cut = merge(cut)
+
+	var out []Interval
+	for _, b := range merge(base) {
+		rest := []Interval{b}
+		for _, c := range cut {
+			var next []Interval
+			for _, r := range rest {
+				if !r.overlaps(c) {
+					next = append(next, r)
+					continue
+				}
+				if r.Start.Before(c.Start) {
+					next = append(next, Interval{r.Start, c.Start})
+				}
+				if c.End.Before(r.End) {
+					next = append(next, Interval{c.End, r.End})
+				}
+			}
+			rest = next
+		}
+		out = append(out, rest...)
+	}
+	return out
+}
+
+func nonEmpty(s, fallback string) string {
+	if s == "" {
+		return fallback
+	}
+	return s
+}
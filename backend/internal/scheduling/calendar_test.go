@@ -0,0 +1,198 @@
+package scheduling
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ireuven89/routewise/internal/models"
+)
+
+// monday is a Monday with no daylight saving change around it
+var monday = time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)
+
+// at returns the time hh:mm on monday plus days
+func at(days, hour, minute int) time.Time {
+	return monday.AddDate(0, 0, days).Add(time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute)
+}
+
+func span(startHour, endHour int) Interval {
+	return Interval{at(0, startHour, 0), at(0, endHour, 0)}
+}
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []Interval
+		want []Interval
+	}{
+		{"empty", nil, nil},
+		{"single", []Interval{span(8, 9)}, []Interval{span(8, 9)}},
+		{"disjoint are sorted", []Interval{span(13, 14), span(8, 9)}, []Interval{span(8, 9), span(13, 14)}},
+		{"overlapping", []Interval{span(8, 11), span(10, 12)}, []Interval{span(8, 12)}},
+		{"touching", []Interval{span(8, 10), span(10, 12)}, []Interval{span(8, 12)}},
+		{"contained", []Interval{span(8, 17), span(10, 12)}, []Interval{span(8, 17)}},
+		{"chain", []Interval{span(14, 16), span(8, 10), span(9, 15)}, []Interval{span(8, 16)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := merge(tt.in); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("merge() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubtract(t *testing.T) {
+	tests := []struct {
+		name string
+		base []Interval
+		cut  []Interval
+		want []Interval
+	}{
+		{"nothing cut", []Interval{span(8, 17)}, nil, []Interval{span(8, 17)}},
+		{"cut outside", []Interval{span(8, 12)}, []Interval{span(13, 14)}, []Interval{span(8, 12)}},
+		{"cut touching end", []Interval{span(8, 12)}, []Interval{span(12, 14)}, []Interval{span(8, 12)}},
+		{"cut middle", []Interval{span(8, 17)}, []Interval{span(12, 13)}, []Interval{span(8, 12), span(13, 17)}},
+		{"cut start", []Interval{span(8, 17)}, []Interval{span(7, 9)}, []Interval{span(9, 17)}},
+		{"cut end", []Interval{span(8, 17)}, []Interval{span(16, 18)}, []Interval{span(8, 16)}},
+		{"cut everything", []Interval{span(8, 17)}, []Interval{span(6, 20)}, nil},
+		{"several cuts", []Interval{span(8, 17)}, []Interval{span(15, 16), span(9, 10), span(9, 11)}, []Interval{span(8, 9), span(11, 15), span(16, 17)}},
+		{"several bases", []Interval{span(8, 12), span(13, 17)}, []Interval{span(11, 14)}, []Interval{span(8, 11), span(14, 17)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := subtract(tt.base, tt.cut); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("subtract() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWorking(t *testing.T) {
+	cal := &Calendar{
+		Location: time.UTC,
+		Hours:    DefaultWorkingHours(),
+		Holidays: []*models.Holiday{{Date: "2026-03-03", Name: "Founders day"}},
+	}
+
+	// Monday to Sunday: Tuesday is a holiday and the weekend is off
+	got := cal.Working(at(0, 0, 0), at(7, 0, 0))
+	want := []Interval{
+		{at(0, 8, 0), at(0, 17, 0)},
+		{at(2, 8, 0), at(2, 17, 0)},
+		{at(3, 8, 0), at(3, 17, 0)},
+		{at(4, 8, 0), at(4, 17, 0)},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Working() = %v, want %v", got, want)
+	}
+
+	// The range clips the day
+	got = cal.Working(at(0, 12, 0), at(0, 20, 0))
+	want = []Interval{{at(0, 12, 0), at(0, 17, 0)}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Working() clipped = %v, want %v", got, want)
+	}
+}
+
+func TestWorkingAcrossDaylightSaving(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("time zone data not available")
+	}
+
+	// Clocks moved forward on Sunday 2026-03-08; the hours stay 08:00-17:00 local
+	cal := &Calendar{Location: loc, Hours: DefaultWorkingHours()}
+	from := time.Date(2026, 3, 6, 0, 0, 0, 0, loc)
+	got := cal.Working(from, from.AddDate(0, 0, 4))
+
+	want := []Interval{
+		{time.Date(2026, 3, 6, 8, 0, 0, 0, loc), time.Date(2026, 3, 6, 17, 0, 0, 0, loc)},
+		{time.Date(2026, 3, 9, 8, 0, 0, 0, loc), time.Date(2026, 3, 9, 17, 0, 0, 0, loc)},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Working() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if !got[i].Start.Equal(want[i].Start) || !got[i].End.Equal(want[i].End) {
+			t.Errorf("Working()[%d] = %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestFree(t *testing.T) {
+	cal := &Calendar{
+		Location: time.UTC,
+		Hours:    DefaultWorkingHours(),
+		Buffer:   15 * time.Minute,
+		Busy:     []*models.BusyBlock{{JobID: 1, Title: "Boiler", Start: at(0, 10, 0), End: at(0, 11, 0)}},
+		TimeOff:  []*models.TimeOff{{StartsAt: at(0, 14, 0), EndsAt: at(0, 15, 0)}},
+	}
+
+	got := cal.Free(at(0, 0, 0), at(1, 0, 0), 30*time.Minute)
+	want := []Interval{
+		{at(0, 8, 0), at(0, 9, 45)},
+		{at(0, 11, 15), at(0, 14, 0)},
+		{at(0, 15, 0), at(0, 17, 0)},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Free() = %v, want %v", got, want)
+	}
+
+	// Slots shorter than the minimum are dropped
+	got = cal.Free(at(0, 0, 0), at(1, 0, 0), 150*time.Minute)
+	want = []Interval{{at(0, 11, 15), at(0, 14, 0)}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Free() with long minimum = %v, want %v", got, want)
+	}
+}
+
+func TestConflicts(t *testing.T) {
+	cal := &Calendar{
+		Location: time.UTC,
+		Hours:    DefaultWorkingHours(),
+		Buffer:   30 * time.Minute,
+		Busy:     []*models.BusyBlock{{JobID: 7, Title: "Boiler", Start: at(0, 10, 0), End: at(0, 11, 0)}},
+		TimeOff:  []*models.TimeOff{{StartsAt: at(0, 14, 0), EndsAt: at(0, 15, 0)}},
+		Holidays: []*models.Holiday{{Date: "2026-03-03", Name: "Founders day"}},
+	}
+
+	tests := []struct {
+		name  string
+		start time.Time
+		end   time.Time
+		want  []string
+	}{
+		{"free slot", at(0, 8, 0), at(0, 9, 0), []string{}},
+		{"ends as the buffer starts", at(0, 8, 30), at(0, 9, 30), []string{}},
+		{"overlaps a job", at(0, 10, 30), at(0, 11, 30), []string{models.ConflictJobOverlap}},
+		{"inside the travel buffer", at(0, 11, 0), at(0, 12, 0), []string{models.ConflictJobOverlap}},
+		{"time off", at(0, 13, 30), at(0, 14, 30), []string{models.ConflictTimeOff}},
+		{"after hours", at(0, 16, 30), at(0, 17, 30), []string{models.ConflictOutsideHours}},
+		{"holiday", at(1, 9, 0), at(1, 10, 0), []string{models.ConflictHoliday, models.ConflictOutsideHours}},
+		{"weekend", at(5, 9, 0), at(5, 10, 0), []string{models.ConflictOutsideHours}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []string{}
+			for _, conflict := range cal.Conflicts(tt.start, tt.end) {
+				got = append(got, conflict.Type)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Conflicts() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	conflicts := cal.Conflicts(at(0, 11, 0), at(0, 12, 0))
+	if len(conflicts) != 1 || conflicts[0].JobID == nil || *conflicts[0].JobID != 7 {
+		t.Fatalf("Conflicts() = %+v, want the busy job", conflicts)
+	}
+	if want := `less than 30m0s travel time from "Boiler"`; conflicts[0].Detail != want {
+		t.Errorf("Detail = %q, want %q", conflicts[0].Detail, want)
+	}
+}
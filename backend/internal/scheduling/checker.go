@@ -0,0 +1,97 @@
+package scheduling
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/ireuven89/routewise/internal/models"
+	"github.com/ireuven89/routewise/internal/repository"
+)
+
+// Checker loads worker calendars and checks proposed job slots against them
+type Checker struct {
+	availabilityRepo *repository.AvailabilityRepository
+}
+
+func NewChecker(db *sql.DB) *Checker {
+	return &Checker{
+		availabilityRepo: repository.NewAvailabilityRepository(db),
+	}
+}
+
+// WithTx returns a checker that reads through tx, for checks made inside
+// the transaction that saves the slot
+func (ch *Checker) WithTx(tx *sql.Tx) *Checker {
+	return &Checker{availabilityRepo: ch.availabilityRepo.WithTx(tx)}
+}
+
+type CheckResult struct {
+	Conflicts []models.ScheduleConflict `json:"conflicts"`
+	// Blocking is set when the organization rejects conflicting schedules.
+	// Working outside normal hours only ever warns.
+	Blocking bool `json:"blocking"`
+}
+
+// Calendar loads the worker's calendar for [from, to). excludeJobID leaves
+// out a job that is being rescheduled so it does not conflict with itself.
+func (ch *Checker) Calendar(organizationID, workerID uint, from, to time.Time, excludeJobID uint) (*Calendar, *models.SchedulingSettings, error) {
+	settings, err := ch.availabilityRepo.GetSettings(organizationID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	loc, err := time.LoadLocation(settings.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+
+	cal := &Calendar{
+		Location: loc,
+		Buffer:   time.Duration(settings.TravelBufferMinutes) * time.Minute,
+	}
+
+	if cal.Hours, err = ch.availabilityRepo.GetWorkingHours(workerID); err != nil {
+		return nil, nil, err
+	}
+	if len(cal.Hours) == 0 {
+		cal.Hours = DefaultWorkingHours()
+	}
+
+	// Widen the window so jobs just outside it still count against the buffer
+	if cal.Busy, err = ch.availabilityRepo.FindBusy(workerID, organizationID, from.Add(-cal.Buffer), to.Add(cal.Buffer), excludeJobID); err != nil {
+		return nil, nil, err
+	}
+	if cal.TimeOff, err = ch.availabilityRepo.FindTimeOff(workerID, from, to); err != nil {
+		return nil, nil, err
+	}
+
+	firstDay := from.In(loc).Format("2006-01-02")
+	lastDay := to.In(loc).Format("2006-01-02")
+	if cal.Holidays, err = ch.availabilityRepo.FindHolidays(organizationID, firstDay, lastDay); err != nil {
+		return nil, nil, err
+	}
+
+	return cal, settings, nil
+}
+
+// Check reports the conflicts of giving the worker a job at start for durationMinutes
+func (ch *Checker) Check(organizationID, workerID uint, start time.Time, durationMinutes int, excludeJobID uint) (*CheckResult, error) {
+	end := start.Add(time.Duration(durationMinutes) * time.Minute)
+
+	cal, settings, err := ch.Calendar(organizationID, workerID, start, end, excludeJobID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &CheckResult{Conflicts: cal.Conflicts(start, end)}
+	if settings.ConflictMode == models.ConflictModeReject {
+		for _, conflict := range result.Conflicts {
+			if conflict.Type != models.ConflictOutsideHours {
+				result.Blocking = true
+				break
+			}
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,88 @@
+// Package trash purges deleted project files, with their stored objects,
+// once they have been in the trash longer than the retention window
+package trash
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/ireuven89/routewise/internal/models"
+	"github.com/ireuven89/routewise/internal/repository"
+	"github.com/ireuven89/routewise/services"
+)
+
+// purgeBatch bounds how many files one pass removes
+const purgeBatch = 100
+
+type Purger struct {
+	fileRepo  *repository.FileRepository
+	storage   services.Storage
+	retention time.Duration
+}
+
+func NewPurger(db *sql.DB, storage services.Storage, retention time.Duration) *Purger {
+	return &Purger{
+		fileRepo:  repository.NewFileRepository(db),
+		storage:   storage,
+		retention: retention,
+	}
+}
+
+// Run purges once immediately and then on every tick until ctx is done
+func (p *Purger) Run(ctx context.Context, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+
+	for {
+		if _, err := p.Purge(ctx, time.Now()); err != nil {
+			sentry.CaptureException(err)
+			log.Printf("trash purge failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Purge hard-deletes files trashed more than the retention window before
+// now. A file whose objects cannot be deleted is kept and retried on the
+// next pass.
+func (p *Purger) Purge(ctx context.Context, now time.Time) (int, error) {
+	expired, err := p.fileRepo.FindTrashedBefore(now.Add(-p.retention), purgeBatch)
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, file := range expired {
+		if err := deleteObjects(ctx, p.storage, file); err != nil {
+			log.Printf("file %d: %v", file.ID, err)
+			continue
+		}
+		if err := p.fileRepo.Delete(file.ID); err != nil {
+			return purged, err
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// deleteObjects removes a file's original and renditions from storage,
+// renditions first so none outlive the original
+func deleteObjects(ctx context.Context, storage services.Storage, file *models.ProjectFile) error {
+	for _, key := range []string{file.ThumbnailS3Key, file.MediumS3Key, file.S3Key} {
+		if key == "" {
+			continue
+		}
+		if err := storage.DeleteFile(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
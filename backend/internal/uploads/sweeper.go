@@ -0,0 +1,91 @@
+// Package uploads cleans up direct-to-storage upload slots that were never
+// confirmed
+package uploads
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/ireuven89/routewise/internal/models"
+	"github.com/ireuven89/routewise/internal/repository"
+	"github.com/ireuven89/routewise/services"
+)
+
+const (
+	// sweepBatch bounds how many slots one pass removes
+	sweepBatch = 100
+	// sweepGrace keeps a slot past its expiry so a confirmation that is
+	// already in flight does not lose its object
+	sweepGrace = time.Hour
+)
+
+// Sweeper deletes expired upload slots and whatever the client managed to
+// upload for them
+type Sweeper struct {
+	uploadRepo *repository.UploadRepository
+	storage    services.Storage
+}
+
+func NewSweeper(db *sql.DB, storage services.Storage) *Sweeper {
+	return &Sweeper{
+		uploadRepo: repository.NewUploadRepository(db),
+		storage:    storage,
+	}
+}
+
+// Run sweeps once immediately and then on every tick until ctx is done
+func (s *Sweeper) Run(ctx context.Context, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.Sweep(ctx, time.Now()); err != nil {
+			sentry.CaptureException(err)
+			log.Printf("upload sweep failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sweep removes slots that expired more than sweepGrace before now. A slot
+// whose object cannot be deleted is kept and retried on the next pass.
+func (s *Sweeper) Sweep(ctx context.Context, now time.Time) (int, error) {
+	expired, err := s.uploadRepo.FindExpired(now.Add(-sweepGrace), sweepBatch)
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, upload := range expired {
+		if err := Discard(ctx, s.storage, upload); err != nil {
+			log.Printf("upload %d: %v", upload.ID, err)
+			continue
+		}
+		if err := s.uploadRepo.Delete(upload.ID); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// Discard deletes whatever was uploaded for a slot, including the parts of
+// an unfinished multipart upload
+func Discard(ctx context.Context, storage services.Storage, upload *models.FileUpload) error {
+	if upload.Multipart() {
+		if multipart, ok := storage.(services.MultipartUploader); ok {
+			if err := multipart.AbortMultipartUpload(ctx, upload.S3Key, upload.MultipartID); err != nil {
+				return err
+			}
+		}
+	}
+	return storage.DeleteFile(ctx, upload.S3Key)
+}
@@ -0,0 +1,122 @@
+// Package usage keeps each organization's storage usage counter in step with
+// its project files, and removes stored objects that nothing refers to
+package usage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/ireuven89/routewise/internal/repository"
+	"github.com/ireuven89/routewise/services"
+)
+
+// orphanGrace is how old an object nothing refers to must be before it is
+// deleted. Uploads are written to storage before their file is saved, and
+// photo renditions before the file is updated.
+const orphanGrace = 24 * time.Hour
+
+type Reconciler struct {
+	usageRepo *repository.UsageRepository
+	storage   services.Storage
+}
+
+func NewReconciler(db *sql.DB, storage services.Storage) *Reconciler {
+	return &Reconciler{
+		usageRepo: repository.NewUsageRepository(db),
+		storage:   storage,
+	}
+}
+
+// Run reconciles every organization once immediately and then on every
+// tick until ctx is done
+func (r *Reconciler) Run(ctx context.Context, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+
+	for {
+		if err := r.ReconcileAll(ctx); err != nil {
+			sentry.CaptureException(err)
+			log.Printf("usage reconciliation failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ReconcileAll reconciles each organization in turn. One that fails is
+// logged and left for the next pass.
+func (r *Reconciler) ReconcileAll(ctx context.Context) error {
+	orgIDs, err := r.usageRepo.FindOrganizationIDs()
+	if err != nil {
+		return err
+	}
+
+	for _, orgID := range orgIDs {
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err := r.Reconcile(ctx, orgID); err != nil {
+			sentry.CaptureException(err)
+			log.Printf("organization %d: usage reconciliation failed: %v", orgID, err)
+		}
+	}
+	return nil
+}
+
+// Reconcile recounts the organization's usage from its project files, then
+// deletes the objects under its projects that no file or open upload refers
+// to, such as those left by failed rollbacks
+func (r *Reconciler) Reconcile(ctx context.Context, organizationID uint) error {
+	before, after, err := r.usageRepo.Recount(organizationID)
+	if err != nil {
+		return err
+	}
+	if before != after {
+		log.Printf("organization %d: storage usage was %d bytes, its files add up to %d", organizationID, before, after)
+	}
+
+	keys, err := r.usageRepo.FindObjectKeys(organizationID)
+	if err != nil {
+		return err
+	}
+	prefix := fmt.Sprintf("organizations/%d/projects/", organizationID)
+	removed, err := r.removeOrphans(ctx, prefix, keys, time.Now().Add(-orphanGrace))
+	if removed > 0 {
+		log.Printf("organization %d: deleted %d orphaned objects", organizationID, removed)
+	}
+	return err
+}
+
+// removeOrphans deletes the objects under prefix that are not in keys and
+// were last modified before cutoff. An object that cannot be deleted is
+// logged and tried again on the next pass.
+func (r *Reconciler) removeOrphans(ctx context.Context, prefix string, keys map[string]bool, cutoff time.Time) (int, error) {
+	var orphans []string
+	err := r.storage.ListFiles(ctx, prefix, func(obj services.ObjectInfo) error {
+		if !keys[obj.Key] && obj.LastModified.Before(cutoff) {
+			orphans = append(orphans, obj.Key)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, key := range orphans {
+		if err := r.storage.DeleteFile(ctx, key); err != nil {
+			log.Printf("orphaned object %s: %v", key, err)
+			continue
+		}
+		removed++
+	}
+	return removed, nil
+}
@@ -0,0 +1,79 @@
+package usage
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ireuven89/routewise/services"
+)
+
+func TestRemoveOrphans(t *testing.T) {
+	ctx := context.Background()
+	prefix := "organizations/1/projects/"
+	referenced := map[string]bool{
+		prefix + "5/photo/1_a.jpg":                 true,
+		prefix + "5/photo/1_a.jpg.thumb.jpg":       true,
+		prefix + "5/document/2_pending-upload.pdf": true,
+	}
+
+	tests := []struct {
+		name        string
+		cutoff      time.Duration // from now
+		wantRemoved []string
+	}{
+		{
+			name:        "old unreferenced objects are deleted",
+			cutoff:      time.Minute,
+			wantRemoved: []string{prefix + "5/document/3_rolled-back.pdf", prefix + "6/photo/4_purge-failed.jpg"},
+		},
+		{
+			name:        "recent objects are kept",
+			cutoff:      -time.Minute,
+			wantRemoved: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := services.NewMemoryStorage(services.NewURLSigner("http://localhost", []byte("secret")))
+			keys := []string{
+				prefix + "5/photo/1_a.jpg",
+				prefix + "5/photo/1_a.jpg.thumb.jpg",
+				prefix + "5/document/2_pending-upload.pdf",
+				prefix + "5/document/3_rolled-back.pdf",
+				prefix + "6/photo/4_purge-failed.jpg",
+				"organizations/2/projects/7/photo/5_other-org.jpg",
+				"organizations/1/branding/6_logo.png",
+			}
+			for _, key := range keys {
+				if err := storage.UploadFile(ctx, strings.NewReader("data"), key, "application/octet-stream"); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			r := &Reconciler{storage: storage}
+			removed, err := r.removeOrphans(ctx, prefix, referenced, time.Now().Add(tt.cutoff))
+			if err != nil {
+				t.Fatalf("removeOrphans() error = %v", err)
+			}
+			if removed != len(tt.wantRemoved) {
+				t.Errorf("removeOrphans() = %d, want %d", removed, len(tt.wantRemoved))
+			}
+
+			var gone []string
+			for _, key := range keys {
+				if _, err := storage.StatFile(ctx, key); errors.Is(err, services.ErrObjectNotFound) {
+					gone = append(gone, key)
+				}
+			}
+			sort.Strings(gone)
+			if strings.Join(gone, ",") != strings.Join(tt.wantRemoved, ",") {
+				t.Errorf("deleted %v, want %v", gone, tt.wantRemoved)
+			}
+		})
+	}
+}
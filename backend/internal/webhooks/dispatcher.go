@@ -0,0 +1,261 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/ireuven89/routewise/internal/events"
+	"github.com/ireuven89/routewise/internal/models"
+	"github.com/ireuven89/routewise/internal/repository"
+)
+
+const (
+	// MaxAttempts includes the first try; after that the delivery is failed
+	MaxAttempts = 8
+
+	firstRetryDelay = 30 * time.Second
+	maxRetryDelay   = 6 * time.Hour
+
+	// A claimed delivery is not picked up again for this long, so a crash
+	// mid-send only delays it
+	claimLease = 5 * time.Minute
+
+	queueSize   = 1000
+	claimBatch  = 50
+	concurrency = 4
+
+	// Response bodies are drained up to this much so connections are reused.
+	// They are never stored, as they could carry data the org should not see.
+	maxDrainedBody = 64 << 10
+)
+
+// Dispatcher turns bus events into webhook deliveries and sends them. Every
+// delivery is stored before it is attempted, so retries survive restarts.
+type Dispatcher struct {
+	webhookRepo *repository.WebhookRepository
+	client      *http.Client
+	queue       chan events.Event
+	sem         chan struct{}
+	wg          sync.WaitGroup
+}
+
+func NewDispatcher(db *sql.DB, client *http.Client) *Dispatcher {
+	if client == nil {
+		client = NewClient(10 * time.Second)
+	}
+	return &Dispatcher{
+		webhookRepo: repository.NewWebhookRepository(db),
+		client:      client,
+		queue:       make(chan events.Event, queueSize),
+		sem:         make(chan struct{}, concurrency),
+	}
+}
+
+// Enqueue is registered with Bus.Listen. It runs on the publishing request,
+// so it only hands the event over to Run.
+func (d *Dispatcher) Enqueue(event events.Event) {
+	select {
+	case d.queue <- event:
+	default:
+		err := fmt.Errorf("webhook queue full, dropping event %s (%s)", event.ID, event.Type)
+		sentry.CaptureException(err)
+		log.Print(err)
+	}
+}
+
+// Run records queued events as deliveries and sends due deliveries, polling
+// for retries every tick, until ctx is done
+func (d *Dispatcher) Run(ctx context.Context, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			d.wg.Wait()
+			return
+		case event := <-d.queue:
+			if err := d.record(event); err != nil {
+				sentry.CaptureException(err)
+				log.Printf("webhook event %s: %v", event.ID, err)
+			}
+			d.sendDue(ctx)
+		case <-ticker.C:
+			d.sendDue(ctx)
+		}
+	}
+}
+
+// record creates one pending delivery per subscription that wants the event
+func (d *Dispatcher) record(event events.Event) error {
+	subs, err := d.webhookRepo.FindActiveSubscriptions(event.OrganizationID, event.Type)
+	if err != nil || len(subs) == 0 {
+		return err
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	for _, sub := range subs {
+		delivery := &models.WebhookDelivery{
+			SubscriptionID: sub.ID,
+			OrganizationID: event.OrganizationID,
+			EventID:        event.ID,
+			EventType:      event.Type,
+			Payload:        payload,
+		}
+		if err := d.webhookRepo.CreateDelivery(delivery); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sendDue claims due deliveries and sends them without waiting for the
+// responses, at most concurrency at a time
+func (d *Dispatcher) sendDue(ctx context.Context) {
+	deliveries, err := d.webhookRepo.ClaimDue(time.Now(), claimLease, claimBatch)
+	if err != nil {
+		sentry.CaptureException(err)
+		log.Printf("webhook claim failed: %v", err)
+		return
+	}
+
+	for _, delivery := range deliveries {
+		select {
+		case d.sem <- struct{}{}:
+		case <-ctx.Done():
+			return // the lease expires and another run picks it up
+		}
+
+		d.wg.Add(1)
+		go func(delivery *models.WebhookDelivery) {
+			defer d.wg.Done()
+			defer func() { <-d.sem }()
+
+			if err := d.Deliver(ctx, delivery); err != nil {
+				sentry.CaptureException(err)
+				log.Printf("webhook delivery %d: %v", delivery.ID, err)
+			}
+		}(delivery)
+	}
+}
+
+// Replay queues a fresh copy of a delivery and sends it straight away. The
+// original stays in the log unchanged.
+func (d *Dispatcher) Replay(ctx context.Context, original *models.WebhookDelivery) (*models.WebhookDelivery, error) {
+	// Created already claimed so Run does not send it as well
+	leased := time.Now().Add(claimLease)
+	replay := &models.WebhookDelivery{
+		NextAttemptAt:  &leased,
+		SubscriptionID: original.SubscriptionID,
+		OrganizationID: original.OrganizationID,
+		EventID:        original.EventID,
+		EventType:      original.EventType,
+		Payload:        original.Payload,
+		ReplayOf:       &original.ID,
+	}
+	if err := d.webhookRepo.CreateDelivery(replay); err != nil {
+		return nil, err
+	}
+
+	if err := d.Deliver(ctx, replay); err != nil {
+		return nil, err
+	}
+
+	return d.webhookRepo.FindDelivery(replay.ID, replay.OrganizationID)
+}
+
+// Deliver makes one attempt and records its outcome. The returned error is
+// about recording; a failed attempt is logged on the delivery instead.
+func (d *Dispatcher) Deliver(ctx context.Context, delivery *models.WebhookDelivery) error {
+	sub, err := d.webhookRepo.FindSubscription(delivery.SubscriptionID, delivery.OrganizationID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	result := d.attempt(ctx, sub, delivery, now)
+	return d.webhookRepo.RecordAttempt(delivery.ID, result.StatusCode, result.Error, now, result.Delivered, result.NextAttemptAt)
+}
+
+// attemptResult is what RecordAttempt stores for one attempt
+type attemptResult struct {
+	StatusCode    int
+	Error         string
+	Delivered     bool
+	NextAttemptAt *time.Time // nil once the delivery has no attempts left
+}
+
+// attempt sends the delivery to the subscription and decides whether and
+// when it is retried
+func (d *Dispatcher) attempt(ctx context.Context, sub *models.WebhookSubscription, delivery *models.WebhookDelivery, now time.Time) attemptResult {
+	if !sub.IsActive {
+		return attemptResult{Error: "webhook is disabled"}
+	}
+
+	statusCode, err := d.send(ctx, sub, delivery, now)
+	if err == nil {
+		return attemptResult{StatusCode: statusCode, Delivered: true}
+	}
+
+	result := attemptResult{StatusCode: statusCode, Error: err.Error()}
+	if attempt := delivery.Attempts + 1; attempt < MaxAttempts {
+		at := now.Add(Backoff(attempt))
+		result.NextAttemptAt = &at
+	}
+	return result
+}
+
+func (d *Dispatcher) send(ctx context.Context, sub *models.WebhookSubscription, delivery *models.WebhookDelivery, at time.Time) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "routewise-webhooks")
+	req.Header.Set(HeaderEvent, delivery.EventType)
+	req.Header.Set(HeaderDelivery, strconv.FormatUint(uint64(delivery.ID), 10))
+	req.Header.Set(HeaderSignature, Sign(sub.Secret, delivery.Payload, at))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		if errors.Is(err, ErrForbiddenAddress) {
+			return 0, ErrForbiddenAddress // without the address it resolved to
+		}
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxDrainedBody))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp.StatusCode, nil
+	}
+	return resp.StatusCode, fmt.Errorf("receiver returned status %d", resp.StatusCode)
+}
+
+// Backoff is the wait after the given failed attempt: 30s, 1m, 2m, ... up to 6h
+func Backoff(attempt int) time.Duration {
+	delay := firstRetryDelay
+	for i := 1; i < attempt && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	return delay
+}
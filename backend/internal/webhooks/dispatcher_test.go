@@ -0,0 +1,175 @@
+package webhooks
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ireuven89/routewise/internal/models"
+)
+
+// receiver is a test endpoint that verifies every delivery and answers with
+// the next of its statuses, repeating the last
+type receiver struct {
+	t        *testing.T
+	secret   string
+	statuses []int
+	bodies   [][]byte
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	if err := Verify(rc.secret, body, r.Header.Get(HeaderSignature), 5*time.Minute, time.Now()); err != nil {
+		rc.t.Errorf("receiver: %v", err)
+	}
+	if got := r.Header.Get(HeaderEvent); got != "job.created" {
+		rc.t.Errorf("receiver: %s = %q, want job.created", HeaderEvent, got)
+	}
+	if got := r.Header.Get(HeaderDelivery); got != "42" {
+		rc.t.Errorf("receiver: %s = %q, want 42", HeaderDelivery, got)
+	}
+	rc.bodies = append(rc.bodies, body)
+
+	status := rc.statuses[0]
+	if len(rc.statuses) > 1 {
+		rc.statuses = rc.statuses[1:]
+	}
+	w.WriteHeader(status)
+	io.WriteString(w, "internal details the org must not see")
+}
+
+func newTestDelivery(url string) (*models.WebhookSubscription, *models.WebhookDelivery) {
+	sub := &models.WebhookSubscription{ID: 7, URL: url, Secret: "whsec_test", IsActive: true}
+	delivery := &models.WebhookDelivery{
+		ID:             42,
+		SubscriptionID: 7,
+		EventType:      "job.created",
+		Payload:        []byte(`{"type":"job.created","data":{"id":1}}`),
+	}
+	return sub, delivery
+}
+
+func TestAttemptDelivers(t *testing.T) {
+	rc := &receiver{t: t, secret: "whsec_test", statuses: []int{http.StatusNoContent}}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+
+	d := &Dispatcher{client: srv.Client()}
+	sub, delivery := newTestDelivery(srv.URL)
+
+	result := d.attempt(context.Background(), sub, delivery, time.Now())
+	if !result.Delivered || result.StatusCode != http.StatusNoContent || result.Error != "" || result.NextAttemptAt != nil {
+		t.Fatalf("attempt() = %+v, want delivered with 204", result)
+	}
+	if len(rc.bodies) != 1 || string(rc.bodies[0]) != string(delivery.Payload) {
+		t.Fatalf("receiver got %q, want the payload once", rc.bodies)
+	}
+}
+
+func TestAttemptRetriesUntilDelivered(t *testing.T) {
+	rc := &receiver{t: t, secret: "whsec_test", statuses: []int{
+		http.StatusInternalServerError, http.StatusBadGateway, http.StatusOK,
+	}}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+
+	d := &Dispatcher{client: srv.Client()}
+	sub, delivery := newTestDelivery(srv.URL)
+	now := time.Now()
+
+	for _, status := range []int{http.StatusInternalServerError, http.StatusBadGateway} {
+		result := d.attempt(context.Background(), sub, delivery, now)
+		if result.Delivered || result.StatusCode != status {
+			t.Fatalf("attempt %d = %+v, want failed with %d", delivery.Attempts+1, result, status)
+		}
+		if strings.Contains(result.Error, "internal details") {
+			t.Errorf("attempt error %q includes the response body", result.Error)
+		}
+		want := now.Add(Backoff(delivery.Attempts + 1))
+		if result.NextAttemptAt == nil || !result.NextAttemptAt.Equal(want) {
+			t.Fatalf("attempt %d retries at %v, want %v", delivery.Attempts+1, result.NextAttemptAt, want)
+		}
+		delivery.Attempts++
+	}
+
+	result := d.attempt(context.Background(), sub, delivery, now)
+	if !result.Delivered || result.StatusCode != http.StatusOK {
+		t.Fatalf("attempt 3 = %+v, want delivered", result)
+	}
+	if len(rc.bodies) != 3 {
+		t.Fatalf("receiver got %d requests, want 3", len(rc.bodies))
+	}
+}
+
+func TestAttemptGivesUpAfterMaxAttempts(t *testing.T) {
+	rc := &receiver{t: t, secret: "whsec_test", statuses: []int{http.StatusServiceUnavailable}}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+
+	d := &Dispatcher{client: srv.Client()}
+	sub, delivery := newTestDelivery(srv.URL)
+	delivery.Attempts = MaxAttempts - 1
+
+	result := d.attempt(context.Background(), sub, delivery, time.Now())
+	if result.Delivered || result.NextAttemptAt != nil {
+		t.Fatalf("last attempt = %+v, want failed with no retry", result)
+	}
+}
+
+func TestAttemptSkipsDisabledWebhooks(t *testing.T) {
+	rc := &receiver{t: t, secret: "whsec_test", statuses: []int{http.StatusOK}}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+
+	d := &Dispatcher{client: srv.Client()}
+	sub, delivery := newTestDelivery(srv.URL)
+	sub.IsActive = false
+
+	result := d.attempt(context.Background(), sub, delivery, time.Now())
+	if result.Delivered || result.NextAttemptAt != nil || result.Error != "webhook is disabled" {
+		t.Fatalf("attempt() = %+v, want disabled with no retry", result)
+	}
+	if len(rc.bodies) != 0 {
+		t.Fatal("disabled webhook was sent")
+	}
+}
+
+func TestAttemptRefusesInternalReceivers(t *testing.T) {
+	rc := &receiver{t: t, secret: "whsec_test", statuses: []int{http.StatusOK}}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+
+	d := &Dispatcher{client: NewClient(time.Second)}
+	sub, delivery := newTestDelivery(srv.URL)
+
+	result := d.attempt(context.Background(), sub, delivery, time.Now())
+	if result.Delivered || result.Error != ErrForbiddenAddress.Error() {
+		t.Fatalf("attempt() = %+v, want %q", result, ErrForbiddenAddress)
+	}
+	if len(rc.bodies) != 0 {
+		t.Fatal("request reached a loopback receiver")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{7, 32 * time.Minute},
+		{20, 6 * time.Hour},
+	}
+
+	for _, tt := range tests {
+		if got := Backoff(tt.attempt); got != tt.want {
+			t.Errorf("Backoff(%d) = %v, want %v", tt.attempt, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestAllowedAddress(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"127.8.8.8", false},
+		{"::1", false},
+		{"0.0.0.0", false},
+		{"::", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.10", false},
+		{"169.254.169.254", false},
+		{"100.100.100.200", false},
+		{"fe80::1", false},
+		{"fd00:ec2::254", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:10.0.0.1", false},
+		{"64:ff9b::a9fe:a9fe", false},
+		{"224.0.0.1", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			if got := allowedAddress(netip.MustParseAddr(tt.addr)); got != tt.want {
+				t.Errorf("allowedAddress(%s) = %v, want %v", tt.addr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckURL(t *testing.T) {
+	tests := []struct {
+		url     string
+		wantErr bool
+	}{
+		{"https://93.184.216.34/hooks", false},
+		{"http://[2606:2800:220:1:248:1893:25c8:1946]:8080/hooks", false},
+		{"http://169.254.169.254/latest/meta-data/", true},
+		{"http://127.0.0.1:5432", true},
+		{"http://10.0.0.5/hooks", true},
+		{"http://[::1]/hooks", true},
+		{"http://localhost/hooks", true},
+		{"ftp://93.184.216.34/hooks", true},
+		{"/hooks", true},
+		{"https://", true},
+		{"https://host.invalid/hooks", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			err := CheckURL(context.Background(), tt.url)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CheckURL(%q) = %v, want error %v", tt.url, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// The test server listens on loopback, so the delivery client must refuse
+// it however the URL was let through
+func TestNewClientRefusesInternalAddresses(t *testing.T) {
+	reached := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+	}))
+	defer srv.Close()
+
+	_, err := NewClient(time.Second).Get(srv.URL)
+	if !errors.Is(err, ErrForbiddenAddress) {
+		t.Fatalf("Get() = %v, want ErrForbiddenAddress", err)
+	}
+	if reached {
+		t.Error("request reached the server")
+	}
+}
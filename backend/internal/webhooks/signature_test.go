@@ -0,0 +1,68 @@
+package webhooks
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	secret := "whsec_test"
+	body := []byte(`{"type":"job.created"}`)
+	signedAt := time.Unix(1700000000, 0)
+	header := Sign(secret, body, signedAt)
+
+	tests := []struct {
+		name      string
+		secret    string
+		body      []byte
+		header    string
+		tolerance time.Duration
+		now       time.Time
+		wantErr   bool
+	}{
+		{"valid", secret, body, header, 5 * time.Minute, signedAt.Add(time.Minute), false},
+		{"no age check", secret, body, header, 0, signedAt.Add(24 * time.Hour), false},
+		{"spaces between parts", secret, body, strings.ReplaceAll(header, ",", ", "), 0, signedAt, false},
+		{"wrong secret", "whsec_other", body, header, 0, signedAt, true},
+		{"tampered body", secret, []byte(`{"type":"job.deleted"}`), header, 0, signedAt, true},
+		{"too old", secret, body, header, 5 * time.Minute, signedAt.Add(6 * time.Minute), true},
+		{"from the future", secret, body, header, 5 * time.Minute, signedAt.Add(-6 * time.Minute), true},
+		{"changed timestamp", secret, body, strings.Replace(header, "t=1700000000", "t=1700000001", 1), 0, signedAt, true},
+		{"missing signature", secret, body, "t=1700000000", 0, signedAt, true},
+		{"missing timestamp", secret, body, header[strings.Index(header, "v1="):], 0, signedAt, true},
+		{"bad timestamp", secret, body, "t=soon,v1=abc", 0, signedAt, true},
+		{"empty", secret, body, "", 0, signedAt, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify(tt.secret, tt.body, tt.header, tt.tolerance, tt.now)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidSignature) {
+					t.Fatalf("Verify() = %v, want ErrInvalidSignature", err)
+				}
+			} else if err != nil {
+				t.Fatalf("Verify() = %v, want nil", err)
+			}
+		})
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	a, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(a, "whsec_") || len(a) != len("whsec_")+64 {
+		t.Errorf("GenerateSecret() = %q, want whsec_ and 64 hex digits", a)
+	}
+	if a == b {
+		t.Error("GenerateSecret() returned the same secret twice")
+	}
+}
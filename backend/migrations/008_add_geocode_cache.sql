@@ -0,0 +1,14 @@
+------------------------------------------------------------
+-- Cache of geocoding lookups, keyed by normalized address
+------------------------------------------------------------
+CREATE TABLE IF NOT EXISTS geocode_cache (
+                               address_key TEXT PRIMARY KEY,
+                               latitude DECIMAL(10, 8) NOT NULL,
+                               longitude DECIMAL(11, 8) NOT NULL,
+                               provider VARCHAR(50) NOT NULL,
+                               created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Speeds up the backfill scan for customers without coordinates
+CREATE INDEX IF NOT EXISTS idx_customers_missing_coordinates
+    ON customers(organization_id) WHERE latitude IS NULL OR longitude IS NULL;
@@ -0,0 +1,23 @@
+------------------------------------------------------------
+-- Location history reported by the worker mobile app
+------------------------------------------------------------
+CREATE TABLE IF NOT EXISTS worker_locations (
+                                  id BIGSERIAL PRIMARY KEY,
+                                  organization_id INTEGER NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+                                  worker_id INTEGER NOT NULL REFERENCES workers(id) ON DELETE CASCADE,
+                                  latitude DECIMAL(10, 8) NOT NULL,
+                                  longitude DECIMAL(11, 8) NOT NULL,
+                                  accuracy_meters REAL,
+                                  speed_mps REAL,
+                                  heading REAL,
+                                  recorded_at TIMESTAMP NOT NULL,
+                                  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_worker_locations_worker_recorded ON worker_locations(worker_id, recorded_at DESC);
+CREATE INDEX IF NOT EXISTS idx_worker_locations_organization ON worker_locations(organization_id);
+
+-- Last-known position, carried over from the technicians table
+ALTER TABLE workers ADD COLUMN IF NOT EXISTS last_lat DECIMAL(10, 8);
+ALTER TABLE workers ADD COLUMN IF NOT EXISTS last_lng DECIMAL(11, 8);
+ALTER TABLE workers ADD COLUMN IF NOT EXISTS last_seen_at TIMESTAMP;
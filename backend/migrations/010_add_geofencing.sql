@@ -0,0 +1,51 @@
+------------------------------------------------------------
+-- Per-organization geofence configuration
+------------------------------------------------------------
+CREATE TABLE IF NOT EXISTS geofence_settings (
+                                   organization_id INTEGER PRIMARY KEY REFERENCES organizations(id) ON DELETE CASCADE,
+                                   enabled BOOLEAN NOT NULL DEFAULT true,
+                                   radius_meters INTEGER NOT NULL DEFAULT 150,
+                                   min_dwell_minutes INTEGER NOT NULL DEFAULT 10,
+                                   updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+------------------------------------------------------------
+-- Time a worker spent inside a job's geofence
+------------------------------------------------------------
+CREATE TABLE IF NOT EXISTS job_geofence_visits (
+                                     id SERIAL PRIMARY KEY,
+                                     job_id INTEGER NOT NULL REFERENCES jobs(id) ON DELETE CASCADE,
+                                     worker_id INTEGER NOT NULL REFERENCES workers(id) ON DELETE CASCADE,
+                                     entered_at TIMESTAMP NOT NULL,
+                                     exited_at TIMESTAMP -- NULL = still inside
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_job_geofence_visits_open
+    ON job_geofence_visits(job_id, worker_id) WHERE exited_at IS NULL;
+
+------------------------------------------------------------
+-- Audit of every geofence rule that fired
+------------------------------------------------------------
+CREATE TABLE IF NOT EXISTS job_geofence_events (
+                                     id SERIAL PRIMARY KEY,
+                                     organization_id INTEGER NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+                                     job_id INTEGER NOT NULL REFERENCES jobs(id) ON DELETE CASCADE,
+                                     worker_id INTEGER NOT NULL REFERENCES workers(id) ON DELETE CASCADE,
+                                     rule VARCHAR(50) NOT NULL,      -- 'arrival_start', 'departure_complete'
+                                     event_type VARCHAR(20) NOT NULL, -- 'entered', 'exited'
+                                     from_status VARCHAR(50),
+                                     to_status VARCHAR(50),
+                                     outcome VARCHAR(20) NOT NULL,    -- 'applied', 'suggested', 'rejected', 'recorded'
+                                     detail TEXT,
+                                     latitude DECIMAL(10, 8),
+                                     longitude DECIMAL(11, 8),
+                                     distance_meters REAL,
+                                     occurred_at TIMESTAMP NOT NULL,
+                                     resolution VARCHAR(20),          -- 'accepted', 'dismissed' for suggestions
+                                     resolved_at TIMESTAMP,
+                                     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_job_geofence_events_job ON job_geofence_events(job_id);
+CREATE INDEX IF NOT EXISTS idx_job_geofence_events_pending
+    ON job_geofence_events(organization_id) WHERE outcome = 'suggested' AND resolved_at IS NULL;
@@ -0,0 +1,11 @@
+------------------------------------------------------------
+-- Record who changed a job's status and why
+------------------------------------------------------------
+ALTER TABLE job_status_updates RENAME COLUMN technician_id TO changed_by_worker;
+
+ALTER TABLE job_status_updates
+    ADD COLUMN IF NOT EXISTS changed_by_user INTEGER REFERENCES organization_users(id),
+    ADD COLUMN IF NOT EXISTS source VARCHAR(30) NOT NULL DEFAULT 'manual', -- manual, geofence
+    ADD COLUMN IF NOT EXISTS reason TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_job_status_updates_job_id ON job_status_updates(job_id, created_at);
@@ -0,0 +1,32 @@
+------------------------------------------------------------
+-- Job notes (the code expected this table, it was never created)
+------------------------------------------------------------
+CREATE TABLE IF NOT EXISTS job_notes (
+                           id SERIAL PRIMARY KEY,
+                           job_id INTEGER NOT NULL REFERENCES jobs(id) ON DELETE CASCADE,
+                           created_by_user INTEGER REFERENCES organization_users(id) ON DELETE SET NULL,
+                           created_by_worker INTEGER REFERENCES workers(id) ON DELETE SET NULL,
+                           note TEXT NOT NULL,
+                           created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+                           updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_job_notes_job_id ON job_notes(job_id);
+
+------------------------------------------------------------
+-- Job parts: track who added them, price is the unit price
+------------------------------------------------------------
+ALTER TABLE job_parts RENAME COLUMN technician_id TO added_by_worker;
+
+ALTER TABLE job_parts
+    ADD COLUMN IF NOT EXISTS added_by_user INTEGER REFERENCES organization_users(id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS description TEXT,
+    ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP;
+
+UPDATE job_parts SET price = 0 WHERE price IS NULL;
+UPDATE job_parts SET quantity = 1 WHERE quantity IS NULL;
+ALTER TABLE job_parts ALTER COLUMN price SET DEFAULT 0;
+ALTER TABLE job_parts ALTER COLUMN price SET NOT NULL;
+ALTER TABLE job_parts ALTER COLUMN quantity SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_job_parts_job_id ON job_parts(job_id);
@@ -0,0 +1,21 @@
+------------------------------------------------------------
+-- Crew assignments: point worker_id at workers, not organization_users
+------------------------------------------------------------
+ALTER TABLE project_assignments DROP CONSTRAINT IF EXISTS project_assignments_worker_id_fkey;
+
+-- Rows written against organization_users cannot be mapped to a worker
+DELETE FROM project_assignments pa
+WHERE NOT EXISTS (SELECT 1 FROM workers w WHERE w.id = pa.worker_id);
+
+ALTER TABLE project_assignments
+    ADD CONSTRAINT project_assignments_worker_id_fkey
+        FOREIGN KEY (worker_id) REFERENCES workers(id) ON DELETE CASCADE;
+
+ALTER TABLE project_assignments ADD COLUMN IF NOT EXISTS assigned_by INTEGER REFERENCES organization_users(id) ON DELETE SET NULL;
+
+-- A worker can be on a crew only once at a time; history rows keep removed_at
+CREATE UNIQUE INDEX IF NOT EXISTS idx_project_assignments_one_active
+    ON project_assignments(project_id, worker_id) WHERE removed_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_project_assignments_worker_active
+    ON project_assignments(worker_id) WHERE removed_at IS NULL;
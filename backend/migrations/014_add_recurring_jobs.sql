@@ -0,0 +1,34 @@
+------------------------------------------------------------
+-- Recurring jobs: a template plus an RRULE, materialized into jobs
+------------------------------------------------------------
+CREATE TABLE IF NOT EXISTS job_templates (
+                               id SERIAL PRIMARY KEY,
+                               organization_id INTEGER NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+                               created_by INTEGER REFERENCES organization_users(id) ON DELETE SET NULL,
+                               customer_id INTEGER NOT NULL REFERENCES customers(id) ON DELETE CASCADE,
+                               technician_id INTEGER REFERENCES workers(id) ON DELETE SET NULL,
+                               title VARCHAR(255) NOT NULL,
+                               description TEXT,
+                               duration_minutes INTEGER NOT NULL DEFAULT 60,
+                               price DECIMAL(10,2),
+                               metadata JSONB,
+                               rrule TEXT NOT NULL, -- e.g. FREQ=MONTHLY;INTERVAL=3
+                               starts_at TIMESTAMP NOT NULL, -- first occurrence, UTC
+                               timezone VARCHAR(64) NOT NULL DEFAULT 'UTC', -- wall clock the rule is evaluated in
+                               generated_until TIMESTAMP, -- jobs exist for every occurrence before this
+                               active BOOLEAN NOT NULL DEFAULT TRUE,
+                               parent_template_id INTEGER REFERENCES job_templates(id) ON DELETE SET NULL, -- set when a series is split
+                               created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+                               updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_job_templates_organization ON job_templates(organization_id);
+CREATE INDEX IF NOT EXISTS idx_job_templates_due ON job_templates(generated_until) WHERE active;
+
+ALTER TABLE jobs
+    ADD COLUMN IF NOT EXISTS template_id INTEGER REFERENCES job_templates(id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS occurrence_at TIMESTAMP, -- the slot the rule produced, before any edit
+    ADD COLUMN IF NOT EXISTS is_exception BOOLEAN NOT NULL DEFAULT FALSE; -- edited alone, series edits skip it
+
+-- The generator relies on this to be idempotent
+CREATE UNIQUE INDEX IF NOT EXISTS idx_jobs_template_occurrence ON jobs(template_id, occurrence_at) WHERE template_id IS NOT NULL;
@@ -0,0 +1,44 @@
+------------------------------------------------------------
+-- Worker availability: weekly hours, time off, holidays
+------------------------------------------------------------
+CREATE TABLE IF NOT EXISTS scheduling_settings (
+                                     organization_id INTEGER PRIMARY KEY REFERENCES organizations(id) ON DELETE CASCADE,
+                                     travel_buffer_minutes INTEGER NOT NULL DEFAULT 15,
+                                     conflict_mode VARCHAR(10) NOT NULL DEFAULT 'warn', -- warn, reject
+                                     timezone VARCHAR(64) NOT NULL DEFAULT 'UTC', -- working hours are wall clock in this zone
+                                     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- No rows for a worker means the default Monday-Friday 08:00-17:00
+CREATE TABLE IF NOT EXISTS worker_working_hours (
+                                      id SERIAL PRIMARY KEY,
+                                      worker_id INTEGER NOT NULL REFERENCES workers(id) ON DELETE CASCADE,
+                                      weekday SMALLINT NOT NULL CHECK (weekday BETWEEN 0 AND 6), -- 0 = Sunday
+                                      start_time TIME NOT NULL,
+                                      end_time TIME NOT NULL,
+                                      CHECK (end_time > start_time)
+);
+
+CREATE INDEX IF NOT EXISTS idx_worker_working_hours_worker ON worker_working_hours(worker_id);
+
+CREATE TABLE IF NOT EXISTS worker_time_off (
+                                 id SERIAL PRIMARY KEY,
+                                 worker_id INTEGER NOT NULL REFERENCES workers(id) ON DELETE CASCADE,
+                                 starts_at TIMESTAMP NOT NULL,
+                                 ends_at TIMESTAMP NOT NULL,
+                                 reason TEXT,
+                                 created_by INTEGER REFERENCES organization_users(id) ON DELETE SET NULL,
+                                 created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+                                 CHECK (ends_at > starts_at)
+);
+
+CREATE INDEX IF NOT EXISTS idx_worker_time_off_worker ON worker_time_off(worker_id, starts_at);
+
+CREATE TABLE IF NOT EXISTS organization_holidays (
+                                       id SERIAL PRIMARY KEY,
+                                       organization_id INTEGER NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+                                       date DATE NOT NULL,
+                                       name VARCHAR(255) NOT NULL,
+                                       created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+                                       UNIQUE (organization_id, date)
+);
@@ -0,0 +1,6 @@
+------------------------------------------------------------
+-- Optimistic locking: every write to a job bumps its version
+------------------------------------------------------------
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+
+CREATE INDEX IF NOT EXISTS idx_jobs_org_scheduled_at ON jobs(organization_id, scheduled_at);
@@ -0,0 +1,39 @@
+------------------------------------------------------------
+-- Outbound webhooks: subscriptions and their delivery log
+------------------------------------------------------------
+CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+                                       id SERIAL PRIMARY KEY,
+                                       organization_id INTEGER NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+                                       url TEXT NOT NULL,
+                                       event_types TEXT[] NOT NULL DEFAULT '{}', -- empty means every event
+                                       secret VARCHAR(100) NOT NULL, -- HMAC-SHA256 signing key
+                                       description TEXT,
+                                       is_active BOOLEAN NOT NULL DEFAULT true,
+                                       created_by INTEGER REFERENCES organization_users(id) ON DELETE SET NULL,
+                                       created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+                                       updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_subscriptions_org ON webhook_subscriptions(organization_id);
+
+-- One row per event per subscription; a replay is a new row pointing at the original
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+                                    id SERIAL PRIMARY KEY,
+                                    subscription_id INTEGER NOT NULL REFERENCES webhook_subscriptions(id) ON DELETE CASCADE,
+                                    organization_id INTEGER NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+                                    event_id VARCHAR(50) NOT NULL,
+                                    event_type VARCHAR(50) NOT NULL,
+                                    payload JSONB NOT NULL,
+                                    status VARCHAR(20) NOT NULL DEFAULT 'pending', -- pending, succeeded, failed
+                                    attempts INTEGER NOT NULL DEFAULT 0,
+                                    next_attempt_at TIMESTAMP,
+                                    last_attempt_at TIMESTAMP,
+                                    last_status_code INTEGER,
+                                    last_error TEXT,
+                                    delivered_at TIMESTAMP,
+                                    replay_of INTEGER REFERENCES webhook_deliveries(id) ON DELETE SET NULL,
+                                    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_subscription ON webhook_deliveries(subscription_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(next_attempt_at) WHERE status = 'pending';
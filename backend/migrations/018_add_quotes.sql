@@ -0,0 +1,57 @@
+------------------------------------------------------------
+-- Quotes with line items and customer approval
+------------------------------------------------------------
+
+-- Per-organization document numbering (quotes now, invoices later)
+CREATE TABLE IF NOT EXISTS document_sequences (
+                                    organization_id INTEGER NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+                                    kind VARCHAR(20) NOT NULL,
+                                    last_number INTEGER NOT NULL DEFAULT 0,
+                                    PRIMARY KEY (organization_id, kind)
+);
+
+CREATE TABLE IF NOT EXISTS quotes (
+                        id SERIAL PRIMARY KEY,
+                        organization_id INTEGER NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+                        customer_id INTEGER NOT NULL REFERENCES customers(id) ON DELETE CASCADE,
+                        number INTEGER NOT NULL,
+                        title VARCHAR(255) NOT NULL,
+                        notes TEXT,
+                        status VARCHAR(20) NOT NULL DEFAULT 'draft', -- draft, sent, accepted, declined
+                        valid_until TIMESTAMP,
+                        subtotal NUMERIC(12, 2) NOT NULL DEFAULT 0,
+                        discount_total NUMERIC(12, 2) NOT NULL DEFAULT 0,
+                        tax_total NUMERIC(12, 2) NOT NULL DEFAULT 0,
+                        total NUMERIC(12, 2) NOT NULL DEFAULT 0,
+                        sent_at TIMESTAMP,
+                        responded_at TIMESTAMP,
+                        responded_by_name VARCHAR(255), -- as typed by the customer, or the office user's note
+                        decline_reason TEXT,
+                        converted_at TIMESTAMP,
+                        created_by INTEGER REFERENCES organization_users(id) ON DELETE SET NULL,
+                        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+                        updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+                        UNIQUE (organization_id, number)
+);
+
+CREATE INDEX IF NOT EXISTS idx_quotes_org_status ON quotes(organization_id, status);
+CREATE INDEX IF NOT EXISTS idx_quotes_customer ON quotes(customer_id);
+
+CREATE TABLE IF NOT EXISTS quote_line_items (
+                                  id SERIAL PRIMARY KEY,
+                                  quote_id INTEGER NOT NULL REFERENCES quotes(id) ON DELETE CASCADE,
+                                  position INTEGER NOT NULL,
+                                  kind VARCHAR(10) NOT NULL, -- labor, part, fee
+                                  description TEXT NOT NULL,
+                                  quantity NUMERIC(12, 3) NOT NULL CHECK (quantity > 0),
+                                  unit_price NUMERIC(12, 2) NOT NULL CHECK (unit_price >= 0),
+                                  discount_percent NUMERIC(5, 2) NOT NULL DEFAULT 0 CHECK (discount_percent BETWEEN 0 AND 100),
+                                  tax_rate NUMERIC(5, 2) NOT NULL DEFAULT 0 CHECK (tax_rate BETWEEN 0 AND 100),
+                                  total NUMERIC(12, 2) NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_quote_line_items_quote ON quote_line_items(quote_id, position);
+
+-- Jobs created from an accepted quote
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS quote_id INTEGER REFERENCES quotes(id) ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS idx_jobs_quote ON jobs(quote_id) WHERE quote_id IS NOT NULL;
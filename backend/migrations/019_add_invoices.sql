@@ -0,0 +1,62 @@
+------------------------------------------------------------
+-- Invoices, their line items and recorded payments
+------------------------------------------------------------
+CREATE TABLE IF NOT EXISTS invoices (
+                          id SERIAL PRIMARY KEY,
+                          organization_id INTEGER NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+                          customer_id INTEGER NOT NULL REFERENCES customers(id) ON DELETE CASCADE,
+                          job_id INTEGER REFERENCES jobs(id) ON DELETE SET NULL,
+                          number INTEGER, -- assigned when the invoice is sent, from document_sequences
+                          status VARCHAR(20) NOT NULL DEFAULT 'draft', -- draft, sent, paid, void; overdue is derived
+                          notes TEXT,
+                          payment_terms_days INTEGER NOT NULL DEFAULT 30,
+                          issued_at TIMESTAMP,
+                          due_date DATE,
+                          subtotal NUMERIC(12, 2) NOT NULL DEFAULT 0,
+                          discount_total NUMERIC(12, 2) NOT NULL DEFAULT 0,
+                          tax_total NUMERIC(12, 2) NOT NULL DEFAULT 0,
+                          total NUMERIC(12, 2) NOT NULL DEFAULT 0,
+                          amount_paid NUMERIC(12, 2) NOT NULL DEFAULT 0, -- kept in step with invoice_payments
+                          paid_at TIMESTAMP,
+                          voided_at TIMESTAMP,
+                          void_reason TEXT,
+                          created_by INTEGER REFERENCES organization_users(id) ON DELETE SET NULL,
+                          created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+                          updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+                          UNIQUE (organization_id, number)
+);
+
+CREATE INDEX IF NOT EXISTS idx_invoices_org_status ON invoices(organization_id, status, due_date);
+CREATE INDEX IF NOT EXISTS idx_invoices_customer ON invoices(customer_id);
+
+-- A job is billed once; voiding its invoice allows a new one
+CREATE UNIQUE INDEX IF NOT EXISTS idx_invoices_open_job ON invoices(job_id) WHERE status <> 'void';
+
+CREATE TABLE IF NOT EXISTS invoice_line_items (
+                                    id SERIAL PRIMARY KEY,
+                                    invoice_id INTEGER NOT NULL REFERENCES invoices(id) ON DELETE CASCADE,
+                                    position INTEGER NOT NULL,
+                                    kind VARCHAR(10) NOT NULL, -- labor, part, fee
+                                    description TEXT NOT NULL,
+                                    quantity NUMERIC(12, 3) NOT NULL CHECK (quantity > 0),
+                                    unit_price NUMERIC(12, 2) NOT NULL CHECK (unit_price >= 0),
+                                    discount_percent NUMERIC(5, 2) NOT NULL DEFAULT 0 CHECK (discount_percent BETWEEN 0 AND 100),
+                                    tax_rate NUMERIC(5, 2) NOT NULL DEFAULT 0 CHECK (tax_rate BETWEEN 0 AND 100),
+                                    total NUMERIC(12, 2) NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_invoice_line_items_invoice ON invoice_line_items(invoice_id, position);
+
+CREATE TABLE IF NOT EXISTS invoice_payments (
+                                  id SERIAL PRIMARY KEY,
+                                  invoice_id INTEGER NOT NULL REFERENCES invoices(id) ON DELETE CASCADE,
+                                  amount NUMERIC(12, 2) NOT NULL CHECK (amount > 0),
+                                  method VARCHAR(20) NOT NULL, -- cash, check, card, bank_transfer, other
+                                  reference VARCHAR(100), -- check number, transfer ID
+                                  paid_at TIMESTAMP NOT NULL,
+                                  notes TEXT,
+                                  recorded_by INTEGER REFERENCES organization_users(id) ON DELETE SET NULL,
+                                  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_invoice_payments_invoice ON invoice_payments(invoice_id, paid_at);
@@ -0,0 +1,11 @@
+------------------------------------------------------------
+-- Per-organization branding for generated PDFs
+------------------------------------------------------------
+CREATE TABLE IF NOT EXISTS organization_branding (
+                                       organization_id INTEGER PRIMARY KEY REFERENCES organizations(id) ON DELETE CASCADE,
+                                       logo_s3_key VARCHAR(500), -- PNG or JPEG, uploaded through the branding endpoint
+                                       primary_color VARCHAR(7) NOT NULL DEFAULT '#1F3A5F', -- headings and table headers
+                                       accent_color VARCHAR(7) NOT NULL DEFAULT '#E8EEF5', -- table stripes and totals
+                                       footer_text TEXT, -- payment instructions, license numbers
+                                       updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,14 @@
+------------------------------------------------------------
+-- Customer signatures on job completion
+------------------------------------------------------------
+
+-- Signatures are project_files with file_type 'signature'; taken_at is when it was signed
+ALTER TABLE project_files ADD COLUMN IF NOT EXISTS signer_name VARCHAR(255);
+
+CREATE INDEX IF NOT EXISTS idx_project_files_signatures ON project_files(project_id) WHERE file_type = 'signature';
+
+CREATE TABLE IF NOT EXISTS completion_settings (
+                                     organization_id INTEGER PRIMARY KEY REFERENCES organizations(id) ON DELETE CASCADE,
+                                     require_signature BOOLEAN NOT NULL DEFAULT false, -- jobs cannot be completed without one
+                                     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
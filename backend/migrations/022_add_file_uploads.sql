@@ -0,0 +1,31 @@
+------------------------------------------------------------
+-- Direct-to-storage uploads
+------------------------------------------------------------
+
+-- A slot is handed out before the client uploads; confirming it moves the
+-- details to project_files. Expired slots are swept along with their objects.
+CREATE TABLE IF NOT EXISTS file_uploads (
+                                     id SERIAL PRIMARY KEY,
+                                     organization_id INTEGER NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+                                     project_id INTEGER NOT NULL REFERENCES jobs(id) ON DELETE CASCADE,
+                                     uploaded_by_user INTEGER REFERENCES organization_users(id) ON DELETE SET NULL,
+                                     uploaded_by_worker INTEGER REFERENCES workers(id) ON DELETE SET NULL,
+                                     file_type VARCHAR(50) NOT NULL,
+                                     file_category VARCHAR(50),
+                                     file_name VARCHAR(255) NOT NULL,
+                                     mime_type VARCHAR(100) NOT NULL,
+                                     file_size BIGINT NOT NULL, -- the object must be exactly this size
+                                     file_extension VARCHAR(10),
+                                     description TEXT,
+                                     taken_at TIMESTAMP,
+                                     s3_key TEXT NOT NULL,
+                                     multipart_upload_id TEXT, -- set when the file is uploaded in parts
+                                     part_size BIGINT,
+                                     expires_at TIMESTAMP NOT NULL,
+                                     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_file_uploads_expires_at ON file_uploads(expires_at);
+
+-- Direct uploads can exceed 2 GB
+ALTER TABLE project_files ALTER COLUMN file_size TYPE BIGINT;
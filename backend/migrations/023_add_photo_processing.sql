@@ -0,0 +1,15 @@
+------------------------------------------------------------
+-- Photo processing: EXIF location and renditions
+------------------------------------------------------------
+ALTER TABLE project_files ADD COLUMN IF NOT EXISTS latitude DOUBLE PRECISION;
+ALTER TABLE project_files ADD COLUMN IF NOT EXISTS longitude DOUBLE PRECISION;
+ALTER TABLE project_files ADD COLUMN IF NOT EXISTS width INTEGER; -- as displayed, after orientation
+ALTER TABLE project_files ADD COLUMN IF NOT EXISTS height INTEGER;
+ALTER TABLE project_files ADD COLUMN IF NOT EXISTS thumbnail_s3_key TEXT; -- stored next to the original
+ALTER TABLE project_files ADD COLUMN IF NOT EXISTS medium_s3_key TEXT;
+ALTER TABLE project_files ADD COLUMN IF NOT EXISTS processing_status VARCHAR(20); -- pending, processing, done, failed
+
+-- Photos uploaded before processing existed are picked up by the processor
+UPDATE project_files SET processing_status = 'pending' WHERE file_type = 'photo' AND processing_status IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_project_files_processing ON project_files(created_at) WHERE processing_status IN ('pending', 'processing');
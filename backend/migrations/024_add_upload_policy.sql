@@ -0,0 +1,15 @@
+------------------------------------------------------------
+-- Upload policy and virus scanning
+------------------------------------------------------------
+CREATE TABLE IF NOT EXISTS upload_policies (
+                                organization_id INTEGER PRIMARY KEY REFERENCES organizations(id) ON DELETE CASCADE,
+                                allowed_types TEXT[] NOT NULL, -- MIME types as sniffed from the content; 'image/*' allows a family
+                                allowed_categories TEXT[] NOT NULL DEFAULT '{}', -- empty allows any category
+                                max_file_size BIGINT NOT NULL, -- bytes
+                                updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE project_files ADD COLUMN IF NOT EXISTS scan_status VARCHAR(20); -- clean, skipped, quarantined; NULL when no scanner is configured
+ALTER TABLE project_files ADD COLUMN IF NOT EXISTS scan_signature TEXT; -- what the scanner found
+
+CREATE INDEX IF NOT EXISTS idx_project_files_quarantined ON project_files(project_id) WHERE scan_status = 'quarantined';
@@ -0,0 +1,15 @@
+------------------------------------------------------------
+-- File versions and trash
+------------------------------------------------------------
+
+-- Versions of one document share the first version's id; it is NULL on the
+-- first version itself
+ALTER TABLE project_files ADD COLUMN IF NOT EXISTS document_id INTEGER;
+ALTER TABLE project_files ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE project_files ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP; -- in the trash; purged with its objects after the retention window
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_project_files_document_version ON project_files((COALESCE(document_id, id)), version);
+CREATE INDEX IF NOT EXISTS idx_project_files_deleted_at ON project_files(deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- An upload slot can be for a new version of an existing file
+ALTER TABLE file_uploads ADD COLUMN IF NOT EXISTS replaces_file_id INTEGER REFERENCES project_files(id) ON DELETE SET NULL;
@@ -0,0 +1,36 @@
+------------------------------------------------------------
+-- Storage plans, quotas and usage
+------------------------------------------------------------
+CREATE TABLE IF NOT EXISTS storage_plans (
+                               name VARCHAR(50) PRIMARY KEY,
+                               quota_bytes BIGINT NOT NULL
+);
+
+INSERT INTO storage_plans (name, quota_bytes) VALUES
+    ('starter', 10737418240),       -- 10 GB
+    ('professional', 107374182400), -- 100 GB
+    ('enterprise', 1099511627776)   -- 1 TB
+ON CONFLICT (name) DO NOTHING;
+
+ALTER TABLE organizations ADD COLUMN IF NOT EXISTS storage_plan VARCHAR(50) NOT NULL DEFAULT 'starter' REFERENCES storage_plans(name);
+ALTER TABLE organizations ADD COLUMN IF NOT EXISTS storage_quota_bytes BIGINT; -- overrides the plan's quota when set
+
+-- Renditions count towards usage along with the original
+ALTER TABLE project_files ADD COLUMN IF NOT EXISTS renditions_size BIGINT NOT NULL DEFAULT 0;
+
+-- Kept in step with project_files in the same transactions; the reconciler
+-- corrects drift against the storage listing
+CREATE TABLE IF NOT EXISTS storage_usage (
+                               organization_id INTEGER PRIMARY KEY REFERENCES organizations(id) ON DELETE CASCADE,
+                               bytes_used BIGINT NOT NULL DEFAULT 0,
+                               file_count INTEGER NOT NULL DEFAULT 0,
+                               reconciled_at TIMESTAMP,
+                               updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO storage_usage (organization_id, bytes_used, file_count)
+SELECT j.organization_id, SUM(f.file_size), COUNT(*)
+FROM project_files f
+JOIN jobs j ON j.id = f.project_id
+GROUP BY j.organization_id
+ON CONFLICT (organization_id) DO NOTHING;
@@ -0,0 +1,4 @@
+------------------------------------------------------------
+-- Lets the invoice sweep find recently completed jobs
+------------------------------------------------------------
+CREATE INDEX IF NOT EXISTS idx_jobs_completed_at ON jobs(completed_at) WHERE status = 'completed';
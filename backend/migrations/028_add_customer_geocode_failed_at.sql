@@ -0,0 +1,5 @@
+------------------------------------------------------------
+-- Remembers failed geocoding so backfills move past customers whose
+-- address cannot be found; cleared when the address changes
+------------------------------------------------------------
+ALTER TABLE customers ADD COLUMN IF NOT EXISTS geocode_failed_at TIMESTAMP;
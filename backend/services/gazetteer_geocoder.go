@@ -0,0 +1,78 @@
+package services
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// GazetteerGeocoder resolves addresses offline from a CSV file with the
+// columns address,latitude,longitude (a header row is optional)
+type GazetteerGeocoder struct {
+	entries map[string]GeocodeResult
+}
+
+func NewGazetteerGeocoder(path string) (*GazetteerGeocoder, error) {
+	if path == "" {
+		return nil, errors.New("GEOCODER_GAZETTEER_FILE not set")
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open gazetteer: %v", err)
+	}
+	defer f.Close()
+
+	return LoadGazetteer(f)
+}
+
+// LoadGazetteer parses gazetteer rows from r
+func LoadGazetteer(r io.Reader) (*GazetteerGeocoder, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 3
+	reader.TrimLeadingSpace = true
+
+	g := &GazetteerGeocoder{entries: make(map[string]GeocodeResult)}
+
+	line := 0
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read gazetteer: %v", err)
+		}
+		line++
+
+		lat, latErr := strconv.ParseFloat(strings.TrimSpace(record[1]), 64)
+		lng, lngErr := strconv.ParseFloat(strings.TrimSpace(record[2]), 64)
+		if latErr != nil || lngErr != nil {
+			if line == 1 {
+				continue // header row
+			}
+			return nil, fmt.Errorf("invalid coordinates on gazetteer line %d", line)
+		}
+
+		g.entries[NormalizeAddress(record[0])] = GeocodeResult{
+			Latitude:  lat,
+			Longitude: lng,
+			Provider:  "gazetteer",
+		}
+	}
+
+	return g, nil
+}
+
+func (g *GazetteerGeocoder) Geocode(ctx context.Context, address string) (*GeocodeResult, error) {
+	entry, ok := g.entries[NormalizeAddress(address)]
+	if !ok {
+		return nil, ErrAddressNotFound
+	}
+	return &entry, nil
+}
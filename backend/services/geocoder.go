@@ -0,0 +1,126 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// ErrAddressNotFound is returned when a provider has no match for an address
+var ErrAddressNotFound = errors.New("address not found")
+
+type GeocodeResult struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Provider  string  `json:"provider"`
+}
+
+// Geocoder resolves a free-form address to coordinates
+type Geocoder interface {
+	Geocode(ctx context.Context, address string) (*GeocodeResult, error)
+}
+
+// GeocodeCache stores previous lookups keyed by normalized address.
+// Get returns nil, nil on a miss.
+type GeocodeCache interface {
+	GetGeocode(addressKey string) (*GeocodeResult, error)
+	SaveGeocode(addressKey string, result *GeocodeResult) error
+}
+
+// NewGeocoderFromEnv builds the configured provider wrapped with the cache.
+// GEOCODER_PROVIDER selects "gazetteer" (GEOCODER_GAZETTEER_FILE) or
+// "http" (GEOCODER_URL). It returns nil when geocoding is disabled.
+func NewGeocoderFromEnv(cache GeocodeCache) (Geocoder, error) {
+	var provider Geocoder
+
+	switch os.Getenv("GEOCODER_PROVIDER") {
+	case "":
+		return nil, nil
+	case "gazetteer":
+		g, err := NewGazetteerGeocoder(os.Getenv("GEOCODER_GAZETTEER_FILE"))
+		if err != nil {
+			return nil, err
+		}
+		provider = g
+	case "http":
+		baseURL := os.Getenv("GEOCODER_URL")
+		if baseURL == "" {
+			return nil, errors.New("GEOCODER_URL not set")
+		}
+		minInterval := time.Second // public Nominatim allows one request per second
+		if v := os.Getenv("GEOCODER_MIN_INTERVAL_MS"); v != "" {
+			var ms int
+			if _, err := fmt.Sscanf(v, "%d", &ms); err != nil {
+				return nil, fmt.Errorf("invalid GEOCODER_MIN_INTERVAL_MS: %v", err)
+			}
+			minInterval = time.Duration(ms) * time.Millisecond
+		}
+		provider = NewHTTPGeocoder(baseURL, minInterval)
+	default:
+		return nil, fmt.Errorf("unknown GEOCODER_PROVIDER %q", os.Getenv("GEOCODER_PROVIDER"))
+	}
+
+	if cache == nil {
+		return provider, nil
+	}
+	return NewCachingGeocoder(provider, cache), nil
+}
+
+// CachingGeocoder consults the cache before calling the wrapped provider
+type CachingGeocoder struct {
+	inner Geocoder
+	cache GeocodeCache
+}
+
+func NewCachingGeocoder(inner Geocoder, cache GeocodeCache) *CachingGeocoder {
+	return &CachingGeocoder{inner: inner, cache: cache}
+}
+
+func (g *CachingGeocoder) Geocode(ctx context.Context, address string) (*GeocodeResult, error) {
+	key := NormalizeAddress(address)
+	if key == "" {
+		return nil, ErrAddressNotFound
+	}
+
+	cached, err := g.cache.GetGeocode(key)
+	if err != nil {
+		fmt.Printf("geocode cache lookup failed: %v\n", err)
+	}
+	if cached != nil {
+		return cached, nil
+	}
+
+	result, err := g.inner.Geocode(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := g.cache.SaveGeocode(key, result); err != nil {
+		fmt.Printf("geocode cache save failed: %v\n", err)
+	}
+
+	return result, nil
+}
+
+// NormalizeAddress lowercases an address and collapses punctuation and
+// whitespace so equivalent spellings share a cache entry
+func NormalizeAddress(address string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range strings.ToLower(address) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if space && b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+			b.WriteRune(r)
+			space = false
+			continue
+		}
+		space = true
+	}
+	return b.String()
+}
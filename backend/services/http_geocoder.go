@@ -0,0 +1,112 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HTTPGeocoder queries a Nominatim-compatible search API:
+// GET {baseURL}/search?format=json&limit=1&q=<address> -> [{"lat": "..", "lon": ".."}]
+type HTTPGeocoder struct {
+	baseURL     string
+	client      *http.Client
+	minInterval time.Duration
+
+	mu       sync.Mutex
+	lastCall time.Time
+}
+
+func NewHTTPGeocoder(baseURL string, minInterval time.Duration) *HTTPGeocoder {
+	return &HTTPGeocoder{
+		baseURL:     strings.TrimRight(baseURL, "/"),
+		client:      &http.Client{Timeout: 10 * time.Second},
+		minInterval: minInterval,
+	}
+}
+
+type nominatimPlace struct {
+	Lat string `json:"lat"`
+	Lon string `json:"lon"`
+}
+
+func (g *HTTPGeocoder) Geocode(ctx context.Context, address string) (*GeocodeResult, error) {
+	if err := g.throttle(ctx); err != nil {
+		return nil, err
+	}
+
+	params := url.Values{}
+	params.Set("format", "json")
+	params.Set("limit", "1")
+	params.Set("q", address)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, g.baseURL+"/search?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "routewise-geocoder")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("geocoder request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("geocoder returned status %d", resp.StatusCode)
+	}
+
+	var places []nominatimPlace
+	if err := json.NewDecoder(resp.Body).Decode(&places); err != nil {
+		return nil, fmt.Errorf("failed to decode geocoder response: %v", err)
+	}
+	if len(places) == 0 {
+		return nil, ErrAddressNotFound
+	}
+
+	lat, err := strconv.ParseFloat(places[0].Lat, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid latitude from geocoder: %v", err)
+	}
+	lng, err := strconv.ParseFloat(places[0].Lon, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid longitude from geocoder: %v", err)
+	}
+
+	return &GeocodeResult{Latitude: lat, Longitude: lng, Provider: "http"}, nil
+}
+
+// throttle spaces out requests to respect the provider's rate limit
+func (g *HTTPGeocoder) throttle(ctx context.Context) error {
+	if g.minInterval <= 0 {
+		return nil
+	}
+
+	g.mu.Lock()
+	wait := time.Until(g.lastCall.Add(g.minInterval))
+	if wait < 0 {
+		wait = 0
+	}
+	g.lastCall = time.Now().Add(wait)
+	g.mu.Unlock()
+
+	if wait == 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,187 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// metaDir holds each file's content type, mirroring the key layout. Keys
+// cannot start a segment with a dot, so it never collides with a file.
+const metaDir = ".meta"
+
+// LocalStorage keeps files on disk under a root directory. Download links
+// point at the API, which verifies them with the signer.
+type LocalStorage struct {
+	root   string
+	signer *URLSigner
+}
+
+func NewLocalStorage(root string, signer *URLSigner) (*LocalStorage, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Join(root, metaDir), 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory: %v", err)
+	}
+	return &LocalStorage{root: root, signer: signer}, nil
+}
+
+func (s *LocalStorage) UploadFile(ctx context.Context, file io.Reader, key string, contentType string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so readers never see a partial file
+	if err := writeAtomic(s.path(key), file); err != nil {
+		return fmt.Errorf("failed to store file: %v", err)
+	}
+	if err := writeAtomic(s.metaPath(key), strings.NewReader(contentType)); err != nil {
+		os.Remove(s.path(key))
+		return fmt.Errorf("failed to store file: %v", err)
+	}
+	return nil
+}
+
+func (s *LocalStorage) DownloadFile(ctx context.Context, key string) (io.ReadCloser, error) {
+	if err := checkKey(key); err != nil {
+		return nil, err
+	}
+	f, err := os.Open(s.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrObjectNotFound
+	}
+	return f, err
+}
+
+func (s *LocalStorage) DeleteFile(ctx context.Context, key string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	if err := os.Remove(s.path(key)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to delete file: %v", err)
+	}
+	os.Remove(s.metaPath(key))
+	return nil
+}
+
+func (s *LocalStorage) GetSignedURL(ctx context.Context, key string) (string, error) {
+	if err := checkKey(key); err != nil {
+		return "", err
+	}
+	return s.signer.Sign(key, time.Now().Add(signedURLExpiry)), nil
+}
+
+func (s *LocalStorage) StatFile(ctx context.Context, key string) (*ObjectInfo, error) {
+	if err := checkKey(key); err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(s.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrObjectNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	contentType := "application/octet-stream"
+	if data, err := os.ReadFile(s.metaPath(key)); err == nil && len(data) > 0 {
+		contentType = string(data)
+	}
+
+	return &ObjectInfo{
+		Key:          key,
+		Size:         info.Size(),
+		ContentType:  contentType,
+		LastModified: info.ModTime(),
+	}, nil
+}
+
+// ListFiles walks the directory holding the prefix, skipping the metadata
+// and unfinished uploads, whose names start with a dot
+func (s *LocalStorage) ListFiles(ctx context.Context, prefix string, fn func(ObjectInfo) error) error {
+	dir := s.root
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		dir = s.path(prefix[:i])
+	}
+
+	err := filepath.WalkDir(dir, func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(entry.Name(), ".") && name != dir {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.IsDir() {
+			return ctx.Err()
+		}
+
+		rel, err := filepath.Rel(s.root, name)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		return fn(ObjectInfo{Key: key, Size: info.Size(), LastModified: info.ModTime()})
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil // nothing stored under the prefix yet
+	}
+	return err
+}
+
+func (s *LocalStorage) PresignUpload(ctx context.Context, key string, contentType string, size int64, expires time.Time) (*PresignedRequest, error) {
+	return s.signer.presignUpload(key, contentType, size, expires)
+}
+
+func (s *LocalStorage) Bucket() string {
+	return "local"
+}
+
+func (s *LocalStorage) Signer() *URLSigner {
+	return s.signer
+}
+
+func (s *LocalStorage) path(key string) string {
+	return filepath.Join(s.root, filepath.FromSlash(key))
+}
+
+func (s *LocalStorage) metaPath(key string) string {
+	return filepath.Join(s.root, metaDir, filepath.FromSlash(key))
+}
+
+func writeAtomic(name string, r io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0o750); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op after the rename
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
@@ -0,0 +1,116 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStorage keeps files in memory, for tests and throwaway environments.
+// Download links are served by the API like LocalStorage's.
+type MemoryStorage struct {
+	signer *URLSigner
+
+	mu      sync.RWMutex
+	objects map[string]memoryObject
+}
+
+type memoryObject struct {
+	data        []byte
+	contentType string
+	modified    time.Time
+}
+
+func NewMemoryStorage(signer *URLSigner) *MemoryStorage {
+	return &MemoryStorage{signer: signer, objects: make(map[string]memoryObject)}
+}
+
+func (s *MemoryStorage) UploadFile(ctx context.Context, file io.Reader, key string, contentType string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return fmt.Errorf("failed to store file: %v", err)
+	}
+
+	s.mu.Lock()
+	s.objects[key] = memoryObject{data: data, contentType: contentType, modified: time.Now()}
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *MemoryStorage) DownloadFile(ctx context.Context, key string) (io.ReadCloser, error) {
+	s.mu.RLock()
+	object, ok := s.objects[key]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, ErrObjectNotFound
+	}
+	// Stored slices are never modified, so readers can share them
+	return io.NopCloser(bytes.NewReader(object.data)), nil
+}
+
+func (s *MemoryStorage) DeleteFile(ctx context.Context, key string) error {
+	s.mu.Lock()
+	delete(s.objects, key)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *MemoryStorage) GetSignedURL(ctx context.Context, key string) (string, error) {
+	if err := checkKey(key); err != nil {
+		return "", err
+	}
+	return s.signer.Sign(key, time.Now().Add(signedURLExpiry)), nil
+}
+
+func (s *MemoryStorage) StatFile(ctx context.Context, key string) (*ObjectInfo, error) {
+	s.mu.RLock()
+	object, ok := s.objects[key]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, ErrObjectNotFound
+	}
+	return &ObjectInfo{
+		Key:          key,
+		Size:         int64(len(object.data)),
+		ContentType:  object.contentType,
+		LastModified: object.modified,
+	}, nil
+}
+
+func (s *MemoryStorage) ListFiles(ctx context.Context, prefix string, fn func(ObjectInfo) error) error {
+	var infos []ObjectInfo
+	s.mu.RLock()
+	for key, object := range s.objects {
+		if strings.HasPrefix(key, prefix) {
+			infos = append(infos, ObjectInfo{Key: key, Size: int64(len(object.data)), LastModified: object.modified})
+		}
+	}
+	s.mu.RUnlock()
+
+	// fn may call back into the storage, so it runs without the lock
+	for _, info := range infos {
+		if err := fn(info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStorage) PresignUpload(ctx context.Context, key string, contentType string, size int64, expires time.Time) (*PresignedRequest, error) {
+	return s.signer.presignUpload(key, contentType, size, expires)
+}
+
+func (s *MemoryStorage) Bucket() string {
+	return "memory"
+}
+
+func (s *MemoryStorage) Signer() *URLSigner {
+	return s.signer
+}
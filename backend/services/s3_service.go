@@ -2,15 +2,19 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
 
 type S3Service struct {
@@ -52,7 +56,7 @@ func (s *S3Service) UploadFile(ctx context.Context, file io.Reader, s3Key string
 	return nil
 }
 
-// GetSignedURL generates a presigned URL for downloading a file (valid for 1 hour)
+// GetSignedURL generates a presigned URL for downloading a file (valid for signedURLExpiry)
 func (s *S3Service) GetSignedURL(ctx context.Context, s3Key string) (string, error) {
 	presignClient := s3.NewPresignClient(s.client)
 
@@ -60,7 +64,7 @@ func (s *S3Service) GetSignedURL(ctx context.Context, s3Key string) (string, err
 		Bucket: aws.String(s.bucketName),
 		Key:    aws.String(s3Key),
 	}, func(opts *s3.PresignOptions) {
-		opts.Expires = time.Hour * 1 // URL valid for 1 hour
+		opts.Expires = signedURLExpiry
 	})
 
 	if err != nil {
@@ -70,6 +74,162 @@ func (s *S3Service) GetSignedURL(ctx context.Context, s3Key string) (string, err
 	return request.URL, nil
 }
 
+// DownloadFile opens a file stored in S3. The caller closes the reader.
+func (s *S3Service) DownloadFile(ctx context.Context, s3Key string) (io.ReadCloser, error) {
+	output, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(s3Key),
+	})
+
+	var noSuchKey *types.NoSuchKey
+	if errors.As(err, &noSuchKey) {
+		return nil, ErrObjectNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to download file from S3: %v", err)
+	}
+
+	return output.Body, nil
+}
+
+// StatFile reads a file's size and content type without downloading it
+func (s *S3Service) StatFile(ctx context.Context, s3Key string) (*ObjectInfo, error) {
+	output, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(s3Key),
+	})
+
+	var notFound *types.NotFound
+	if errors.As(err, &notFound) {
+		return nil, ErrObjectNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat file in S3: %v", err)
+	}
+
+	return &ObjectInfo{
+		Key:          s3Key,
+		Size:         aws.ToInt64(output.ContentLength),
+		ContentType:  aws.ToString(output.ContentType),
+		LastModified: aws.ToTime(output.LastModified),
+	}, nil
+}
+
+func (s *S3Service) ListFiles(ctx context.Context, prefix string, fn func(ObjectInfo) error) error {
+	pages := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucketName),
+		Prefix: aws.String(prefix),
+	})
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list files in S3: %v", err)
+		}
+		for _, object := range page.Contents {
+			err := fn(ObjectInfo{
+				Key:          aws.ToString(object.Key),
+				Size:         aws.ToInt64(object.Size),
+				LastModified: aws.ToTime(object.LastModified),
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// PresignUpload returns a PUT the client sends straight to S3. The signature
+// covers the content length, so S3 rejects any other size.
+func (s *S3Service) PresignUpload(ctx context.Context, s3Key string, contentType string, size int64, expires time.Time) (*PresignedRequest, error) {
+	request, err := s3.NewPresignClient(s.client).PresignPutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(s.bucketName),
+		Key:           aws.String(s3Key),
+		ContentType:   aws.String(contentType),
+		ContentLength: aws.Int64(size),
+	}, presignUntil(expires))
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to presign upload: %v", err)
+	}
+
+	return presignedRequest(request, expires), nil
+}
+
+func (s *S3Service) CreateMultipartUpload(ctx context.Context, s3Key string, contentType string) (string, error) {
+	output, err := s.client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:      aws.String(s.bucketName),
+		Key:         aws.String(s3Key),
+		ContentType: aws.String(contentType),
+	})
+
+	if err != nil {
+		return "", fmt.Errorf("failed to start multipart upload: %v", err)
+	}
+
+	return aws.ToString(output.UploadId), nil
+}
+
+func (s *S3Service) PresignUploadPart(ctx context.Context, s3Key, uploadID string, partNumber int32, size int64, expires time.Time) (*PresignedRequest, error) {
+	request, err := s3.NewPresignClient(s.client).PresignUploadPart(ctx, &s3.UploadPartInput{
+		Bucket:        aws.String(s.bucketName),
+		Key:           aws.String(s3Key),
+		UploadId:      aws.String(uploadID),
+		PartNumber:    aws.Int32(partNumber),
+		ContentLength: aws.Int64(size),
+	}, presignUntil(expires))
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to presign upload part: %v", err)
+	}
+
+	return presignedRequest(request, expires), nil
+}
+
+func (s *S3Service) CompleteMultipartUpload(ctx context.Context, s3Key, uploadID string, parts []UploadedPart) error {
+	completed := make([]types.CompletedPart, len(parts))
+	for i, part := range parts {
+		completed[i] = types.CompletedPart{
+			ETag:       aws.String(part.ETag),
+			PartNumber: aws.Int32(part.PartNumber),
+		}
+	}
+
+	_, err := s.client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(s.bucketName),
+		Key:             aws.String(s3Key),
+		UploadId:        aws.String(uploadID),
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: completed},
+	})
+
+	if err != nil {
+		return fmt.Errorf("failed to complete multipart upload: %v", err)
+	}
+
+	return nil
+}
+
+// AbortMultipartUpload discards the uploaded parts. An upload that no
+// longer exists is not an error.
+func (s *S3Service) AbortMultipartUpload(ctx context.Context, s3Key, uploadID string) error {
+	_, err := s.client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(s.bucketName),
+		Key:      aws.String(s3Key),
+		UploadId: aws.String(uploadID),
+	})
+
+	var noSuchUpload *types.NoSuchUpload
+	if err != nil && !errors.As(err, &noSuchUpload) {
+		return fmt.Errorf("failed to abort multipart upload: %v", err)
+	}
+
+	return nil
+}
+
+func (s *S3Service) Bucket() string {
+	return s.bucketName
+}
+
 // DeleteFile deletes a file from S3
 func (s *S3Service) DeleteFile(ctx context.Context, s3Key string) error {
 	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
@@ -85,10 +245,35 @@ func (s *S3Service) DeleteFile(ctx context.Context, s3Key string) error {
 	return nil
 }
 
+func presignUntil(expires time.Time) func(*s3.PresignOptions) {
+	return func(opts *s3.PresignOptions) {
+		opts.Expires = time.Until(expires)
+	}
+}
+
+// presignedRequest lists the signed headers the client must send. Host and
+// Content-Length are set by the client's HTTP stack.
+func presignedRequest(request *v4.PresignedHTTPRequest, expires time.Time) *PresignedRequest {
+	headers := map[string]string{}
+	for name, values := range request.SignedHeader {
+		if len(values) == 0 || strings.EqualFold(name, "Host") || strings.EqualFold(name, "Content-Length") {
+			continue
+		}
+		headers[name] = values[0]
+	}
+	return &PresignedRequest{
+		Method:    request.Method,
+		URL:       request.URL,
+		Headers:   headers,
+		ExpiresAt: expires,
+	}
+}
+
 // GenerateS3Key creates a unique S3 key for a file
 // Format: organizations/{orgID}/projects/{projectID}/{fileType}/{timestamp}_{filename}
 func GenerateS3Key(orgID, projectID uint, fileType, filename string) string {
-	timestamp := time.Now().Unix()
+	// Nanoseconds, so re-uploading a file as a new version never reuses a key
+	timestamp := time.Now().UnixNano()
 	safeFilename := filepath.Base(filename) // Prevent path traversal
 	return fmt.Sprintf("organizations/%d/projects/%d/%s/%d_%s",
 		orgID, projectID, fileType, timestamp, safeFilename)
@@ -0,0 +1,151 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrTooLargeToScan is returned for content over the scanner's size limit
+var ErrTooLargeToScan = errors.New("too large to scan")
+
+type ScanResult struct {
+	Infected  bool
+	Signature string // what was found, e.g. "Eicar-Test-Signature"
+}
+
+// Scanner checks uploaded content for malware
+type Scanner interface {
+	Scan(ctx context.Context, content io.Reader) (*ScanResult, error)
+}
+
+// NewScannerFromEnv builds the configured scanner. SCANNER selects "clamd",
+// which talks to CLAMD_ADDRESS (default localhost:3310, or a unix socket
+// path) and sends at most SCANNER_MAX_MB (default 25, clamd's own default
+// StreamMaxLength). It returns nil when scanning is disabled.
+func NewScannerFromEnv() (Scanner, error) {
+	switch os.Getenv("SCANNER") {
+	case "":
+		return nil, nil
+	case "clamd":
+		address := os.Getenv("CLAMD_ADDRESS")
+		if address == "" {
+			address = "localhost:3310"
+		}
+		maxMB := 25
+		if v := os.Getenv("SCANNER_MAX_MB"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("invalid SCANNER_MAX_MB %q", v)
+			}
+			maxMB = n
+		}
+		return NewClamdScanner(address, int64(maxMB)<<20), nil
+	default:
+		return nil, fmt.Errorf("unknown SCANNER %q", os.Getenv("SCANNER"))
+	}
+}
+
+const (
+	clamdChunkSize = 64 << 10
+	clamdTimeout   = 2 * time.Minute
+)
+
+// ClamdScanner streams content to a ClamAV daemon with the INSTREAM command
+type ClamdScanner struct {
+	network  string
+	address  string
+	maxBytes int64
+}
+
+// NewClamdScanner connects to address over TCP, or over a unix socket when
+// it is an absolute path
+func NewClamdScanner(address string, maxBytes int64) *ClamdScanner {
+	network := "tcp"
+	if strings.HasPrefix(address, "/") {
+		network = "unix"
+	}
+	return &ClamdScanner{network: network, address: address, maxBytes: maxBytes}
+}
+
+func (s *ClamdScanner) Scan(ctx context.Context, content io.Reader) (*ScanResult, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, s.network, s.address)
+	if err != nil {
+		return nil, fmt.Errorf("clamd: %w", err)
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(clamdTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	// The z prefix makes clamd expect and send NUL-terminated lines
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return nil, fmt.Errorf("clamd: %w", err)
+	}
+
+	// Each chunk is prefixed with its length; a zero length ends the stream
+	buf := make([]byte, 4+clamdChunkSize)
+	var sent int64
+	for {
+		n, readErr := io.ReadFull(content, buf[4:])
+		if n > 0 {
+			if sent += int64(n); sent > s.maxBytes {
+				return nil, ErrTooLargeToScan
+			}
+			binary.BigEndian.PutUint32(buf, uint32(n))
+			if _, err := conn.Write(buf[:4+n]); err != nil {
+				return nil, fmt.Errorf("clamd: %w", err)
+			}
+		}
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			break
+		}
+		if readErr != nil {
+			return nil, readErr
+		}
+	}
+	if _, err := conn.Write([]byte{0, 0, 0, 0}); err != nil {
+		return nil, fmt.Errorf("clamd: %w", err)
+	}
+
+	reply, err := bufio.NewReader(conn).ReadBytes(0)
+	if err != nil {
+		return nil, fmt.Errorf("clamd: reading reply: %w", err)
+	}
+	return parseClamdReply(string(bytes.TrimRight(reply, "\x00")))
+}
+
+// parseClamdReply reads "stream: OK", "stream: <signature> FOUND" or an
+// error ending in "ERROR"
+func parseClamdReply(reply string) (*ScanResult, error) {
+	reply = strings.TrimSpace(reply)
+	switch {
+	case strings.HasSuffix(reply, " FOUND"):
+		signature := strings.TrimSuffix(reply, " FOUND")
+		if _, after, ok := strings.Cut(signature, ": "); ok {
+			signature = after
+		}
+		return &ScanResult{Infected: true, Signature: signature}, nil
+	case strings.HasSuffix(reply, ": OK"):
+		return &ScanResult{}, nil
+	case strings.Contains(reply, "size limit exceeded"):
+		return nil, ErrTooLargeToScan
+	default:
+		return nil, fmt.Errorf("clamd: %s", reply)
+	}
+}
@@ -0,0 +1,220 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrObjectNotFound is returned when a key does not exist in storage
+var ErrObjectNotFound = errors.New("object not found")
+
+// ErrInvalidSignature is returned for download links that were tampered
+// with or have expired
+var ErrInvalidSignature = errors.New("invalid or expired signature")
+
+// signedURLExpiry is how long download links stay valid
+const signedURLExpiry = time.Hour
+
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	ContentType  string
+	LastModified time.Time
+}
+
+// Storage keeps uploaded files. Keys are slash-separated paths such as
+// those made by GenerateS3Key.
+type Storage interface {
+	UploadFile(ctx context.Context, file io.Reader, key string, contentType string) error
+	// DownloadFile opens a stored file. The caller closes the reader.
+	DownloadFile(ctx context.Context, key string) (io.ReadCloser, error)
+	DeleteFile(ctx context.Context, key string) error
+	// GetSignedURL returns a temporary download link that needs no other auth
+	GetSignedURL(ctx context.Context, key string) (string, error)
+	StatFile(ctx context.Context, key string) (*ObjectInfo, error)
+	// ListFiles calls fn for every file whose key starts with prefix, in no
+	// particular order, stopping at the first error. ContentType is not set.
+	ListFiles(ctx context.Context, prefix string, fn func(ObjectInfo) error) error
+	// PresignUpload returns a request the client makes to upload exactly
+	// size bytes to key, valid until expires
+	PresignUpload(ctx context.Context, key string, contentType string, size int64, expires time.Time) (*PresignedRequest, error)
+	// Bucket names where files live; it is recorded with each project file
+	Bucket() string
+}
+
+// MultipartUploader is implemented by backends that accept large uploads in
+// parts, so a dropped connection only retries one part
+type MultipartUploader interface {
+	CreateMultipartUpload(ctx context.Context, key string, contentType string) (uploadID string, err error)
+	PresignUploadPart(ctx context.Context, key, uploadID string, partNumber int32, size int64, expires time.Time) (*PresignedRequest, error)
+	CompleteMultipartUpload(ctx context.Context, key, uploadID string, parts []UploadedPart) error
+	AbortMultipartUpload(ctx context.Context, key, uploadID string) error
+}
+
+// PresignedRequest is an upload the client sends directly to storage
+type PresignedRequest struct {
+	Method    string            `json:"method"`
+	URL       string            `json:"url"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	ExpiresAt time.Time         `json:"expires_at"`
+}
+
+// UploadedPart is reported by the client after uploading a part; the ETag
+// comes from the storage response
+type UploadedPart struct {
+	PartNumber int32  `json:"part_number" binding:"required,min=1"`
+	ETag       string `json:"etag" binding:"required"`
+}
+
+// SelfServedStorage is implemented by backends whose signed URLs point back
+// at the API, which verifies them and streams the file
+type SelfServedStorage interface {
+	Storage
+	Signer() *URLSigner
+}
+
+// NewStorageFromEnv builds the configured backend. STORAGE_BACKEND selects
+// "s3" (the default; AWS_REGION, S3_BUCKET_NAME), "local" (STORAGE_LOCAL_DIR)
+// or "memory". Local and memory links are served from STORAGE_PUBLIC_URL.
+func NewStorageFromEnv() (Storage, error) {
+	backend := os.Getenv("STORAGE_BACKEND")
+	if backend == "" || backend == "s3" {
+		return NewS3Service()
+	}
+
+	signer, err := NewURLSignerFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	switch backend {
+	case "local":
+		dir := os.Getenv("STORAGE_LOCAL_DIR")
+		if dir == "" {
+			dir = "data/storage"
+		}
+		return NewLocalStorage(dir, signer)
+	case "memory":
+		return NewMemoryStorage(signer), nil
+	default:
+		return nil, fmt.Errorf("unknown STORAGE_BACKEND %q", backend)
+	}
+}
+
+// URLSigner makes and checks HMAC-signed links of the form
+// {baseURL}/{key}?expires=<unix>&signature=<hex>. Upload links also carry
+// the exact size, and the signature covers the HTTP method.
+type URLSigner struct {
+	baseURL string
+	key     []byte
+}
+
+func NewURLSigner(baseURL string, key []byte) *URLSigner {
+	return &URLSigner{baseURL: strings.TrimRight(baseURL, "/"), key: key}
+}
+
+// NewURLSignerFromEnv signs links for STORAGE_PUBLIC_URL (default
+// http://localhost:8080/api/v1/storage) with a key derived from
+// STORAGE_SIGNING_KEY, or JWT_SECRET when that is not set
+func NewURLSignerFromEnv() (*URLSigner, error) {
+	baseURL := os.Getenv("STORAGE_PUBLIC_URL")
+	if baseURL == "" {
+		baseURL = "http://localhost:8080/api/v1/storage"
+	}
+
+	secret := os.Getenv("STORAGE_SIGNING_KEY")
+	if secret == "" {
+		secret = os.Getenv("JWT_SECRET")
+	}
+	if secret == "" {
+		return nil, errors.New("STORAGE_SIGNING_KEY or JWT_SECRET must be set")
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("storage-url"))
+	return NewURLSigner(baseURL, mac.Sum(nil)), nil
+}
+
+// Sign returns a download link to key that is valid until expires
+func (s *URLSigner) Sign(key string, expires time.Time) string {
+	return s.sign(http.MethodGet, key, "", expires)
+}
+
+// SignUpload returns a link for uploading exactly size bytes to key with PUT
+func (s *URLSigner) SignUpload(key string, size int64, expires time.Time) string {
+	return s.sign(http.MethodPut, key, strconv.FormatInt(size, 10), expires)
+}
+
+func (s *URLSigner) sign(method, key, size string, expires time.Time) string {
+	exp := strconv.FormatInt(expires.Unix(), 10)
+	query := url.Values{}
+	query.Set("expires", exp)
+	if size != "" {
+		query.Set("size", size)
+	}
+	query.Set("signature", s.signature(method, key, size, exp))
+	return s.baseURL + "/" + (&url.URL{Path: key}).EscapedPath() + "?" + query.Encode()
+}
+
+// Verify checks a link's query values for the method and key. For uploads
+// it returns the size the link was signed for.
+func (s *URLSigner) Verify(method, key string, query url.Values, now time.Time) (int64, error) {
+	expires := query.Get("expires")
+	exp, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || now.Unix() > exp {
+		return 0, ErrInvalidSignature
+	}
+	size := query.Get("size")
+	if !hmac.Equal([]byte(query.Get("signature")), []byte(s.signature(method, key, size, expires))) {
+		return 0, ErrInvalidSignature
+	}
+	if size == "" {
+		return 0, nil
+	}
+	return strconv.ParseInt(size, 10, 64)
+}
+
+func (s *URLSigner) signature(method, key, size, expires string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(method + "\n" + key + "\n" + size + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// presignUpload is PresignUpload for the backends that the API serves
+func (s *URLSigner) presignUpload(key, contentType string, size int64, expires time.Time) (*PresignedRequest, error) {
+	if err := checkKey(key); err != nil {
+		return nil, err
+	}
+	return &PresignedRequest{
+		Method:    http.MethodPut,
+		URL:       s.SignUpload(key, size, expires),
+		Headers:   map[string]string{"Content-Type": contentType},
+		ExpiresAt: expires,
+	}, nil
+}
+
+// checkKey rejects keys that could escape the storage root or address the
+// hidden files a backend keeps next to the data
+func checkKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.ContainsRune(key, 0) || path.Clean(key) != key {
+		return fmt.Errorf("invalid storage key %q", key)
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if strings.HasPrefix(segment, ".") {
+			return fmt.Errorf("invalid storage key %q", key)
+		}
+	}
+	return nil
+}
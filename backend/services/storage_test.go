@@ -0,0 +1,358 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestSigner() *URLSigner {
+	return NewURLSigner("http://localhost:8080/api/v1/storage/", []byte("secret"))
+}
+
+// testStorageContract checks the behaviour every Storage backend must share.
+// Keys are placed under prefix, which must not hold anything else.
+func testStorageContract(t *testing.T, storage Storage, prefix string) {
+	ctx := context.Background()
+	files := map[string]string{
+		prefix + "1/photo/1_a.jpg":      "first",
+		prefix + "1/document/2_b.pdf":   "second file",
+		prefix + "10/photo/3_other.jpg": "other project",
+	}
+	for key, content := range files {
+		if err := storage.UploadFile(ctx, strings.NewReader(content), key, "image/jpeg"); err != nil {
+			t.Fatalf("UploadFile(%q) error = %v", key, err)
+		}
+	}
+	t.Cleanup(func() {
+		for key := range files {
+			storage.DeleteFile(context.Background(), key)
+		}
+	})
+
+	t.Run("stat", func(t *testing.T) {
+		key := prefix + "1/document/2_b.pdf"
+		info, err := storage.StatFile(ctx, key)
+		if err != nil {
+			t.Fatalf("StatFile() error = %v", err)
+		}
+		if info.Key != key || info.Size != int64(len(files[key])) || info.ContentType != "image/jpeg" {
+			t.Errorf("StatFile() = %+v, want key %q, size %d and image/jpeg", info, key, len(files[key]))
+		}
+		if info.LastModified.IsZero() {
+			t.Errorf("StatFile() LastModified is not set")
+		}
+	})
+
+	t.Run("download", func(t *testing.T) {
+		key := prefix + "1/photo/1_a.jpg"
+		body, err := storage.DownloadFile(ctx, key)
+		if err != nil {
+			t.Fatalf("DownloadFile() error = %v", err)
+		}
+		defer body.Close()
+		data, err := io.ReadAll(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != files[key] {
+			t.Errorf("DownloadFile() = %q, want %q", data, files[key])
+		}
+	})
+
+	t.Run("overwrite", func(t *testing.T) {
+		key := prefix + "1/photo/1_a.jpg"
+		if err := storage.UploadFile(ctx, strings.NewReader("replaced"), key, "image/png"); err != nil {
+			t.Fatalf("UploadFile() error = %v", err)
+		}
+		info, err := storage.StatFile(ctx, key)
+		if err != nil {
+			t.Fatalf("StatFile() error = %v", err)
+		}
+		if info.Size != int64(len("replaced")) || info.ContentType != "image/png" {
+			t.Errorf("StatFile() = %+v, want the replaced file", info)
+		}
+		files[key] = "replaced"
+	})
+
+	t.Run("list", func(t *testing.T) {
+		tests := []struct {
+			prefix string
+			want   []string
+		}{
+			{prefix + "1/", []string{prefix + "1/document/2_b.pdf", prefix + "1/photo/1_a.jpg"}},
+			{prefix + "1", []string{prefix + "1/document/2_b.pdf", prefix + "1/photo/1_a.jpg", prefix + "10/photo/3_other.jpg"}},
+			{prefix + "1/photo/", []string{prefix + "1/photo/1_a.jpg"}},
+			{prefix + "2/", nil},
+		}
+		for _, tt := range tests {
+			var got []string
+			err := storage.ListFiles(ctx, tt.prefix, func(info ObjectInfo) error {
+				if info.Size != int64(len(files[info.Key])) {
+					t.Errorf("ListFiles() size of %q = %d, want %d", info.Key, info.Size, len(files[info.Key]))
+				}
+				got = append(got, info.Key)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("ListFiles(%q) error = %v", tt.prefix, err)
+			}
+			sort.Strings(got)
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("ListFiles(%q) = %v, want %v", tt.prefix, got, tt.want)
+			}
+		}
+	})
+
+	t.Run("list stops at the first error", func(t *testing.T) {
+		stop := errors.New("stop")
+		calls := 0
+		err := storage.ListFiles(ctx, prefix, func(ObjectInfo) error {
+			calls++
+			return stop
+		})
+		if !errors.Is(err, stop) || calls != 1 {
+			t.Errorf("ListFiles() = %v after %d calls, want %v after 1", err, calls, stop)
+		}
+	})
+
+	t.Run("signed url", func(t *testing.T) {
+		link, err := storage.GetSignedURL(ctx, prefix+"1/photo/1_a.jpg")
+		if err != nil {
+			t.Fatalf("GetSignedURL() error = %v", err)
+		}
+		if _, err := url.Parse(link); err != nil || !strings.Contains(link, "1_a.jpg") {
+			t.Errorf("GetSignedURL() = %q, want a link to the file", link)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		key := prefix + "10/photo/3_other.jpg"
+		if err := storage.DeleteFile(ctx, key); err != nil {
+			t.Fatalf("DeleteFile() error = %v", err)
+		}
+		if _, err := storage.StatFile(ctx, key); !errors.Is(err, ErrObjectNotFound) {
+			t.Errorf("StatFile() after delete error = %v, want %v", err, ErrObjectNotFound)
+		}
+		if _, err := storage.DownloadFile(ctx, key); !errors.Is(err, ErrObjectNotFound) {
+			t.Errorf("DownloadFile() after delete error = %v, want %v", err, ErrObjectNotFound)
+		}
+		// Deleting is idempotent
+		if err := storage.DeleteFile(ctx, key); err != nil {
+			t.Errorf("DeleteFile() of a missing file error = %v", err)
+		}
+	})
+}
+
+// testSelfServedStorage checks what the backends the API serves add to the
+// contract: key validation and links the signer accepts
+func testSelfServedStorage(t *testing.T, storage SelfServedStorage) {
+	ctx := context.Background()
+
+	for _, key := range []string{"../escape", "a/../../escape", "/absolute", "a/.meta/b", ""} {
+		if err := storage.UploadFile(ctx, strings.NewReader("x"), key, "text/plain"); err == nil {
+			t.Errorf("UploadFile(%q) succeeded, want an invalid key error", key)
+		}
+		if _, err := storage.PresignUpload(ctx, key, "text/plain", 1, time.Now().Add(time.Minute)); err == nil {
+			t.Errorf("PresignUpload(%q) succeeded, want an invalid key error", key)
+		}
+	}
+
+	key := "organizations/1/projects/1/photo/1_a b.jpg"
+	link, err := storage.GetSignedURL(ctx, key)
+	if err != nil {
+		t.Fatalf("GetSignedURL() error = %v", err)
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := storage.Signer().Verify(http.MethodGet, key, u.Query(), time.Now()); err != nil {
+		t.Errorf("Verify() of a download link error = %v", err)
+	}
+
+	upload, err := storage.PresignUpload(ctx, key, "image/jpeg", 42, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("PresignUpload() error = %v", err)
+	}
+	u, err = url.Parse(upload.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	size, err := storage.Signer().Verify(upload.Method, key, u.Query(), time.Now())
+	if err != nil || size != 42 {
+		t.Errorf("Verify() of an upload link = %d, %v, want 42", size, err)
+	}
+}
+
+func TestMemoryStorage(t *testing.T) {
+	testStorageContract(t, NewMemoryStorage(newTestSigner()), "organizations/1/projects/")
+	testSelfServedStorage(t, NewMemoryStorage(newTestSigner()))
+}
+
+func TestLocalStorage(t *testing.T) {
+	root := t.TempDir()
+	storage, err := NewLocalStorage(root, newTestSigner())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Leftovers of an interrupted upload are not files
+	dir := filepath.Join(root, "organizations", "1", "projects", "1", "photo")
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, ".upload-123"), []byte("partial"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+
+	testStorageContract(t, storage, "organizations/1/projects/")
+	testSelfServedStorage(t, storage)
+
+	// Stored files stay inside the root
+	err = filepath.WalkDir(filepath.Dir(root), func(name string, entry os.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		if !strings.HasPrefix(name, root+string(filepath.Separator)) {
+			t.Errorf("file %q written outside the storage root", name)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestS3Service runs the contract against a real bucket when S3_TEST_BUCKET
+// is set, using the usual AWS_REGION and credentials
+func TestS3Service(t *testing.T) {
+	bucket := os.Getenv("S3_TEST_BUCKET")
+	if bucket == "" {
+		t.Skip("S3_TEST_BUCKET not set")
+	}
+	t.Setenv("S3_BUCKET_NAME", bucket)
+
+	storage, err := NewS3Service()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStorageContract(t, storage, fmt.Sprintf("storage-test/%d/", time.Now().UnixNano()))
+}
+
+func TestCheckKey(t *testing.T) {
+	tests := []struct {
+		key     string
+		wantErr bool
+	}{
+		{"organizations/1/projects/2/photo/1_a.jpg", false},
+		{"organizations/1/branding/logo.png", false},
+		{"file.txt", false},
+		{"a/name.with.dots", false},
+		{"", true},
+		{"/etc/passwd", true},
+		{"../escape", true},
+		{"a/../../escape", true},
+		{"a/../b", true},
+		{"a/./b", true},
+		{"a//b", true},
+		{"a/b/", true},
+		{".meta/a", true},
+		{"a/.meta/b", true},
+		{"a/.upload-123", true},
+		{"a/b\x00c", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			if err := checkKey(tt.key); (err != nil) != tt.wantErr {
+				t.Errorf("checkKey(%q) error = %v, wantErr %v", tt.key, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestURLSigner(t *testing.T) {
+	signer := newTestSigner()
+	now := time.Now()
+	key := "organizations/1/projects/2/photo/1_a b.jpg"
+
+	// query parses the values of a signed link and lets the test edit them
+	query := func(link string, edit func(url.Values)) url.Values {
+		u, err := url.Parse(link)
+		if err != nil {
+			t.Fatal(err)
+		}
+		values := u.Query()
+		if edit != nil {
+			edit(values)
+		}
+		return values
+	}
+	download := signer.Sign(key, now.Add(time.Hour))
+	upload := signer.SignUpload(key, 1024, now.Add(time.Hour))
+
+	if !strings.HasPrefix(download, "http://localhost:8080/api/v1/storage/organizations/1/projects/2/photo/1_a%20b.jpg?") {
+		t.Errorf("Sign() = %q, want a link under the base URL with the key escaped", download)
+	}
+
+	tests := []struct {
+		name     string
+		signer   *URLSigner
+		method   string
+		key      string
+		query    url.Values
+		now      time.Time
+		wantSize int64
+		wantErr  bool
+	}{
+		{"download", signer, http.MethodGet, key, query(download, nil), now, 0, false},
+		{"download just before expiry", signer, http.MethodGet, key, query(download, nil), now.Add(time.Hour), 0, false},
+		{"download expired", signer, http.MethodGet, key, query(download, nil), now.Add(time.Hour + time.Second), 0, true},
+		{"expiry extended", signer, http.MethodGet, key, query(download, func(v url.Values) {
+			v.Set("expires", fmt.Sprint(now.Add(48*time.Hour).Unix()))
+		}), now.Add(2 * time.Hour), 0, true},
+		{"expiry missing", signer, http.MethodGet, key, query(download, func(v url.Values) { v.Del("expires") }), now, 0, true},
+		{"signature tampered", signer, http.MethodGet, key, query(download, func(v url.Values) {
+			sig := []byte(v.Get("signature"))
+			sig[0] ^= 1
+			v.Set("signature", string(sig))
+		}), now, 0, true},
+		{"signature missing", signer, http.MethodGet, key, query(download, func(v url.Values) { v.Del("signature") }), now, 0, true},
+		{"other key", signer, http.MethodGet, "organizations/2/projects/2/photo/1_a b.jpg", query(download, nil), now, 0, true},
+		{"other signing key", NewURLSigner("http://localhost:8080/api/v1/storage", []byte("other")), http.MethodGet, key, query(download, nil), now, 0, true},
+		{"download link used to upload", signer, http.MethodPut, key, query(download, nil), now, 0, true},
+		{"upload", signer, http.MethodPut, key, query(upload, nil), now, 1024, false},
+		{"upload link used to download", signer, http.MethodGet, key, query(upload, nil), now, 0, true},
+		{"upload size changed", signer, http.MethodPut, key, query(upload, func(v url.Values) { v.Set("size", "1048576") }), now, 0, true},
+		{"upload size removed", signer, http.MethodPut, key, query(upload, func(v url.Values) { v.Del("size") }), now, 0, true},
+		{"upload expired", signer, http.MethodPut, key, query(upload, nil), now.Add(2 * time.Hour), 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			size, err := tt.signer.Verify(tt.method, tt.key, tt.query, tt.now)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidSignature) {
+					t.Errorf("Verify() error = %v, want %v", err, ErrInvalidSignature)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if size != tt.wantSize {
+				t.Errorf("Verify() = %d, want %d", size, tt.wantSize)
+			}
+		})
+	}
+}
@@ -48,14 +48,167 @@ export const jobsAPI = {
     getAll: (params) => apiClient.get('/api/v1/jobs', { params }),
     getById: (id) => apiClient.get(`/api/v1/jobs/${id}`),
     create: (data) => apiClient.post('/api/v1/jobs', data),
+    // data.version is the job.version last loaded; a stale one gets 409
     update: (id, data) => apiClient.put(`/api/v1/jobs/${id}`, data),
     delete: (id) => apiClient.delete(`/api/v1/jobs/${id}`),
-    assignTechnician: (id, technicianId) =>
-        apiClient.patch(`/api/v1/jobs/${id}/assign`, { technician_id: technicianId }),
+    assignTechnician: (id, technicianId, version) =>
+        apiClient.patch(`/api/v1/jobs/${id}/assign`, { technician_id: technicianId, version }),
+    // Reschedule and reassign in one request; version is the job.version last loaded
+    move: (id, { workerId, scheduledAt, durationMinutes, version }) =>
+        apiClient.post(`/api/v1/jobs/${id}/move`, {
+            worker_id: workerId,
+            scheduled_at: scheduledAt,
+            duration_minutes: durationMinutes,
+            version,
+        }),
     updateStatus: (id, status) => {
         console.log('🔍 Calling updateStatus API:', { id, status });
         return apiClient.patch(`/api/v1/jobs/${id}/status`, { status });
     },
+    // Completion report PDF as a Blob
+    report: (id) => apiClient.get(`/api/v1/jobs/${id}/report`, { responseType: 'blob' }),
+    // ZIP of the job's files as a Blob; params: { category, from, to } with dates as YYYY-MM-DD
+    filesArchive: (id, params) => apiClient.get(`/api/v1/projects/${id}/files/archive`, { params, responseType: 'blob' }),
+    // Customer sign-off; file is a PNG or SVG Blob, signedAt an ISO string (defaults to now)
+    sign: (id, file, signerName, signedAt) => {
+        const form = new FormData();
+        form.append('signature', file);
+        form.append('signer_name', signerName);
+        if (signedAt) form.append('signed_at', signedAt);
+        return apiClient.post(`/api/v1/jobs/${id}/signature`, form, {
+            headers: { 'Content-Type': 'multipart/form-data' },
+        });
+    },
+    getCompletionSettings: () => apiClient.get('/api/v1/completion/settings'),
+    updateCompletionSettings: (data) => apiClient.put('/api/v1/completion/settings', data),
+};
+
+// Dispatch board API
+export const dispatchAPI = {
+    getBoard: (from, to) => apiClient.get('/api/v1/dispatch/board', { params: { from, to } }),
+};
+
+// Live events. EventSource reconnects on its own and resends Last-Event-ID,
+// so missed events are replayed; a "reset" event means reload everything.
+// The stream token is only good for a couple of minutes, so once the
+// EventSource gives up (readyState CLOSED), subscribe again with the last
+// event ID seen.
+export const eventsAPI = {
+    subscribe: async (types, lastEventId) => {
+        const { data } = await apiClient.post('/api/v1/events/token');
+        const params = new URLSearchParams({ stream_token: data.token });
+        if (types?.length) {
+            params.set('types', types.join(','));
+        }
+        if (lastEventId) {
+            params.set('last_event_id', lastEventId);
+        }
+        return new EventSource(`${API_BASE_URL}/api/v1/events?${params}`);
+    },
+};
+
+// Quotes API
+export const quotesAPI = {
+    getAll: (params) => apiClient.get('/api/v1/quotes', { params }),
+    getById: (id) => apiClient.get(`/api/v1/quotes/${id}`),
+    create: (data) => apiClient.post('/api/v1/quotes', data),
+    update: (id, data) => apiClient.put(`/api/v1/quotes/${id}`, data),
+    delete: (id) => apiClient.delete(`/api/v1/quotes/${id}`),
+    send: (id) => apiClient.post(`/api/v1/quotes/${id}/send`),
+    accept: (id, name) => apiClient.post(`/api/v1/quotes/${id}/accept`, { name }),
+    decline: (id, reason) => apiClient.post(`/api/v1/quotes/${id}/decline`, { reason }),
+    convert: (id, jobs) => apiClient.post(`/api/v1/quotes/${id}/convert`, { jobs }),
+    pdf: (id) => apiClient.get(`/api/v1/quotes/${id}/pdf`, { responseType: 'blob' }),
+};
+
+// Invoices API
+export const invoicesAPI = {
+    getAll: (params) => apiClient.get('/api/v1/invoices', { params }),
+    getById: (id) => apiClient.get(`/api/v1/invoices/${id}`),
+    createFromJob: (jobId, data) => apiClient.post(`/api/v1/jobs/${jobId}/invoice`, data),
+    update: (id, data) => apiClient.put(`/api/v1/invoices/${id}`, data),
+    delete: (id) => apiClient.delete(`/api/v1/invoices/${id}`),
+    send: (id) => apiClient.post(`/api/v1/invoices/${id}/send`),
+    void: (id, reason) => apiClient.post(`/api/v1/invoices/${id}/void`, { reason }),
+    addPayment: (id, data) => apiClient.post(`/api/v1/invoices/${id}/payments`, data),
+    deletePayment: (id, paymentId) => apiClient.delete(`/api/v1/invoices/${id}/payments/${paymentId}`),
+    pdf: (id) => apiClient.get(`/api/v1/invoices/${id}/pdf`, { responseType: 'blob' }),
+    agedReceivables: (asOf) => apiClient.get('/api/v1/reports/aged-receivables', { params: { as_of: asOf } }),
+};
+
+// Branding used on generated PDFs
+export const brandingAPI = {
+    get: () => apiClient.get('/api/v1/organization/branding'),
+    update: (data) => apiClient.put('/api/v1/organization/branding', data),
+    uploadLogo: (file) => {
+        const form = new FormData();
+        form.append('logo', file);
+        // Override the JSON default so axios sends multipart with a boundary
+        return apiClient.post('/api/v1/organization/branding/logo', form, {
+            headers: { 'Content-Type': 'multipart/form-data' },
+        });
+    },
+    deleteLogo: () => apiClient.delete('/api/v1/organization/branding/logo'),
+};
+
+// Direct-to-storage uploads: request a slot, PUT the file (or its parts)
+// straight to storage, then confirm
+export const uploadsAPI = {
+    request: (projectId, data) => apiClient.post(`/api/v1/projects/${projectId}/uploads`, data),
+    complete: (uploadId, parts) => apiClient.post(`/api/v1/uploads/${uploadId}/complete`, parts ? { parts } : {}),
+    cancel: (uploadId) => apiClient.delete(`/api/v1/uploads/${uploadId}`),
+    getPolicy: () => apiClient.get('/api/v1/files/policy'),
+    updatePolicy: (data) => apiClient.put('/api/v1/files/policy', data),
+    getQuarantined: () => apiClient.get('/api/v1/files/quarantined'),
+    getUsage: () => apiClient.get('/api/v1/files/usage'),
+    getVersions: (fileId) => apiClient.get(`/api/v1/files/${fileId}/versions`),
+    getTrash: (projectId) => apiClient.get(`/api/v1/projects/${projectId}/files/trash`),
+    restore: (fileId) => apiClient.post(`/api/v1/files/${fileId}/restore`),
+    // Runs the whole flow for a File; resolves with the confirmed project file
+    // replacesFileId uploads a new version of that file
+    upload: async (projectId, file, { category, description, replacesFileId } = {}) => {
+        const { data: slot } = await uploadsAPI.request(projectId, {
+            file_name: file.name,
+            mime_type: file.type,
+            file_size: file.size,
+            category,
+            description,
+            replaces_file_id: replacesFileId,
+        });
+        // Storage URLs are signed; they must not get our Authorization header
+        const put = ({ method, url, headers }, body) => axios({ method, url, headers, data: body });
+        try {
+            let parts;
+            if (slot.parts) {
+                parts = [];
+                let offset = 0;
+                for (const part of slot.parts) {
+                    const response = await put(part.request, file.slice(offset, offset + part.size));
+                    parts.push({ part_number: part.part_number, etag: response.headers.etag });
+                    offset += part.size;
+                }
+            } else {
+                await put(slot.request, file);
+            }
+            const { data } = await uploadsAPI.complete(slot.upload.id, parts);
+            return data.file;
+        } catch (error) {
+            uploadsAPI.cancel(slot.upload.id).catch(() => {});
+            throw error;
+        }
+    },
+};
+
+// Webhooks API
+export const webhooksAPI = {
+    getAll: () => apiClient.get('/api/v1/webhooks'),
+    getById: (id) => apiClient.get(`/api/v1/webhooks/${id}`),
+    create: (data) => apiClient.post('/api/v1/webhooks', data),
+    update: (id, data) => apiClient.put(`/api/v1/webhooks/${id}`, data),
+    delete: (id) => apiClient.delete(`/api/v1/webhooks/${id}`),
+    rotateSecret: (id) => apiClient.post(`/api/v1/webhooks/${id}/rotate-secret`),
+    getDeliveries: (id, params) => apiClient.get(`/api/v1/webhooks/${id}/deliveries`, { params }),
+    replay: (id, deliveryId) => apiClient.post(`/api/v1/webhooks/${id}/deliveries/${deliveryId}/replay`),
 };
 
 // Customers API
@@ -47,21 +47,31 @@ const Jobs = () => {
 
     const handleUpdateJob = async (jobData) => {
         try {
-            await jobsAPI.update(editingJob.id, jobData);
+            await jobsAPI.update(editingJob.id, { ...jobData, version: editingJob.version });
             await loadData();
             setEditingJob(null);
         } catch (error) {
             console.error('Failed to update job:', error);
+            if (error.response?.status === 409) {
+                alert(error.response.data.error);
+                await loadData();
+                return;
+            }
             alert('Failed to update job');
         }
     };
 
-    const handleAssignTechnician = async (jobId, technicianId) => {
+    const handleAssignTechnician = async (job, technicianId) => {
         try {
-            await jobsAPI.assignTechnician(jobId, technicianId);
+            await jobsAPI.assignTechnician(job.id, technicianId, job.version);
             await loadData();
         } catch (error) {
             console.error('Failed to assign technician:', error);
+            if (error.response?.status === 409) {
+                alert(error.response.data.error);
+                await loadData();
+                return;
+            }
             alert('Failed to assign technician');
         }
     };
@@ -231,7 +241,7 @@ const JobItem = ({ job, technicians, onEdit, onDelete, onAssignTechnician, onUpd
                         {/* Technician Assignment */}
                         <select
                             value={job.technician_id || ''}
-                            onChange={(e) => onAssignTechnician(job.id, e.target.value ? parseInt(e.target.value) : null)}
+                            onChange={(e) => onAssignTechnician(job, e.target.value ? parseInt(e.target.value) : null)}
                             className="text-sm border-gray-300 rounded-md"
                         >
                             <option value="">Unassigned</option>